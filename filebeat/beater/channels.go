@@ -178,3 +178,15 @@ func (c *combinedEventer) DroppedOnPublish(event beat.Event) {
 	c.a.DroppedOnPublish(event)
 	c.b.DroppedOnPublish(event)
 }
+
+// ProcessingFailed forwards the events dropped by a failing processor to the
+// eventers implementing beat.ProcessingErrorEventer, such as the dead letter
+// queue of an input.
+func (c *combinedEventer) ProcessingFailed(event beat.Event, err error) {
+	if failed, ok := c.a.(beat.ProcessingErrorEventer); ok {
+		failed.ProcessingFailed(event, err)
+	}
+	if failed, ok := c.b.(beat.ProcessingErrorEventer); ok {
+		failed.ProcessingFailed(event, err)
+	}
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// failingPipeline reports every published event as dropped by a failing
+// processor, as the pipeline client does.
+type failingPipeline struct{}
+
+func (failingPipeline) Connect() (beat.Client, error) {
+	return failingPipeline{}.ConnectWith(beat.ClientConfig{})
+}
+
+func (failingPipeline) ConnectWith(config beat.ClientConfig) (beat.Client, error) {
+	return &failingClient{events: config.Events}, nil
+}
+
+type failingClient struct {
+	events beat.ClientEventer
+}
+
+func (c *failingClient) Publish(event beat.Event) {
+	if failed, ok := c.events.(beat.ProcessingErrorEventer); ok {
+		failed.ProcessingFailed(event, errors.New("processor failed"))
+	}
+}
+
+func (c *failingClient) PublishAll(events []beat.Event) {
+	for _, event := range events {
+		c.Publish(event)
+	}
+}
+
+func (c *failingClient) Close() error { return nil }
+
+type deadLetterEventer struct {
+	failed []beat.Event
+}
+
+func (*deadLetterEventer) Closing()                    {}
+func (*deadLetterEventer) Closed()                     {}
+func (*deadLetterEventer) Published()                  {}
+func (*deadLetterEventer) FilteredOut(beat.Event)      {}
+func (*deadLetterEventer) DroppedOnPublish(beat.Event) {}
+func (e *deadLetterEventer) ProcessingFailed(event beat.Event, _ error) {
+	e.failed = append(e.failed, event)
+}
+
+func TestPipelineEventCounterProcessingFailed(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	pipeline := withPipelineEventCounter(failingPipeline{}, &eventCounter{
+		count: monitoring.NewInt(reg, "active"),
+		added: monitoring.NewUint(reg, "added"),
+		done:  monitoring.NewUint(reg, "done"),
+	})
+
+	eventer := &deadLetterEventer{}
+	client, err := pipeline.ConnectWith(beat.ClientConfig{Events: eventer})
+	require.NoError(t, err)
+	defer client.Close()
+
+	event := beat.Event{Fields: common.MapStr{"message": "line"}}
+	client.Publish(event)
+	assert.Equal(t, []beat.Event{event}, eventer.failed)
+}
@@ -0,0 +1,50 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+	kafkainput "github.com/elastic/beats/v7/filebeat/input/kafka"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+)
+
+// kafkaConsumerGroup returns the consumer group of the kafka input of
+// filebeat.inputs with the group id.
+func kafkaConsumerGroup(beat *beat.Beat, id string) (*kafka.ConsumerGroup, error) {
+	cfg := config.DefaultConfig
+	if err := beat.BeatConfig.Unpack(&cfg); err != nil {
+		return nil, errors.Wrap(err, "reading filebeat.inputs")
+	}
+
+	for _, input := range cfg.Inputs {
+		var settings struct {
+			Type    string `config:"type"`
+			GroupID string `config:"group_id"`
+		}
+		if err := input.Unpack(&settings); err != nil {
+			return nil, err
+		}
+		if settings.Type == "kafka" && settings.GroupID == id {
+			return kafkainput.ConsumerGroup(input)
+		}
+	}
+	return nil, errors.Errorf("no kafka input with group_id %v in filebeat.inputs", id)
+}
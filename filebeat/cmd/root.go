@@ -57,6 +57,8 @@ func Filebeat(inputs beater.PluginFactory, settings instance.Settings) *cmd.Beat
 	command.TestCmd.Flags().AddGoFlag(flag.CommandLine.Lookup("modules"))
 	command.SetupCmd.Flags().AddGoFlag(flag.CommandLine.Lookup("modules"))
 	command.AddCommand(cmd.GenModulesCmd(Name, "", buildModulesManager))
+	command.AddCommand(cmd.GenKafkaCmd(settings, kafkaConsumerGroup))
+	command.AddCommand(cmd.GenReplayDLQCmd(settings))
 	command.AddCommand(genGenerateCmd())
 	return command
 }
@@ -0,0 +1,207 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/goccy/go-json"
+	"github.com/klauspost/compress/zstd"
+)
+
+// recordCompression is the compression of the value of a record by the
+// collector, independent of the compression of the Kafka protocol.
+type recordCompression int
+
+const (
+	recordCompressionNone recordCompression = iota
+	recordCompressionAuto
+	recordCompressionGzip
+	recordCompressionZstd
+)
+
+// recordSplit is how a record batching several log lines is split into
+// events.
+type recordSplit int
+
+const (
+	recordSplitNone recordSplit = iota
+	recordSplitNDJSON
+	recordSplitArray
+)
+
+var (
+	recordCompressions = map[string]recordCompression{
+		"none": recordCompressionNone,
+		"auto": recordCompressionAuto,
+		"gzip": recordCompressionGzip,
+		"zstd": recordCompressionZstd,
+	}
+	recordSplits = map[string]recordSplit{
+		"none":   recordSplitNone,
+		"ndjson": recordSplitNDJSON,
+		"array":  recordSplitArray,
+	}
+)
+
+// Unpack validates and unpack the "decompression" config option
+func (c *recordCompression) Unpack(value string) error {
+	compression, ok := recordCompressions[value]
+	if !ok {
+		return fmt.Errorf("invalid decompression '%s'", value)
+	}
+	*c = compression
+	return nil
+}
+
+// Unpack validates and unpack the "split" config option
+func (s *recordSplit) Unpack(value string) error {
+	split, ok := recordSplits[value]
+	if !ok {
+		return fmt.Errorf("invalid split '%s'", value)
+	}
+	*s = split
+	return nil
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// recordDecoder decompresses and splits the values of records.
+type recordDecoder struct {
+	compression recordCompression
+	split       recordSplit
+	maxSize     int64
+	zstd        *zstd.Decoder
+}
+
+func newRecordDecoder(config kafkaInputConfig) (*recordDecoder, error) {
+	d := &recordDecoder{
+		compression: config.Decompression,
+		split:       config.Split,
+		maxSize:     int64(config.MaxDecompressedSize),
+	}
+	if d.compression == recordCompressionAuto || d.compression == recordCompressionZstd {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(d.maxSize)))
+		if err != nil {
+			return nil, err
+		}
+		d.zstd = decoder
+	}
+	return d, nil
+}
+
+func (d *recordDecoder) Close() {
+	if d.zstd != nil {
+		d.zstd.Close()
+	}
+}
+
+// decode returns the events of a record value.
+func (d *recordDecoder) decode(value []byte) ([][]byte, error) {
+	value, err := d.decompress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.split {
+	case recordSplitNDJSON:
+		return splitLines(value), nil
+	case recordSplitArray:
+		return splitArray(value)
+	default:
+		return [][]byte{value}, nil
+	}
+}
+
+func (d *recordDecoder) decompress(value []byte) ([]byte, error) {
+	compression := d.compression
+	if compression == recordCompressionAuto {
+		switch {
+		case bytes.HasPrefix(value, gzipMagic):
+			compression = recordCompressionGzip
+		case bytes.HasPrefix(value, zstdMagic):
+			compression = recordCompressionZstd
+		default:
+			return value, nil
+		}
+	}
+
+	switch compression {
+	case recordCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("gzip record: %w", err)
+		}
+		// read one byte past the limit to tell a record of exactly maxSize
+		// from a bigger one
+		out, err := ioutil.ReadAll(io.LimitReader(r, d.maxSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("gzip record: %w", err)
+		}
+		if int64(len(out)) > d.maxSize {
+			return nil, fmt.Errorf("gzip record exceeds max_decompressed_size of %d bytes", d.maxSize)
+		}
+		return out, nil
+	case recordCompressionZstd:
+		out, err := d.zstd.DecodeAll(value, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd record: %w", err)
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// splitLines splits newline delimited JSON, skipping blank lines.
+func splitLines(value []byte) [][]byte {
+	var lines [][]byte
+	for len(value) > 0 {
+		line := value
+		if i := bytes.IndexByte(value, '\n'); i >= 0 {
+			line, value = value[:i], value[i+1:]
+		} else {
+			value = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// splitArray splits a JSON array into its elements.
+func splitArray(value []byte) ([][]byte, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(value, &elements); err != nil {
+		return nil, fmt.Errorf("splitting JSON array: %w", err)
+	}
+	out := make([][]byte, len(elements))
+	for i, e := range elements {
+		out[i] = e
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const ndjsonBatch = "{\"log\":\"a\"}\n{\"log\":\"b\"}\r\n\n{\"log\":\"c\"}\n"
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, s string) []byte {
+	w, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer w.Close()
+	return w.EncodeAll([]byte(s), nil)
+}
+
+func newTestDecoder(t *testing.T, compression recordCompression, split recordSplit) *recordDecoder {
+	config := defaultConfig()
+	config.Decompression, config.Split = compression, split
+	d, err := newRecordDecoder(config)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+	return d
+}
+
+func TestRecordDecoder(t *testing.T) {
+	lines := [][]byte{[]byte(`{"log":"a"}`), []byte(`{"log":"b"}`), []byte(`{"log":"c"}`)}
+
+	for name, test := range map[string]struct {
+		compression recordCompression
+		split       recordSplit
+		value       []byte
+		expected    [][]byte
+	}{
+		"plain":       {recordCompressionNone, recordSplitNone, []byte("line"), [][]byte{[]byte("line")}},
+		"ndjson":      {recordCompressionNone, recordSplitNDJSON, []byte(ndjsonBatch), lines},
+		"gzip ndjson": {recordCompressionGzip, recordSplitNDJSON, gzipped(t, ndjsonBatch), lines},
+		"zstd ndjson": {recordCompressionZstd, recordSplitNDJSON, zstded(t, ndjsonBatch), lines},
+		"auto gzip":   {recordCompressionAuto, recordSplitNDJSON, gzipped(t, ndjsonBatch), lines},
+		"auto zstd":   {recordCompressionAuto, recordSplitNDJSON, zstded(t, ndjsonBatch), lines},
+		"auto plain":  {recordCompressionAuto, recordSplitNDJSON, []byte(ndjsonBatch), lines},
+		"array": {
+			recordCompressionAuto, recordSplitArray,
+			gzipped(t, `[{"log":"a"}, {"log":"b"},{"log":"c"}]`),
+			lines,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			values, err := newTestDecoder(t, test.compression, test.split).decode(test.value)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, values)
+		})
+	}
+}
+
+func TestRecordDecoderErrors(t *testing.T) {
+	_, err := newTestDecoder(t, recordCompressionGzip, recordSplitNone).decode([]byte("not gzip"))
+	assert.Error(t, err)
+
+	_, err = newTestDecoder(t, recordCompressionNone, recordSplitArray).decode([]byte(`{"log":"a"}`))
+	assert.Error(t, err)
+
+	d := newTestDecoder(t, recordCompressionGzip, recordSplitNone)
+	d.maxSize = 4
+	_, err = d.decode(gzipped(t, "12345"))
+	assert.Error(t, err)
+	values, err := d.decode(gzipped(t, "1234"))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1234")}, values)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Topic() string                            { return "logs" }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestRecordReaderSplitsRecords(t *testing.T) {
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 1, Value: gzipped(t, ndjsonBatch)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte("not gzip")}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 3, Value: gzipped(t, "single")}
+	close(claim.messages)
+
+	handler := &groupHandler{decoder: newTestDecoder(t, recordCompressionGzip, recordSplitNDJSON)}
+	r := &recordReader{claim: claim, groupHandler: handler, log: logp.NewLogger("kafka test")}
+
+	var metas []eventMeta
+	for {
+		message, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		meta := message.Private.(eventMeta)
+		metas = append(metas, eventMeta{offset: meta.offset, events: meta.events})
+	}
+
+	// the undecodable record is skipped
+	assert.Equal(t, []eventMeta{
+		{offset: 1, events: 3},
+		{offset: 1, events: 3},
+		{offset: 1, events: 3},
+		{offset: 3, events: 1},
+	}, metas)
+}
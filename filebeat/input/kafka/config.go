@@ -24,8 +24,10 @@ import (
 
 	"github.com/Shopify/sarama"
 
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
 	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/common/match"
 	"github.com/elastic/beats/v7/libbeat/common/transport/kerberos"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/beats/v7/libbeat/monitoring"
@@ -47,11 +49,14 @@ var (
 type kafkaInputConfig struct {
 	// Kafka hosts with port, e.g. "localhost:9092"
 	Hosts                    []string          `config:"hosts" validate:"required"`
-	Topics                   []string          `config:"topics" validate:"required"`
+	Topics                   []string          `config:"topics"`
+	TopicsPattern            *match.Matcher    `config:"topics_pattern"`
+	TopicsRefreshInterval    time.Duration     `config:"topics_refresh_interval" validate:"nonzero,positive"`
 	GroupID                  string            `config:"group_id" validate:"required"`
 	ClientID                 string            `config:"client_id"`
 	Version                  kafka.Version     `config:"version"`
 	InitialOffset            initialOffset     `config:"initial_offset"`
+	InitialTimestamp         *timestamp        `config:"initial_timestamp"`
 	ConnectBackoff           time.Duration     `config:"connect_backoff" validate:"min=0"`
 	ConsumeBackoff           time.Duration     `config:"consume_backoff" validate:"min=0"`
 	WaitClose                time.Duration     `config:"wait_close" validate:"min=0"`
@@ -66,6 +71,13 @@ type kafkaInputConfig struct {
 	Username                 string            `config:"username"`
 	Password                 string            `config:"password"`
 	ExpandEventListFromField string            `config:"expand_event_list_from_field"`
+	MaxInFlightPerPartition  int               `config:"max_in_flight_per_partition" validate:"min=0"`
+	Decompression            recordCompression `config:"decompression"`
+	Split                    recordSplit       `config:"split"`
+	MaxDecompressedSize      cfgtype.ByteSize  `config:"max_decompressed_size" validate:"min=1"`
+	DeadLetter               *deadLetterConfig `config:"dead_letter"`
+	Throttle                 *throttleConfig   `config:"throttle"`
+	OffsetCommit             offsetCommit      `config:"offset_commit"`
 	Parsers                  parser.Config     `config:",inline"`
 }
 
@@ -95,8 +107,14 @@ type initialOffset int
 const (
 	initialOffsetOldest initialOffset = iota
 	initialOffsetNewest
+	initialOffsetTimestamp // the first record at or after initial_timestamp
 )
 
+// timestamp is a time set in the configuration as a RFC3339 timestamp.
+type timestamp struct {
+	time.Time
+}
+
 type rebalanceStrategy int
 
 const (
@@ -104,6 +122,13 @@ const (
 	rebalanceStrategyRoundRobin
 )
 
+type offsetCommit int
+
+const (
+	offsetCommitInput  offsetCommit = iota // the input commits the offsets of the acked events
+	offsetCommitOutput                     // the transactional kafka output commits them with the events
+)
+
 type isolationLevel int
 
 const (
@@ -113,8 +138,9 @@ const (
 
 var (
 	initialOffsets = map[string]initialOffset{
-		"oldest": initialOffsetOldest,
-		"newest": initialOffsetNewest,
+		"oldest":    initialOffsetOldest,
+		"newest":    initialOffsetNewest,
+		"timestamp": initialOffsetTimestamp,
 	}
 	rebalanceStrategies = map[string]rebalanceStrategy{
 		"range":      rebalanceStrategyRange,
@@ -124,20 +150,25 @@ var (
 		"read_uncommitted": isolationLevelReadUncommitted,
 		"read_committed":   isolationLevelReadCommitted,
 	}
+	offsetCommits = map[string]offsetCommit{
+		"input":  offsetCommitInput,
+		"output": offsetCommitOutput,
+	}
 )
 
 // The default config for the kafka input. When in doubt, default values
 // were chosen to match sarama's defaults.
 func defaultConfig() kafkaInputConfig {
 	return kafkaInputConfig{
-		Version:        kafka.Version("1.0.0"),
-		InitialOffset:  initialOffsetOldest,
-		ClientID:       "filebeat",
-		ConnectBackoff: 30 * time.Second,
-		ConsumeBackoff: 2 * time.Second,
-		WaitClose:      2 * time.Second,
-		MaxWaitTime:    250 * time.Millisecond,
-		IsolationLevel: isolationLevelReadUncommitted,
+		Version:               kafka.Version("1.0.0"),
+		InitialOffset:         initialOffsetOldest,
+		ClientID:              "filebeat",
+		ConnectBackoff:        30 * time.Second,
+		ConsumeBackoff:        2 * time.Second,
+		WaitClose:             2 * time.Second,
+		MaxWaitTime:           250 * time.Millisecond,
+		TopicsRefreshInterval: time.Minute,
+		IsolationLevel:        isolationLevelReadUncommitted,
 		Fetch: kafkaFetch{
 			Min:     1,
 			Default: (1 << 20), // 1 MB
@@ -155,6 +186,11 @@ func defaultConfig() kafkaInputConfig {
 		Heartbeat: kafkaHeartbeat{
 			Interval: 3 * time.Second,
 		},
+		MaxInFlightPerPartition: 0,
+		Decompression:           recordCompressionNone,
+		Split:                   recordSplitNone,
+		MaxDecompressedSize:     64 * 1024 * 1024,
+		OffsetCommit:            offsetCommitInput,
 	}
 }
 
@@ -164,13 +200,36 @@ func (c *kafkaInputConfig) Validate() error {
 		return errors.New("no hosts configured")
 	}
 
+	if len(c.Topics) == 0 && c.TopicsPattern == nil {
+		return errors.New("no topics or topics_pattern configured")
+	}
+
 	if err := c.Version.Validate(); err != nil {
 		return err
 	}
 
+	if c.Split != recordSplitNone && c.ExpandEventListFromField != "" {
+		return errors.New("split and expand_event_list_from_field can not be used together")
+	}
+
+	// The events merged by multiline lose the number of events of their
+	// record, an event ending in the middle of a record would commit it.
+	if c.Parsers.Merging && (c.Split != recordSplitNone || c.ExpandEventListFromField != "") {
+		return errors.New("split and expand_event_list_from_field can not be used with the multiline parser")
+	}
+
 	if c.Username != "" && c.Password == "" {
 		return fmt.Errorf("password must be set when username is configured")
 	}
+
+	if c.InitialOffset == initialOffsetTimestamp {
+		if c.InitialTimestamp == nil {
+			return errors.New("initial_timestamp must be set with initial_offset: timestamp")
+		}
+		if version, ok := c.Version.Get(); !ok || !version.IsAtLeast(sarama.V0_10_1_0) {
+			return errors.New("initial_offset: timestamp requires kafka version 0.10.1 or newer")
+		}
+	}
 	return nil
 }
 
@@ -251,6 +310,9 @@ func (off initialOffset) asSaramaOffset() int64 {
 	return map[initialOffset]int64{
 		initialOffsetOldest: sarama.OffsetOldest,
 		initialOffsetNewest: sarama.OffsetNewest,
+		// the partitions are moved to the timestamp when the group session
+		// starts, the oldest offset is used if the offset is out of range
+		initialOffsetTimestamp: sarama.OffsetOldest,
 	}[off]
 }
 
@@ -264,6 +326,16 @@ func (off *initialOffset) Unpack(value string) error {
 	return nil
 }
 
+// Unpack validates and unpack the "initial_timestamp" config option
+func (t *timestamp) Unpack(value string) error {
+	ts, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp '%s', expected a RFC3339 timestamp like 2006-01-02T15:04:05Z07:00", value)
+	}
+	t.Time = ts
+	return nil
+}
+
 func (st rebalanceStrategy) asSaramaStrategy() sarama.BalanceStrategy {
 	return map[rebalanceStrategy]sarama.BalanceStrategy{
 		rebalanceStrategyRange:      sarama.BalanceStrategyRange,
@@ -296,3 +368,13 @@ func (is *isolationLevel) Unpack(value string) error {
 	*is = isolationLevel
 	return nil
 }
+
+// Unpack validates and unpack the "offset_commit" config option
+func (oc *offsetCommit) Unpack(value string) error {
+	commit, ok := offsetCommits[value]
+	if !ok {
+		return fmt.Errorf("invalid offset commit '%s'", value)
+	}
+	*oc = commit
+	return nil
+}
@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/goccy/go-json"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// Headers added to the records produced to the dead letter topic. The
+// original headers of the record are kept.
+const (
+	deadLetterHeaderTopic     = "x-dead-letter-topic"
+	deadLetterHeaderPartition = "x-dead-letter-partition"
+	deadLetterHeaderOffset    = "x-dead-letter-offset"
+	deadLetterHeaderError     = "x-dead-letter-error"
+)
+
+type deadLetterConfig struct {
+	Topic string `config:"topic"` // produce to this topic of the input's cluster
+	Path  string `config:"path"`  // append to this local file
+}
+
+func (c *deadLetterConfig) Validate() error {
+	if (c.Topic == "") == (c.Path == "") {
+		return errors.New("dead_letter requires exactly one of topic or path")
+	}
+	return nil
+}
+
+// deadLetterWriter stores the dead letters, synchronously so that the offset
+// of a record is only committed once its dead letter is stored.
+type deadLetterWriter interface {
+	write(kafka.DeadLetter) error
+	Close() error
+}
+
+// deadLetterQueue routes the records failing in the input or in the
+// processors to the configured writer. It is nil when dead_letter is not
+// configured.
+type deadLetterQueue struct {
+	writer deadLetterWriter
+	topic  string // records read from the dead letter topic are not requeued
+	log    *logp.Logger
+}
+
+func newDeadLetterQueue(config *deadLetterConfig, hosts []string, saramaConfig *sarama.Config, log *logp.Logger) (*deadLetterQueue, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	var (
+		writer deadLetterWriter
+		err    error
+	)
+	if config.Topic != "" {
+		writer, err = newDeadLetterTopic(config.Topic, hosts, saramaConfig)
+	} else {
+		writer, err = newDeadLetterFile(config.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterQueue{writer: writer, topic: config.Topic, log: log}, nil
+}
+
+// send stores the dead letter of a failed record. It returns an error when
+// the dead letter could not be written, the record must then not be acked.
+func (q *deadLetterQueue) send(msg *sarama.ConsumerMessage, value []byte, reason error) error {
+	if q == nil {
+		return nil
+	}
+	if q.topic != "" && msg.Topic == q.topic {
+		q.log.Errorw("Dropping record of the dead letter topic failing again", "error", reason, "offset", msg.Offset)
+		return nil
+	}
+	if err := q.writer.write(kafka.NewDeadLetter(msg, value, reason)); err != nil {
+		q.log.Errorw("Error writing kafka record to the dead letter queue", "error", err,
+			"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "reason", reason)
+		return fmt.Errorf("writing offset %d of %s/%d to the dead letter queue: %w", msg.Offset, msg.Topic, msg.Partition, err)
+	}
+	return nil
+}
+
+func (q *deadLetterQueue) Close() error {
+	if q == nil {
+		return nil
+	}
+	return q.writer.Close()
+}
+
+// ProcessingFailed implements beat.ProcessingErrorEventer, routing the events
+// dropped by a failing processor to the dead letter queue. When the dead
+// letter can not be written the partition of the event is failed, so that
+// its offset is not committed and the record is read again.
+func (q *deadLetterQueue) ProcessingFailed(event beat.Event, err error) {
+	if meta, ok := event.Private.(eventMeta); ok && meta.record != nil {
+		if err := q.send(meta.record, meta.value, err); err != nil && meta.failHandler != nil {
+			meta.failHandler(err)
+		}
+	}
+}
+
+func (q *deadLetterQueue) Closing()                    {}
+func (q *deadLetterQueue) Closed()                     {}
+func (q *deadLetterQueue) Published()                  {}
+func (q *deadLetterQueue) FilteredOut(beat.Event)      {}
+func (q *deadLetterQueue) DroppedOnPublish(beat.Event) {}
+
+// deadLetterTopic produces the dead letters with their original key, value
+// and headers, so that an input reading the topic replays them.
+type deadLetterTopic struct {
+	topic    string
+	producer sarama.SyncProducer
+}
+
+func newDeadLetterTopic(topic string, hosts []string, saramaConfig *sarama.Config) (*deadLetterTopic, error) {
+	config := *saramaConfig
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	producer, err := sarama.NewSyncProducer(hosts, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterTopic{topic: topic, producer: producer}, nil
+}
+
+func (t *deadLetterTopic) write(dl kafka.DeadLetter) error {
+	msg := dl.ProducerMessage(t.topic)
+	msg.Headers = append(msg.Headers,
+		sarama.RecordHeader{Key: []byte(deadLetterHeaderTopic), Value: []byte(dl.Topic)},
+		sarama.RecordHeader{Key: []byte(deadLetterHeaderPartition), Value: []byte(strconv.Itoa(int(dl.Partition)))},
+		sarama.RecordHeader{Key: []byte(deadLetterHeaderOffset), Value: []byte(strconv.FormatInt(dl.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(deadLetterHeaderError), Value: []byte(dl.Error)},
+	)
+	_, _, err := t.producer.SendMessage(msg)
+	return err
+}
+
+func (t *deadLetterTopic) Close() error {
+	return t.producer.Close()
+}
+
+// deadLetterFile appends the dead letters to a file as JSON lines, replayed
+// with the kafka replay-dead-letters command.
+type deadLetterFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newDeadLetterFile(path string) (*deadLetterFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterFile{file: file}, nil
+}
+
+func (f *deadLetterFile) write(dl kafka.DeadLetter) error {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(line); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *deadLetterFile) Close() error {
+	return f.file.Close()
+}
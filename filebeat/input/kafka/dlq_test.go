@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+type memoryDeadLetters struct {
+	letters []kafka.DeadLetter
+	err     error // returned instead of storing the letters
+}
+
+func (m *memoryDeadLetters) write(dl kafka.DeadLetter) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.letters = append(m.letters, dl)
+	return nil
+}
+func (m *memoryDeadLetters) Close() error { return nil }
+
+func TestDeadLetterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.ndjson")
+	queue, err := newDeadLetterQueue(&deadLetterConfig{Path: path}, nil, nil, logp.NewLogger("kafka test"))
+	require.NoError(t, err)
+
+	record := &sarama.ConsumerMessage{
+		Topic:     "logs",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("vid"),
+		Value:     []byte("raw line"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("collector"), Value: []byte("ilogtail")},
+			{Key: []byte("trace"), Value: []byte("a")},
+			{Key: []byte("trace"), Value: []byte("b")},
+		},
+		Timestamp: time.Date(2023, 9, 18, 11, 32, 58, 0, time.UTC),
+	}
+	queue.ProcessingFailed(beat.Event{Private: eventMeta{record: record, value: record.Value}}, errors.New("malformed"))
+	require.NoError(t, queue.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	require.NoError(t, err)
+
+	var dl kafka.DeadLetter
+	require.NoError(t, json.Unmarshal(line, &dl))
+	assert.Equal(t, kafka.DeadLetter{
+		Topic:     "logs",
+		Partition: 2,
+		Offset:    42,
+		Key:       []byte("vid"),
+		Value:     []byte("raw line"),
+		Headers: []kafka.DeadLetterHeader{
+			{Key: "collector", Value: "ilogtail"},
+			{Key: "trace", Value: "a"},
+			{Key: "trace", Value: "b"},
+		},
+		Timestamp: record.Timestamp,
+		Error:     "malformed",
+	}, dl)
+}
+
+func TestDeadLetterQueueSkipsDeadLetterTopic(t *testing.T) {
+	letters := &memoryDeadLetters{}
+	queue := &deadLetterQueue{writer: letters, topic: "logs-dlq", log: logp.NewLogger("kafka test")}
+
+	queue.send(&sarama.ConsumerMessage{Topic: "logs", Offset: 1}, []byte("a"), errors.New("failed"))
+	queue.send(&sarama.ConsumerMessage{Topic: "logs-dlq", Offset: 1}, []byte("a"), errors.New("failed again"))
+	if assert.Len(t, letters.letters, 1) {
+		assert.Equal(t, "logs", letters.letters[0].Topic)
+	}
+
+	// the queue is optional
+	var disabled *deadLetterQueue
+	disabled.send(&sarama.ConsumerMessage{}, nil, errors.New("failed"))
+	assert.NoError(t, disabled.Close())
+}
+
+func TestRecordReaderDeadLettersUndecodableRecords(t *testing.T) {
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: 1, Value: []byte("not gzip")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: 2, Value: gzipped(t, "line")}
+	close(claim.messages)
+
+	letters := &memoryDeadLetters{}
+	handler := &groupHandler{
+		decoder:    newTestDecoder(t, recordCompressionGzip, recordSplitNone),
+		deadLetter: &deadLetterQueue{writer: letters, log: logp.NewLogger("kafka test")},
+	}
+	r := &recordReader{claim: claim, groupHandler: handler, log: logp.NewLogger("kafka test")}
+
+	message, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "line", string(message.Content))
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+
+	if assert.Len(t, letters.letters, 1) {
+		assert.Equal(t, int64(1), letters.letters[0].Offset)
+		assert.Equal(t, []byte("not gzip"), letters.letters[0].Value)
+		assert.Contains(t, letters.letters[0].Error, "gzip")
+	}
+}
+
+func TestDeadLetterQueueWriteFailure(t *testing.T) {
+	letters := &memoryDeadLetters{err: errors.New("disk full")}
+	queue := &deadLetterQueue{writer: letters, log: logp.NewLogger("kafka test")}
+	record := &sarama.ConsumerMessage{Topic: "logs", Offset: 7, Value: []byte("raw line")}
+
+	var failed error
+	queue.ProcessingFailed(beat.Event{Private: eventMeta{
+		record:      record,
+		value:       record.Value,
+		failHandler: func(err error) { failed = err },
+	}}, errors.New("malformed"))
+	assert.Error(t, failed, "the partition fails when the dead letter is not written")
+
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: 1, Value: []byte("not gzip")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: 2, Value: gzipped(t, "line")}
+	close(claim.messages)
+	handler := &groupHandler{
+		decoder:    newTestDecoder(t, recordCompressionGzip, recordSplitNone),
+		deadLetter: queue,
+	}
+	r := &recordReader{claim: claim, groupHandler: handler, log: logp.NewLogger("kafka test")}
+	_, err := r.Next()
+	assert.Error(t, err, "the record is not skipped when the dead letter is not written")
+}
+
+func TestDeadLetterConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"topic":   {common.MapStr{"topic": "logs-dlq"}, true},
+		"path":    {common.MapStr{"path": "/var/lib/filebeat/dlq.ndjson"}, true},
+		"both":    {common.MapStr{"topic": "logs-dlq", "path": "dlq.ndjson"}, false},
+		"neither": {common.MapStr{}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":       "localhost:9092",
+				"topics":      "logs",
+				"group_id":    "filebeat",
+				"dead_letter": test.settings,
+			})
+			config := defaultConfig()
+			err := cfg.Unpack(&config)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
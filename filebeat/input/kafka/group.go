@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+)
+
+// ConsumerGroup returns the consumer group of a kafka input configuration,
+// for the commands managing its offsets.
+func ConsumerGroup(cfg *common.Config) (*kafka.ConsumerGroup, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	saramaConfig, err := newSaramaConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing Sarama config")
+	}
+
+	return &kafka.ConsumerGroup{
+		ID:     config.GroupID,
+		Hosts:  config.Hosts,
+		Config: saramaConfig,
+		Topics: func(client sarama.Client) ([]string, error) {
+			if config.TopicsPattern == nil {
+				return matchTopics(config.Topics, nil, nil), nil
+			}
+			available, err := client.Topics()
+			if err != nil {
+				return nil, err
+			}
+			return matchTopics(config.Topics, config.TopicsPattern, available), nil
+		},
+	}, nil
+}
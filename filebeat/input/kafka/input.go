@@ -27,8 +27,6 @@ import (
 
 	"github.com/goccy/go-json"
 
-	"github.com/elastic/beats/v7/libbeat/common/atomic"
-
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
 
@@ -104,13 +102,23 @@ func (input *kafkaInput) Test(ctx input.TestContext) error {
 		return fmt.Errorf("Of configured topics %v, topics: %v are not in available topics %v", input.config.Topics, missingTopics, topics)
 	}
 
+	if pattern := input.config.TopicsPattern; pattern != nil && len(matchTopics(nil, pattern, topics)) == 0 {
+		return fmt.Errorf("topics_pattern %v matches none of the available topics %v", pattern, topics)
+	}
+
 	return nil
 }
 
 func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 	log := ctx.Logger.Named("kafka input")
 
-	client, err := pipeline.ConnectWith(beat.ClientConfig{
+	deadLetter, err := newDeadLetterQueue(input.config.DeadLetter, input.config.Hosts, input.saramaConfig, log)
+	if err != nil {
+		return errors.Wrap(err, "initializing dead letter queue")
+	}
+	defer deadLetter.Close()
+
+	clientConfig := beat.ClientConfig{
 		ACKHandler: acker.ConnectionOnly(
 			acker.EventPrivateReporter(func(_ int, events []interface{}) {
 				for _, event := range events {
@@ -122,7 +130,13 @@ func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 		),
 		CloseRef:  ctx.Cancelation,
 		WaitClose: input.config.WaitClose,
-	})
+	}
+	if deadLetter != nil {
+		// the events dropped by failing processors go to the dead letter
+		// queue before they are acked
+		clientConfig.Events = deadLetter
+	}
+	client, err := pipeline.ConnectWith(clientConfig)
 	if err != nil {
 		return err
 	}
@@ -167,21 +181,75 @@ func (input *kafkaInput) Run(ctx input.Context, pipeline beat.Pipeline) error {
 		input.saramaWaitGroup.Done()
 	}()
 
+	// Listen asynchronously to any errors during the consume process, until
+	// the consumer group is closed.
+	go func() {
+		for err := range consumerGroup.Errors() {
+			log.Errorw("Error reading from kafka", "error", err)
+		}
+	}()
+
+	watcher := &topicWatcher{
+		static:       input.config.Topics,
+		pattern:      input.config.TopicsPattern,
+		interval:     input.config.TopicsRefreshInterval,
+		hosts:        input.config.Hosts,
+		saramaConfig: input.saramaConfig,
+		log:          log,
+	}
+	defer watcher.close()
+
+	decoder, err := newRecordDecoder(input.config)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	throttle := newThrottle(input.config.Throttle, input.config.GroupID)
+	defer throttle.close()
+
 	handler := &groupHandler{
-		version: input.config.Version,
-		client:  client,
-		parsers: input.config.Parsers,
+		version:     input.config.Version,
+		groupID:     input.config.GroupID,
+		maxInFlight: input.config.MaxInFlightPerPartition,
+		commit:      input.config.OffsetCommit,
+		client:      client,
+		parsers:     input.config.Parsers,
 		// expandEventListFromField will be assigned the configuration option expand_event_list_from_field
 		expandEventListFromField: input.config.ExpandEventListFromField,
+		decoder:                  decoder,
+		deadLetter:               deadLetter,
 		log:                      log,
+		hosts:                    input.config.Hosts,
+		saramaConfig:             input.saramaConfig,
+		throttle:                 throttle,
+	}
+	if input.config.InitialOffset == initialOffsetTimestamp {
+		handler.initialTimestamp = input.config.InitialTimestamp.Time
 	}
 	for goContext.Err() == nil {
+		topics, err := watcher.topics()
+		if err != nil || len(topics) == 0 {
+			log.Warnw("No kafka topics to consume, retrying", "error", err, "topics_pattern", input.config.TopicsPattern)
+			select {
+			case <-goContext.Done():
+			case <-time.After(input.config.TopicsRefreshInterval):
+			}
+			continue
+		}
+
 		// We have a connected consumer group now, try to start the main event
 		// loop by calling Consume (which starts an asynchronous consumer).
-		// In an ideal run, this function never returns until shutdown; if it
-		// does, it means the errors have been logged and the consumer group
-		// has been closed, so we try creating a new one in the next iteration.
-		input.runConsumerGroup(log, goContext, consumerGroup, handler)
+		// In an ideal run, this function never returns until shutdown or a
+		// change of the topics matching topics_pattern; if it does, it means
+		// the errors have been logged and the consumer group has been closed,
+		// so we try creating a new one in the next iteration.
+		sessionContext, endSession := context.WithCancel(goContext)
+		if watcher.dynamic() {
+			go watcher.watch(sessionContext, topics, endSession)
+		}
+		input.runConsumerGroup(log, sessionContext, consumerGroup, handler, topics)
+		endSession()
 	}
 
 	if ctx.Cancelation.Err() == context.Canceled {
@@ -209,25 +277,40 @@ func (input *kafkaInput) Wait() {
 }
 
 func (input *kafkaInput) runConsumerGroup(log *logp.Logger, context context.Context,
-	consumerGroup sarama.ConsumerGroup, handler sarama.ConsumerGroupHandler) {
-
-	// Listen asynchronously to any errors during the consume process
-	go func() {
-		for err := range consumerGroup.Errors() {
-			log.Errorw("Error reading from kafka", "error", err)
-		}
-	}()
+	consumerGroup sarama.ConsumerGroup, handler sarama.ConsumerGroupHandler, topics []string) {
 
-	err := consumerGroup.Consume(context, input.config.Topics, handler)
+	err := consumerGroup.Consume(context, topics, handler)
 	if err != nil {
-		log.Errorw("Kafka consume error", "error", err, "topics", input.config.Topics, "groupId", input.config.GroupID)
+		log.Errorw("Kafka consume error", "error", err, "topics", topics, "groupId", input.config.GroupID)
 	}
 }
 
 // The metadata attached to incoming events, so they can be ACKed once they've
-// been successfully sent.
+// been successfully sent. Readers set the offset of the message, the number
+// of events split from it and the index of the event, the ackHandler is set
+// when the event is published.
 type eventMeta struct {
+	offset     int64
+	events     int
+	index      int
 	ackHandler func()
+	// failHandler stops the partition when the event can not be acked
+	failHandler func(error)
+
+	// the offset committed by the output with offset_commit: output
+	consumerOffset *kafka.ConsumerOffset
+
+	// the record and the value of the event, for the dead letter queue
+	record *sarama.ConsumerMessage
+	value  []byte
+}
+
+// ConsumerOffset implements kafka.OffsetCommitter.
+func (m eventMeta) ConsumerOffset() (kafka.ConsumerOffset, bool) {
+	if m.consumerOffset == nil {
+		return kafka.ConsumerOffset{}, false
+	}
+	return *m.consumerOffset, true
 }
 
 func arrayForKafkaHeaders(headers []*sarama.RecordHeader) []string {
@@ -275,24 +358,77 @@ func (c channelCtx) Value(_ interface{}) interface{} { return nil }
 // and passing ACKs from the output channel back to the kafka cluster.
 type groupHandler struct {
 	sync.Mutex
-	version kafka.Version
-	session sarama.ConsumerGroupSession
-	client  beat.Client
-	parsers parser.Config
+	version     kafka.Version
+	groupID     string
+	maxInFlight int
+	commit      offsetCommit
+	session     sarama.ConsumerGroupSession
+	client      beat.Client
+	parsers     parser.Config
 	// if the fileset using this input expects to receive multiple messages bundled under a specific field then this value is assigned
 	// ex. in this case are the azure fielsets where the events are found under the json object "records"
 	expandEventListFromField string // TODO
+	decoder                  *recordDecoder
+	deadLetter               *deadLetterQueue
 	log                      *logp.Logger
 	reader                   reader.Reader
+
+	// the time the partitions without a committed offset start from, with
+	// initial_offset: timestamp
+	initialTimestamp time.Time
+	hosts            []string
+	saramaConfig     *sarama.Config
+
+	// nil when the records are not throttled
+	throttle *throttle
 }
 
 func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	if !h.initialTimestamp.IsZero() {
+		if err := h.seekInitialTimestamp(session); err != nil {
+			return errors.Wrap(err, "moving partitions to initial_timestamp")
+		}
+	}
+
 	h.Lock()
 	h.session = session
 	h.Unlock()
 	return nil
 }
 
+// seekInitialTimestamp marks the offsets of the claimed partitions without a
+// committed offset at their first record since initial_timestamp. The claims
+// are consumed from the marked offsets once Setup returns.
+func (h *groupHandler) seekInitialTimestamp(session sarama.ConsumerGroupSession) error {
+	client, err := sarama.NewClient(h.hosts, h.saramaConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	claims := session.Claims()
+	committed, err := kafka.CommittedOffsets(client, h.groupID, claims)
+	if err != nil {
+		return err
+	}
+	starts, err := kafka.OffsetsForTime(client, claims, h.initialTimestamp)
+	if err != nil {
+		return err
+	}
+	for topic, partitions := range committed {
+		for partition, offset := range partitions {
+			if offset >= 0 {
+				continue
+			}
+			start := starts[topic][partition]
+			h.log.Infow("Starting partition at initial_timestamp", "topic", topic, "partition", partition,
+				"initial_timestamp", h.initialTimestamp, "offset", start)
+			session.MarkOffset(topic, partition, start, "")
+		}
+	}
+	return nil
+}
+
 func (h *groupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 	h.Lock()
 	h.session = nil
@@ -300,20 +436,18 @@ func (h *groupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 	return nil
 }
 
-// ack informs the kafka cluster that this message has been consumed. Called
-// from the input's ACKEvents handler.
-func (h *groupHandler) ack(message *sarama.ConsumerMessage) {
-	h.Lock()
-	defer h.Unlock()
-	if h.session != nil {
-		h.session.MarkMessage(message, "")
-	}
-}
-
+// ConsumeClaim publishes the messages of a partition. The offsets are marked
+// by the partitionTracker of the claim as the events are acked, the input's
+// ACKEvents handler calling the ackHandler of each event. With offset_commit:
+// output the events carry the offset to commit instead.
 func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	reader := h.createReader(claim)
+	tracker := newPartitionTracker(session, h.groupID, claim.Topic(), claim.Partition(), claim.InitialOffset(), h.maxInFlight)
+	tracker.markOffsets = h.commit == offsetCommitInput
+	defer tracker.close()
+
+	reader := h.createReader(session.Context(), claim)
 	parser := h.parsers.Create(reader)
-	for h.session.Context().Err() == nil {
+	for session.Context().Err() == nil {
 		message, err := parser.Next()
 		if err == io.EOF {
 			return nil
@@ -321,20 +455,80 @@ func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim s
 		if err != nil {
 			return err
 		}
+		meta, err := messageMeta(message)
+		if err != nil {
+			return err
+		}
+		if !tracker.acquire(session.Context()) {
+			return nil
+		}
+		offset := meta.offset
+		tracker.add(offset, meta.events, claim.HighWaterMarkOffset())
+		meta.ackHandler = func() { tracker.ack(offset) }
+		meta.failHandler = tracker.fail
+		if h.commit == offsetCommitOutput {
+			meta.consumerOffset = h.consumerOffset(claim, meta)
+		}
+
 		h.client.Publish(beat.Event{
 			Timestamp:   message.Ts,
 			Meta:        message.Meta,
 			Fields:      message.Fields,
-			Private:     message.Private,
+			Private:     meta,
 			MessageSize: len(message.Content),
 		})
+
+		// The processors run in Publish, a dead letter failing to be
+		// written ends the claim before later records are published.
+		if err := tracker.err(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Reader {
+// consumerOffset returns the offset to commit once the event is written. The
+// output writes the events of a partition in order, so the offset following
+// the message is committed with its last event. The earlier events of a
+// message split in several events commit its own offset, a crash before the
+// last one is written reads the message again.
+func (h *groupHandler) consumerOffset(claim sarama.ConsumerGroupClaim, meta eventMeta) *kafka.ConsumerOffset {
+	next := meta.offset
+	if meta.index == meta.events-1 {
+		next++
+	}
+	return &kafka.ConsumerOffset{
+		GroupID:   h.groupID,
+		Topic:     claim.Topic(),
+		Partition: claim.Partition(),
+		Offset:    next,
+	}
+}
+
+// messageMeta returns the offset of the last kafka message in a parsed
+// message and the number of events of it. Parsers merging several messages,
+// like multiline, drop the private metadata but keep the fields of the last
+// message. Their records are never split in several events, the config
+// rejects split and expand_event_list_from_field with them, so the merged
+// message completes the record of its last line.
+func messageMeta(message reader.Message) (eventMeta, error) {
+	if meta, ok := message.Private.(eventMeta); ok {
+		return meta, nil
+	}
+	if offset, err := message.Fields.GetValue("kafka.offset"); err == nil {
+		if offset, ok := offset.(int64); ok {
+			return eventMeta{offset: offset, events: 1}, nil
+		}
+	}
+	return eventMeta{}, errors.New("parsed kafka message without offset")
+}
+
+// createReader returns the reader of the claim, ctx is done when the claim
+// ends.
+func (h *groupHandler) createReader(ctx context.Context, claim sarama.ConsumerGroupClaim) reader.Reader {
 	if h.expandEventListFromField != "" {
 		return &listFromFieldReader{
+			ctx:          ctx,
 			claim:        claim,
 			groupHandler: h,
 			field:        h.expandEventListFromField,
@@ -342,6 +536,7 @@ func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Read
 		}
 	}
 	return &recordReader{
+		ctx:          ctx,
 		claim:        claim,
 		groupHandler: h,
 		log:          h.log,
@@ -349,8 +544,10 @@ func (h *groupHandler) createReader(claim sarama.ConsumerGroupClaim) reader.Read
 }
 
 type recordReader struct {
+	ctx          context.Context
 	claim        sarama.ConsumerGroupClaim
 	groupHandler *groupHandler
+	buffer       []reader.Message
 	log          *logp.Logger
 }
 
@@ -359,19 +556,36 @@ func (m *recordReader) Close() error {
 }
 
 func (m *recordReader) Next() (reader.Message, error) {
-	msg, ok := <-m.claim.Messages()
-	if !ok {
-		return reader.Message{}, io.EOF
-	}
+	for len(m.buffer) == 0 {
+		msg, ok := <-m.claim.Messages()
+		if !ok {
+			return reader.Message{}, io.EOF
+		}
+		if err := m.groupHandler.throttle.wait(m.ctx, msg); err != nil {
+			return reader.Message{}, io.EOF
+		}
 
-	timestamp, kafkaFields := composeEventMetadata(m.claim, m.groupHandler, msg)
-	ackHandler := func() {
-		m.groupHandler.ack(msg)
+		values, err := m.groupHandler.decoder.decode(msg.Value)
+		if err != nil {
+			m.log.Errorw("Kafka decoding record", "error", err, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			if err := m.groupHandler.deadLetter.send(msg, msg.Value, err); err != nil {
+				return reader.Message{}, err
+			}
+			continue
+		}
+		timestamp, kafkaFields := composeEventMetadata(m.claim, m.groupHandler, msg)
+		for i, value := range values {
+			m.buffer = append(m.buffer, composeMessage(timestamp, value, kafkaFields, msg, i, len(values)))
+		}
 	}
-	return composeMessage(timestamp, msg.Value, kafkaFields, ackHandler), nil
+
+	next := m.buffer[0]
+	m.buffer = m.buffer[1:]
+	return next, nil
 }
 
 type listFromFieldReader struct {
+	ctx          context.Context
 	claim        sarama.ConsumerGroupClaim
 	groupHandler *groupHandler
 	buffer       []reader.Message
@@ -384,27 +598,28 @@ func (l *listFromFieldReader) Close() error {
 }
 
 func (l *listFromFieldReader) Next() (reader.Message, error) {
-	if len(l.buffer) != 0 {
-		return l.returnFromBuffer()
-	}
-
-	msg, ok := <-l.claim.Messages()
-	if !ok {
-		return reader.Message{}, io.EOF
-	}
-
-	timestamp, kafkaFields := composeEventMetadata(l.claim, l.groupHandler, msg)
-	messages := l.parseMultipleMessages(msg.Value)
+	for len(l.buffer) == 0 {
+		msg, ok := <-l.claim.Messages()
+		if !ok {
+			return reader.Message{}, io.EOF
+		}
+		if err := l.groupHandler.throttle.wait(l.ctx, msg); err != nil {
+			return reader.Message{}, io.EOF
+		}
 
-	neededAcks := atomic.MakeInt(len(messages))
-	ackHandler := func() {
-		if neededAcks.Dec() == 0 {
-			l.groupHandler.ack(msg)
+		value, err := l.groupHandler.decoder.decompress(msg.Value)
+		if err != nil {
+			l.log.Errorw("Kafka decompressing record", "error", err, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			if err := l.groupHandler.deadLetter.send(msg, msg.Value, err); err != nil {
+				return reader.Message{}, err
+			}
+			continue
+		}
+		timestamp, kafkaFields := composeEventMetadata(l.claim, l.groupHandler, msg)
+		messages := l.parseMultipleMessages(value)
+		for i, message := range messages {
+			l.buffer = append(l.buffer, composeMessage(timestamp, []byte(message), kafkaFields, msg, i, len(messages)))
 		}
-	}
-	for _, message := range messages {
-		newBuffer := append(l.buffer, composeMessage(timestamp, []byte(message), kafkaFields, ackHandler))
-		l.buffer = newBuffer
 	}
 
 	return l.returnFromBuffer()
@@ -460,7 +675,7 @@ func composeEventMetadata(claim sarama.ConsumerGroupClaim, handler *groupHandler
 	return timestamp, kafkaFields
 }
 
-func composeMessage(timestamp time.Time, content []byte, kafkaFields common.MapStr, ackHandler func()) reader.Message {
+func composeMessage(timestamp time.Time, content []byte, kafkaFields common.MapStr, record *sarama.ConsumerMessage, index, events int) reader.Message {
 	return reader.Message{
 		Ts:      timestamp,
 		Content: content,
@@ -468,12 +683,40 @@ func composeMessage(timestamp time.Time, content []byte, kafkaFields common.MapS
 			"kafka":   kafkaFields,
 			"message": string(content),
 		},
+		Meta: composeHeaders(record),
 		Private: eventMeta{
-			ackHandler: ackHandler,
+			offset: record.Offset,
+			events: events,
+			index:  index,
+			record: record,
+			value:  content,
 		},
 	}
 }
 
+// composeHeaders passes the headers of a record through in
+// @metadata.kafka.headers, the kafka output sets them on the records it
+// produces. The value of a key is a string, or the list of its values in
+// order when the record repeats the key.
+func composeHeaders(record *sarama.ConsumerMessage) common.MapStr {
+	if len(record.Headers) == 0 {
+		return nil
+	}
+	headers := make(common.MapStr, len(record.Headers))
+	for _, h := range record.Headers {
+		key, value := string(h.Key), string(h.Value)
+		switch values := headers[key].(type) {
+		case nil:
+			headers[key] = value
+		case string:
+			headers[key] = []string{values, value}
+		case []string:
+			headers[key] = append(values, value)
+		}
+	}
+	return common.MapStr{"kafka": common.MapStr{"headers": headers}}
+}
+
 func contains(elements []string, element string) bool {
 	for _, e := range elements {
 		if e == element {
@@ -22,7 +22,10 @@ package kafka
 
 import (
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -52,3 +55,98 @@ func AssertNotStartedInputCanBeDone(t *testing.T, configMap *common.Config) {
 	_, err = Plugin().Manager.Create(config)
 	require.NoError(t, err)
 }
+
+func TestComposeMessageHeaders(t *testing.T) {
+	record := &sarama.ConsumerMessage{
+		Offset: 3,
+		Value:  []byte("line"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace_id"), Value: []byte("4bf92f35")},
+			{Key: []byte("vid"), Value: []byte("LJ1EEAUU0N")},
+		},
+	}
+	message := composeMessage(time.Now(), record.Value, common.MapStr{}, record, 0, 1)
+	assert.Equal(t, common.MapStr{
+		"kafka": common.MapStr{
+			"headers": common.MapStr{"trace_id": "4bf92f35", "vid": "LJ1EEAUU0N"},
+		},
+	}, message.Meta)
+
+	// repeated keys keep all their values
+	record.Headers = append(record.Headers,
+		&sarama.RecordHeader{Key: []byte("hop"), Value: []byte("a")},
+		&sarama.RecordHeader{Key: []byte("hop"), Value: []byte("b")},
+		&sarama.RecordHeader{Key: []byte("hop"), Value: []byte("c")},
+	)
+	message = composeMessage(time.Now(), record.Value, common.MapStr{}, record, 0, 1)
+	hops, _ := message.Meta.GetValue("kafka.headers.hop")
+	assert.Equal(t, []string{"a", "b", "c"}, hops)
+
+	record.Headers = nil
+	assert.Nil(t, composeMessage(time.Now(), record.Value, common.MapStr{}, record, 0, 1).Meta)
+}
+
+func TestSplitWithMultilineConfig(t *testing.T) {
+	multiline := []common.MapStr{{"multiline": common.MapStr{"pattern": "^\\s", "match": "after"}}}
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"multiline":            {common.MapStr{"parsers": multiline}, true},
+		"split":                {common.MapStr{"split": "ndjson"}, true},
+		"split multiline":      {common.MapStr{"split": "ndjson", "parsers": multiline}, false},
+		"expand multiline":     {common.MapStr{"expand_event_list_from_field": "records", "parsers": multiline}, false},
+		"decompress multiline": {common.MapStr{"decompression": "gzip", "parsers": multiline}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":    "localhost:9092",
+				"topics":   "logs",
+				"group_id": "filebeat",
+			})
+			require.NoError(t, cfg.Merge(test.settings))
+
+			config := defaultConfig()
+			err := cfg.Unpack(&config)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestInitialOffsetConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"newest":                              {common.MapStr{"initial_offset": "newest"}, true},
+		"timestamp":                           {common.MapStr{"initial_offset": "timestamp", "initial_timestamp": "2026-10-16T08:00:00+02:00"}, true},
+		"timestamp without initial_timestamp": {common.MapStr{"initial_offset": "timestamp"}, false},
+		"invalid initial_timestamp":           {common.MapStr{"initial_offset": "timestamp", "initial_timestamp": "yesterday"}, false},
+		"timestamp with kafka 0.10.0": {common.MapStr{
+			"version":           "0.10.0",
+			"initial_offset":    "timestamp",
+			"initial_timestamp": "2026-10-16T08:00:00Z",
+		}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":    "localhost:9092",
+				"topics":   "logs",
+				"group_id": "filebeat",
+			})
+			require.NoError(t, cfg.Merge(test.settings))
+
+			config := defaultConfig()
+			err := cfg.Unpack(&config)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -22,9 +22,11 @@ package kafka
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -39,8 +41,14 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/avro"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/format"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/kafka"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
 )
 
 const (
@@ -266,6 +274,373 @@ func TestInputWithJsonPayload(t *testing.T) {
 	}
 }
 
+func TestInputWithSchemaRegistry(t *testing.T) {
+	testTopic := createTestTopicName()
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+
+	// Encode the message with the avro codec of the outputs.
+	config := schemaregistry.DefaultSerializerConfig()
+	config.Registry.URL = registry.URL
+	config.Subject = testTopic + "-value"
+	config.Schema = `{
+		"type": "record",
+		"name": "Log",
+		"fields": [
+			{"name": "val", "type": "string"},
+			{"name": "level", "type": ["null", "string"], "default": null}
+		]
+	}`
+	encoder, err := avro.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := encoder.Encode("", &beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"val": "val1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToKafkaTopic(t, testTopic, string(payload), nil, time.Second*20)
+
+	// Setup the input config
+	inputConfig := common.MustNewConfigFrom(common.MapStr{
+		"hosts":      getTestKafkaHost(),
+		"topics":     []string{testTopic},
+		"group_id":   "filebeat",
+		"wait_close": 0,
+		"parsers": []common.MapStr{
+			{
+				"schema_registry": common.MapStr{
+					"url": registry.URL,
+				},
+			},
+		},
+	})
+
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	events := client.Channel
+	input, cancel := run(t, inputConfig, client)
+
+	timeout := time.After(30 * time.Second)
+	select {
+	case event := <-events:
+		assert.Equal(t, "val1", event.Fields["val"])
+		assert.Nil(t, event.Fields["level"])
+		assert.NotContains(t, event.Fields, "message")
+	case <-timeout:
+		t.Fatal("timeout waiting for incoming events")
+	}
+
+	cancel()
+	// Close the done channel and make sure the beat shuts down in a reasonable
+	// amount of time.
+	didClose := make(chan struct{})
+	go func() {
+		input.Wait()
+		close(didClose)
+	}()
+
+	select {
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for beat to shut down")
+	case <-didClose:
+	}
+}
+
+func TestInputWithTopicsPattern(t *testing.T) {
+	prefix := createTestTopicName()
+	writeToKafkaTopic(t, prefix+"-a", "first topic", nil, time.Second*20)
+
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":                   getTestKafkaHost(),
+		"topics_pattern":          "^" + regexp.QuoteMeta(prefix),
+		"topics_refresh_interval": "1s",
+		"group_id":                "filebeat",
+		"wait_close":              0,
+	})
+
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	events := client.Channel
+	input, cancel := run(t, config, client)
+
+	received := func(text string) {
+		select {
+		case event := <-events:
+			message, err := event.Fields.GetValue("message")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, text, message)
+			event.Private.(eventMeta).ackHandler()
+		case <-time.After(30 * time.Second):
+			t.Fatalf("timeout waiting for %q", text)
+		}
+	}
+	received("first topic")
+
+	// a topic created while the input runs is joined without a restart
+	writeToKafkaTopic(t, prefix+"-b", "new topic", nil, time.Second*20)
+	received("new topic")
+
+	cancel()
+	didClose := make(chan struct{})
+	go func() {
+		input.Wait()
+		close(didClose)
+	}()
+
+	select {
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for beat to shut down")
+	case <-didClose:
+	}
+}
+
+func TestInputWithInitialTimestamp(t *testing.T) {
+	testTopic := createTestTopicName()
+	writeToKafkaTopic(t, testTopic, "before", nil, time.Second*20)
+	time.Sleep(2 * time.Second)
+	// second precision, after the first record and before the second one
+	start := time.Now().Add(-500 * time.Millisecond).Truncate(time.Second)
+	writeToKafkaTopic(t, testTopic, "after", nil, time.Second*20)
+
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":             getTestKafkaHost(),
+		"topics":            []string{testTopic},
+		"group_id":          "filebeat",
+		"initial_offset":    "timestamp",
+		"initial_timestamp": start.Format(time.RFC3339),
+		"wait_close":        0,
+	})
+
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	events := client.Channel
+	input, cancel := run(t, config, client)
+
+	select {
+	case event := <-events:
+		message, err := event.Fields.GetValue("message")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "after", message)
+		event.Private.(eventMeta).ackHandler()
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for incoming events")
+	}
+
+	// sarama commits every second
+	<-time.After(2 * time.Second)
+	cancel()
+	input.Wait()
+	assertOffset(t, "filebeat", testTopic, 2)
+}
+
+func TestInputWithTransactionalOutput(t *testing.T) {
+	source := createTestTopicName()
+	destination := source + "-relayed"
+	groupID := "filebeat-relay"
+	config := common.MustNewConfigFrom(common.MapStr{
+		"hosts":           getTestKafkaHost(),
+		"topics":          []string{source},
+		"group_id":        groupID,
+		"wait_close":      0,
+		"offset_commit":   "output",
+		"isolation_level": "read_committed",
+	})
+
+	first := []string{"first", "second", "third"}
+	for _, m := range first {
+		writeToKafkaTopic(t, source, m, nil, time.Second*20)
+	}
+	relayTransaction(t, config, groupID, destination, first)
+	assertOffset(t, groupID, source, int64(len(first)))
+
+	// A relay crashing in the middle of a batch leaves an open transaction,
+	// the restarted relay aborts it: its records and offsets are not
+	// committed and the restarted input resumes at the committed offset.
+	abandonTransaction(t, groupID, destination, "third")
+	second := []string{"fourth", "fifth", "sixth"}
+	for _, m := range second {
+		writeToKafkaTopic(t, source, m, nil, time.Second*20)
+	}
+	relayTransaction(t, config, groupID, destination, second)
+	assertOffset(t, groupID, source, int64(len(first)+len(second)))
+
+	want := append(first, second...)
+	relayed := readCommittedMessages(t, destination, len(want)+1, 10*time.Second)
+	var values []string
+	for _, msg := range relayed {
+		var event struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, event.Message)
+	}
+	assert.ElementsMatch(t, want, values, "each record is relayed exactly once")
+}
+
+// relayTransaction runs the input with a transactional kafka output relaying
+// the events to destination, until the messages are relayed.
+func relayTransaction(t *testing.T, config *common.Config, transactionalID, destination string, messages []string) {
+	client := beattest.NewChanClient(100)
+	defer client.Close()
+	input, cancel := run(t, config, client)
+
+	output, err := outputs.Load(nil, beat.Info{Beat: "filebeat", IndexPrefix: "filebeat"}, outputs.NewNilObserver(), "kafka",
+		common.MustNewConfigFrom(common.MapStr{
+			"hosts":            []string{getTestKafkaHost()},
+			"topic":            destination,
+			"version":          "2.1",
+			"transactional_id": transactionalID,
+			"backoff.init":     "100ms",
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := output.Clients[0].(outputs.NetworkClient)
+	if err := relay.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+
+	var events []beat.Event
+	for range messages {
+		select {
+		case event := <-client.Channel:
+			events = append(events, event)
+		case <-time.After(30 * time.Second):
+			t.Fatal("timeout waiting for incoming events")
+		}
+	}
+	var read []string
+	for _, event := range events {
+		message, _ := event.Fields.GetValue("message")
+		read = append(read, message.(string))
+	}
+	assert.Equal(t, messages, read, "the input reads from the committed offset")
+
+	// emulating the pipeline: the events are acked once their transaction is
+	// committed
+	batch := outest.NewBatch(events...)
+	if err := relay.Publish(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+	for _, event := range events {
+		event.Private.(eventMeta).ackHandler()
+	}
+
+	// the input does not commit, wait for a commit interval to make sure
+	<-time.After(2 * time.Second)
+	cancel()
+	didClose := make(chan struct{})
+	go func() {
+		input.Wait()
+		close(didClose)
+	}()
+	select {
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for beat to shut down")
+	case <-didClose:
+	}
+}
+
+// abandonTransaction emulates a relay crashing in the middle of a batch: it
+// writes values to partition 0 of topic in a transaction of transactionalID
+// and never ends the transaction.
+func abandonTransaction(t *testing.T, transactionalID, topic string, values ...string) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_1_0_0
+	client, err := sarama.NewClient([]string{getTestKafkaHost()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	leader, err := client.Leader(topic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := leader.FindCoordinator(&sarama.FindCoordinatorRequest{
+		Version:         1,
+		CoordinatorKey:  transactionalID,
+		CoordinatorType: sarama.CoordinatorTransaction,
+	})
+	if err != nil || found.Err != sarama.ErrNoError {
+		t.Fatal("finding the transaction coordinator", err, found.Err)
+	}
+	coordinator := found.Coordinator
+	if err := coordinator.Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer coordinator.Close()
+
+	producer, err := coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+		TransactionalID:    &transactionalID,
+		TransactionTimeout: time.Minute,
+	})
+	if err != nil || producer.Err != sarama.ErrNoError {
+		t.Fatal("initializing the producer", err, producer.Err)
+	}
+	added, err := coordinator.AddPartitionsToTxn(&sarama.AddPartitionsToTxnRequest{
+		TransactionalID: transactionalID,
+		ProducerID:      producer.ProducerID,
+		ProducerEpoch:   producer.ProducerEpoch,
+		TopicPartitions: map[string][]int32{topic: {0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, errs := range added.Errors {
+		for _, e := range errs {
+			if e.Err != sarama.ErrNoError {
+				t.Fatal("adding the partition to the transaction", e.Err)
+			}
+		}
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	batch := &sarama.RecordBatch{
+		Version:         2,
+		ProducerID:      producer.ProducerID,
+		ProducerEpoch:   producer.ProducerEpoch,
+		IsTransactional: true,
+		FirstTimestamp:  now,
+		MaxTimestamp:    now,
+		LastOffsetDelta: int32(len(values) - 1),
+	}
+	for i, value := range values {
+		batch.Records = append(batch.Records, &sarama.Record{
+			OffsetDelta: int64(i),
+			Value:       []byte(`{"message":"` + value + `"}`),
+		})
+	}
+	req := &sarama.ProduceRequest{
+		TransactionalID: &transactionalID,
+		RequiredAcks:    sarama.WaitForAll,
+		Timeout:         10000,
+		Version:         3,
+	}
+	req.AddBatch(topic, 0, batch)
+	resp, err := leader.Produce(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block := resp.GetBlock(topic, 0); block == nil || block.Err != sarama.ErrNoError {
+		t.Fatal("producing the abandoned records", block)
+	}
+}
+
 func TestInputWithJsonPayloadAndMultipleEvents(t *testing.T) {
 	testTopic := createTestTopicName()
 
@@ -465,6 +840,49 @@ func assertOffset(t *testing.T, groupID, topic string, expected int64) {
 	assert.Equal(t, expected, offsetSum, "offset does not match, perhaps messages were not acknowledged")
 }
 
+// readCommittedMessages reads the records of committed transactions of a
+// topic.
+func readCommittedMessages(t *testing.T, topic string, n int, timeout time.Duration) []*sarama.ConsumerMessage {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_1_0_0
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	consumer, err := sarama.NewConsumer([]string{getTestKafkaHost()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make(chan *sarama.ConsumerMessage, n)
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		go func() {
+			for msg := range pc.Messages() {
+				msgs <- msg
+			}
+		}()
+	}
+
+	var messages []*sarama.ConsumerMessage
+	deadline := time.After(timeout)
+	for len(messages) < n {
+		select {
+		case msg := <-msgs:
+			messages = append(messages, msg)
+		case <-deadline:
+			return messages
+		}
+	}
+	return messages
+}
+
 func writeToKafkaTopic(
 	t *testing.T, topic string, message string,
 	headers []sarama.RecordHeader, timeout time.Duration,
@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// partitionMetrics is the dataset namespace, served by the HTTP stats
+// endpoint under /dataset.
+var partitionMetrics = monitoring.GetNamespace("dataset").GetRegistry()
+
+// pendingOffset is a message of the partition with events not yet acked.
+type pendingOffset struct {
+	offset int64
+	events int
+}
+
+// partitionTracker commits the offsets of one claimed partition in order:
+// an offset is only marked once all events of it and of every earlier
+// message are acked, so a crash never skips unacked messages. It also bounds
+// the events of the partition in flight in the pipeline.
+type partitionTracker struct {
+	sync.Mutex
+	session   sarama.ConsumerGroupSession
+	topic     string
+	partition int32
+	pending   []pendingOffset
+	slots     chan struct{} // nil when in flight events are unbounded
+
+	// markOffsets is false when the output commits the offsets, the acked
+	// offsets are then only reported in the metrics.
+	markOffsets bool
+
+	// failure stops committing offsets, set when an event of the partition
+	// could not be acked.
+	failure error
+
+	id             string
+	inFlight       *monitoring.Int
+	committed      *monitoring.Int
+	highWatermark  *monitoring.Int
+	lag            *monitoring.Int
+	committedValue int64
+}
+
+func newPartitionTracker(
+	session sarama.ConsumerGroupSession,
+	groupID, topic string,
+	partition int32,
+	initialOffset int64,
+	maxInFlight int,
+) *partitionTracker {
+	t := &partitionTracker{
+		session:        session,
+		topic:          topic,
+		partition:      partition,
+		markOffsets:    true,
+		id:             partitionMetricsID(groupID, topic, partition),
+		committedValue: -1,
+	}
+	if maxInFlight > 0 {
+		t.slots = make(chan struct{}, maxInFlight)
+	}
+	// Offsets below zero are the oldest and newest sentinels of a partition
+	// without a committed offset.
+	if initialOffset >= 0 {
+		t.committedValue = initialOffset
+	}
+
+	// A partition claimed again after a rebalance replaces its old metrics.
+	partitionMetrics.Remove(t.id)
+	reg := partitionMetrics.NewRegistry(t.id)
+	monitoring.NewString(reg, "input").Set(pluginName)
+	monitoring.NewString(reg, "group_id").Set(groupID)
+	monitoring.NewString(reg, "topic").Set(topic)
+	monitoring.NewInt(reg, "partition").Set(int64(partition))
+	t.inFlight = monitoring.NewInt(reg, "in_flight")
+	t.committed = monitoring.NewInt(reg, "committed_offset")
+	t.highWatermark = monitoring.NewInt(reg, "high_watermark")
+	t.lag = monitoring.NewInt(reg, "lag")
+	t.committed.Set(t.committedValue)
+	return t
+}
+
+// partitionMetricsID names the metrics of a partition, in the dataset
+// namespace.
+func partitionMetricsID(groupID, topic string, partition int32) string {
+	return fmt.Sprintf("kafka-%s-%s-%d", escapeMetricsName(groupID), escapeMetricsName(topic), partition)
+}
+
+// escapeMetricsName percent-encodes the characters splitting registry names
+// and the ids of the partition and throttle metrics, so that distinct names
+// never collide.
+func escapeMetricsName(name string) string {
+	return metricsNameEscaper.Replace(name)
+}
+
+var metricsNameEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "-", "%2D")
+
+// acquire reserves a slot for an event, blocking while the partition has
+// max_in_flight_per_partition events in flight. It returns false once ctx
+// is done.
+func (t *partitionTracker) acquire(ctx context.Context) bool {
+	if t.slots == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case t.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// add records an event of the message at offset about to be published,
+// events is the number of events split from the message. The message is
+// pending until all of them are acked, even if the first ones are acked
+// before the others are published. Offsets of a partition are added in
+// increasing order.
+func (t *partitionTracker) add(offset int64, events int, highWatermark int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	n := len(t.pending)
+	if n == 0 || t.pending[n-1].offset != offset {
+		t.pending = append(t.pending, pendingOffset{offset: offset, events: events})
+		if t.committedValue < 0 && n == 0 {
+			t.committedValue = offset
+			t.committed.Set(offset)
+		}
+	}
+	t.inFlight.Inc()
+	t.highWatermark.Set(highWatermark)
+	t.updateLag()
+}
+
+// ack acknowledges an event of the message at offset, marking the offset
+// following the acked prefix of the pending messages.
+func (t *partitionTracker) ack(offset int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.slots != nil {
+		<-t.slots
+	}
+	t.inFlight.Dec()
+
+	if t.failure != nil {
+		return
+	}
+
+	for i := range t.pending {
+		if t.pending[i].offset == offset {
+			t.pending[i].events--
+			break
+		}
+	}
+
+	acked := 0
+	for acked < len(t.pending) && t.pending[acked].events <= 0 {
+		acked++
+	}
+	if acked == 0 {
+		return
+	}
+
+	next := t.pending[acked-1].offset + 1
+	t.pending = t.pending[acked:]
+	if t.markOffsets {
+		t.session.MarkOffset(t.topic, t.partition, next, "")
+	}
+	t.committedValue = next
+	t.committed.Set(next)
+	t.updateLag()
+}
+
+// fail stops committing the offsets of the partition, the records from the
+// last committed offset on are read again once the partition is claimed
+// again.
+func (t *partitionTracker) fail(err error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.failure == nil {
+		t.failure = err
+	}
+}
+
+// err returns the error the partition failed with.
+func (t *partitionTracker) err() error {
+	t.Lock()
+	defer t.Unlock()
+	return t.failure
+}
+
+func (t *partitionTracker) updateLag() {
+	if t.committedValue < 0 {
+		return
+	}
+	lag := t.highWatermark.Get() - t.committedValue
+	if lag < 0 {
+		lag = 0
+	}
+	t.lag.Set(lag)
+}
+
+// close removes the metrics of the partition once it is no longer claimed.
+func (t *partitionTracker) close() {
+	partitionMetrics.Remove(t.id)
+}
@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+type markingSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *markingSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.marked = append(s.marked, offset)
+}
+
+func TestPartitionTrackerOrderedCommits(t *testing.T) {
+	session := &markingSession{}
+	tracker := newPartitionTracker(session, "group", "logs.app", 3, sarama.OffsetOldest, 0)
+	defer tracker.close()
+
+	reg := partitionMetrics.GetRegistry("kafka-group-logs%2Eapp-3")
+	if !assert.NotNil(t, reg) {
+		return
+	}
+
+	// offset 11 holds two events, as with expand_event_list_from_field
+	for _, offset := range []int64{10, 11, 11, 12} {
+		events := 1
+		if offset == 11 {
+			events = 2
+		}
+		tracker.add(offset, events, 20)
+	}
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(4), snapshot.Ints["in_flight"])
+	assert.Equal(t, int64(10), snapshot.Ints["committed_offset"])
+	assert.Equal(t, int64(10), snapshot.Ints["lag"])
+	assert.Equal(t, "logs.app", snapshot.Strings["topic"])
+
+	tracker.ack(11)
+	tracker.ack(12)
+	assert.Empty(t, session.marked, "nothing is committed before offset 10 is acked")
+
+	tracker.ack(10)
+	assert.Equal(t, []int64{11}, session.marked, "offset 11 still has an event in flight")
+
+	tracker.ack(11)
+	assert.Equal(t, []int64{11, 13}, session.marked)
+
+	snapshot = monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(0), snapshot.Ints["in_flight"])
+	assert.Equal(t, int64(13), snapshot.Ints["committed_offset"])
+	assert.Equal(t, int64(20), snapshot.Ints["high_watermark"])
+	assert.Equal(t, int64(7), snapshot.Ints["lag"])
+
+	tracker.close()
+	assert.Nil(t, partitionMetrics.GetRegistry("kafka-group-logs%2Eapp-3"))
+}
+
+func TestPartitionMetricsID(t *testing.T) {
+	ids := map[string]bool{}
+	for _, name := range [][2]string{
+		{"group", "app.logs"},
+		{"group", "app_logs"},
+		{"group-app", "logs"},
+		{"group", "app-logs"},
+	} {
+		id := partitionMetricsID(name[0], name[1], 3)
+		assert.NotContains(t, id, ".")
+		assert.False(t, ids[id], "duplicate id %v", id)
+		ids[id] = true
+	}
+	assert.Equal(t, "kafka-filebeat-app%2Elogs-3", partitionMetricsID("filebeat", "app.logs", 3))
+}
+
+func TestPartitionTrackerFail(t *testing.T) {
+	session := &markingSession{}
+	tracker := newPartitionTracker(session, "group", "logs", 0, 10, 0)
+	defer tracker.close()
+
+	tracker.add(10, 1, 20)
+	tracker.add(11, 1, 20)
+	tracker.ack(10)
+	assert.Equal(t, []int64{11}, session.marked)
+
+	failure := errors.New("dead letter queue unavailable")
+	tracker.fail(failure)
+	tracker.ack(11)
+	assert.Equal(t, []int64{11}, session.marked, "no offset is committed once the partition failed")
+	assert.Equal(t, failure, tracker.err())
+}
+
+func TestPartitionTrackerMaxInFlight(t *testing.T) {
+	tracker := newPartitionTracker(&markingSession{}, "group", "logs", 0, 5, 2)
+	defer tracker.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.True(t, tracker.acquire(ctx))
+	tracker.add(5, 1, 10)
+	assert.True(t, tracker.acquire(ctx))
+	tracker.add(6, 1, 10)
+
+	acquired := make(chan bool)
+	go func() { acquired <- tracker.acquire(ctx) }()
+	tracker.ack(5)
+	assert.True(t, <-acquired, "an ack releases a slot")
+
+	go func() { acquired <- tracker.acquire(ctx) }()
+	cancel()
+	assert.False(t, <-acquired, "a full partition stops waiting when the session ends")
+}
+
+func TestPartitionTrackerSplitRecord(t *testing.T) {
+	session := &markingSession{}
+	tracker := newPartitionTracker(session, "group", "logs", 1, 3, 0)
+	defer tracker.close()
+
+	// the first event of a batch is acked before the second is published
+	tracker.add(3, 2, 10)
+	tracker.ack(3)
+	assert.Empty(t, session.marked)
+
+	tracker.add(3, 2, 10)
+	tracker.ack(3)
+	assert.Equal(t, []int64{4}, session.marked)
+}
+
+func TestMessageMeta(t *testing.T) {
+	meta, err := messageMeta(reader.Message{Private: eventMeta{offset: 7, events: 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, eventMeta{offset: 7, events: 3}, meta)
+
+	// multiline keeps the fields of the last message only
+	meta, err = messageMeta(reader.Message{Fields: common.MapStr{"kafka": common.MapStr{"offset": int64(9)}}})
+	assert.NoError(t, err)
+	assert.Equal(t, eventMeta{offset: 9, events: 1}, meta)
+
+	_, err = messageMeta(reader.Message{})
+	assert.Error(t, err)
+}
+
+func TestOffsetCommitOutput(t *testing.T) {
+	session := &markingSession{}
+	tracker := newPartitionTracker(session, "relay", "logs", 0, 3, 0)
+	tracker.markOffsets = false
+	defer tracker.close()
+
+	tracker.add(3, 1, 10)
+	tracker.ack(3)
+	assert.Empty(t, session.marked, "the output commits the offsets")
+
+	handler := &groupHandler{groupID: "relay", commit: offsetCommitOutput}
+	claim := &testClaim{}
+	for index, expected := range []int64{7, 8} {
+		meta := eventMeta{offset: 7, events: 2, index: index}
+		meta.consumerOffset = handler.consumerOffset(claim, meta)
+		offset, ok := meta.ConsumerOffset()
+		assert.True(t, ok)
+		assert.Equal(t, kafka.ConsumerOffset{GroupID: "relay", Topic: "logs", Partition: 0, Offset: expected}, offset,
+			"the offset following a split record is committed with its last event")
+	}
+
+	_, ok := eventMeta{offset: 7, events: 1}.ConsumerOffset()
+	assert.False(t, ok)
+}
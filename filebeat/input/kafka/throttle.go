@@ -0,0 +1,337 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/time/rate"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+type throttleBy int
+
+const (
+	throttleByTopic  throttleBy = iota // the tenant of a record is its topic
+	throttleByHeader                   // the value of the header named by throttle.header
+	throttleByKey                      // the key of the record
+)
+
+var throttleBys = map[string]throttleBy{
+	"topic":  throttleByTopic,
+	"header": throttleByHeader,
+	"key":    throttleByKey,
+}
+
+// Unpack validates and unpack the "throttle.by" config option
+func (b *throttleBy) Unpack(value string) error {
+	by, ok := throttleBys[value]
+	if !ok {
+		return fmt.Errorf("invalid throttle by '%s'", value)
+	}
+	*b = by
+	return nil
+}
+
+// throttleConfig limits the rate of the records read for each tenant. A
+// limit of 0 is unlimited.
+type throttleConfig struct {
+	By               throttleBy             `config:"by"`
+	Header           string                 `config:"header"`
+	RecordsPerSecond float64                `config:"records_per_second"`
+	BytesPerSecond   cfgtype.ByteSize       `config:"bytes_per_second"`
+	Tenants          []tenantThrottleConfig `config:"tenants"`
+}
+
+// tenantThrottleConfig replaces the limits of a tenant, the unset ones are
+// the limits of all the tenants.
+type tenantThrottleConfig struct {
+	Value            string            `config:"value" validate:"required"`
+	RecordsPerSecond *float64          `config:"records_per_second"`
+	BytesPerSecond   *cfgtype.ByteSize `config:"bytes_per_second"`
+}
+
+func (c *throttleConfig) Validate() error {
+	if c.By == throttleByHeader && c.Header == "" {
+		return errors.New("throttle.header must be set with throttle.by: header")
+	}
+	if c.By != throttleByHeader && c.Header != "" {
+		return errors.New("throttle.header requires throttle.by: header")
+	}
+
+	limited := c.RecordsPerSecond > 0 || c.BytesPerSecond > 0
+	if c.RecordsPerSecond < 0 {
+		return errors.New("throttle limits must not be negative")
+	}
+	for _, tenant := range c.Tenants {
+		if tenant.RecordsPerSecond != nil {
+			if *tenant.RecordsPerSecond < 0 {
+				return fmt.Errorf("throttle limits of tenant '%s' must not be negative", tenant.Value)
+			}
+			limited = limited || *tenant.RecordsPerSecond > 0
+		}
+		if tenant.BytesPerSecond != nil {
+			limited = limited || *tenant.BytesPerSecond > 0
+		}
+	}
+	if !limited {
+		return errors.New("throttle requires records_per_second or bytes_per_second")
+	}
+	return nil
+}
+
+// tenantIdleTimeout is how long the limiters of a tenant without records are
+// kept. The bursts are the limits of one second, so the limiters of a tenant
+// idle for longer are full and dropping them changes nothing.
+const tenantIdleTimeout = time.Minute
+
+// throttle delays the records of the tenants reading faster than their
+// limits. The reader of a partition waits for the records of the partition
+// in order, so a throttled tenant pauses the partitions holding its records:
+// sarama stops fetching a partition whose records are not consumed and
+// resumes once they are. Other partitions are not affected. It is nil when
+// throttle is not configured.
+type throttle struct {
+	config  *throttleConfig
+	groupID string
+
+	mu      sync.Mutex
+	tenants map[string]*tenantThrottle
+	metrics map[string]*throttleMetrics // of the configured tenants
+	others  *throttleMetrics            // of all the other tenants
+	swept   time.Time
+}
+
+// tenantThrottle are the limiters of a tenant, nil when unlimited.
+type tenantThrottle struct {
+	records *rate.Limiter
+	bytes   *rate.Limiter
+	metrics *throttleMetrics
+
+	configured bool
+	idleSince  time.Time // end of the last delay, guarded by throttle.mu
+}
+
+// throttleMetrics are the metrics of a tenant listed in throttle.tenants, or
+// of all the other tenants together.
+type throttleMetrics struct {
+	id           string
+	throttled    *monitoring.Int // records delayed
+	throttleTime *monitoring.Int // total delay in milliseconds
+	paused       *monitoring.Int // partitions waiting for the tenant
+}
+
+func newThrottle(config *throttleConfig, groupID string) *throttle {
+	if config == nil {
+		return nil
+	}
+	return &throttle{
+		config:  config,
+		groupID: groupID,
+		tenants: map[string]*tenantThrottle{},
+		metrics: map[string]*throttleMetrics{},
+		swept:   time.Now(),
+	}
+}
+
+// wait blocks until the record can be read within the limits of its tenant.
+// It returns the error of ctx if ctx is done first.
+func (t *throttle) wait(ctx context.Context, record *sarama.ConsumerMessage) error {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	tenant := t.tenant(t.tenantOf(record), now)
+
+	var (
+		delay        time.Duration
+		reservations []*rate.Reservation
+	)
+	reserve := func(limiter *rate.Limiter, n int) {
+		if limiter == nil {
+			return
+		}
+		// a record larger than the burst takes the whole burst
+		if n > limiter.Burst() {
+			n = limiter.Burst()
+		}
+		r := limiter.ReserveN(now, n)
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	reserve(tenant.records, 1)
+	reserve(tenant.bytes, len(record.Key)+len(record.Value))
+	if delay <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	if until := now.Add(delay); until.After(tenant.idleSince) {
+		tenant.idleSince = until
+	}
+	t.mu.Unlock()
+
+	metrics := tenant.metrics
+	metrics.throttled.Inc()
+	metrics.paused.Inc()
+	defer metrics.paused.Dec()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		for _, r := range reservations {
+			r.Cancel()
+		}
+		return ctx.Err()
+	case <-timer.C:
+		metrics.throttleTime.Add(delay.Milliseconds())
+		return nil
+	}
+}
+
+// tenantOf returns the tenant of a record.
+func (t *throttle) tenantOf(record *sarama.ConsumerMessage) string {
+	switch t.config.By {
+	case throttleByHeader:
+		for _, h := range record.Headers {
+			if h != nil && string(h.Key) == t.config.Header {
+				return string(h.Value)
+			}
+		}
+		return ""
+	case throttleByKey:
+		return string(record.Key)
+	default:
+		return record.Topic
+	}
+}
+
+// tenant returns the limiters of a tenant, created with its first record.
+// The limiters of the tenants not listed in throttle.tenants are dropped once
+// idle, so that the tenants of by: key do not pile up.
+func (t *throttle) tenant(value string, now time.Time) *tenantThrottle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.swept) >= tenantIdleTimeout {
+		for v, tenant := range t.tenants {
+			if !tenant.configured && now.Sub(tenant.idleSince) >= tenantIdleTimeout {
+				delete(t.tenants, v)
+			}
+		}
+		t.swept = now
+	}
+
+	if tenant, ok := t.tenants[value]; ok {
+		if now.After(tenant.idleSince) {
+			tenant.idleSince = now
+		}
+		return tenant
+	}
+
+	tenant := &tenantThrottle{idleSince: now}
+	records, bytes := t.config.RecordsPerSecond, t.config.BytesPerSecond
+	for _, c := range t.config.Tenants {
+		if c.Value != value {
+			continue
+		}
+		tenant.configured = true
+		if c.RecordsPerSecond != nil {
+			records = *c.RecordsPerSecond
+		}
+		if c.BytesPerSecond != nil {
+			bytes = *c.BytesPerSecond
+		}
+	}
+
+	// the bursts are the limits of one second
+	if records > 0 {
+		tenant.records = rate.NewLimiter(rate.Limit(records), int(math.Ceil(records)))
+	}
+	if bytes > 0 {
+		tenant.bytes = rate.NewLimiter(rate.Limit(bytes), int(bytes))
+	}
+
+	if tenant.configured {
+		tenant.metrics = t.newMetrics(value, true)
+		t.metrics[value] = tenant.metrics
+	} else {
+		if t.others == nil {
+			t.others = t.newMetrics("", false)
+		}
+		tenant.metrics = t.others
+	}
+
+	t.tenants[value] = tenant
+	return tenant
+}
+
+// newMetrics registers the metrics of a configured tenant, or of the other
+// tenants when configured is false.
+func (t *throttle) newMetrics(value string, configured bool) *throttleMetrics {
+	id := throttleMetricsID(t.groupID)
+	if configured {
+		id += "-" + escapeMetricsName(value)
+	}
+	partitionMetrics.Remove(id)
+	reg := partitionMetrics.NewRegistry(id)
+	monitoring.NewString(reg, "input").Set(pluginName)
+	monitoring.NewString(reg, "group_id").Set(t.groupID)
+	if configured {
+		monitoring.NewString(reg, "tenant").Set(value)
+	}
+	return &throttleMetrics{
+		id:           id,
+		throttled:    monitoring.NewInt(reg, "throttled_records"),
+		throttleTime: monitoring.NewInt(reg, "throttle_time_ms"),
+		paused:       monitoring.NewInt(reg, "paused_partitions"),
+	}
+}
+
+// close removes the metrics of the tenants.
+func (t *throttle) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, metrics := range t.metrics {
+		partitionMetrics.Remove(metrics.id)
+	}
+	if t.others != nil {
+		partitionMetrics.Remove(t.others.id)
+	}
+}
+
+// throttleMetricsID names the metrics of the tenants of a group, in the
+// dataset namespace with the metrics of the partitions. The metrics of a
+// configured tenant add "-<tenant>".
+func throttleMetricsID(groupID string) string {
+	return "kafka-" + escapeMetricsName(groupID) + "-throttle"
+}
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+func TestThrottleConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"by topic": {common.MapStr{"records_per_second": 100}, true},
+		"by header": {common.MapStr{
+			"by":               "header",
+			"header":           "tenant",
+			"bytes_per_second": "1MiB",
+		}, true},
+		"tenant limits only": {common.MapStr{
+			"by":      "key",
+			"tenants": []common.MapStr{{"value": "noisy", "records_per_second": 10}},
+		}, true},
+		"invalid by":            {common.MapStr{"by": "partition", "records_per_second": 100}, false},
+		"header without by":     {common.MapStr{"header": "tenant", "records_per_second": 100}, false},
+		"by header no header":   {common.MapStr{"by": "header", "records_per_second": 100}, false},
+		"no limits":             {common.MapStr{"by": "topic"}, false},
+		"negative limit":        {common.MapStr{"records_per_second": -1}, false},
+		"tenant without value":  {common.MapStr{"tenants": []common.MapStr{{"records_per_second": 10}}}, false},
+		"tenant negative limit": {common.MapStr{"records_per_second": 100, "tenants": []common.MapStr{{"value": "a", "records_per_second": -1}}}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":    "localhost:9092",
+				"topics":   "logs",
+				"group_id": "filebeat",
+				"throttle": test.settings,
+			})
+
+			config := defaultConfig()
+			err := cfg.Unpack(&config)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestThrottleWait(t *testing.T) {
+	records := 2.0
+	throttle := newThrottle(&throttleConfig{
+		By:               throttleByHeader,
+		Header:           "tenant",
+		RecordsPerSecond: 1000,
+		Tenants:          []tenantThrottleConfig{{Value: "noisy", RecordsPerSecond: &records}},
+	}, "group")
+	defer throttle.close()
+
+	record := func(tenant string) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{
+			Topic:   "logs",
+			Headers: []*sarama.RecordHeader{{Key: []byte("tenant"), Value: []byte(tenant)}},
+		}
+	}
+	ctx := context.Background()
+
+	// the burst of the noisy tenant is read without delay, the next record
+	// waits for the limit
+	start := time.Now()
+	require.NoError(t, throttle.wait(ctx, record("noisy")))
+	require.NoError(t, throttle.wait(ctx, record("noisy")))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	require.NoError(t, throttle.wait(ctx, record("noisy")))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// other tenants are not delayed by the noisy one
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, throttle.wait(ctx, record("quiet")))
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	reg := partitionMetrics.GetRegistry("kafka-group-throttle-noisy")
+	require.NotNil(t, reg)
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, "noisy", snapshot.Strings["tenant"])
+	assert.Equal(t, int64(1), snapshot.Ints["throttled_records"])
+	assert.Greater(t, snapshot.Ints["throttle_time_ms"], int64(0))
+	assert.Equal(t, int64(0), snapshot.Ints["paused_partitions"])
+
+	// the other tenants share their metrics
+	reg = partitionMetrics.GetRegistry("kafka-group-throttle")
+	require.NotNil(t, reg)
+	snapshot = monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, "group", snapshot.Strings["group_id"])
+	assert.NotContains(t, snapshot.Strings, "tenant")
+	assert.Equal(t, int64(0), snapshot.Ints["throttled_records"])
+
+	// a throttled record returns once the claim ends
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, throttle.wait(ctx, record("noisy")))
+
+	throttle.close()
+	assert.Nil(t, partitionMetrics.GetRegistry("kafka-group-throttle-noisy"))
+	assert.Nil(t, partitionMetrics.GetRegistry("kafka-group-throttle"))
+}
+
+func TestThrottleIdleTenants(t *testing.T) {
+	records := 2.0
+	throttle := newThrottle(&throttleConfig{
+		By:               throttleByKey,
+		RecordsPerSecond: 1,
+		Tenants:          []tenantThrottleConfig{{Value: "vip", RecordsPerSecond: &records}},
+	}, "group")
+	defer throttle.close()
+
+	start := time.Now()
+	vip := throttle.tenant("vip", start)
+	for i := 0; i < 100; i++ {
+		throttle.tenant(fmt.Sprintf("vehicle-%d", i), start)
+	}
+	assert.Len(t, throttle.tenants, 101)
+	assert.Same(t, throttle.tenant("vehicle-0", start).metrics, throttle.tenant("vehicle-1", start).metrics)
+
+	// a tenant throttled until later is kept, the configured tenants are
+	// always kept
+	throttle.tenant("vehicle-0", start).idleSince = start.Add(tenantIdleTimeout)
+	throttle.tenant("recent", start.Add(tenantIdleTimeout))
+	assert.Len(t, throttle.tenants, 3)
+	assert.Same(t, vip, throttle.tenants["vip"])
+	assert.Contains(t, throttle.tenants, "vehicle-0")
+	assert.Contains(t, throttle.tenants, "recent")
+}
+
+func TestThrottleMetricsID(t *testing.T) {
+	ids := map[string]bool{}
+	for _, name := range [][2]string{
+		{"group", "app.logs"},
+		{"group", "app_logs"},
+		{"group", "app%2Elogs"},
+		{"group-throttle", "app"},
+		{"group", "throttle-app"},
+	} {
+		id := throttleMetricsID(name[0]) + "-" + escapeMetricsName(name[1])
+		assert.NotContains(t, id, ".")
+		assert.False(t, ids[id], "duplicate id %v", id)
+		ids[id] = true
+	}
+	assert.Equal(t, "kafka-filebeat%2Dlogs-throttle-app%2Elogs", throttleMetricsID("filebeat-logs")+"-"+escapeMetricsName("app.logs"))
+}
+
+func TestThrottleTenant(t *testing.T) {
+	record := &sarama.ConsumerMessage{
+		Topic:   "logs",
+		Key:     []byte("vid"),
+		Headers: []*sarama.RecordHeader{{Key: []byte("service"), Value: []byte("api")}},
+	}
+	for by, tenant := range map[throttleBy]string{
+		throttleByTopic:  "logs",
+		throttleByKey:    "vid",
+		throttleByHeader: "api",
+	} {
+		throttle := newThrottle(&throttleConfig{By: by, Header: "service"}, "group")
+		assert.Equal(t, tenant, throttle.tenantOf(record))
+	}
+}
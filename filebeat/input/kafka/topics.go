@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// topicWatcher resolves the topics consumed by the input: the configured
+// topics and, with topics_pattern, the topics of the cluster matching it.
+type topicWatcher struct {
+	static   []string
+	pattern  *match.Matcher
+	interval time.Duration
+	log      *logp.Logger
+
+	// metadata client, connected by the first refresh of a pattern
+	mu           sync.Mutex
+	hosts        []string
+	saramaConfig *sarama.Config
+	client       sarama.Client
+}
+
+// dynamic reports whether the topics can change while the input runs.
+func (w *topicWatcher) dynamic() bool {
+	return w.pattern != nil
+}
+
+// topics returns the sorted topics to consume.
+func (w *topicWatcher) topics() ([]string, error) {
+	if !w.dynamic() {
+		return matchTopics(w.static, nil, nil), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.client == nil {
+		client, err := sarama.NewClient(w.hosts, w.saramaConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "initializing kafka metadata client")
+		}
+		w.client = client
+	}
+	if err := w.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	available, err := w.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+	return matchTopics(w.static, w.pattern, available), nil
+}
+
+// watch refreshes the topics every interval and calls changed once they
+// differ from current, ending the consumer group session so that it joins
+// the new topics and leaves the deleted ones. It returns when ctx is done.
+func (w *topicWatcher) watch(ctx context.Context, current []string, changed func()) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		topics, err := w.topics()
+		if err != nil {
+			w.log.Errorw("Error refreshing kafka topics", "error", err)
+			continue
+		}
+		if !equalTopics(topics, current) {
+			w.log.Infow("Kafka topics changed", "topics", topics, "previous", current)
+			changed()
+			return
+		}
+	}
+}
+
+func (w *topicWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.client != nil {
+		w.client.Close()
+	}
+}
+
+// matchTopics returns the sorted union of the static topics and of the
+// available topics matching pattern. Internal topics such as
+// __consumer_offsets are never matched.
+func matchTopics(static []string, pattern *match.Matcher, available []string) []string {
+	set := make(map[string]struct{}, len(static))
+	for _, topic := range static {
+		set[topic] = struct{}{}
+	}
+	if pattern != nil {
+		for _, topic := range available {
+			if !strings.HasPrefix(topic, "__") && pattern.MatchString(topic) {
+				set[topic] = struct{}{}
+			}
+		}
+	}
+
+	topics := make([]string, 0, len(set))
+	for topic := range set {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+func mockMetadata(t *testing.T, broker *sarama.MockBroker, topics ...string) {
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetController(broker.BrokerID())
+	for _, topic := range topics {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{"MetadataRequest": metadata})
+}
+
+func TestTopicWatcher(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	mockMetadata(t, broker, "log-billing", "log-auth", "metrics", "__consumer_offsets")
+
+	config := sarama.NewConfig()
+	config.Metadata.Retry.Max = 0
+	pattern := match.MustCompile(`^log-`)
+	watcher := &topicWatcher{
+		static:       []string{"audit"},
+		pattern:      &pattern,
+		interval:     10 * time.Millisecond,
+		hosts:        []string{broker.Addr()},
+		saramaConfig: config,
+		log:          logp.NewLogger("kafka test"),
+	}
+	defer watcher.close()
+
+	topics, err := watcher.topics()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"audit", "log-auth", "log-billing"}, topics)
+
+	// unchanged topics keep the session
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	watcher.watch(ctx, topics, func() { t.Error("topics did not change") })
+
+	// a new service topic is created and log-auth is deleted
+	mockMetadata(t, broker, "log-billing", "log-search", "metrics")
+	changed := make(chan struct{})
+	go watcher.watch(context.Background(), topics, func() { close(changed) })
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new topic not discovered")
+	}
+
+	topics, err = watcher.topics()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"audit", "log-billing", "log-search"}, topics)
+}
+
+func TestTopicsConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"topics":         {common.MapStr{"topics": "logs"}, true},
+		"topics_pattern": {common.MapStr{"topics_pattern": "^log-"}, true},
+		"none":           {common.MapStr{}, false},
+		"zero refresh":   {common.MapStr{"topics_pattern": "^log-", "topics_refresh_interval": 0}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(common.MapStr{
+				"hosts":    "localhost:9092",
+				"group_id": "filebeat",
+			})
+			require.NoError(t, cfg.Merge(test.settings))
+
+			config := defaultConfig()
+			err := cfg.Unpack(&config)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -43,6 +43,14 @@ const (
 	// Bulk API encoding of the event. The key's value can be an empty string, `create`, `index`, or `delete`.
 	// If empty, `create` will be used if FieldMetaID is set; otherwise `index` will be used.
 	FieldMetaOpType = "op_type"
+
+	// FieldMetaRouting defines the routing value of the event, to store the
+	// events sharing it in the same shard.
+	FieldMetaRouting = "routing"
+
+	// FieldMetaRequireAlias requires the index of the event to be an alias,
+	// for the Elasticsearch Bulk API to fail instead of creating the index.
+	FieldMetaRequireAlias = "require_alias"
 )
 
 // GetMetaStringValue returns the value of the given event metadata string field
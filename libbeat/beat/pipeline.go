@@ -136,6 +136,14 @@ type ClientEventer interface {
 	DroppedOnPublish(Event) // event has been dropped, while waiting for the queue
 }
 
+// ProcessingErrorEventer is an optional interface of a ClientEventer, it is
+// informed of the events dropped because a processor failed, before the
+// event is reported to the ACKer. Inputs can use it to route the events to a
+// dead letter queue.
+type ProcessingErrorEventer interface {
+	ProcessingFailed(Event, error) // event has been dropped by a failing processor
+}
+
 type ProcessorList interface {
 	Processor
 	Close() error
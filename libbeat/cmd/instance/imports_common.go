@@ -32,17 +32,21 @@ import (
 	_ "github.com/elastic/beats/v7/libbeat/processors/convert"
 	_ "github.com/elastic/beats/v7/libbeat/processors/decode_xml"
 	_ "github.com/elastic/beats/v7/libbeat/processors/decode_xml_wineventlog"
+	_ "github.com/elastic/beats/v7/libbeat/processors/dispatch"
 	_ "github.com/elastic/beats/v7/libbeat/processors/dissect"
+	_ "github.com/elastic/beats/v7/libbeat/processors/dissect_filename"
 	_ "github.com/elastic/beats/v7/libbeat/processors/dns"
 	_ "github.com/elastic/beats/v7/libbeat/processors/extract_array"
 	_ "github.com/elastic/beats/v7/libbeat/processors/fingerprint"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_cdc_alog"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_filebeat_log"
+	_ "github.com/elastic/beats/v7/libbeat/processors/parse_jidu_log"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_serverlog"
 	_ "github.com/elastic/beats/v7/libbeat/processors/parse_vehicle_tracelog"
 	_ "github.com/elastic/beats/v7/libbeat/processors/ratelimit"
 	_ "github.com/elastic/beats/v7/libbeat/processors/registered_domain"
 	_ "github.com/elastic/beats/v7/libbeat/processors/translate_sid"
 	_ "github.com/elastic/beats/v7/libbeat/processors/urldecode"
+	_ "github.com/elastic/beats/v7/libbeat/processors/vehicle_trace_span"
 	_ "github.com/elastic/beats/v7/libbeat/publisher/includes" // Register publisher pipeline modules
 )
@@ -0,0 +1,272 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+)
+
+// kafkaGroupFactory returns the kafka consumer group with the given id
+// configured in the Beat.
+type kafkaGroupFactory func(beat *beat.Beat, id string) (*kafka.ConsumerGroup, error)
+
+// GenKafkaCmd initializes a command to manage the kafka consumer groups of
+// the Beat, it offers the reset-offsets and replay-dead-letters actions
+func GenKafkaCmd(settings instance.Settings, groupFactory kafkaGroupFactory) *cobra.Command {
+	kafkaCmd := cobra.Command{
+		Use:   "kafka",
+		Short: "Manage kafka consumer groups",
+	}
+
+	kafkaCmd.AddCommand(genResetOffsetsCmd(settings, groupFactory))
+	kafkaCmd.AddCommand(genReplayDeadLettersCmd(settings, groupFactory))
+
+	return &kafkaCmd
+}
+
+func genResetOffsetsCmd(settings instance.Settings, groupFactory kafkaGroupFactory) *cobra.Command {
+	var (
+		flagGroup    string
+		flagTopics   []string
+		flagDatetime string
+		flagOffset   int64
+		flagExecute  bool
+	)
+	command := &cobra.Command{
+		Use:   "reset-offsets",
+		Short: "Move the offsets of a consumer group to a time or an offset",
+		Long: "Move the offsets of the consumer group of a kafka input to the first records since a time " +
+			"or to an offset. The offsets are only printed unless --execute is set. The consumers of the " +
+			"group must be stopped.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			datetime, err := parseResetFlags(flagGroup, flagDatetime, cmd.Flags().Changed("to-offset"))
+			if err != nil {
+				return err
+			}
+
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			group, err := groupFactory(&b.Beat, flagGroup)
+			if err != nil {
+				return err
+			}
+
+			reset := offsetReset{
+				group:    group,
+				topics:   flagTopics,
+				datetime: datetime,
+				offset:   flagOffset,
+				execute:  flagExecute,
+			}
+			return reset.run(os.Stdout)
+		}),
+	}
+	command.Flags().StringVar(&flagGroup, "group", "", "The group_id of the kafka input")
+	command.Flags().StringSliceVar(&flagTopics, "topic", nil, "The topics to reset, all the topics of the input by default")
+	command.Flags().StringVar(&flagDatetime, "to-datetime", "", "Move to the first records since this RFC3339 time")
+	command.Flags().Int64Var(&flagOffset, "to-offset", 0, "Move to this offset, within the offsets of each partition")
+	command.Flags().BoolVar(&flagExecute, "execute", false, "Commit the offsets")
+	return command
+}
+
+func genReplayDeadLettersCmd(settings instance.Settings, groupFactory kafkaGroupFactory) *cobra.Command {
+	var flagGroup string
+	command := &cobra.Command{
+		Use:   "replay-dead-letters FILE",
+		Short: "Produce the records of a dead letter file back to their topics",
+		Long: "Produce the records of the dead_letter.path file of a kafka input back to the topics they " +
+			"were read from, with their key, headers and timestamp, so that the input reads them again. " +
+			"Other consumer groups of the topics read them again too.",
+		Args: cobra.ExactArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if flagGroup == "" {
+				return errors.New("--group is required")
+			}
+
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			group, err := groupFactory(&b.Beat, flagGroup)
+			if err != nil {
+				return err
+			}
+
+			config := *group.Config
+			config.Producer.Return.Successes = true
+			config.Producer.Return.Errors = true
+			config.Producer.RequiredAcks = sarama.WaitForAll
+			producer, err := sarama.NewSyncProducer(group.Hosts, &config)
+			if err != nil {
+				return errors.Wrap(err, "connecting to kafka")
+			}
+			defer producer.Close()
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return replayDeadLetters(producer, file, os.Stdout)
+		}),
+	}
+	command.Flags().StringVar(&flagGroup, "group", "", "The group_id of the kafka input")
+	return command
+}
+
+// replayDeadLetters produces the dead letters read as JSON lines to their
+// topics. It stops at the first failure, the records before it are replayed.
+func replayDeadLetters(producer sarama.SyncProducer, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	replayed := 0
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrapf(err, "reading line %d, %d records replayed", line, replayed)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var dl kafka.DeadLetter
+			if err := json.Unmarshal(data, &dl); err != nil {
+				return errors.Wrapf(err, "decoding line %d, %d records replayed", line, replayed)
+			}
+			if dl.Topic == "" {
+				return errors.Errorf("line %d has no topic, %d records replayed", line, replayed)
+			}
+			if _, _, err := producer.SendMessage(dl.ProducerMessage(dl.Topic)); err != nil {
+				return errors.Wrapf(err, "producing line %d to %v, %d records replayed", line, dl.Topic, replayed)
+			}
+			replayed++
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	fmt.Fprintf(out, "Replayed %d records.\n", replayed)
+	return nil
+}
+
+// parseResetFlags checks the flags of reset-offsets and returns the time to
+// move to, zero when moving to an offset.
+func parseResetFlags(group, datetime string, toOffset bool) (time.Time, error) {
+	if group == "" {
+		return time.Time{}, errors.New("--group is required")
+	}
+	if (datetime == "") == !toOffset {
+		return time.Time{}, errors.New("one of --to-datetime or --to-offset is required")
+	}
+	if datetime == "" {
+		return time.Time{}, nil
+	}
+	ts, err := time.Parse(time.RFC3339, datetime)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid --to-datetime '%v', expected a RFC3339 timestamp like 2006-01-02T15:04:05Z07:00", datetime)
+	}
+	return ts, nil
+}
+
+// offsetReset moves the offsets of a consumer group.
+type offsetReset struct {
+	group    *kafka.ConsumerGroup
+	topics   []string
+	datetime time.Time // the time to move to, zero to move to offset
+	offset   int64
+	execute  bool
+}
+
+func (r *offsetReset) run(out io.Writer) error {
+	client, err := sarama.NewClient(r.group.Hosts, r.group.Config)
+	if err != nil {
+		return errors.Wrap(err, "connecting to kafka")
+	}
+	defer client.Close()
+
+	if r.execute {
+		if err := kafka.CheckGroupInactive(client, r.group.ID); err != nil {
+			return err
+		}
+	}
+
+	topics := r.topics
+	if len(topics) == 0 {
+		topics, err = r.group.Topics(client)
+		if err != nil {
+			return errors.Wrap(err, "reading the topics of the group")
+		}
+	}
+	partitions, err := kafka.Partitions(client, topics)
+	if err != nil {
+		return err
+	}
+
+	var offsets kafka.PartitionOffsets
+	if !r.datetime.IsZero() {
+		offsets, err = kafka.OffsetsForTime(client, partitions, r.datetime)
+	} else {
+		offsets, err = kafka.OffsetsAt(client, partitions, r.offset)
+	}
+	if err != nil {
+		return err
+	}
+	committed, err := kafka.CommittedOffsets(client, r.group.ID, partitions)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITION\tCURRENT-OFFSET\tNEW-OFFSET")
+	sort.Strings(topics)
+	for _, topic := range topics {
+		for _, partition := range partitions[topic] {
+			current := "-"
+			if offset := committed[topic][partition]; offset >= 0 {
+				current = fmt.Sprint(offset)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", topic, partition, current, offsets[topic][partition])
+		}
+	}
+	w.Flush()
+
+	if !r.execute {
+		fmt.Fprintln(out, "Dry run, set --execute to commit the offsets.")
+		return nil
+	}
+	if err := kafka.CommitOffsets(client, r.group.ID, offsets); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Committed the offsets of group %v.\n", r.group.ID)
+	return nil
+}
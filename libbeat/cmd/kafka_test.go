@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+)
+
+var resetTime = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+// newResetBroker serves topic logs with partition 0 holding offsets 10 to
+// 100 and partition 1 offsets 0 to 7. Group filebeat committed offset 50 of
+// partition 0, group active has a member.
+func newResetBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	millis := resetTime.UnixNano() / int64(time.Millisecond)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs", 0, broker.BrokerID()).
+			SetLeader("logs", 1, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetVersion(1).
+			SetOffset("logs", 0, sarama.OffsetOldest, 10).
+			SetOffset("logs", 0, sarama.OffsetNewest, 100).
+			SetOffset("logs", 0, millis, 42).
+			SetOffset("logs", 1, sarama.OffsetOldest, 0).
+			SetOffset("logs", 1, sarama.OffsetNewest, 7).
+			SetOffset("logs", 1, millis, -1),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "filebeat", broker).
+			SetCoordinator(sarama.CoordinatorGroup, "active", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("filebeat", "logs", 0, 50, "", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).
+			AddGroupDescription("filebeat", &sarama.GroupDescription{GroupId: "filebeat", State: "Empty"}).
+			AddGroupDescription("active", &sarama.GroupDescription{
+				GroupId: "active",
+				State:   "Stable",
+				Members: map[string]*sarama.GroupMemberDescription{"filebeat-1": {}},
+			}),
+	})
+	return broker
+}
+
+func newResetGroup(broker *sarama.MockBroker, id string) *kafka.ConsumerGroup {
+	config := sarama.NewConfig()
+	config.Version = sarama.V1_0_0_0
+	config.Metadata.Retry.Max = 0
+	return &kafka.ConsumerGroup{
+		ID:     id,
+		Hosts:  []string{broker.Addr()},
+		Config: config,
+		Topics: func(sarama.Client) ([]string, error) { return []string{"logs"}, nil },
+	}
+}
+
+// committedOffsets returns the offsets committed through the broker.
+func committedOffsets(broker *sarama.MockBroker) map[int32]int64 {
+	var offsets map[int32]int64
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			offsets = map[int32]int64{}
+			for _, partition := range []int32{0, 1} {
+				if offset, _, err := req.Offset("logs", partition); err == nil {
+					offsets[partition] = offset
+				}
+			}
+		}
+	}
+	return offsets
+}
+
+func TestParseResetFlags(t *testing.T) {
+	for name, test := range map[string]struct {
+		group    string
+		datetime string
+		toOffset bool
+		want     time.Time
+		valid    bool
+	}{
+		"datetime":         {group: "filebeat", datetime: "2026-10-16T10:00:00+02:00", want: resetTime, valid: true},
+		"offset":           {group: "filebeat", toOffset: true, valid: true},
+		"no group":         {datetime: "2026-10-16T08:00:00Z"},
+		"no target":        {group: "filebeat"},
+		"both targets":     {group: "filebeat", datetime: "2026-10-16T08:00:00Z", toOffset: true},
+		"invalid datetime": {group: "filebeat", datetime: "2026-10-16 08:00"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			datetime, err := parseResetFlags(test.group, test.datetime, test.toOffset)
+			if !test.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, test.want.Equal(datetime), "got %v", datetime)
+		})
+	}
+}
+
+func TestResetOffsetsDryRun(t *testing.T) {
+	broker := newResetBroker(t)
+	reset := offsetReset{group: newResetGroup(broker, "filebeat"), datetime: resetTime}
+
+	var out bytes.Buffer
+	require.NoError(t, reset.run(&out))
+
+	// partition 1 has no record since the time, it moves to its end
+	assert.Equal(t, ""+
+		"TOPIC  PARTITION  CURRENT-OFFSET  NEW-OFFSET\n"+
+		"logs   0          50              42\n"+
+		"logs   1          -               7\n"+
+		"Dry run, set --execute to commit the offsets.\n", out.String())
+	assert.Nil(t, committedOffsets(broker), "a dry run commits nothing")
+}
+
+func TestResetOffsetsExecute(t *testing.T) {
+	broker := newResetBroker(t)
+	reset := offsetReset{group: newResetGroup(broker, "filebeat"), topics: []string{"logs"}, offset: 5, execute: true}
+
+	var out bytes.Buffer
+	require.NoError(t, reset.run(&out))
+
+	// the offset is moved into the range of each partition
+	assert.Contains(t, out.String(), "logs   0          50              10\n")
+	assert.Contains(t, out.String(), "logs   1          -               5\n")
+	assert.Contains(t, out.String(), "Committed the offsets of group filebeat.\n")
+	assert.Equal(t, map[int32]int64{0: 10, 1: 5}, committedOffsets(broker))
+}
+
+func TestResetOffsetsActiveGroup(t *testing.T) {
+	broker := newResetBroker(t)
+	reset := offsetReset{group: newResetGroup(broker, "active"), offset: 5, execute: true}
+
+	var out bytes.Buffer
+	assert.Error(t, reset.run(&out), "the offsets of a group with members are not reset")
+	assert.Nil(t, committedOffsets(broker))
+}
+
+func deadLetterLines(t *testing.T, letters ...kafka.DeadLetter) string {
+	var lines strings.Builder
+	for _, dl := range letters {
+		line, err := json.Marshal(dl)
+		require.NoError(t, err)
+		lines.Write(line)
+		lines.WriteString("\n")
+	}
+	return lines.String()
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	first := kafka.DeadLetter{
+		Topic:     "logs",
+		Partition: 1,
+		Offset:    42,
+		Key:       []byte("vid"),
+		Value:     []byte("raw line"),
+		Headers: []kafka.DeadLetterHeader{
+			{Key: "trace", Value: "a"},
+			{Key: "trace", Value: "b"},
+		},
+		Timestamp: resetTime,
+		Error:     "malformed",
+	}
+	second := kafka.DeadLetter{Topic: "metrics", Value: []byte("other line"), Error: "malformed"}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "logs", msg.Topic)
+		assert.Equal(t, sarama.ByteEncoder("vid"), msg.Key)
+		assert.Equal(t, sarama.ByteEncoder("raw line"), msg.Value)
+		assert.Equal(t, []sarama.RecordHeader{
+			{Key: []byte("trace"), Value: []byte("a")},
+			{Key: []byte("trace"), Value: []byte("b")},
+		}, msg.Headers)
+		assert.True(t, resetTime.Equal(msg.Timestamp))
+		return nil
+	})
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "metrics", msg.Topic)
+		assert.Nil(t, msg.Key)
+		return nil
+	})
+
+	var out bytes.Buffer
+	in := deadLetterLines(t, first) + "\n" + deadLetterLines(t, second)
+	require.NoError(t, replayDeadLetters(producer, strings.NewReader(in), &out))
+	assert.Equal(t, "Replayed 2 records.\n", out.String())
+}
+
+func TestReplayDeadLettersFailure(t *testing.T) {
+	dl := kafka.DeadLetter{Topic: "logs", Value: []byte("raw line")}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndFail(errors.New("unavailable"))
+
+	var out bytes.Buffer
+	err := replayDeadLetters(producer, strings.NewReader(deadLetterLines(t, dl, dl, dl)), &out)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "producing line 2 to logs, 1 records replayed")
+	}
+	assert.Empty(t, out.String())
+
+	err = replayDeadLetters(producer, strings.NewReader("not json\n"), &out)
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
+)
+
+// GenReplayDLQCmd initializes a command replaying the dead letters kept by
+// the file non_indexable_policy of the Elasticsearch output
+func GenReplayDLQCmd(settings instance.Settings) *cobra.Command {
+	var (
+		flagRejected string
+		flagBulkSize int
+	)
+	command := &cobra.Command{
+		Use:   "replay-dlq <file>...",
+		Short: "Replay the dead letters of the Elasticsearch output",
+		Long: "Index the events of the dead letter files written by the file non_indexable_policy of the " +
+			"Elasticsearch output again, in the index and with the pipeline they were first sent to. " +
+			"The lines failing again are appended to <file>.rejected, or to --rejected.",
+		Args: cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			outCfg := b.Config.Output
+			if outCfg.Name() != "elasticsearch" {
+				return errors.New("replaying dead letters requires the Elasticsearch output")
+			}
+			conn, err := eslegclient.NewConnectedClient(outCfg.Config(), b.Info.Beat)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			for _, path := range args {
+				rejectedPath := flagRejected
+				if rejectedPath == "" {
+					rejectedPath = path + ".rejected"
+				}
+				if err := replayDeadLetterFile(conn, path, rejectedPath, flagBulkSize); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}
+	command.Flags().StringVar(&flagRejected, "rejected", "", "The file to append the lines failing again to")
+	command.Flags().IntVar(&flagBulkSize, "bulk-size", 50, "The number of events per bulk request")
+	return command
+}
+
+func replayDeadLetterFile(conn *eslegclient.Connection, path, rejectedPath string, bulkSize int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rejected := &appendFile{path: rejectedPath}
+	defer rejected.Close()
+
+	stats, err := elasticsearch.ReplayDeadLetters(context.Background(), conn, f, rejected, bulkSize)
+	fmt.Printf("%s: replayed %d, rejected %d\n", path, stats.Replayed, stats.Rejected) //nolint:forbidigo // required to give feedback to user
+	if stats.Rejected > 0 {
+		fmt.Printf("Rejected lines appended to %s\n", rejectedPath) //nolint:forbidigo // required to give feedback to user
+	}
+	return errors.Wrapf(err, "replaying %s", path)
+}
+
+// appendFile is a file created with its first write, so that it only exists
+// once something is written to it.
+type appendFile struct {
+	path string
+	f    *os.File
+}
+
+func (a *appendFile) Write(p []byte) (int, error) {
+	if a.f == nil {
+		f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return 0, err
+		}
+		a.f = f
+	}
+	return a.f.Write(p)
+}
+
+func (a *appendFile) Close() error {
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
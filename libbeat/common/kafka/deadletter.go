@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// DeadLetter is a record a kafka input failed to decode or process, as kept
+// by its dead letter queue. Value is the record as it was read or, for the
+// events split from a batched record, the value of the failed event.
+type DeadLetter struct {
+	Topic     string             `json:"topic"`
+	Partition int32              `json:"partition"`
+	Offset    int64              `json:"offset"`
+	Key       []byte             `json:"key,omitempty"`
+	Value     []byte             `json:"value"`
+	Headers   []DeadLetterHeader `json:"headers,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+	Error     string             `json:"error"`
+}
+
+// DeadLetterHeader is a header of a dead letter. The headers are kept in
+// order, with their repeated keys.
+type DeadLetterHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// NewDeadLetter returns the dead letter of a record failing with reason.
+func NewDeadLetter(msg *sarama.ConsumerMessage, value []byte, reason error) DeadLetter {
+	dl := DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     value,
+		Timestamp: msg.Timestamp,
+		Error:     reason.Error(),
+	}
+	for _, h := range msg.Headers {
+		if h != nil {
+			dl.Headers = append(dl.Headers, DeadLetterHeader{Key: string(h.Key), Value: string(h.Value)})
+		}
+	}
+	return dl
+}
+
+// ProducerMessage returns the record producing the dead letter to topic,
+// with its original key, value, headers and timestamp.
+func (dl *DeadLetter) ProducerMessage(topic string) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(dl.Value),
+		Timestamp: dl.Timestamp,
+	}
+	if dl.Key != nil {
+		msg.Key = sarama.ByteEncoder(dl.Key)
+	}
+	for _, h := range dl.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: []byte(h.Value)})
+	}
+	return msg
+}
@@ -0,0 +1,206 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ConsumerGroup is a consumer group configured in a beat, for the commands
+// managing its offsets.
+type ConsumerGroup struct {
+	ID     string
+	Hosts  []string
+	Config *sarama.Config
+
+	// Topics returns the topics consumed by the group.
+	Topics func(client sarama.Client) ([]string, error)
+}
+
+// PartitionOffsets are offsets by topic and partition.
+type PartitionOffsets map[string]map[int32]int64
+
+func (o PartitionOffsets) set(topic string, partition int32, offset int64) {
+	if o[topic] == nil {
+		o[topic] = map[int32]int64{}
+	}
+	o[topic][partition] = offset
+}
+
+// Partitions returns the partitions of the topics, in order.
+func Partitions(client sarama.Client, topics []string) (map[string][]int32, error) {
+	partitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		ids, err := client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("reading the partitions of topic %v: %w", topic, err)
+		}
+		ids = append([]int32(nil), ids...)
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		partitions[topic] = ids
+	}
+	return partitions, nil
+}
+
+// OffsetsForTime returns the offsets of the first records of the partitions
+// with a timestamp at or after ts, the end offset of the partitions without
+// such a record. It requires kafka 0.10.1 or newer.
+func OffsetsForTime(client sarama.Client, partitions map[string][]int32, ts time.Time) (PartitionOffsets, error) {
+	millis := ts.UnixNano() / int64(time.Millisecond)
+	offsets := PartitionOffsets{}
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			offset, err := client.GetOffset(topic, partition, millis)
+			if err != nil {
+				return nil, fmt.Errorf("reading the offset of %v/%v at %v: %w", topic, partition, ts, err)
+			}
+			if offset < 0 {
+				// no record since ts
+				offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+				if err != nil {
+					return nil, fmt.Errorf("reading the end offset of %v/%v: %w", topic, partition, err)
+				}
+			}
+			offsets.set(topic, partition, offset)
+		}
+	}
+	return offsets, nil
+}
+
+// OffsetsAt returns offset for all the partitions, moved into the range of
+// the offsets of each partition.
+func OffsetsAt(client sarama.Client, partitions map[string][]int32, offset int64) (PartitionOffsets, error) {
+	offsets := PartitionOffsets{}
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, fmt.Errorf("reading the start offset of %v/%v: %w", topic, partition, err)
+			}
+			newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("reading the end offset of %v/%v: %w", topic, partition, err)
+			}
+			switch {
+			case offset < oldest:
+				offsets.set(topic, partition, oldest)
+			case offset > newest:
+				offsets.set(topic, partition, newest)
+			default:
+				offsets.set(topic, partition, offset)
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// CommittedOffsets returns the offsets committed by the group for the
+// partitions, -1 for the partitions without a committed offset.
+func CommittedOffsets(client sarama.Client, group string, partitions map[string][]int32) (PartitionOffsets, error) {
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return nil, fmt.Errorf("finding the coordinator of group %v: %w", group, err)
+	}
+
+	req := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: group}
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			req.AddPartition(topic, partition)
+		}
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the offsets of group %v: %w", group, err)
+	}
+
+	offsets := PartitionOffsets{}
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			offset := int64(-1)
+			if block := resp.GetBlock(topic, partition); block != nil {
+				if block.Err != sarama.ErrNoError {
+					return nil, fmt.Errorf("fetching the offset of group %v for %v/%v: %w", group, topic, partition, block.Err)
+				}
+				offset = block.Offset
+			}
+			offsets.set(topic, partition, offset)
+		}
+	}
+	return offsets, nil
+}
+
+// CommitOffsets commits the offsets of a group. The group must have no
+// active members, the broker rejecting the commits from outside the group
+// otherwise.
+func CommitOffsets(client sarama.Client, group string, offsets PartitionOffsets) error {
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return fmt.Errorf("finding the coordinator of group %v: %w", group, err)
+	}
+
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			req.AddBlock(topic, partition, offset, 0, "")
+		}
+	}
+	resp, err := coordinator.CommitOffset(req)
+	if err != nil {
+		return fmt.Errorf("committing the offsets of group %v: %w", group, err)
+	}
+	for topic, partitions := range resp.Errors {
+		for partition, kerr := range partitions {
+			if kerr != sarama.ErrNoError {
+				return fmt.Errorf("committing the offset of group %v for %v/%v: %w", group, topic, partition, kerr)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckGroupInactive returns an error if the group has active members.
+func CheckGroupInactive(client sarama.Client, group string) error {
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return err
+	}
+	// the admin is not closed, it would close the client
+
+	groups, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return fmt.Errorf("describing group %v: %w", group, err)
+	}
+	for _, g := range groups {
+		if g.Err != sarama.ErrNoError {
+			return fmt.Errorf("describing group %v: %w", group, g.Err)
+		}
+		if g.State != "Empty" && g.State != "Dead" {
+			return fmt.Errorf("group %v is %v with %d members, stop its consumers first", group, g.State, len(g.Members))
+		}
+	}
+	return nil
+}
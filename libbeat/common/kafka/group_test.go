@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockGroupBroker(t *testing.T, group string) (*sarama.MockBroker, sarama.Client) {
+	broker := sarama.NewMockBroker(t, 1)
+	ts := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	millis := ts.UnixNano() / int64(time.Millisecond)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs", 1, broker.BrokerID()).
+			SetLeader("logs", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetVersion(1).
+			SetOffset("logs", 0, sarama.OffsetOldest, 10).
+			SetOffset("logs", 0, sarama.OffsetNewest, 100).
+			SetOffset("logs", 0, millis, 42).
+			SetOffset("logs", 1, sarama.OffsetOldest, 0).
+			SetOffset("logs", 1, sarama.OffsetNewest, 7).
+			SetOffset("logs", 1, millis, -1),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, group, broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(group, "logs", 0, 50, "", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t).
+			SetError(group, "logs", 1, sarama.ErrUnknownMemberId),
+		"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).
+			AddGroupDescription("active", &sarama.GroupDescription{
+				GroupId: "active",
+				State:   "Stable",
+				Members: map[string]*sarama.GroupMemberDescription{"filebeat-1": {}},
+			}),
+	})
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V1_0_0_0
+	config.Metadata.Retry.Max = 0
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	require.NoError(t, err)
+	return broker, client
+}
+
+func TestGroupOffsets(t *testing.T) {
+	broker, client := newMockGroupBroker(t, "filebeat")
+	defer broker.Close()
+	defer client.Close()
+
+	partitions, err := Partitions(client, []string{"logs"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]int32{"logs": {0, 1}}, partitions)
+
+	// the partitions without a record since the time start at their end
+	offsets, err := OffsetsForTime(client, partitions, time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, PartitionOffsets{"logs": {0: 42, 1: 7}}, offsets)
+
+	offsets, err = OffsetsAt(client, partitions, 5)
+	require.NoError(t, err)
+	assert.Equal(t, PartitionOffsets{"logs": {0: 10, 1: 5}}, offsets)
+
+	committed, err := CommittedOffsets(client, "filebeat", partitions)
+	require.NoError(t, err)
+	assert.Equal(t, PartitionOffsets{"logs": {0: 50, 1: -1}}, committed)
+
+	assert.NoError(t, CommitOffsets(client, "filebeat", PartitionOffsets{"logs": {0: 42}}))
+	assert.Error(t, CommitOffsets(client, "filebeat", PartitionOffsets{"logs": {0: 42, 1: 7}}))
+
+	assert.NoError(t, CheckGroupInactive(client, "filebeat"))
+	assert.Error(t, CheckGroupInactive(client, "active"))
+}
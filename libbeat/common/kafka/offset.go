@@ -0,0 +1,35 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+// ConsumerOffset is the offset a consumer group resumes a partition from.
+type ConsumerOffset struct {
+	GroupID   string
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// OffsetCommitter is implemented by the private metadata of the events of
+// inputs leaving the commit of their consumer offsets to the output, so the
+// transactional kafka output commits them with the records it produces.
+type OffsetCommitter interface {
+	// ConsumerOffset returns the offset to commit once the event is
+	// written, false if the event has no offset to commit.
+	ConsumerOffset() (ConsumerOffset, bool)
+}
@@ -0,0 +1,468 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// logicalTypes are the logical types goavro converts from and to time.Time,
+// unions name their members by their type followed by the logical type.
+var logicalTypes = map[string]bool{
+	"long.timestamp-millis": true,
+	"long.timestamp-micros": true,
+	"int.date":              true,
+}
+
+// AvroSchema encodes and decodes the records of an Avro schema. Events are
+// converted following the schema: fields the schema does not define are
+// dropped, fields it defines missing in the event take their default value
+// and the values of unions are encoded with the first member they fit.
+type AvroSchema struct {
+	codec *goavro.Codec
+	root  interface{}
+	named map[string]map[string]interface{}
+}
+
+// NewAvroSchema parses an Avro schema describing a record.
+func NewAvroSchema(spec string) (*AvroSchema, error) {
+	codec, err := goavro.NewCodec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	var root interface{}
+	if err := json.Unmarshal([]byte(spec), &root); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	s := &AvroSchema{codec: codec, root: root, named: map[string]map[string]interface{}{}}
+	s.collect(root, "")
+	if typ, _, _ := s.resolve(root, ""); typ != "record" {
+		return nil, fmt.Errorf("avro schema must describe a record, not %s", typ)
+	}
+	return s, nil
+}
+
+// Encode returns the Avro binary encoding of the fields.
+func (s *AvroSchema) Encode(fields common.MapStr) ([]byte, error) {
+	native, err := s.toNative(s.root, "", map[string]interface{}(fields))
+	if err != nil {
+		return nil, err
+	}
+	return s.codec.BinaryFromNative(nil, native)
+}
+
+// Decode returns the fields of an Avro binary encoded record. Unions decode
+// to the value of their member.
+func (s *AvroSchema) Decode(payload []byte) (common.MapStr, error) {
+	native, rest, err := s.codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after avro record", len(rest))
+	}
+	fields, _ := s.fromNative(s.root, "", native).(map[string]interface{})
+	return common.MapStr(fields), nil
+}
+
+// collect indexes the named types of a schema by their full name.
+func (s *AvroSchema) collect(schema interface{}, namespace string) {
+	switch schema := schema.(type) {
+	case []interface{}:
+		for _, member := range schema {
+			s.collect(member, namespace)
+		}
+	case map[string]interface{}:
+		switch typ := schema["type"].(type) {
+		case string:
+			switch typ {
+			case "record", "error", "enum", "fixed":
+				name := fullName(schema, namespace)
+				s.named[name] = schema
+				for _, field := range fields(schema) {
+					s.collect(field["type"], namespaceOf(name))
+				}
+			case "array":
+				s.collect(schema["items"], namespace)
+			case "map":
+				s.collect(schema["values"], namespace)
+			}
+		default:
+			s.collect(typ, namespace)
+		}
+	}
+}
+
+// resolve returns the type of a schema, its definition if it is not a
+// primitive type and the namespace of the types it refers to.
+func (s *AvroSchema) resolve(schema interface{}, namespace string) (string, map[string]interface{}, string) {
+	switch schema := schema.(type) {
+	case []interface{}:
+		return "union", nil, namespace
+	case string:
+		if def, name, ok := s.lookup(schema, namespace); ok {
+			return s.resolve(def, namespaceOf(name))
+		}
+		return schema, nil, namespace
+	case map[string]interface{}:
+		typ, ok := schema["type"].(string)
+		if !ok {
+			return s.resolve(schema["type"], namespace)
+		}
+		switch typ {
+		case "record", "error", "enum", "fixed":
+			return typ, schema, namespaceOf(fullName(schema, namespace))
+		case "array", "map":
+			return typ, schema, namespace
+		}
+		if def, name, ok := s.lookup(typ, namespace); ok {
+			return s.resolve(def, namespaceOf(name))
+		}
+		return typ, schema, namespace
+	}
+	return "", nil, namespace
+}
+
+func (s *AvroSchema) lookup(name, namespace string) (map[string]interface{}, string, bool) {
+	if namespace != "" && !strings.Contains(name, ".") {
+		if def, ok := s.named[namespace+"."+name]; ok {
+			return def, namespace + "." + name, true
+		}
+	}
+	def, ok := s.named[name]
+	return def, name, ok
+}
+
+// unionName returns the name goavro gives to a member of a union.
+func (s *AvroSchema) unionName(schema interface{}, namespace string) string {
+	typ, def, _ := s.resolve(schema, namespace)
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		if name, ok := schema.(string); ok {
+			_, full, _ := s.lookup(name, namespace)
+			return full
+		}
+		return fullName(def, namespace)
+	}
+	if lt, ok := def["logicalType"].(string); ok && logicalTypes[typ+"."+lt] {
+		return typ + "." + lt
+	}
+	return typ
+}
+
+func (s *AvroSchema) toNative(schema interface{}, namespace string, v interface{}) (interface{}, error) {
+	typ, def, namespace := s.resolve(schema, namespace)
+	if typ == "union" {
+		return s.unionToNative(schema, namespace, v)
+	}
+	if v == nil {
+		if typ == "null" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("null value for %s", typ)
+	}
+
+	if t, ok := toTime(v); ok {
+		lt, _ := def["logicalType"].(string)
+		switch {
+		case logicalTypes[typ+"."+lt]:
+			return t, nil
+		case typ == "string":
+			return common.Time(t).String(), nil
+		}
+		return nil, fmt.Errorf("cannot encode time as %s", typ)
+	}
+
+	switch typ {
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case "int":
+		if n, ok := toInt64(v); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n), nil
+		}
+	case "long":
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+	case "float":
+		if f, ok := toFloat64(v); ok {
+			return float32(f), nil
+		}
+	case "double":
+		if f, ok := toFloat64(v); ok {
+			return f, nil
+		}
+	case "string", "enum":
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+	case "bytes", "fixed":
+		switch v := v.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		}
+	case "record", "error":
+		m, ok := toMap(v)
+		if !ok {
+			break
+		}
+		record := make(map[string]interface{}, len(m))
+		for _, field := range fields(def) {
+			name, _ := field["name"].(string)
+			value, ok := m[name]
+			if !ok {
+				continue
+			}
+			native, err := s.toNative(field["type"], namespace, value)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", name, err)
+			}
+			record[name] = native
+		}
+		return record, nil
+	case "array":
+		values, ok := toSlice(v)
+		if !ok {
+			break
+		}
+		array := make([]interface{}, len(values))
+		for i, value := range values {
+			native, err := s.toNative(def["items"], namespace, value)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = native
+		}
+		return array, nil
+	case "map":
+		m, ok := toMap(v)
+		if !ok {
+			break
+		}
+		values := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			native, err := s.toNative(def["values"], namespace, value)
+			if err != nil {
+				return nil, fmt.Errorf("key '%s': %w", key, err)
+			}
+			values[key] = native
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as %s", v, typ)
+}
+
+func (s *AvroSchema) unionToNative(schema interface{}, namespace string, v interface{}) (interface{}, error) {
+	members, _ := schema.([]interface{})
+	for _, member := range members {
+		native, err := s.toNative(member, namespace, v)
+		if err != nil {
+			continue
+		}
+		if native == nil {
+			return nil, nil
+		}
+		return goavro.Union(s.unionName(member, namespace), native), nil
+	}
+	return nil, fmt.Errorf("%T value fits no member of union %v", v, schema)
+}
+
+func (s *AvroSchema) fromNative(schema interface{}, namespace string, v interface{}) interface{} {
+	typ, def, namespace := s.resolve(schema, namespace)
+	switch typ {
+	case "union":
+		wrapped, ok := v.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return v
+		}
+		members, _ := schema.([]interface{})
+		for name, value := range wrapped {
+			for _, member := range members {
+				if s.unionName(member, namespace) == name {
+					return s.fromNative(member, namespace, value)
+				}
+			}
+			return value
+		}
+	case "record", "error":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		record := make(map[string]interface{}, len(m))
+		for _, field := range fields(def) {
+			name, _ := field["name"].(string)
+			record[name] = s.fromNative(field["type"], namespace, m[name])
+		}
+		return record
+	case "array":
+		values, ok := v.([]interface{})
+		if !ok {
+			return v
+		}
+		for i, value := range values {
+			values[i] = s.fromNative(def["items"], namespace, value)
+		}
+		return values
+	case "map":
+		values, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		for key, value := range values {
+			values[key] = s.fromNative(def["values"], namespace, value)
+		}
+		return values
+	}
+	return v
+}
+
+func fields(def map[string]interface{}) []map[string]interface{} {
+	list, _ := def["fields"].([]interface{})
+	fields := make([]map[string]interface{}, 0, len(list))
+	for _, field := range list {
+		if field, ok := field.(map[string]interface{}); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// fullName returns the name of a named type qualified by its namespace, the
+// enclosing namespace if it does not set one.
+func fullName(def map[string]interface{}, namespace string) string {
+	name, _ := def["name"].(string)
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if ns, ok := def["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func namespaceOf(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case common.Time:
+		return time.Time(v), true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case common.MapStr:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	if values, ok := v.([]interface{}); ok {
+		return values, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
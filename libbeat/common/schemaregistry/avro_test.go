@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const testAvroEventSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "com.jidu.logs",
+	"fields": [
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "message", "type": "string"},
+		{"name": "level", "type": ["null", "string"], "default": null},
+		{"name": "code", "type": ["null", "int", "string"], "default": null},
+		{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+		{"name": "labels", "type": {"type": "map", "values": "string"}, "default": {}},
+		{"name": "host", "type": ["null", {
+			"type": "record",
+			"name": "Host",
+			"fields": [
+				{"name": "name", "type": "string"},
+				{"name": "cpus", "type": "long", "default": 1}
+			]
+		}], "default": null},
+		{"name": "previous", "type": ["null", "Host"], "default": null}
+	]
+}`
+
+func TestAvroSchemaRoundTrip(t *testing.T) {
+	schema, err := NewAvroSchema(testAvroEventSchema)
+	require.NoError(t, err)
+
+	ts := time.Date(2022, 7, 1, 10, 30, 0, 0, time.UTC)
+	payload, err := schema.Encode(common.MapStr{
+		"timestamp": common.Time(ts),
+		"message":   "hello",
+		"code":      uint16(404),
+		"tags":      []string{"a", "b"},
+		"labels":    map[string]string{"env": "prod"},
+		"host":      common.MapStr{"name": "vehicle-1", "ip": "10.0.0.1"},
+		"previous":  map[string]interface{}{"name": "vehicle-0", "cpus": 4.0},
+		"ignored":   "dropped",
+	})
+	require.NoError(t, err)
+
+	fields, err := schema.Decode(payload)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"timestamp": ts,
+		"message":   "hello",
+		"level":     nil,
+		"code":      int32(404),
+		"tags":      []interface{}{"a", "b"},
+		"labels":    map[string]interface{}{"env": "prod"},
+		"host":      map[string]interface{}{"name": "vehicle-1", "cpus": int64(1)},
+		"previous":  map[string]interface{}{"name": "vehicle-0", "cpus": int64(4)},
+	}, fields)
+}
+
+func TestAvroSchemaUnions(t *testing.T) {
+	schema, err := NewAvroSchema(testAvroEventSchema)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		code, decoded interface{}
+	}{
+		"null":    {nil, nil},
+		"int":     {200, int32(200)},
+		"string":  {"E42", "E42"},
+		"too big": {int64(1) << 40, nil},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			payload, err := schema.Encode(common.MapStr{
+				"timestamp": time.Now(),
+				"message":   "hello",
+				"code":      test.code,
+			})
+			if name == "too big" {
+				assert.Error(t, err, "value fits no member of the union")
+				return
+			}
+			require.NoError(t, err)
+
+			fields, err := schema.Decode(payload)
+			require.NoError(t, err)
+			assert.Equal(t, test.decoded, fields["code"])
+		})
+	}
+}
+
+func TestAvroSchemaErrors(t *testing.T) {
+	_, err := NewAvroSchema(`{"type": "string"}`)
+	assert.Error(t, err, "schema is not a record")
+
+	_, err = NewAvroSchema(`{"type": "record"`)
+	assert.Error(t, err, "invalid json")
+
+	schema, err := NewAvroSchema(testAvroEventSchema)
+	require.NoError(t, err)
+
+	_, err = schema.Encode(common.MapStr{"timestamp": time.Now()})
+	assert.Error(t, err, "message has no default")
+
+	_, err = schema.Encode(common.MapStr{"timestamp": time.Now(), "message": 42})
+	assert.Error(t, err, "message is not a string")
+}
@@ -0,0 +1,256 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Schema types of the registry. Schemas registered without a type are Avro
+// schemas.
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Schema is a schema stored in the registry.
+type Schema struct {
+	ID     int    `json:"id,omitempty"`
+	Type   string `json:"schemaType,omitempty"`
+	Schema string `json:"schema"`
+}
+
+// Client looks up and registers schemas in a Confluent compatible schema
+// registry. Schemas are immutable once registered, the client caches them by
+// id and the ids of the schemas it looked up or registered by subject.
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+
+	mu       sync.RWMutex
+	schemas  map[int]Schema
+	subjects map[subjectSchema]int
+}
+
+type subjectSchema struct {
+	subject string
+	schema  Schema
+}
+
+// Error is an error response of the registry.
+type Error struct {
+	StatusCode int
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry error %d (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// NewClient creates a client of the registry configured.
+func NewClient(config Config) (*Client, error) {
+	client, err := config.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		url:      strings.TrimSuffix(config.URL, "/"),
+		username: config.Username,
+		password: config.Password,
+		http:     client,
+		schemas:  map[int]Schema{},
+		subjects: map[subjectSchema]int{},
+	}, nil
+}
+
+// SchemaByID returns the schema registered with the id.
+func (c *Client) SchemaByID(id int) (Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	if err := c.do(http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &schema); err != nil {
+		return Schema{}, err
+	}
+	schema.ID = id
+	schema.Type = schemaType(schema.Type)
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// Latest returns the latest version of the schema of a subject.
+func (c *Client) Latest(subject string) (Schema, error) {
+	var schema Schema
+	if err := c.do(http.MethodGet, subjectPath(subject)+"/versions/latest", nil, &schema); err != nil {
+		return Schema{}, err
+	}
+	schema.Type = schemaType(schema.Type)
+	c.cache(subject, schema)
+	return schema, nil
+}
+
+// Lookup returns the schema with the id it is registered with under the
+// subject. Lookup fails with a 404 Error if the schema is not registered.
+func (c *Client) Lookup(subject string, schema Schema) (Schema, error) {
+	if id, ok := c.cached(subject, schema); ok {
+		schema.ID = id
+		return schema, nil
+	}
+
+	var found Schema
+	if err := c.do(http.MethodPost, subjectPath(subject), request(schema), &found); err != nil {
+		return Schema{}, err
+	}
+	schema.ID = found.ID
+	c.cache(subject, schema)
+	return schema, nil
+}
+
+// Register registers the schema under the subject and returns it with its
+// id. Registering a schema already registered returns its existing id.
+func (c *Client) Register(subject string, schema Schema) (Schema, error) {
+	if id, ok := c.cached(subject, schema); ok {
+		schema.ID = id
+		return schema, nil
+	}
+
+	var registered Schema
+	if err := c.do(http.MethodPost, subjectPath(subject)+"/versions", request(schema), &registered); err != nil {
+		return Schema{}, err
+	}
+	schema.ID = registered.ID
+	c.cache(subject, schema)
+	return schema, nil
+}
+
+// Resolve returns the schema an encoder writes a subject with: the latest
+// version of the subject if no schema is given, else the schema given,
+// registered first if autoRegister is set.
+func (c *Client) Resolve(subject string, schema Schema, autoRegister bool) (Schema, error) {
+	switch {
+	case schema.Schema == "":
+		latest, err := c.Latest(subject)
+		if err != nil {
+			return Schema{}, err
+		}
+		if latest.Type != schema.Type {
+			return Schema{}, fmt.Errorf("latest schema of subject '%s' is a %s schema, not %s", subject, latest.Type, schema.Type)
+		}
+		return latest, nil
+	case autoRegister:
+		return c.Register(subject, schema)
+	default:
+		return c.Lookup(subject, schema)
+	}
+}
+
+func (c *Client) cached(subject string, schema Schema) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	id, ok := c.subjects[subjectSchema{subject, Schema{Type: schema.Type, Schema: schema.Schema}}]
+	return id, ok
+}
+
+func (c *Client) cache(subject string, schema Schema) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subjects[subjectSchema{subject, Schema{Type: schema.Type, Schema: schema.Schema}}] = schema.ID
+	c.schemas[schema.ID] = schema
+}
+
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		registryErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, registryErr) != nil || registryErr.Message == "" {
+			registryErr.Message = strings.TrimSpace(string(data))
+		}
+		return registryErr
+	}
+	return json.Unmarshal(data, result)
+}
+
+// request is the body registering or looking up a schema. Avro schemas are
+// sent without a type for registries predating other schema types.
+func request(schema Schema) Schema {
+	if schema.Type == TypeAvro {
+		schema.Type = ""
+	}
+	return Schema{Type: schema.Type, Schema: schema.Schema}
+}
+
+func schemaType(t string) string {
+	if t == "" {
+		return TypeAvro
+	}
+	return t
+}
+
+func subjectPath(subject string) string {
+	return "/subjects/" + url.PathEscape(subject)
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+)
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "Log",
+	"namespace": "com.jidu.logs",
+	"fields": [
+		{"name": "message", "type": "string"},
+		{"name": "level", "type": ["null", "string"], "default": null}
+	]
+}`
+
+func newTestClient(t *testing.T, registry *schemaregistrytest.Registry) *Client {
+	config := DefaultConfig()
+	config.URL = registry.URL
+	client, err := NewClient(config)
+	require.NoError(t, err)
+	return client
+}
+
+func TestClientRegister(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+	client := newTestClient(t, registry)
+
+	schema := Schema{Type: TypeAvro, Schema: testAvroSchema}
+	registered, err := client.Register("logs-value", schema)
+	require.NoError(t, err)
+	assert.Equal(t, 1, registered.ID)
+
+	requests := registry.Requests()
+	again, err := client.Register("logs-value", schema)
+	require.NoError(t, err)
+	assert.Equal(t, registered, again)
+	assert.Equal(t, requests, registry.Requests(), "registered schema is cached")
+
+	byID, err := client.SchemaByID(registered.ID)
+	require.NoError(t, err)
+	assert.Equal(t, registered, byID)
+	assert.Equal(t, requests, registry.Requests(), "registered schema is cached by id")
+}
+
+func TestClientLookup(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+	registry.Register("logs-value", "", testAvroSchema)
+	registry.Register("logs-value", "PROTOBUF", `syntax = "proto3"; message Log { string message = 1; }`)
+	client := newTestClient(t, registry)
+
+	schema, err := client.Lookup("logs-value", Schema{Type: TypeAvro, Schema: testAvroSchema})
+	require.NoError(t, err)
+	assert.Equal(t, 1, schema.ID)
+
+	_, err = client.Lookup("metrics-value", Schema{Type: TypeAvro, Schema: testAvroSchema})
+	var registryErr *Error
+	require.True(t, errors.As(err, &registryErr), "unexpected error %v", err)
+	assert.Equal(t, http.StatusNotFound, registryErr.StatusCode)
+	assert.Equal(t, 40403, registryErr.Code)
+
+	latest, err := client.Latest("logs-value")
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.ID)
+	assert.Equal(t, TypeProtobuf, latest.Type)
+
+	byID, err := client.SchemaByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, TypeAvro, byID.Type)
+	assert.Equal(t, testAvroSchema, byID.Schema)
+}
+
+func TestClientResolve(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+	client := newTestClient(t, registry)
+	avro := Schema{Type: TypeAvro, Schema: testAvroSchema}
+
+	_, err := client.Resolve("logs-value", avro, false)
+	assert.Error(t, err, "schema is not registered")
+
+	registered, err := client.Resolve("logs-value", avro, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, registered.ID)
+
+	latest, err := client.Resolve("logs-value", Schema{Type: TypeAvro}, false)
+	require.NoError(t, err)
+	assert.Equal(t, registered, latest)
+
+	_, err = client.Resolve("logs-value", Schema{Type: TypeProtobuf}, false)
+	assert.Error(t, err, "latest schema is not a protobuf schema")
+}
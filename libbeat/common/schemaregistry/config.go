@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/httpcommon"
+)
+
+// Config configures the connection to a schema registry.
+type Config struct {
+	URL      string `config:"url" validate:"required"`
+	Username string `config:"username"`
+	Password string `config:"password"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// DefaultConfig returns the default schema registry connection settings.
+func DefaultConfig() Config {
+	return Config{
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("schema registry url must use http or https")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Deserializer decodes payloads in the wire format with the Avro or protobuf
+// schema of the id they start with. Schemas are looked up once per id.
+type Deserializer struct {
+	client *Client
+
+	mu       sync.Mutex
+	avro     map[int]*AvroSchema
+	protobuf map[int]protoreflect.FileDescriptor
+}
+
+// NewDeserializer creates a Deserializer looking up schemas with the client.
+func NewDeserializer(client *Client) *Deserializer {
+	return &Deserializer{
+		client:   client,
+		avro:     map[int]*AvroSchema{},
+		protobuf: map[int]protoreflect.FileDescriptor{},
+	}
+}
+
+// Decode returns the fields of the record or message of a payload.
+func (d *Deserializer) Decode(data []byte) (common.MapStr, error) {
+	id, payload, err := Unframe(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if schema, ok := d.avro[id]; ok {
+		return schema.Decode(payload)
+	}
+	if file, ok := d.protobuf[id]; ok {
+		return decodeProtobuf(file, payload)
+	}
+
+	schema, err := d.client.SchemaByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema %d: %w", id, err)
+	}
+	switch schema.Type {
+	case TypeAvro:
+		avro, err := NewAvroSchema(schema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %w", id, err)
+		}
+		d.avro[id] = avro
+		return avro.Decode(payload)
+	case TypeProtobuf:
+		file, err := parseProto(schema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %w", id, err)
+		}
+		d.protobuf[id] = file
+		return decodeProtobuf(file, payload)
+	}
+	return nil, fmt.Errorf("schema %d has unsupported type %s", id, schema.Type)
+}
+
+func decodeProtobuf(file protoreflect.FileDescriptor, data []byte) (common.MapStr, error) {
+	indexes, payload, err := unframeProtobuf(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := messageAt(file, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMessage(message, payload)
+}
@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+)
+
+func TestDeserializer(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+	avroID := registry.Register("logs-value", "", testAvroSchema)
+	protobufID := registry.Register("metrics-value", "PROTOBUF", testProtobufSchema)
+	deserializer := NewDeserializer(newTestClient(t, registry))
+
+	avro, err := NewAvroSchema(testAvroSchema)
+	require.NoError(t, err)
+	payload, err := avro.Encode(common.MapStr{"message": "hello", "level": "info"})
+	require.NoError(t, err)
+
+	fields, err := deserializer.Decode(Frame(avroID, payload))
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"message": "hello", "level": "info"}, fields)
+
+	metric, err := NewProtobufSchema(testProtobufSchema, "Metric")
+	require.NoError(t, err)
+	payload, err = metric.Encode(common.MapStr{"name": "cpu", "value": 0.5})
+	require.NoError(t, err)
+
+	fields, err = deserializer.Decode(FrameProtobuf(protobufID, metric.Indexes(), payload))
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"name": "cpu", "value": 0.5}, fields)
+
+	requests := registry.Requests()
+	_, err = deserializer.Decode(FrameProtobuf(protobufID, metric.Indexes(), payload))
+	require.NoError(t, err)
+	assert.Equal(t, requests, registry.Requests(), "schemas are looked up once")
+
+	_, err = deserializer.Decode(Frame(42, payload))
+	assert.Error(t, err, "unknown schema id")
+	_, err = deserializer.Decode([]byte(`{"message": "hello"}`))
+	assert.Error(t, err, "not in the wire format")
+}
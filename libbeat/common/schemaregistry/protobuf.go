@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// protoFilename names the schema parsed, registry schemas are the source of
+// a single .proto file.
+const protoFilename = "schema.proto"
+
+// ProtobufSchema encodes and decodes a message type of a protobuf schema.
+type ProtobufSchema struct {
+	message protoreflect.MessageDescriptor
+	indexes []int
+}
+
+// NewProtobufSchema parses the .proto source of a schema and selects the
+// message type with the name, the first message of the schema if the name is
+// empty. Names are either fully qualified or relative to the package of the
+// schema. Schemas can import the well known types only.
+func NewProtobufSchema(spec, name string) (*ProtobufSchema, error) {
+	file, err := parseProto(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var message protoreflect.MessageDescriptor
+	if name == "" {
+		message, err = messageAt(file, []int{0})
+	} else {
+		message, err = findMessage(file, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ProtobufSchema{message: message, indexes: messageIndexes(message)}, nil
+}
+
+// Indexes returns the indexes of the message type in its schema, written in
+// the wire format header.
+func (s *ProtobufSchema) Indexes() []int {
+	return s.indexes
+}
+
+// Encode returns the binary encoding of the message of the fields. Fields
+// are mapped to the message with the protobuf JSON mapping, fields the
+// message does not define are dropped.
+func (s *ProtobufSchema) Encode(fields common.MapStr) ([]byte, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(s.message)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(message)
+}
+
+// Decode returns the fields of a binary encoded message.
+func (s *ProtobufSchema) Decode(payload []byte) (common.MapStr, error) {
+	return decodeMessage(s.message, payload)
+}
+
+func decodeMessage(descriptor protoreflect.MessageDescriptor, payload []byte) (common.MapStr, error) {
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(payload, message); err != nil {
+		return nil, err
+	}
+	return messageFields(message), nil
+}
+
+func parseProto(spec string) (protoreflect.FileDescriptor, error) {
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{protoFilename: spec}),
+	}
+	parsed, err := parser.ParseFiles(protoFilename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf schema: %w", err)
+	}
+	return fileDescriptor(parsed[0], new(protoregistry.Files))
+}
+
+// fileDescriptor converts a parsed file and its imports to protoreflect
+// descriptors, registered in files.
+func fileDescriptor(parsed *desc.FileDescriptor, files *protoregistry.Files) (protoreflect.FileDescriptor, error) {
+	if file, err := files.FindFileByPath(parsed.GetName()); err == nil {
+		return file, nil
+	}
+	for _, dep := range parsed.GetDependencies() {
+		if _, err := fileDescriptor(dep, files); err != nil {
+			return nil, err
+		}
+	}
+	file, err := protodesc.NewFile(parsed.AsFileDescriptorProto(), files)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf schema: %w", err)
+	}
+	return file, files.RegisterFile(file)
+}
+
+// messageAt returns the message type at the indexes of the wire format.
+func messageAt(file protoreflect.FileDescriptor, indexes []int) (protoreflect.MessageDescriptor, error) {
+	if len(indexes) == 0 {
+		return nil, errors.New("no protobuf message index")
+	}
+	messages := file.Messages()
+	var message protoreflect.MessageDescriptor
+	for _, i := range indexes {
+		if i >= messages.Len() {
+			return nil, fmt.Errorf("protobuf schema has no message at index %v", indexes)
+		}
+		message = messages.Get(i)
+		messages = message.Messages()
+	}
+	return message, nil
+}
+
+func findMessage(file protoreflect.FileDescriptor, name string) (protoreflect.MessageDescriptor, error) {
+	names := []protoreflect.FullName{protoreflect.FullName(name)}
+	if pkg := file.Package(); pkg != "" {
+		names = append(names, protoreflect.FullName(string(pkg)+"."+name))
+	}
+	var find func(messages protoreflect.MessageDescriptors) protoreflect.MessageDescriptor
+	find = func(messages protoreflect.MessageDescriptors) protoreflect.MessageDescriptor {
+		for i := 0; i < messages.Len(); i++ {
+			message := messages.Get(i)
+			for _, name := range names {
+				if message.FullName() == name {
+					return message
+				}
+			}
+			if nested := find(message.Messages()); nested != nil {
+				return nested
+			}
+		}
+		return nil
+	}
+	if message := find(file.Messages()); message != nil {
+		return message, nil
+	}
+	return nil, fmt.Errorf("protobuf schema has no message '%s'", name)
+}
+
+func messageIndexes(message protoreflect.MessageDescriptor) []int {
+	var indexes []int
+	for d := protoreflect.Descriptor(message); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+	}
+	return indexes
+}
+
+// messageFields returns the populated fields of a message by their name.
+func messageFields(message protoreflect.Message) common.MapStr {
+	fields := common.MapStr{}
+	message.Range(func(field protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case field.IsList():
+			list := v.List()
+			values := make([]interface{}, list.Len())
+			for i := range values {
+				values[i] = fieldValue(field, list.Get(i))
+			}
+			fields[string(field.Name())] = values
+		case field.IsMap():
+			values := map[string]interface{}{}
+			v.Map().Range(func(key protoreflect.MapKey, v protoreflect.Value) bool {
+				values[key.String()] = fieldValue(field.MapValue(), v)
+				return true
+			})
+			fields[string(field.Name())] = values
+		default:
+			fields[string(field.Name())] = fieldValue(field, v)
+		}
+		return true
+	})
+	return fields
+}
+
+func fieldValue(field protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch field.Kind() {
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name())
+		}
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		message := v.Message()
+		if message.Descriptor().FullName() == "google.protobuf.Timestamp" {
+			fields := message.Descriptor().Fields()
+			seconds := message.Get(fields.ByName("seconds")).Int()
+			nanos := message.Get(fields.ByName("nanos")).Int()
+			return time.Unix(seconds, nanos).UTC()
+		}
+		return messageFields(message)
+	}
+	return v.Interface()
+}
@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const testProtobufSchema = `
+syntax = "proto3";
+package jidu.logs;
+
+import "google/protobuf/timestamp.proto";
+
+message Event {
+	enum Level {
+		INFO = 0;
+		WARN = 1;
+		ERROR = 2;
+	}
+	message Host {
+		string name = 1;
+		int64 cpus = 2;
+	}
+
+	google.protobuf.Timestamp timestamp = 1;
+	string message = 2;
+	Level level = 3;
+	repeated string tags = 4;
+	map<string, string> labels = 5;
+	Host host = 6;
+}
+
+message Metric {
+	string name = 1;
+	double value = 2;
+}
+`
+
+func TestProtobufSchemaRoundTrip(t *testing.T) {
+	schema, err := NewProtobufSchema(testProtobufSchema, "")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, schema.Indexes())
+
+	ts := time.Date(2022, 7, 1, 10, 30, 0, 0, time.UTC)
+	payload, err := schema.Encode(common.MapStr{
+		"timestamp": common.Time(ts),
+		"message":   "hello",
+		"level":     "WARN",
+		"tags":      []string{"a", "b"},
+		"labels":    common.MapStr{"env": "prod"},
+		"host":      common.MapStr{"name": "vehicle-1", "cpus": 4},
+		"ignored":   "dropped",
+	})
+	require.NoError(t, err)
+
+	fields, err := schema.Decode(payload)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"timestamp": ts,
+		"message":   "hello",
+		"level":     "WARN",
+		"tags":      []interface{}{"a", "b"},
+		"labels":    map[string]interface{}{"env": "prod"},
+		"host":      common.MapStr{"name": "vehicle-1", "cpus": int64(4)},
+	}, fields)
+}
+
+func TestProtobufSchemaMessage(t *testing.T) {
+	tests := map[string][]int{
+		"Metric":                {1},
+		"jidu.logs.Metric":      {1},
+		"Event.Host":            {0, 0},
+		"jidu.logs.Event.Host":  {0, 0},
+		"jidu.logs.Event.Level": nil,
+		"Missing":               nil,
+	}
+	for name, indexes := range tests {
+		t.Run(name, func(t *testing.T) {
+			schema, err := NewProtobufSchema(testProtobufSchema, name)
+			if indexes == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, indexes, schema.Indexes())
+		})
+	}
+
+	_, err := NewProtobufSchema(`syntax = "proto3"; message {`, "")
+	assert.Error(t, err, "invalid schema")
+}
+
+func TestProtobufSchemaEncodeErrors(t *testing.T) {
+	schema, err := NewProtobufSchema(testProtobufSchema, "Metric")
+	require.NoError(t, err)
+
+	_, err = schema.Encode(common.MapStr{"name": "cpu", "value": "high"})
+	assert.Error(t, err, "value is not a number")
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schemaregistrytest provides an in memory schema registry serving
+// the Confluent API over HTTP for tests.
+package schemaregistrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry is a schema registry test server. Schemas get the ids 1, 2, ...
+// in the order they are registered, the same schema registered under several
+// subjects keeps its id.
+type Registry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	schemas  []schema
+	subjects map[string][]int
+	requests int
+}
+
+type schema struct {
+	Type   string `json:"schemaType,omitempty"`
+	Schema string `json:"schema"`
+}
+
+type errorResponse struct {
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+// NewRegistry starts a Registry, it must be closed once done.
+func NewRegistry() *Registry {
+	r := &Registry{subjects: map[string][]int{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// Register registers a schema under the subject and returns its id. Avro
+// schemas have an empty type.
+func (r *Registry) Register(subject, schemaType, spec string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.register(subject, schema{Type: schemaType, Schema: spec})
+}
+
+// Requests returns the number of requests served.
+func (r *Registry) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+func (r *Registry) register(subject string, s schema) int {
+	if id, ok := r.lookup(subject, s); ok {
+		return id
+	}
+	id := 0
+	for i, registered := range r.schemas {
+		if registered == s {
+			id = i + 1
+		}
+	}
+	if id == 0 {
+		r.schemas = append(r.schemas, s)
+		id = len(r.schemas)
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id
+}
+
+func (r *Registry) lookup(subject string, s schema) (int, bool) {
+	for _, id := range r.subjects[subject] {
+		if r.schemas[id-1] == s {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (r *Registry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	path := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+	switch {
+	case req.Method == http.MethodGet && len(path) == 3 && path[0] == "schemas" && path[1] == "ids":
+		id, err := strconv.Atoi(path[2])
+		if err != nil || id < 1 || id > len(r.schemas) {
+			writeError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		writeJSON(w, r.schemas[id-1])
+	case req.Method == http.MethodGet && len(path) == 4 && path[0] == "subjects" && path[2] == "versions" && path[3] == "latest":
+		ids := r.subjects[subject(path[1])]
+		if len(ids) == 0 {
+			writeError(w, http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		id := ids[len(ids)-1]
+		writeJSON(w, map[string]interface{}{
+			"subject":    subject(path[1]),
+			"id":         id,
+			"version":    len(ids),
+			"schema":     r.schemas[id-1].Schema,
+			"schemaType": r.schemas[id-1].Type,
+		})
+	case req.Method == http.MethodPost && len(path) == 3 && path[0] == "subjects" && path[2] == "versions":
+		var s schema
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil || s.Schema == "" {
+			writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema")
+			return
+		}
+		writeJSON(w, map[string]int{"id": r.register(subject(path[1]), s)})
+	case req.Method == http.MethodPost && len(path) == 2 && path[0] == "subjects":
+		var s schema
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema")
+			return
+		}
+		id, ok := r.lookup(subject(path[1]), s)
+		if !ok {
+			writeError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"subject": subject(path[1]),
+			"id":      id,
+			"schema":  s.Schema,
+		})
+	default:
+		writeError(w, http.StatusNotFound, 404, "Not found")
+	}
+}
+
+func subject(escaped string) string {
+	s, err := url.PathUnescape(escaped)
+	if err != nil {
+		return escaped
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
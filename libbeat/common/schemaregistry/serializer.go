@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// SerializerConfig configures the schema a Serializer writes a subject with.
+type SerializerConfig struct {
+	Registry Config `config:"registry"`
+	Subject  string `config:"subject" validate:"required"`
+
+	// Schema is the schema to write, the latest version of the subject is
+	// written if it is empty.
+	Schema       string `config:"schema"`
+	AutoRegister bool   `config:"auto_register"`
+
+	// TimestampField is the top level field the timestamp of the events is
+	// written to, unless the event sets it.
+	TimestampField string `config:"timestamp_field"`
+}
+
+// DefaultSerializerConfig returns the default serializer settings.
+func DefaultSerializerConfig() SerializerConfig {
+	return SerializerConfig{
+		Registry:       DefaultConfig(),
+		AutoRegister:   true,
+		TimestampField: "timestamp",
+	}
+}
+
+// Serializer encodes events in the wire format with the schema of a subject.
+// The schema is resolved in the registry with the first event serialized,
+// and again with the next one if that fails.
+type Serializer struct {
+	client  *Client
+	config  SerializerConfig
+	schema  Schema
+	message string
+
+	encode func(common.MapStr) ([]byte, error)
+}
+
+// NewAvroSerializer creates a Serializer writing Avro records.
+func NewAvroSerializer(config SerializerConfig) (*Serializer, error) {
+	if config.Schema != "" {
+		if _, err := NewAvroSchema(config.Schema); err != nil {
+			return nil, err
+		}
+	}
+	return newSerializer(config, Schema{Type: TypeAvro, Schema: config.Schema}, "")
+}
+
+// NewProtobufSerializer creates a Serializer writing the protobuf message
+// type with the name, the first message of the schema if empty.
+func NewProtobufSerializer(config SerializerConfig, message string) (*Serializer, error) {
+	if config.Schema != "" {
+		if _, err := NewProtobufSchema(config.Schema, message); err != nil {
+			return nil, err
+		}
+	}
+	return newSerializer(config, Schema{Type: TypeProtobuf, Schema: config.Schema}, message)
+}
+
+func newSerializer(config SerializerConfig, schema Schema, message string) (*Serializer, error) {
+	client, err := NewClient(config.Registry)
+	if err != nil {
+		return nil, err
+	}
+	return &Serializer{client: client, config: config, schema: schema, message: message}, nil
+}
+
+// Serialize encodes the fields of an event.
+func (s *Serializer) Serialize(timestamp time.Time, fields common.MapStr) ([]byte, error) {
+	if s.encode == nil {
+		if err := s.resolve(); err != nil {
+			return nil, err
+		}
+	}
+
+	if name := s.config.TimestampField; name != "" {
+		if _, exists := fields[name]; !exists {
+			withTimestamp := make(common.MapStr, len(fields)+1)
+			for k, v := range fields {
+				withTimestamp[k] = v
+			}
+			withTimestamp[name] = timestamp
+			fields = withTimestamp
+		}
+	}
+	return s.encode(fields)
+}
+
+func (s *Serializer) resolve() error {
+	schema, err := s.client.Resolve(s.config.Subject, s.schema, s.config.AutoRegister)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the schema of subject '%s': %w", s.config.Subject, err)
+	}
+
+	switch schema.Type {
+	case TypeAvro:
+		avro, err := NewAvroSchema(schema.Schema)
+		if err != nil {
+			return err
+		}
+		s.encode = func(fields common.MapStr) ([]byte, error) {
+			payload, err := avro.Encode(fields)
+			if err != nil {
+				return nil, err
+			}
+			return Frame(schema.ID, payload), nil
+		}
+	case TypeProtobuf:
+		protobuf, err := NewProtobufSchema(schema.Schema, s.message)
+		if err != nil {
+			return err
+		}
+		s.encode = func(fields common.MapStr) ([]byte, error) {
+			payload, err := protobuf.Encode(fields)
+			if err != nil {
+				return nil, err
+			}
+			return FrameProtobuf(schema.ID, protobuf.Indexes(), payload), nil
+		}
+	}
+	return nil
+}
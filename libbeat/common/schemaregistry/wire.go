@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// magicByte starts the payloads of the registry wire format, followed by the
+// big endian id of the schema they are encoded with.
+const magicByte = 0
+
+const headerSize = 5
+
+// Frame prefixes the payload with the wire format header of the schema id.
+func Frame(id int, payload []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	putHeader(buf, id)
+	return append(buf, payload...)
+}
+
+// FrameProtobuf prefixes a protobuf payload with the wire format header of
+// the schema id and the indexes of its message type in the schema: the index
+// of the top level message followed by the indexes of the nested ones. The
+// indexes are written as zig-zag varints preceded by their count, the first
+// message of a schema as a single 0.
+func FrameProtobuf(id int, indexes []int, payload []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+binary.MaxVarintLen64*(len(indexes)+1)+len(payload))
+	putHeader(buf, id)
+	if len(indexes) == 1 && indexes[0] == 0 {
+		buf = appendVarint(buf, 0)
+	} else {
+		buf = appendVarint(buf, int64(len(indexes)))
+		for _, i := range indexes {
+			buf = appendVarint(buf, int64(i))
+		}
+	}
+	return append(buf, payload...)
+}
+
+// Unframe returns the schema id and the payload of data in the wire format.
+func Unframe(data []byte) (int, []byte, error) {
+	if len(data) < headerSize {
+		return 0, nil, fmt.Errorf("payload of %d bytes is too short for the schema registry wire format", len(data))
+	}
+	if data[0] != magicByte {
+		return 0, nil, fmt.Errorf("unknown magic byte %d", data[0])
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
+
+// unframeProtobuf returns the message indexes and the protobuf payload
+// following the wire format header.
+func unframeProtobuf(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, nil, errors.New("invalid protobuf message indexes")
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+	if count < 0 || count > int64(len(data)) {
+		return nil, nil, fmt.Errorf("invalid count of protobuf message indexes %d", count)
+	}
+
+	indexes := make([]int, count)
+	for i := range indexes {
+		index, n := binary.Varint(data)
+		if n <= 0 || index < 0 {
+			return nil, nil, errors.New("invalid protobuf message indexes")
+		}
+		indexes[i] = int(index)
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
+
+func putHeader(buf []byte, id int) {
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:headerSize], uint32(id))
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
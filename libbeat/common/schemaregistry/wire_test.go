@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrame(t *testing.T) {
+	data := Frame(258, []byte("payload"))
+	assert.Equal(t, []byte{0, 0, 0, 1, 2}, data[:5])
+
+	id, payload, err := Unframe(data)
+	require.NoError(t, err)
+	assert.Equal(t, 258, id)
+	assert.Equal(t, []byte("payload"), payload)
+
+	_, _, err = Unframe([]byte{1, 0, 0, 0, 1, 'x'})
+	assert.Error(t, err, "unknown magic byte")
+	_, _, err = Unframe([]byte{0, 0, 0})
+	assert.Error(t, err, "truncated header")
+}
+
+func TestFrameProtobuf(t *testing.T) {
+	tests := map[string]struct {
+		indexes []int
+		header  []byte
+	}{
+		"first message":  {[]int{0}, []byte{0}},
+		"second message": {[]int{1}, []byte{2, 2}},
+		"nested message": {[]int{0, 2}, []byte{4, 0, 4}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := FrameProtobuf(7, test.indexes, []byte("payload"))
+			id, payload, err := Unframe(data)
+			require.NoError(t, err)
+			assert.Equal(t, 7, id)
+			assert.Equal(t, test.header, payload[:len(test.header)])
+
+			indexes, payload, err := unframeProtobuf(payload)
+			require.NoError(t, err)
+			assert.Equal(t, test.indexes, indexes)
+			assert.Equal(t, []byte("payload"), payload)
+		})
+	}
+}
@@ -55,6 +55,10 @@ type BulkMeta struct {
 	DocType  string `json:"_type,omitempty" struct:"_type,omitempty"`
 	Pipeline string `json:"pipeline,omitempty" struct:"pipeline,omitempty"`
 	ID       string `json:"_id,omitempty" struct:"_id,omitempty"`
+
+	// Routing and RequireAlias are only set by events overriding them.
+	Routing      string `json:"routing,omitempty" struct:"routing,omitempty"`
+	RequireAlias *bool  `json:"require_alias,omitempty" struct:"require_alias,omitempty"`
 }
 
 type bulkRequest struct {
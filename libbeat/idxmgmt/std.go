@@ -40,6 +40,7 @@ type indexSupport struct {
 	migration    bool
 	templateCfg  template.TemplateConfig
 	defaultIndex string
+	dataStream   bool
 
 	st indexState
 }
@@ -57,8 +58,9 @@ type indexManager struct {
 }
 
 type indexSelector struct {
-	sel      outil.Selector
-	beatInfo beat.Info
+	sel        outil.Selector
+	beatInfo   beat.Info
+	dataStream bool
 }
 
 type ilmIndexSelector struct {
@@ -117,16 +119,32 @@ func newIndexSupport(
 		return nil, err
 	}
 
+	defaultIndex := fmt.Sprintf("%v-%v-%%{+yyyy.MM.dd}", info.IndexPrefix, info.Version)
+	if tmplCfg.DataStream.Enabled {
+		// events are written to the data stream named after the template
+		defaultIndex = tmplCfg.Name
+		if defaultIndex == "" {
+			defaultIndex = fmt.Sprintf("%v-%v", info.IndexPrefix, info.Version)
+		}
+	}
+
 	return &indexSupport{
 		log:          log,
 		ilm:          ilmSupporter,
 		info:         info,
 		templateCfg:  tmplCfg,
 		migration:    migration,
-		defaultIndex: fmt.Sprintf("%v-%v-%%{+yyyy.MM.dd}", info.IndexPrefix, info.Version),
+		defaultIndex: defaultIndex,
+		dataStream:   tmplCfg.DataStream.Enabled,
 	}, nil
 }
 
+// DataStreams returns true if events are written to data streams, which
+// only accept the create operation.
+func (s *indexSupport) DataStreams() bool {
+	return s.dataStream
+}
+
 func (s *indexSupport) Enabled() bool {
 	return s.enabled(componentTemplate) || s.enabled(componentILM)
 }
@@ -179,6 +197,10 @@ func (s *indexSupport) BuildSelector(cfg *common.Config) (outputs.IndexSelector,
 
 	var alias string
 	mode := s.ilm.Mode()
+	if s.dataStream {
+		// data streams roll over by themselves, no write alias is used
+		mode = ilm.ModeDisabled
+	}
 	if mode != ilm.ModeDisabled {
 		alias = s.ilm.Alias().Name
 		log.Infof("Set %v to '%s' as ILM is enabled.", cfg.PathOf("index"), alias)
@@ -235,7 +257,7 @@ func (s *indexSupport) BuildSelector(cfg *common.Config) (outputs.IndexSelector,
 	}
 
 	if mode != ilm.ModeAuto {
-		return indexSelector{indexSel, s.info}, nil
+		return indexSelector{indexSel, s.info, s.dataStream}, nil
 	}
 
 	selCfg.SetString("index", -1, alias)
@@ -308,7 +330,12 @@ func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
 		tmplCfg := m.support.templateCfg
 		tmplCfg.Overwrite, tmplCfg.Enabled = templateComponent.overwrite, templateComponent.enabled
 
-		if ilmComponent.enabled {
+		if ilmComponent.enabled && m.support.dataStream {
+			tmplCfg, err = applyDataStreamILMSettings(log, tmplCfg, m.support.ilm.Policy())
+			if err != nil {
+				return err
+			}
+		} else if ilmComponent.enabled {
 			tmplCfg, err = applyILMSettings(log, tmplCfg, m.support.ilm.Policy(), m.support.ilm.Alias())
 			if err != nil {
 				return err
@@ -323,7 +350,7 @@ func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
 		log.Info("Loaded index template.")
 	}
 
-	if ilmComponent.load {
+	if ilmComponent.load && !m.support.dataStream {
 		err := m.ilm.EnsureAlias()
 		if err != nil {
 			return err
@@ -350,7 +377,7 @@ func (m *indexManager) setupWithILM() (bool, error) {
 }
 
 func (s *ilmIndexSelector) Select(evt *beat.Event) (string, error) {
-	if idx := getEventCustomIndex(evt, s.beatInfo); idx != "" {
+	if idx := getEventCustomIndex(evt, s.beatInfo, false); idx != "" {
 		return idx, nil
 	}
 
@@ -364,13 +391,13 @@ func (s *ilmIndexSelector) Select(evt *beat.Event) (string, error) {
 }
 
 func (s indexSelector) Select(evt *beat.Event) (string, error) {
-	if idx := getEventCustomIndex(evt, s.beatInfo); idx != "" {
+	if idx := getEventCustomIndex(evt, s.beatInfo, s.dataStream); idx != "" {
 		return idx, nil
 	}
 	return s.sel.Select(evt)
 }
 
-func getEventCustomIndex(evt *beat.Event, beatInfo beat.Info) string {
+func getEventCustomIndex(evt *beat.Event, beatInfo beat.Info, dataStream bool) string {
 	if len(evt.Meta) == 0 {
 		return ""
 	}
@@ -380,6 +407,10 @@ func getEventCustomIndex(evt *beat.Event, beatInfo beat.Info) string {
 	}
 
 	if idx, err := events.GetMetaStringValue(*evt, events.FieldMetaIndex); err == nil {
+		if dataStream {
+			// the data stream handles the backing indices
+			return strings.ToLower(idx)
+		}
 		ts := evt.Timestamp.UTC()
 		return fmt.Sprintf("%s-%d.%02d.%02d",
 			strings.ToLower(idx), ts.Year(), ts.Month(), ts.Day())
@@ -429,7 +460,55 @@ func applyILMSettings(
 	}
 
 	// rollover_alias and lifecycle.name can't be configured and will be overwritten
+	tmpl, lifecycle, err := copyLifecycleSettings(tmpl)
+	if err != nil {
+		return tmpl, err
+	}
+
+	// add rollover_alias and name to index.lifecycle settings
+	if _, exists := lifecycle["rollover_alias"]; !exists {
+		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
+		lifecycle["rollover_alias"] = alias.Name
+	}
+	if _, exists := lifecycle["name"]; !exists {
+		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
+		lifecycle["name"] = policy.Name
+	}
+
+	return tmpl, nil
+}
+
+// applyDataStreamILMSettings sets the ILM policy of the data stream backing
+// indices. Data streams are rolled over without alias, the template name and
+// pattern are kept.
+func applyDataStreamILMSettings(
+	log *logp.Logger,
+	tmpl template.TemplateConfig,
+	policy ilm.Policy,
+) (template.TemplateConfig, error) {
+	if !tmpl.Enabled {
+		return tmpl, nil
+	}
+
+	if policy.Name == "" {
+		return tmpl, errors.New("no ilm policy name configured")
+	}
+
+	tmpl, lifecycle, err := copyLifecycleSettings(tmpl)
+	if err != nil {
+		return tmpl, err
+	}
+	if _, exists := lifecycle["name"]; !exists {
+		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
+		lifecycle["name"] = policy.Name
+	}
+
+	return tmpl, nil
+}
 
+// copyLifecycleSettings copies the template index settings, returning the
+// index.lifecycle settings of the copy to update.
+func copyLifecycleSettings(tmpl template.TemplateConfig) (template.TemplateConfig, map[string]interface{}, error) {
 	// init/copy index settings
 	idxSettings := tmpl.Settings.Index
 	if idxSettings == nil {
@@ -453,19 +532,9 @@ func applyILMSettings(
 			lifecycle[k] = v
 		}
 	} else {
-		return tmpl, errors.New("settings.index.lifecycle must be an object")
+		return tmpl, nil, errors.New("settings.index.lifecycle must be an object")
 	}
 	idxSettings["lifecycle"] = lifecycle
 
-	// add rollover_alias and name to index.lifecycle settings
-	if _, exists := lifecycle["rollover_alias"]; !exists {
-		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
-		lifecycle["rollover_alias"] = alias.Name
-	}
-	if _, exists := lifecycle["name"]; !exists {
-		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
-		lifecycle["name"] = policy.Name
-	}
-
-	return tmpl, nil
+	return tmpl, lifecycle, nil
 }
@@ -210,6 +210,24 @@ func TestDefaultSupport_BuildSelector(t *testing.T) {
 				"index": "event-index",
 			},
 		},
+		"data stream with template name": {
+			ilmCalls: ilmTemplateSettings("test-9.9.9", "test-9.9.9"),
+			imCfg: map[string]interface{}{
+				"setup.template.data_stream.enabled": true,
+				"setup.template.name":                "metrics-test",
+			},
+			cfg:  map[string]interface{}{},
+			want: stable("metrics-test"),
+		},
+		"event index with data stream": {
+			ilmCalls: ilmTemplateSettings("test-9.9.9", "test-9.9.9"),
+			imCfg:    map[string]interface{}{"setup.template.data_stream.enabled": true},
+			cfg:      map[string]interface{}{},
+			want:     stable("event-index"),
+			meta: common.MapStr{
+				"index": "Event-index",
+			},
+		},
 		"use indices": {
 			ilmCalls: ilmTemplateSettings("test-9.9.9", "test-9.9.9"),
 			cfg: map[string]interface{}{
@@ -460,6 +478,17 @@ func TestIndexManager_Setup(t *testing.T) {
 				"settings.index.lifecycle.rollover_alias": "test-9.9.9",
 			}),
 		},
+		"template data stream ilm default": {
+			cfg: common.MapStr{
+				"setup.template.data_stream.enabled": true,
+			},
+			tmplCfg: cfgWith(template.DefaultConfig(), map[string]interface{}{
+				"overwrite":                     "true",
+				"data_stream.enabled":           "true",
+				"settings.index.lifecycle.name": "test",
+			}),
+			policy: "test",
+		},
 		"template loadmode disabled ilm loadmode disabled": {
 			loadTemplate: LoadModeDisabled,
 			loadILM:      LoadModeDisabled,
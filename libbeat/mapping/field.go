@@ -125,6 +125,17 @@ func (d *DynamicType) Unpack(s string) error {
 	return nil
 }
 
+// IsDimension returns true if the field identifies a time series. Keywords are
+// dimensions by default, which can be disabled with `dimension: false`.
+func (f *Field) IsDimension() bool {
+	if f.Dimension == nil {
+		return f.Type == "keyword" || (f.Type == "object" && f.ObjectType == "keyword")
+	}
+
+	// user defined dimension (dimension: true in fields.yml)
+	return *f.Dimension
+}
+
 // Validate ensures objectTypeParams are not mixed with top level objectType configuration
 func (f *Field) Validate() error {
 	if err := f.validateType(); err != nil {
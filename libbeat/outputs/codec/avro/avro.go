@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// Encoder serializes a beat.Event to an Avro record in the schema registry
+// wire format.
+type Encoder struct {
+	serializer *schemaregistry.Serializer
+}
+
+// Config is used to pass encoding parameters to New.
+type Config = schemaregistry.SerializerConfig
+
+func init() {
+	codec.RegisterType("avro", func(_ beat.Info, cfg *common.Config) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("avro codec requires a subject and a schema registry")
+		}
+		config := schemaregistry.DefaultSerializerConfig()
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		return New(config)
+	})
+}
+
+// New creates a new avro Encoder.
+func New(config Config) (*Encoder, error) {
+	serializer, err := schemaregistry.NewAvroSerializer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{serializer: serializer}, nil
+}
+
+// Encode serializes the fields of a beat event with the Avro schema of the
+// subject.
+func (e *Encoder) Encode(_ string, event *beat.Event) ([]byte, error) {
+	return e.serializer.Serialize(event.Timestamp, event.Fields)
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "Log",
+	"fields": [
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "message", "type": "string"},
+		{"name": "level", "type": ["null", "string"], "default": null}
+	]
+}`
+
+func createEncoder(t *testing.T, settings map[string]interface{}) (codec.Codec, error) {
+	var config codec.Config
+	err := common.MustNewConfigFrom(map[string]interface{}{"avro": settings}).Unpack(&config)
+	require.NoError(t, err)
+	return codec.CreateEncoder(beat.Info{}, config)
+}
+
+func TestEncodeRegistersSchema(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+
+	encoder, err := createEncoder(t, map[string]interface{}{
+		"registry.url": registry.URL,
+		"subject":      "logs-value",
+		"schema":       testSchema,
+	})
+	require.NoError(t, err)
+
+	ts := time.Date(2022, 7, 1, 10, 30, 0, 0, time.UTC)
+	data, err := encoder.Encode("logs", &beat.Event{
+		Timestamp: ts,
+		Fields:    common.MapStr{"message": "hello", "host": common.MapStr{"name": "vehicle-1"}},
+	})
+	require.NoError(t, err)
+
+	id, _, err := schemaregistry.Unframe(data)
+	require.NoError(t, err)
+	assert.Equal(t, registry.Register("logs-value", "", testSchema), id, "schema is registered")
+
+	config := schemaregistry.DefaultConfig()
+	config.URL = registry.URL
+	client, err := schemaregistry.NewClient(config)
+	require.NoError(t, err)
+	fields, err := schemaregistry.NewDeserializer(client).Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"timestamp": ts, "message": "hello", "level": nil}, fields)
+}
+
+func TestEncodeLatestSchema(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+
+	encoder, err := createEncoder(t, map[string]interface{}{
+		"registry.url": registry.URL,
+		"subject":      "logs-value",
+	})
+	require.NoError(t, err)
+
+	event := &beat.Event{Timestamp: time.Now(), Fields: common.MapStr{"message": "hello"}}
+	_, err = encoder.Encode("logs", event)
+	assert.Error(t, err, "subject has no schema yet")
+
+	id := registry.Register("logs-value", "", testSchema)
+	data, err := encoder.Encode("logs", event)
+	require.NoError(t, err)
+	actual, _, err := schemaregistry.Unframe(data)
+	require.NoError(t, err)
+	assert.Equal(t, id, actual)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := createEncoder(t, map[string]interface{}{"registry.url": "http://localhost:8081"})
+	assert.Error(t, err, "subject is required")
+
+	_, err = createEncoder(t, map[string]interface{}{"subject": "logs-value"})
+	assert.Error(t, err, "registry url is required")
+
+	_, err = createEncoder(t, map[string]interface{}{
+		"registry.url": "http://localhost:8081",
+		"subject":      "logs-value",
+		"schema":       `{"type": "record", "name": "Log"}`,
+	})
+	assert.Error(t, err, "schema is invalid")
+}
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+const testSchema = `
+syntax = "proto3";
+package jidu.logs;
+
+import "google/protobuf/timestamp.proto";
+
+message Log {
+	google.protobuf.Timestamp timestamp = 1;
+	string message = 2;
+}
+
+message Metric {
+	google.protobuf.Timestamp timestamp = 1;
+	string name = 2;
+	double value = 3;
+}
+`
+
+func createEncoder(t *testing.T, settings map[string]interface{}) (codec.Codec, error) {
+	var config codec.Config
+	err := common.MustNewConfigFrom(map[string]interface{}{"protobuf": settings}).Unpack(&config)
+	require.NoError(t, err)
+	return codec.CreateEncoder(beat.Info{}, config)
+}
+
+func TestEncode(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+
+	encoder, err := createEncoder(t, map[string]interface{}{
+		"registry.url": registry.URL,
+		"subject":      "metrics-value",
+		"schema":       testSchema,
+		"message":      "Metric",
+	})
+	require.NoError(t, err)
+
+	ts := time.Date(2022, 7, 1, 10, 30, 0, 0, time.UTC)
+	data, err := encoder.Encode("metrics", &beat.Event{
+		Timestamp: ts,
+		Fields:    common.MapStr{"name": "cpu", "value": 0.5, "host": common.MapStr{"name": "vehicle-1"}},
+	})
+	require.NoError(t, err)
+
+	id, payload, err := schemaregistry.Unframe(data)
+	require.NoError(t, err)
+	assert.Equal(t, registry.Register("metrics-value", "PROTOBUF", testSchema), id, "schema is registered")
+	assert.Equal(t, byte(2), payload[0], "one message index")
+	assert.Equal(t, byte(2), payload[1], "second message")
+
+	config := schemaregistry.DefaultConfig()
+	config.URL = registry.URL
+	client, err := schemaregistry.NewClient(config)
+	require.NoError(t, err)
+	fields, err := schemaregistry.NewDeserializer(client).Decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"timestamp": ts, "name": "cpu", "value": 0.5}, fields)
+}
+
+func TestEncodeWithoutRegistering(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+
+	encoder, err := createEncoder(t, map[string]interface{}{
+		"registry.url":  registry.URL,
+		"subject":       "logs-value",
+		"schema":        testSchema,
+		"auto_register": false,
+	})
+	require.NoError(t, err)
+
+	event := &beat.Event{Timestamp: time.Now(), Fields: common.MapStr{"message": "hello"}}
+	_, err = encoder.Encode("logs", event)
+	assert.Error(t, err, "schema is not registered")
+
+	id := registry.Register("logs-value", "PROTOBUF", testSchema)
+	data, err := encoder.Encode("logs", event)
+	require.NoError(t, err)
+	assert.Equal(t, schemaregistry.FrameProtobuf(id, []int{0}, nil), data[:6])
+}
+
+func TestConfig(t *testing.T) {
+	_, err := createEncoder(t, map[string]interface{}{
+		"registry.url": "http://localhost:8081",
+		"subject":      "logs-value",
+		"schema":       testSchema,
+		"message":      "Missing",
+	})
+	assert.Error(t, err, "schema has no such message")
+}
@@ -0,0 +1,266 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// adaptiveRegistryName is the monitoring registry reporting the current
+// settings of the adaptive controller.
+const adaptiveRegistryName = "libbeat.outputs.elasticsearch.adaptive"
+
+// adaptiveConfig configures the adaptive controller of the bulk requests.
+// bulk_max_size is the largest bulk size, and the number of workers of all
+// the hosts the largest concurrency.
+type adaptiveConfig struct {
+	Enabled          bool             `config:"enabled"`
+	MinBulkSize      int              `config:"min_bulk_size"`
+	MaxBulkBytes     cfgtype.ByteSize `config:"max_bulk_bytes"`
+	MinConcurrency   int              `config:"min_concurrency"`
+	MaxConcurrency   int              `config:"max_concurrency"`
+	TargetLatency    time.Duration    `config:"target_latency"`
+	MaxRejectionRate float64          `config:"max_rejection_rate"`
+	Increase         int              `config:"increase"`
+	Decrease         float64          `config:"decrease"`
+}
+
+var defaultAdaptiveConfig = adaptiveConfig{
+	Enabled:          false,
+	MinBulkSize:      10,
+	MaxBulkBytes:     10 * 1024 * 1024,
+	MinConcurrency:   1,
+	MaxConcurrency:   0,
+	TargetLatency:    5 * time.Second,
+	MaxRejectionRate: 0,
+	Increase:         10,
+	Decrease:         0.5,
+}
+
+func (c *adaptiveConfig) Validate() error {
+	switch {
+	case c.MinBulkSize < 1:
+		return errors.New("adaptive.min_bulk_size must be at least 1")
+	case c.MaxBulkBytes < 1:
+		return errors.New("adaptive.max_bulk_bytes must be at least 1")
+	case c.MinConcurrency < 1:
+		return errors.New("adaptive.min_concurrency must be at least 1")
+	case c.MaxConcurrency != 0 && c.MaxConcurrency < c.MinConcurrency:
+		return errors.New("adaptive.max_concurrency must not be less than adaptive.min_concurrency")
+	case c.TargetLatency <= 0:
+		return errors.New("adaptive.target_latency must be positive")
+	case c.MaxRejectionRate < 0 || c.MaxRejectionRate >= 1:
+		return errors.New("adaptive.max_rejection_rate must be in [0, 1)")
+	case c.Increase < 1:
+		return errors.New("adaptive.increase must be at least 1")
+	case c.Decrease <= 0 || c.Decrease >= 1:
+		return errors.New("adaptive.decrease must be in (0, 1)")
+	}
+	return nil
+}
+
+// adaptiveController sizes the bulk requests of the clients of an output,
+// and limits how many of them are in flight, with AIMD (additive increase,
+// multiplicative decrease). Each response without congestion adds
+// adaptive.increase events to the bulk size up to bulk_max_size, then one
+// request to the concurrency. A response rejecting more than
+// adaptive.max_rejection_rate of its events with 429 Too Many Requests, or
+// slower than adaptive.target_latency, multiplies both by adaptive.decrease.
+// Only the responses to requests sent since the last change increase the
+// settings, and since the last decrease decrease them, so a burst of
+// rejections decreases the settings once. It starts at the largest settings,
+// as the output does without it.
+type adaptiveController struct {
+	config         adaptiveConfig
+	maxBulkSize    int
+	maxConcurrency int
+
+	mu          sync.Mutex
+	bulkSize    int
+	concurrency int
+	inFlight    int
+	generation  uint64        // incremented by each change of the settings
+	decreased   uint64        // generation of the last decrease
+	released    chan struct{} // closed and replaced when a request completes
+
+	metrics adaptiveMetrics
+}
+
+type adaptiveMetrics struct {
+	bulkSize     *monitoring.Int
+	maxBulkBytes *monitoring.Int
+	concurrency  *monitoring.Int
+	inFlight     *monitoring.Int
+	increases    *monitoring.Uint
+	decreases    *monitoring.Uint
+}
+
+// bulkOutcome is the response to a bulk request, as seen by the adaptive
+// controller.
+type bulkOutcome struct {
+	responded bool // false on connection errors, left to the backoff
+	events    int  // number of events in the request
+	rejected  int  // number of events rejected with 429 Too Many Requests
+	latency   time.Duration
+}
+
+// newAdaptiveController creates the controller shared by the clients of an
+// output. The concurrency is at most the number of clients, as each sends
+// one request at a time.
+func newAdaptiveController(config adaptiveConfig, maxBulkSize, clients int, reg *monitoring.Registry) *adaptiveController {
+	maxConcurrency := config.MaxConcurrency
+	if maxConcurrency == 0 || maxConcurrency > clients {
+		maxConcurrency = clients
+	}
+	if config.MinConcurrency > maxConcurrency {
+		config.MinConcurrency = maxConcurrency
+	}
+	if config.MinBulkSize > maxBulkSize {
+		config.MinBulkSize = maxBulkSize
+	}
+
+	c := &adaptiveController{
+		config:         config,
+		maxBulkSize:    maxBulkSize,
+		maxConcurrency: maxConcurrency,
+		bulkSize:       maxBulkSize,
+		concurrency:    maxConcurrency,
+		released:       make(chan struct{}),
+		metrics: adaptiveMetrics{
+			bulkSize:     monitoring.NewInt(reg, "bulk_size"),
+			maxBulkBytes: monitoring.NewInt(reg, "max_bulk_bytes"),
+			concurrency:  monitoring.NewInt(reg, "concurrency"),
+			inFlight:     monitoring.NewInt(reg, "in_flight"),
+			increases:    monitoring.NewUint(reg, "increases"),
+			decreases:    monitoring.NewUint(reg, "decreases"),
+		},
+	}
+	c.metrics.maxBulkBytes.Set(int64(config.MaxBulkBytes))
+	c.updateMetrics()
+	return c
+}
+
+// newAdaptiveRegistry creates the registry of the adaptive controller,
+// replacing the one of a previous output.
+func newAdaptiveRegistry() *monitoring.Registry {
+	monitoring.Default.Remove(adaptiveRegistryName)
+	return monitoring.Default.NewRegistry(adaptiveRegistryName)
+}
+
+// maxBytes is the largest size of the messages of a bulk request, a request
+// with a single event larger than it is sent anyway.
+func (c *adaptiveController) maxBytes() int {
+	return int(c.config.MaxBulkBytes)
+}
+
+// acquire waits until a request can be sent and returns the number of events
+// to send in it. The generation must be passed to release once the request
+// completes.
+func (c *adaptiveController) acquire(ctx context.Context) (bulkSize int, generation uint64, err error) {
+	c.mu.Lock()
+	for c.inFlight >= c.concurrency {
+		released := c.released
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, 0, ctx.Err()
+		case <-released:
+		}
+		c.mu.Lock()
+	}
+	defer c.mu.Unlock()
+
+	c.inFlight++
+	c.updateMetrics()
+	return c.bulkSize, c.generation, nil
+}
+
+// release frees the slot of a completed request and adapts the settings to
+// its outcome.
+func (c *adaptiveController) release(generation uint64, outcome bulkOutcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	if outcome.responded {
+		congested := c.congested(outcome)
+		if congested && generation >= c.decreased {
+			c.decrease()
+		} else if !congested && generation == c.generation {
+			c.increase()
+		}
+	}
+	c.updateMetrics()
+
+	close(c.released)
+	c.released = make(chan struct{})
+}
+
+func (c *adaptiveController) congested(outcome bulkOutcome) bool {
+	if outcome.latency > c.config.TargetLatency {
+		return true
+	}
+	return outcome.rejected > 0 &&
+		float64(outcome.rejected) > c.config.MaxRejectionRate*float64(outcome.events)
+}
+
+func (c *adaptiveController) increase() {
+	switch {
+	case c.bulkSize < c.maxBulkSize:
+		c.bulkSize += c.config.Increase
+		if c.bulkSize > c.maxBulkSize {
+			c.bulkSize = c.maxBulkSize
+		}
+	case c.concurrency < c.maxConcurrency:
+		c.concurrency++
+	default:
+		return
+	}
+	c.generation++
+	c.metrics.increases.Inc()
+}
+
+func (c *adaptiveController) decrease() {
+	bulkSize := int(float64(c.bulkSize) * c.config.Decrease)
+	if bulkSize < c.config.MinBulkSize {
+		bulkSize = c.config.MinBulkSize
+	}
+	concurrency := int(float64(c.concurrency) * c.config.Decrease)
+	if concurrency < c.config.MinConcurrency {
+		concurrency = c.config.MinConcurrency
+	}
+	if bulkSize == c.bulkSize && concurrency == c.concurrency {
+		return
+	}
+	c.bulkSize, c.concurrency = bulkSize, concurrency
+	c.generation++
+	c.decreased = c.generation
+	c.metrics.decreases.Inc()
+}
+
+func (c *adaptiveController) updateMetrics() {
+	c.metrics.bulkSize.Set(int64(c.bulkSize))
+	c.metrics.concurrency.Set(int64(c.concurrency))
+	c.metrics.inFlight.Set(int64(c.inFlight))
+}
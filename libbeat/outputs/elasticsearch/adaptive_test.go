@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+)
+
+func newTestAdaptiveController(maxBulkSize, clients int) (*adaptiveController, *monitoring.Registry) {
+	config := defaultAdaptiveConfig
+	config.Enabled = true
+	config.TargetLatency = time.Second
+	reg := monitoring.NewRegistry()
+	return newAdaptiveController(config, maxBulkSize, clients, reg), reg
+}
+
+func TestAdaptiveControllerAIMD(t *testing.T) {
+	c, reg := newTestAdaptiveController(50, 4)
+	ctx := context.Background()
+
+	bulkSize, gen, err := c.acquire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 50, bulkSize)
+	assert.Equal(t, 4, c.concurrency)
+
+	// a request sent before the decrease does not decrease again
+	_, staleGen, err := c.acquire(ctx)
+	require.NoError(t, err)
+	c.release(gen, bulkOutcome{responded: true, events: 50, rejected: 1})
+	assert.Equal(t, 25, c.bulkSize)
+	assert.Equal(t, 2, c.concurrency)
+	c.release(staleGen, bulkOutcome{responded: true, events: 50, rejected: 50})
+	assert.Equal(t, 25, c.bulkSize)
+
+	// slow responses are congestion too
+	_, gen, _ = c.acquire(ctx)
+	c.release(gen, bulkOutcome{responded: true, events: 25, latency: 2 * time.Second})
+	assert.Equal(t, 12, c.bulkSize)
+	assert.Equal(t, 1, c.concurrency)
+
+	// connection errors are left to the backoff
+	_, gen, _ = c.acquire(ctx)
+	c.release(gen, bulkOutcome{events: 12})
+	assert.Equal(t, 12, c.bulkSize)
+
+	// the bulk size grows to bulk_max_size, then the concurrency
+	for i := 0; i < 6; i++ {
+		_, gen, _ = c.acquire(ctx)
+		c.release(gen, bulkOutcome{responded: true, events: 10})
+	}
+	assert.Equal(t, 50, c.bulkSize)
+	assert.Equal(t, 3, c.concurrency)
+
+	// the settings don't decrease below their minimum
+	for i := 0; i < 10; i++ {
+		_, gen, _ = c.acquire(ctx)
+		c.release(gen, bulkOutcome{responded: true, events: 10, rejected: 10})
+	}
+	assert.Equal(t, 10, c.bulkSize)
+	assert.Equal(t, 1, c.concurrency)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(10), snapshot.Ints["bulk_size"])
+	assert.Equal(t, int64(1), snapshot.Ints["concurrency"])
+	assert.Equal(t, int64(0), snapshot.Ints["in_flight"])
+	assert.Equal(t, int64(10*1024*1024), snapshot.Ints["max_bulk_bytes"])
+	assert.Equal(t, int64(6), snapshot.Ints["increases"])
+	assert.Equal(t, int64(5), snapshot.Ints["decreases"])
+}
+
+func TestAdaptiveControllerRejectionRate(t *testing.T) {
+	c, _ := newTestAdaptiveController(100, 1)
+	c.config.MaxRejectionRate = 0.1
+	ctx := context.Background()
+
+	_, gen, _ := c.acquire(ctx)
+	c.release(gen, bulkOutcome{responded: true, events: 100, rejected: 10})
+	assert.Equal(t, 100, c.bulkSize)
+
+	_, gen, _ = c.acquire(ctx)
+	c.release(gen, bulkOutcome{responded: true, events: 100, rejected: 11})
+	assert.Equal(t, 50, c.bulkSize)
+}
+
+func TestAdaptiveControllerConcurrency(t *testing.T) {
+	c, _ := newTestAdaptiveController(50, 1)
+
+	_, gen, err := c.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = c.acquire(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		_, gen, err := c.acquire(context.Background())
+		assert.NoError(t, err)
+		c.release(gen, bulkOutcome{})
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot above the concurrency")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.release(gen, bulkOutcome{})
+	<-acquired
+	assert.Equal(t, 0, c.inFlight)
+}
+
+func TestAdaptiveConfig(t *testing.T) {
+	config, err := readConfig(common.MustNewConfigFrom(`
+bulk_max_size: 100
+adaptive:
+  enabled: true
+  max_bulk_bytes: 1MiB
+  target_latency: 2s
+`))
+	require.NoError(t, err)
+	assert.True(t, config.Adaptive.Enabled)
+	assert.Equal(t, 1024*1024, int(config.Adaptive.MaxBulkBytes))
+	assert.Equal(t, 2*time.Second, config.Adaptive.TargetLatency)
+	assert.Equal(t, defaultAdaptiveConfig.Decrease, config.Adaptive.Decrease)
+
+	tests := map[string]string{
+		"no bulk_max_size":         "adaptive.enabled: true",
+		"min_bulk_size":            "adaptive.min_bulk_size: 0",
+		"max_concurrency":          "adaptive.min_concurrency: 2\nadaptive.max_concurrency: 1",
+		"decrease":                 "adaptive.decrease: 1",
+		"max_rejection_rate":       "adaptive.max_rejection_rate: -0.5",
+		"target_latency":           "adaptive.target_latency: 0s",
+		"increase":                 "adaptive.increase: 0",
+		"negative max_concurrency": "adaptive.max_concurrency: -1",
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readConfig(common.MustNewConfigFrom(test))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPublishAdaptive(t *testing.T) {
+	var mu sync.Mutex
+	var bulks []int
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.10.0" } }`)
+			return
+		}
+
+		lines := 0
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines++
+		}
+		events := lines / 2
+
+		mu.Lock()
+		bulks = append(bulks, events)
+		requests++
+		first := requests == 1
+		mu.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, `{"error":{"type":"es_rejected_execution_exception"},"status":429}`)
+			return
+		}
+		items := strings.TrimSuffix(strings.Repeat(`{"create":{"status":201}},`, events), ",")
+		fmt.Fprintf(w, `{"items":[%s]}`, items)
+	}))
+	defer ts.Close()
+
+	config := defaultAdaptiveConfig
+	config.Enabled = true
+	config.MinBulkSize = 2
+	config.MaxBulkBytes = 1024
+	adaptive := newAdaptiveController(config, 8, 1, monitoring.NewRegistry())
+
+	client, err := NewClient(ClientSettings{
+		ConnectionSettings: eslegclient.ConnectionSettings{URL: ts.URL},
+		Index:              outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+		Adaptive:           adaptive,
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+
+	newEvents := func(n int, message string) []beat.Event {
+		events := make([]beat.Event, n)
+		for i := range events {
+			events[i] = beat.Event{Fields: common.MapStr{"message": message}, MessageSize: len(message)}
+		}
+		return events
+	}
+
+	// the rejected request is retried, with half the bulk size
+	batch := outest.NewBatch(newEvents(8, "small")...)
+	err = client.Publish(context.Background(), batch)
+	assert.Error(t, err)
+	assert.Equal(t, []outest.BatchSignal{{Tag: outest.BatchRetryEvents, Events: batch.Events()}}, batch.Signals)
+
+	batch = outest.NewBatch(newEvents(8, "small")...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.Equal(t, []int{8, 4, 4}, bulks)
+	assert.Equal(t, 8, adaptive.bulkSize)
+
+	// the messages are limited to max_bulk_bytes
+	mu.Lock()
+	bulks = nil
+	mu.Unlock()
+	batch = outest.NewBatch(newEvents(4, strings.Repeat("x", 400))...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.Equal(t, []int{2, 2}, bulks)
+}
@@ -47,6 +47,11 @@ type Client struct {
 
 	observer           outputs.Observer
 	NonIndexableAction string
+	nonIndexablePolicy nonIndexablePolicy
+	dataStreams        bool
+
+	// adaptive sizes the bulk requests when adaptive is enabled.
+	adaptive *adaptiveController
 
 	log *logp.Logger
 }
@@ -58,6 +63,14 @@ type ClientSettings struct {
 	Pipeline           *outil.Selector
 	Observer           outputs.Observer
 	NonIndexableAction string
+	// NonIndexablePolicy is the policy of NonIndexableAction, with its
+	// fallbacks. It is the policy of the action without fallback when nil.
+	NonIndexablePolicy nonIndexablePolicy
+	// DataStreams forces the create operation, as data streams are append-only.
+	DataStreams bool
+	// Adaptive is the adaptive controller shared by the clients of the
+	// output, nil when adaptive is disabled.
+	Adaptive *adaptiveController
 }
 
 type bulkResultStats struct {
@@ -125,15 +138,26 @@ func NewClient(
 		return nil
 	}
 
+	policy := s.NonIndexablePolicy
+	if policy == nil {
+		policy = defaultPolicy()
+		if s.NonIndexableAction == dead_letter_index {
+			policy = DeadLetterIndexPolicy{}
+		}
+	}
+
 	client := &Client{
 		conn:               *conn,
 		index:              s.Index,
 		pipeline:           pipeline,
 		observer:           s.Observer,
 		NonIndexableAction: s.NonIndexableAction,
+		nonIndexablePolicy: policy,
+		dataStreams:        s.DataStreams,
 
 		log: logp.NewLogger("elasticsearch"),
 	}
+	client.adaptive = s.Adaptive
 
 	return client, nil
 }
@@ -171,6 +195,9 @@ func (client *Client) Clone() *Client {
 			Index:              client.index,
 			Pipeline:           client.pipeline,
 			NonIndexableAction: client.NonIndexableAction,
+			NonIndexablePolicy: client.nonIndexablePolicy,
+			DataStreams:        client.dataStreams,
+			Adaptive:           client.adaptive,
 		},
 		nil, // XXX: do not pass connection callback?
 	)
@@ -219,21 +246,57 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		return nil, nil
 	}
 
+	var failedEvents []publisher.Event
+	var err error
+	if client.adaptive != nil {
+		failedEvents, err = client.publishAdaptive(ctx, data, bulkItems)
+	} else {
+		failedEvents, _, err = client.publishBulk(ctx, data, totalSize, bulkItems)
+	}
+	if err != nil && len(failedEvents) == len(data) {
+		return failedEvents, err
+	}
+
+	pubCount := len(data)
+	span.Context.SetLabel("events_published", pubCount)
+
+	client.log.Debugf("PublishEvents: %d events have been published to elasticsearch in %v.",
+		pubCount,
+		time.Now().Sub(begin))
+
+	failed := len(failedEvents)
+	span.Context.SetLabel("events_failed", failed)
+	if failed > 0 {
+		if err == nil {
+			err = eslegclient.ErrTempBulkFailure
+		}
+		return failedEvents, err
+	}
+	return nil, nil
+}
+
+// publishBulk sends the events in a single bulk request. It returns the events
+// to retry and the outcome of the request for the adaptive controller.
+func (client *Client) publishBulk(ctx context.Context, data []publisher.Event, totalSize int, bulkItems []interface{}) ([]publisher.Event, bulkOutcome, error) {
+	outcome := bulkOutcome{events: len(data)}
 	beginBulk := time.Now()
 	status, result, sendErr := client.conn.Bulk(ctx, "", "", nil, bulkItems)
 	if sendErr != nil {
 		err := apm.CaptureError(ctx, fmt.Errorf("failed to perform any bulk index operations: %w", sendErr))
 		err.Send()
 		client.log.Error(err)
-		return data, sendErr
+		client.countDeadLetterAttempts(data)
+		if status == http.StatusTooManyRequests {
+			// Elasticsearch rejected the whole request
+			outcome.responded = true
+			outcome.rejected = len(data)
+			outcome.latency = time.Since(beginBulk)
+		}
+		return data, outcome, sendErr
 	}
 	latency := time.Since(beginBulk)
-	pubCount := len(data)
-	span.Context.SetLabel("events_published", pubCount)
-
-	client.log.Debugf("PublishEvents: %d events have been published to elasticsearch in %v.",
-		pubCount,
-		time.Now().Sub(begin))
+	outcome.responded = true
+	outcome.latency = latency
 
 	// check response for transient errors
 	var failedEvents []publisher.Event
@@ -242,12 +305,13 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		failedEvents = data
 		stats.fails = len(failedEvents)
 		client.log.Error("Bulk index request err: %s", result)
+		client.countDeadLetterAttempts(data)
 	} else {
 		failedEvents, stats = client.bulkCollectPublishFails(result, data)
 	}
+	outcome.rejected = stats.tooMany
 
 	failed := len(failedEvents)
-	span.Context.SetLabel("events_failed", failed)
 	if st := client.observer; st != nil {
 		dropped := stats.nonIndexable
 		duplicates := stats.duplicates
@@ -261,14 +325,58 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		st.MessageBytes(totalSize)
 		st.ErrTooMany(stats.tooMany)
 	}
+	return failedEvents, outcome, nil
+}
 
-	if failed > 0 {
-		if sendErr == nil {
-			sendErr = eslegclient.ErrTempBulkFailure
+// publishAdaptive sends the events in bulk requests sized by the adaptive
+// controller, each with at most its bulk size events and its max_bulk_bytes
+// body. It stops at the first connection error, returning the events not
+// sent with the events to retry.
+func (client *Client) publishAdaptive(ctx context.Context, data []publisher.Event, bulkItems []interface{}) ([]publisher.Event, error) {
+	// the failed events of each request are moved to the front of data,
+	// before the events not sent yet
+	failed := data[:0]
+	for len(data) > 0 {
+		bulkSize, generation, err := client.adaptive.acquire(ctx)
+		if err != nil {
+			return append(failed, data...), err
 		}
-		return failedEvents, sendErr
+
+		n, items, totalSize := client.nextBulk(data, bulkItems, bulkSize)
+		rest, outcome, err := client.publishBulk(ctx, data[:n], totalSize, bulkItems[:items])
+		client.adaptive.release(generation, outcome)
+		if err != nil {
+			return append(failed, data...), err
+		}
+
+		failed = append(failed, rest...)
+		data, bulkItems = data[n:], bulkItems[items:]
 	}
-	return nil, nil
+	return failed, nil
+}
+
+// nextBulk returns the number of events, and of their bulk items, in the
+// next bulk request, and the size of their messages. The request has at
+// most bulkSize events, and messages of at most max_bulk_bytes unless its
+// first event alone is larger.
+func (client *Client) nextBulk(data []publisher.Event, bulkItems []interface{}, bulkSize int) (events, items, totalSize int) {
+	maxBytes := client.adaptive.maxBytes()
+	for events < len(data) && events < bulkSize {
+		size := data[events].Content.MessageSize
+		if events > 0 && totalSize+size > maxBytes {
+			break
+		}
+
+		count := 2
+		if _, ok := bulkItems[items].(eslegclient.BulkDeleteAction); ok {
+			// We don't include the event source in a bulk DELETE
+			count = 1
+		}
+		totalSize += size
+		events++
+		items += count
+	}
+	return events, items, totalSize
 }
 
 // bulkEncodePublishRequest encodes all bulk requests and returns slice of events
@@ -280,17 +388,28 @@ func (client *Client) bulkEncodePublishRequest(version common.Version, data []pu
 	for i := range data {
 		event := &data[i].Content
 		meta, err := client.createEventBulkMeta(version, event)
+		var metaErr *invalidEventMetaError
+		if errors.As(err, &metaErr) {
+			if !client.applyInvalidEventMetaPolicy(&data[i], metaErr) {
+				continue
+			}
+			// sent to the dead letter index, without the invalid metadata
+			meta, err = client.createEventBulkMeta(version, event)
+		}
 		if err != nil {
 			client.log.Errorf("Failed to encode event meta data: %+v", err)
 			continue
 		}
-		if opType := events.GetOpType(*event); opType == events.OpTypeDelete {
+		if _, ok := meta.(eslegclient.BulkDeleteAction); ok {
 			// We don't include the event source in a bulk DELETE
 			bulkItems = append(bulkItems, meta)
 		} else {
 			bulkItems = append(bulkItems, meta, event)
 		}
 		okEvents = append(okEvents, data[i])
+		if client.nonIndexablePolicy.action() != drop {
+			trackDeadLetterTarget(event, meta)
+		}
 
 		totalSize += event.MessageSize
 
@@ -321,7 +440,6 @@ func (client *Client) createEventBulkMeta(version common.Version, event *beat.Ev
 	}
 
 	id, _ := events.GetMetaStringValue(*event, events.FieldMetaID)
-	opType := events.GetOpType(*event)
 
 	meta := eslegclient.BulkMeta{
 		Index:    strings.ToLower(index),
@@ -330,12 +448,38 @@ func (client *Client) createEventBulkMeta(version common.Version, event *beat.Ev
 		ID:       id,
 	}
 
-	if opType == events.OpTypeDelete {
-		if id != "" {
-			return eslegclient.BulkDeleteAction{Delete: meta}, nil
-		} else {
-			return nil, fmt.Errorf("%s %s requires _id", events.FieldMetaOpType, events.OpTypeDelete)
+	opType := events.OpTypeDefault
+	if deadLettered, _ := event.Meta.HasKey(dead_letter_marker_field); !deadLettered {
+		// the dead letter document is indexed without the event overrides
+		if opType, err = eventOpType(event); err == nil {
+			meta.Routing, err = eventRouting(event)
+		}
+		if err == nil {
+			var requireAlias bool
+			if requireAlias, err = eventRequireAlias(version, event); requireAlias {
+				meta.RequireAlias = &requireAlias
+			}
+		}
+		if metaErr, ok := err.(*invalidEventMetaError); ok {
+			metaErr.target = meta
+			return nil, metaErr
+		}
+	}
+
+	if opType == events.OpTypeDelete && (id == "" || client.dataStreams) {
+		reason := "delete requires _id"
+		if client.dataStreams {
+			reason = "delete is not supported by data streams"
 		}
+		return nil, &invalidEventMetaError{field: events.FieldMetaOpType, reason: reason, target: meta}
+	}
+
+	if client.dataStreams {
+		return eslegclient.BulkCreateAction{Create: meta}, nil
+	}
+
+	if opType == events.OpTypeDelete {
+		return eslegclient.BulkDeleteAction{Delete: meta}, nil
 	}
 	if id != "" || version.Major > 7 || (version.Major == 7 && version.Minor >= 5) {
 		if opType == events.OpTypeIndex {
@@ -348,6 +492,11 @@ func (client *Client) createEventBulkMeta(version common.Version, event *beat.Ev
 
 func (client *Client) getPipeline(event *beat.Event) (string, error) {
 	if event.Meta != nil {
+		if deadLettered, _ := event.Meta.HasKey(dead_letter_marker_field); deadLettered {
+			// the dead letter document is indexed as is
+			return "", nil
+		}
+
 		pipeline, err := events.GetMetaStringValue(*event, events.FieldMetaPipeline)
 		if err == common.ErrKeyNotFound {
 			return "", nil
@@ -376,6 +525,7 @@ func (client *Client) bulkCollectPublishFails(result eslegclient.BulkResult, dat
 		return nil, bulkResultStats{}
 	}
 
+	now := time.Now()
 	count := len(data)
 	failed := data[:0]
 	stats := bulkResultStats{}
@@ -398,33 +548,14 @@ func (client *Client) bulkCollectPublishFails(result eslegclient.BulkResult, dat
 			continue // ok
 		}
 
+		countDeadLetterAttempt(&data[i].Content, now)
 		if status < 500 {
 			if status == http.StatusTooManyRequests {
 				stats.tooMany++
 			} else {
 				// hard failure, apply policy action
-				result, _ := data[i].Content.Meta.HasKey(dead_letter_marker_field)
-				if result {
-					stats.nonIndexable++
-					client.log.Errorf("Can't deliver to dead letter index event %#v (status=%v): %s", data[i], status, msg)
-					// poison pill - this will clog the pipeline if the underlying failure is non transient.
-				} else if client.NonIndexableAction == dead_letter_index {
-					client.log.Warnf("Cannot index event %#v (status=%v): %s, trying dead letter index", data[i], status, msg)
-					if data[i].Content.Meta == nil {
-						data[i].Content.Meta = common.MapStr{
-							dead_letter_marker_field: true,
-						}
-					} else {
-						data[i].Content.Meta.Put(dead_letter_marker_field, true)
-					}
-					data[i].Content.Fields = common.MapStr{
-						"message":       data[i].Content.Fields.String(),
-						"error.type":    status,
-						"error.message": string(msg),
-					}
-				} else { // drop
+				if !client.applyNonIndexablePolicy(&data[i], status, msg) {
 					stats.nonIndexable++
-					client.log.Warnf("Cannot index event %#v (status=%v): %s, dropping event!", data[i], status, msg)
 					continue
 				}
 			}
@@ -438,12 +569,110 @@ func (client *Client) bulkCollectPublishFails(result eslegclient.BulkResult, dat
 	return failed, stats
 }
 
+// applyNonIndexablePolicy applies the non indexable policy to an event
+// rejected by Elasticsearch, going through the fallbacks of the policies
+// failing to keep it. It returns true if the event is retried, either sent to
+// the dead letter index or because no policy could keep it.
+func (client *Client) applyNonIndexablePolicy(event *publisher.Event, status int, msg []byte) bool {
+	policy := client.nonIndexablePolicy
+	deadLettered, _ := event.Content.Meta.HasKey(dead_letter_marker_field)
+	if deadLettered {
+		// the dead letter index rejected the dead letter document too
+		policy = policy.fallback()
+		if policy == nil {
+			client.log.Errorf("Can't deliver to dead letter index event %#v (status=%v): %s", event, status, msg)
+			// poison pill - this will clog the pipeline if the underlying failure is non transient.
+			return true
+		}
+	}
+
+	for {
+		switch policy.action() {
+		case drop:
+			client.log.Warnf("Cannot index event %#v (status=%v): %s, dropping event!", event, status, msg)
+			return false
+
+		case dead_letter_index:
+			client.log.Warnf("Cannot index event %#v (status=%v): %s, trying dead letter index", event, status, msg)
+			if event.Content.Meta == nil {
+				event.Content.Meta = common.MapStr{
+					dead_letter_marker_field: true,
+				}
+			} else {
+				event.Content.Meta.Put(dead_letter_marker_field, true)
+			}
+			event.Content.Fields = deadLetterFields(&event.Content, status, msg)
+			return true
+
+		default:
+			var fields common.MapStr
+			if deadLettered {
+				// keep the rejection of the original event, with the
+				// attempts to index the dead letter document
+				fields = event.Content.Fields.Clone()
+				if deadLetter := deadLetterHistory(&event.Content); deadLetter != nil {
+					fields["dead_letter"] = deadLetter
+				}
+			} else {
+				fields = deadLetterFields(&event.Content, status, msg)
+			}
+			if failure := deadLetterFailureOf(&event.Content); failure != nil && failure.id == "" {
+				// replaying the document twice must not index the event twice
+				failure.id = deadLetterIDs.NextID()
+				fields["dead_letter"] = deadLetterHistory(&event.Content)
+			}
+			err := policy.(deadLetterSpill).spill(deadLetterDocument(event.Content.Timestamp, fields))
+			if err == nil {
+				client.log.Warnf("Cannot index event %#v (status=%v): %s, kept by %s policy", event, status, msg, policy.action())
+				return false
+			}
+			client.log.Errorf("Can't deliver to %s policy event %#v: %v", policy.action(), event, err)
+			if policy = policy.fallback(); policy == nil {
+				return true
+			}
+		}
+	}
+}
+
+// applyInvalidEventMetaPolicy applies the non indexable policy to an event
+// whose metadata can't be encoded. It returns true if the event is sent to the
+// dead letter index.
+func (client *Client) applyInvalidEventMetaPolicy(event *publisher.Event, metaErr *invalidEventMetaError) bool {
+	if client.nonIndexablePolicy.action() != drop {
+		trackDeadLetterTarget(&event.Content, eslegclient.BulkIndexAction{Index: metaErr.target})
+		countDeadLetterAttempt(&event.Content, time.Now())
+	}
+	if !client.applyNonIndexablePolicy(event, 0, metaErr.itemError()) {
+		return false
+	}
+	deadLettered, _ := event.Content.Meta.HasKey(dead_letter_marker_field)
+	return deadLettered
+}
+
+// countDeadLetterAttempts counts a failed attempt of events whose bulk
+// request failed, with a dead letter policy.
+func (client *Client) countDeadLetterAttempts(data []publisher.Event) {
+	if client.nonIndexablePolicy.action() == drop {
+		return
+	}
+	now := time.Now()
+	for i := range data {
+		countDeadLetterAttempt(&data[i].Content, now)
+	}
+}
+
 func (client *Client) Connect() error {
 	return client.conn.Connect()
 }
 
+// Close closes the connection and the dead letter spills of the non indexable
+// policy.
 func (client *Client) Close() error {
-	return client.conn.Close()
+	err := client.conn.Close()
+	if spillErr := closeDeadLetterSpills(client.nonIndexablePolicy); err == nil {
+		err = spillErr
+	}
+	return err
 }
 
 func (client *Client) String() string {
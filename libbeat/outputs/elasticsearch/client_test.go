@@ -21,10 +21,14 @@
 package elasticsearch
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -38,6 +42,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
 	"github.com/elastic/beats/v7/libbeat/idxmgmt"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/outest"
 	"github.com/elastic/beats/v7/libbeat/outputs/outil"
 	"github.com/elastic/beats/v7/libbeat/publisher"
@@ -132,28 +137,121 @@ func TestCollectPublishFailDeadLetterQueue(t *testing.T) {
 
 	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"bar": 1}}}
 	eventFail := publisher.Event{Content: beat.Event{Fields: common.MapStr{"bar": "bar1"}}}
+	trackDeadLetterTarget(&eventFail.Content, eslegclient.BulkCreateAction{
+		Create: eslegclient.BulkMeta{Index: "logs-2023.09.18", Pipeline: "serverlog"},
+	})
 	events := []publisher.Event{event, eventFail, event}
 
 	res, stats := client.bulkCollectPublishFails(response, events)
 	assert.Equal(t, 1, len(res))
 	if len(res) == 1 {
-		expected := publisher.Event{
-			Content: beat.Event{
-				Fields: common.MapStr{
-					"message":       "{\"bar\":\"bar1\"}",
-					"error.type":    400,
-					"error.message": "{\n\t\t\t\"root_cause\" : [\n\t\t\t  {\n\t\t\t\t\"type\" : \"mapper_parsing_exception\",\n\t\t\t\t\"reason\" : \"failed to parse field [bar] of type [long] in document with id '1'. Preview of field's value: 'bar1'\"\n\t\t\t  }\n\t\t\t],\n\t\t\t\"type\" : \"mapper_parsing_exception\",\n\t\t\t\"reason\" : \"failed to parse field [bar] of type [long] in document with id '1'. Preview of field's value: 'bar1'\",\n\t\t\t\"caused_by\" : {\n\t\t\t  \"type\" : \"illegal_argument_exception\",\n\t\t\t  \"reason\" : \"For input string: \\\"bar1\\\"\"\n\t\t\t}\n\t\t  }",
-				},
-				Meta: common.MapStr{
-					dead_letter_marker_field: true,
-				},
+		failure := deadLetterFailureOf(&res[0].Content)
+		require.NotNil(t, failure)
+		assert.False(t, failure.firstFailure.IsZero())
+
+		expected := common.MapStr{
+			"message": "{\"bar\":\"bar1\"}",
+			"error": common.MapStr{
+				"type":    400,
+				"code":    "mapper_parsing_exception",
+				"message": "failed to parse field [bar] of type [long] in document with id '1'. Preview of field's value: 'bar1'",
+			},
+			"http": common.MapStr{"response": common.MapStr{"status_code": 400}},
+			"dead_letter": common.MapStr{
+				"index":         "logs-2023.09.18",
+				"pipeline":      "serverlog",
+				"attempts":      1,
+				"first_failure": failure.firstFailure,
 			},
 		}
-		assert.Equal(t, expected, res[0])
+		assert.Equal(t, expected, res[0].Content.Fields)
+		deadLettered, _ := res[0].Content.Meta.HasKey(dead_letter_marker_field)
+		assert.True(t, deadLettered)
+
+		// the dead letter document skips the pipeline of the event
+		pipeline, err := client.getPipeline(&res[0].Content)
+		assert.NoError(t, err)
+		assert.Empty(t, pipeline)
 	}
 	assert.Equal(t, bulkResultStats{acked: 2, fails: 1, nonIndexable: 0}, stats)
 }
 
+func TestCollectPublishFailDeadLetterFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+	client, err := NewClient(
+		ClientSettings{
+			NonIndexableAction: dead_letter_index,
+			NonIndexablePolicy: DeadLetterIndexPolicy{
+				Index: "dead-letter",
+				next:  &DeadLetterFilePolicy{Path: path, Permissions: 0600},
+			},
+		},
+		nil,
+	)
+	require.NoError(t, err)
+
+	response := []byte(`{"items": [{"create": {"status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}]}`)
+	event := publisher.Event{Content: beat.Event{
+		Timestamp: time.Date(2023, 9, 18, 11, 32, 58, 0, time.UTC),
+		Fields:    common.MapStr{"bar": "bar1"},
+	}}
+	trackDeadLetterTarget(&event.Content, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{Index: "logs"}})
+
+	// the rejected event is retried to the dead letter index
+	res, stats := client.bulkCollectPublishFails(response, []publisher.Event{event})
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, bulkResultStats{fails: 1}, stats)
+
+	// the dead letter index rejects it too, it is written to the file
+	res, stats = client.bulkCollectPublishFails(response, res)
+	assert.Equal(t, 0, len(res))
+	assert.Equal(t, bulkResultStats{nonIndexable: 1}, stats)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var document map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &document))
+	assert.Equal(t, "2023-09-18T11:32:58Z", document["@timestamp"])
+	assert.Equal(t, `{"bar":"bar1"}`, document["message"])
+	assert.Equal(t, map[string]interface{}{
+		"type":    float64(400),
+		"code":    "mapper_parsing_exception",
+		"message": "failed to parse",
+	}, document["error"])
+	deadLetter := document["dead_letter"].(map[string]interface{})
+	assert.Equal(t, "logs", deadLetter["index"])
+	assert.Equal(t, float64(2), deadLetter["attempts"])
+	// an event without _id gets one, for replaying it only once
+	assert.NotEmpty(t, deadLetter["id"])
+
+	// closing the client closes the file, the next document opens it again
+	spill := client.nonIndexablePolicy.fallback().(*DeadLetterFilePolicy)
+	require.NotNil(t, spill.file)
+	require.NoError(t, client.Close())
+	assert.Nil(t, spill.file)
+
+	// the _id of the event is kept
+	event = publisher.Event{Content: beat.Event{Fields: common.MapStr{"bar": "bar2"}}}
+	trackDeadLetterTarget(&event.Content, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{Index: "logs", ID: "bar2"}})
+	client.nonIndexablePolicy = spill
+	res, stats = client.bulkCollectPublishFails(response, []publisher.Event{event})
+	assert.Equal(t, 0, len(res))
+	assert.Equal(t, bulkResultStats{nonIndexable: 1}, stats)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	require.Equal(t, 2, len(lines))
+	require.NoError(t, json.Unmarshal(lines[1], &document))
+	assert.Equal(t, "bar2", document["dead_letter"].(map[string]interface{})["id"])
+	require.NoError(t, client.Close())
+
+	// an event the file policy fails to keep is retried
+	client.nonIndexablePolicy = &DeadLetterFilePolicy{Path: filepath.Join(path, "missing", "dead-letter.ndjson")}
+	res, stats = client.bulkCollectPublishFails(response, []publisher.Event{event})
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, bulkResultStats{fails: 1}, stats)
+}
+
 func TestCollectPublishFailDrop(t *testing.T) {
 	client, err := NewClient(
 		ClientSettings{
@@ -562,6 +660,152 @@ func TestBulkEncodeEventsWithOpType(t *testing.T) {
 
 }
 
+func TestBulkEncodeEventsWithMetaOverrides(t *testing.T) {
+	index, err := outil.BuildSelectorFromConfig(common.MustNewConfigFrom(common.MapStr{"index": "logs"}), outil.Settings{
+		Key:              "index",
+		MultiKey:         "indices",
+		EnableSingleOnly: true,
+		FailEmpty:        true,
+	})
+	require.NoError(t, err)
+
+	newEvent := func(meta common.MapStr) publisher.Event {
+		return publisher.Event{Content: beat.Event{
+			Meta:   meta,
+			Fields: common.MapStr{"message": "test"},
+		}}
+	}
+	ver := *common.MustNewVersion("7.17.0")
+
+	t.Run("valid overrides", func(t *testing.T) {
+		client, err := NewClient(ClientSettings{Index: index}, nil)
+		require.NoError(t, err)
+
+		encoded, _, bulkItems := client.bulkEncodePublishRequest(ver, []publisher.Event{
+			newEvent(common.MapStr{e.FieldMetaRouting: "LJ8E3C1M5MB000001"}),
+			newEvent(common.MapStr{e.FieldMetaRouting: 42, e.FieldMetaOpType: "index"}),
+			newEvent(common.MapStr{e.FieldMetaRequireAlias: true, e.FieldMetaOpType: e.OpTypeCreate}),
+			newEvent(common.MapStr{e.FieldMetaRequireAlias: "false"}),
+		})
+		require.Equal(t, 4, len(encoded))
+		require.Equal(t, 8, len(bulkItems))
+
+		assert.Equal(t, "LJ8E3C1M5MB000001", bulkItems[0].(eslegclient.BulkCreateAction).Create.Routing)
+		assert.Equal(t, "42", bulkItems[2].(eslegclient.BulkIndexAction).Index.Routing)
+		requireAlias := true
+		assert.Equal(t, &requireAlias, bulkItems[4].(eslegclient.BulkCreateAction).Create.RequireAlias)
+		assert.Nil(t, bulkItems[6].(eslegclient.BulkCreateAction).Create.RequireAlias)
+	})
+
+	invalid := []publisher.Event{
+		newEvent(common.MapStr{e.FieldMetaOpType: "upsert"}),
+		newEvent(common.MapStr{e.FieldMetaRouting: ""}),
+		newEvent(common.MapStr{e.FieldMetaRouting: []string{"a", "b"}}),
+		newEvent(common.MapStr{e.FieldMetaRequireAlias: "maybe"}),
+		newEvent(common.MapStr{e.FieldMetaOpType: "delete"}),
+	}
+
+	t.Run("invalid overrides are dropped", func(t *testing.T) {
+		client, err := NewClient(ClientSettings{Index: index}, nil)
+		require.NoError(t, err)
+
+		events := append([]publisher.Event{}, invalid...)
+		encoded, _, bulkItems := client.bulkEncodePublishRequest(ver, events)
+		assert.Equal(t, 0, len(encoded))
+		assert.Equal(t, 0, len(bulkItems))
+	})
+
+	t.Run("require_alias needs ES 7.10", func(t *testing.T) {
+		client, err := NewClient(ClientSettings{Index: index}, nil)
+		require.NoError(t, err)
+
+		encoded, _, _ := client.bulkEncodePublishRequest(*common.MustNewVersion("7.9.0"), []publisher.Event{
+			newEvent(common.MapStr{e.FieldMetaRequireAlias: true}),
+		})
+		assert.Equal(t, 0, len(encoded))
+	})
+
+	t.Run("invalid overrides are sent to the dead letter index", func(t *testing.T) {
+		client, err := NewClient(ClientSettings{
+			Index:              DeadLetterSelector{Selector: index, DeadLetterIndex: "dead-letter"},
+			NonIndexableAction: dead_letter_index,
+			NonIndexablePolicy: DeadLetterIndexPolicy{Index: "dead-letter"},
+		}, nil)
+		require.NoError(t, err)
+
+		events := append([]publisher.Event{}, invalid...)
+		encoded, _, bulkItems := client.bulkEncodePublishRequest(ver, events)
+		require.Equal(t, len(invalid), len(encoded))
+		require.Equal(t, 2*len(invalid), len(bulkItems))
+		for i := range encoded {
+			action, ok := bulkItems[2*i].(eslegclient.BulkCreateAction)
+			require.True(t, ok)
+			assert.Equal(t, "dead-letter", action.Create.Index)
+			assert.Empty(t, action.Create.Routing)
+			assert.Nil(t, action.Create.RequireAlias)
+
+			fields := encoded[i].Content.Fields
+			errCode, _ := fields.GetValue("error.code")
+			assert.Equal(t, "invalid_event_metadata", errCode)
+			hasType, _ := fields.HasKey("error.type")
+			assert.False(t, hasType, "events rejected before being sent have no status")
+			index, _ := fields.GetValue("dead_letter.index")
+			assert.Equal(t, "logs", index)
+			assert.NotContains(t, fields, "http")
+		}
+	})
+}
+
+func TestBulkEncodeEventsDataStreams(t *testing.T) {
+	cfg := common.MustNewConfigFrom(common.MapStr{})
+	info := beat.Info{
+		IndexPrefix: "test",
+		Version:     version.GetDefaultVersion(),
+	}
+
+	im, err := idxmgmt.DefaultSupport(nil, info, common.MustNewConfigFrom(common.MapStr{
+		"setup.template.data_stream.enabled": true,
+	}))
+	require.NoError(t, err)
+	dsm, ok := im.(outputs.DataStreamIndexManager)
+	require.True(t, ok)
+	require.True(t, dsm.DataStreams())
+
+	index, pipeline, err := buildSelectors(im, info, cfg)
+	require.NoError(t, err)
+
+	client, err := NewClient(
+		ClientSettings{
+			Index:       index,
+			Pipeline:    pipeline,
+			DataStreams: true,
+		},
+		nil,
+	)
+	require.NoError(t, err)
+
+	events := []publisher.Event{
+		{Content: beat.Event{Fields: common.MapStr{"message": "no op_type"}}},
+		{Content: beat.Event{
+			Meta:   common.MapStr{"_id": "1", e.FieldMetaOpType: e.OpTypeIndex},
+			Fields: common.MapStr{"message": "index"},
+		}},
+		{Content: beat.Event{
+			Meta:   common.MapStr{"_id": "2", e.FieldMetaOpType: e.OpTypeDelete},
+			Fields: common.MapStr{"message": "delete"},
+		}},
+	}
+
+	encoded, _, bulkItems := client.bulkEncodePublishRequest(*common.MustNewVersion(version.GetDefaultVersion()), events)
+	require.Equal(t, 2, len(encoded), "delete is not supported by data streams")
+	require.Equal(t, 4, len(bulkItems))
+	for _, i := range []int{0, 2} {
+		action, ok := bulkItems[i].(eslegclient.BulkCreateAction)
+		require.True(t, ok, "data streams only accept create")
+		assert.Equal(t, "test-"+version.GetDefaultVersion(), action.Create.Index)
+	}
+}
+
 func TestClientWithAPIKey(t *testing.T) {
 	var headers http.Header
 
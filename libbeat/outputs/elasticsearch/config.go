@@ -43,6 +43,7 @@ type elasticsearchConfig struct {
 	MaxRetries         int                     `config:"max_retries"`
 	Backoff            Backoff                 `config:"backoff"`
 	NonIndexablePolicy *common.ConfigNamespace `config:"non_indexable_policy"`
+	Adaptive           adaptiveConfig          `config:"adaptive"`
 
 	Transport httpcommon.HTTPTransportSettings `config:",inline"`
 }
@@ -73,6 +74,7 @@ var (
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
+		Adaptive:  defaultAdaptiveConfig,
 		Transport: httpcommon.DefaultHTTPTransportSettings(),
 	}
 )
@@ -81,6 +83,9 @@ func (c *elasticsearchConfig) Validate() error {
 	if c.APIKey != "" && (c.Username != "" || c.Password != "") {
 		return fmt.Errorf("cannot set both api_key and username/password")
 	}
+	if c.Adaptive.Enabled && c.BulkMaxSize <= 0 {
+		return fmt.Errorf("adaptive requires a positive bulk_max_size")
+	}
 
 	return nil
 }
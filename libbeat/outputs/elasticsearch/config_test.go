@@ -58,6 +58,35 @@ non_indexable_policy.dead_letter_index:
 	assert.Equal(t, "my-dead-letter-index", policy.index(), "index should match config")
 }
 
+func TestChainedNonIndexablePolicyConfig(t *testing.T) {
+	config := `
+non_indexable_policy.dead_letter_index:
+    index: "my-dead-letter-index"
+    fallback.file:
+        path: "/var/lib/beat/dead-letter.ndjson"
+        fallback.kafka:
+            hosts: ["localhost:9092"]
+            topic: "dead-letter"
+`
+	c := common.MustNewConfigFrom(config)
+	elasticsearchOutputConfig, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input")
+	}
+	policy, err := newNonIndexablePolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input: %v", err)
+	}
+	assert.Equal(t, dead_letter_index, policy.action())
+	file := policy.fallback()
+	assert.Equal(t, dead_letter_file, file.action())
+	assert.Equal(t, "/var/lib/beat/dead-letter.ndjson", file.(*DeadLetterFilePolicy).Path)
+	kafka := file.fallback()
+	assert.Equal(t, dead_letter_kafka, kafka.action())
+	assert.Equal(t, "dead-letter", kafka.(*DeadLetterKafkaPolicy).Topic)
+	assert.Nil(t, kafka.fallback())
+}
+
 func TestInvalidNonIndexablePolicyConfig(t *testing.T) {
 	tests := map[string]string{
 		"non_indexable_policy with invalid policy": `
@@ -77,6 +106,30 @@ non_indexable_policy.dead_letter_index:
 		"dead_Letter_index policy empty index": `
 non_indexable_policy.dead_letter_index:
     index: ""
+`,
+		"file policy without path": `
+non_indexable_policy.file: ~
+`,
+		"kafka policy without topic": `
+non_indexable_policy.kafka:
+    hosts: ["localhost:9092"]
+`,
+		"kafka policy invalid version": `
+non_indexable_policy.kafka:
+    hosts: ["localhost:9092"]
+    topic: "dead-letter"
+    version: "0.1"
+`,
+		"dead_letter_index policy as fallback": `
+non_indexable_policy.file:
+    path: "dead-letter.ndjson"
+    fallback.dead_letter_index:
+        index: "my-dead-letter-index"
+`,
+		"invalid fallback": `
+non_indexable_policy.dead_letter_index:
+    index: "my-dead-letter-index"
+    fallback.juggle: ~
 `,
 	}
 
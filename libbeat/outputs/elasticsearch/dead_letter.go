@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/processors/add_id/generator"
+)
+
+// deadLetterIDs generates the _id of the events spilled without one.
+var deadLetterIDs = generator.ESTimeBasedUUIDGenerator()
+
+// deadLetterFailure is the history of an event published with the
+// dead_letter_index policy, kept in its metadata while it is retried and
+// reported in its dead letter document.
+type deadLetterFailure struct {
+	index        string    // target index of the first attempt
+	pipeline     string    // ingest pipeline of the first attempt
+	id           string    // _id of the first attempt, generated when spilled without one
+	attempts     int       // failed attempts, including the rejection
+	firstFailure time.Time // time of the first failed attempt
+}
+
+// bulkItemError is the error of a bulk item rejected by Elasticsearch.
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// trackDeadLetterTarget keeps the index and pipeline of the first attempt to
+// index the event, before the event is sent to the dead letter index.
+func trackDeadLetterTarget(event *beat.Event, action interface{}) {
+	if deadLetterFailureOf(event) != nil {
+		return
+	}
+
+	var meta eslegclient.BulkMeta
+	switch action := action.(type) {
+	case eslegclient.BulkIndexAction:
+		meta = action.Index
+	case eslegclient.BulkCreateAction:
+		meta = action.Create
+	default:
+		return
+	}
+
+	if event.Meta == nil {
+		event.Meta = common.MapStr{}
+	}
+	event.Meta[dead_letter_failure_field] = &deadLetterFailure{
+		index:    meta.Index,
+		pipeline: meta.Pipeline,
+		id:       meta.ID,
+	}
+}
+
+func deadLetterFailureOf(event *beat.Event) *deadLetterFailure {
+	failure, _ := event.Meta[dead_letter_failure_field].(*deadLetterFailure)
+	return failure
+}
+
+// countDeadLetterAttempt counts a failed attempt to index the event.
+func countDeadLetterAttempt(event *beat.Event, now time.Time) {
+	failure := deadLetterFailureOf(event)
+	if failure == nil {
+		return
+	}
+	if failure.attempts == 0 {
+		failure.firstFailure = now
+	}
+	failure.attempts++
+}
+
+// deadLetterFields returns the dead letter document of an event rejected by
+// Elasticsearch with status and the error msg of its bulk item. The original
+// event is kept as a JSON string in message, so none of its fields can
+// conflict with the mapping of the dead letter index. error.type is the
+// status as in previous versions, the error type of Elasticsearch is in
+// error.code.
+func deadLetterFields(event *beat.Event, status int, msg []byte) common.MapStr {
+	errorFields := common.MapStr{"message": string(msg)}
+	var itemErr bulkItemError
+	if err := json.Unmarshal(msg, &itemErr); err == nil && itemErr.Type != "" {
+		errorFields = common.MapStr{
+			"code":    itemErr.Type,
+			"message": itemErr.Reason,
+		}
+	}
+
+	fields := common.MapStr{
+		"message": event.Fields.String(),
+		"error":   errorFields,
+	}
+	if status != 0 {
+		// events rejected before being sent have no response
+		errorFields["type"] = status
+		fields["http"] = common.MapStr{"response": common.MapStr{"status_code": status}}
+	}
+	if deadLetter := deadLetterHistory(event); deadLetter != nil {
+		fields["dead_letter"] = deadLetter
+	}
+	return fields
+}
+
+// deadLetterHistory returns the dead_letter field of the dead letter document
+// of the event, nil if its history is unknown.
+func deadLetterHistory(event *beat.Event) common.MapStr {
+	failure := deadLetterFailureOf(event)
+	if failure == nil {
+		return nil
+	}
+	deadLetter := common.MapStr{
+		"index":         failure.index,
+		"attempts":      failure.attempts,
+		"first_failure": failure.firstFailure,
+	}
+	if failure.pipeline != "" {
+		deadLetter["pipeline"] = failure.pipeline
+	}
+	if failure.id != "" {
+		deadLetter["id"] = failure.id
+	}
+	return deadLetter
+}
+
+// deadLetterDocument encodes the dead letter document of an event for the
+// policies keeping it outside of Elasticsearch.
+func deadLetterDocument(timestamp time.Time, fields common.MapStr) []byte {
+	document := common.MapStr{"@timestamp": timestamp}
+	document.DeepUpdate(fields)
+	return []byte(document.String())
+}
@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// ReplayStats counts the dead letter documents of a replay.
+type ReplayStats struct {
+	Replayed int // indexed, or already indexed with the same _id
+	Rejected int // written to the rejected lines
+}
+
+// deadLetterLine is the part of a dead letter document needed to replay it.
+type deadLetterLine struct {
+	Timestamp  interface{} `json:"@timestamp"`
+	Message    string      `json:"message"`
+	DeadLetter struct {
+		Index    string `json:"index"`
+		Pipeline string `json:"pipeline"`
+		ID       string `json:"id"`
+	} `json:"dead_letter"`
+}
+
+// ReplayDeadLetters indexes the original events of the dead letter documents
+// read from r, one per line as written by the file policy, in the index and
+// with the pipeline they were first sent to. The lines that can not be
+// replayed are written as they were read to rejected, so that every line is
+// either replayed or rejected. It returns the error of the last failed bulk
+// request, the later requests are still sent.
+func ReplayDeadLetters(ctx context.Context, conn *eslegclient.Connection, r io.Reader, rejected io.Writer, bulkSize int) (ReplayStats, error) {
+	log := logp.NewLogger(logSelector)
+	version := conn.GetVersion()
+	if bulkSize <= 0 {
+		bulkSize = defaultBulkSize
+	}
+
+	var (
+		stats   ReplayStats
+		bulkErr error
+		lines   [][]byte
+		items   []interface{}
+	)
+	reject := func(line []byte) error {
+		stats.Rejected++
+		_, err := rejected.Write(line)
+		return err
+	}
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		defer func() { lines, items = lines[:0], items[:0] }()
+
+		statuses, err := replayBulk(ctx, conn, log, items, len(lines))
+		if err != nil {
+			log.Errorf("Failed to replay %d dead letters: %v", len(lines), err)
+			bulkErr = err
+		}
+		for i, line := range lines {
+			if statuses != nil && (statuses[i] < 300 || statuses[i] == 409) {
+				stats.Replayed++
+				continue
+			}
+			if err := reject(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return stats, readErr
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			meta, fields, err := replayEvent(version, line)
+			if err != nil {
+				log.Errorf("Can't replay dead letter: %v", err)
+				if err := reject(line); err != nil {
+					return stats, err
+				}
+			} else {
+				lines = append(lines, line)
+				items = append(items, meta, fields)
+			}
+		}
+
+		if len(lines) >= bulkSize || (readErr == io.EOF && len(lines) > 0) {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+		if readErr == io.EOF {
+			return stats, bulkErr
+		}
+	}
+}
+
+// replayEvent returns the bulk meta and the original event of a dead letter
+// document, created with the _id of the first attempt so that a document
+// replayed twice is indexed once.
+func replayEvent(version common.Version, line []byte) (interface{}, common.MapStr, error) {
+	var dl deadLetterLine
+	if err := json.Unmarshal(line, &dl); err != nil {
+		return nil, nil, err
+	}
+	if dl.Message == "" || dl.DeadLetter.Index == "" {
+		return nil, nil, errors.New("dead letter without message or dead_letter.index")
+	}
+
+	var fields common.MapStr
+	if err := json.Unmarshal([]byte(dl.Message), &fields); err != nil {
+		return nil, nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if _, ok := fields["@timestamp"]; !ok && dl.Timestamp != nil {
+		fields["@timestamp"] = dl.Timestamp
+	}
+
+	meta := eslegclient.BulkMeta{
+		Index:    strings.ToLower(dl.DeadLetter.Index),
+		Pipeline: dl.DeadLetter.Pipeline,
+		ID:       dl.DeadLetter.ID,
+	}
+	if version.Major < 7 {
+		meta.DocType = defaultEventType
+	}
+	if meta.ID != "" || version.Major > 7 || (version.Major == 7 && version.Minor >= 5) {
+		return eslegclient.BulkCreateAction{Create: meta}, fields, nil
+	}
+	return eslegclient.BulkIndexAction{Index: meta}, fields, nil
+}
+
+// replayBulk sends the bulk items of count documents, returning the status
+// of each document.
+func replayBulk(ctx context.Context, conn *eslegclient.Connection, log *logp.Logger, items []interface{}, count int) ([]int, error) {
+	status, result, err := conn.Bulk(ctx, "", "", nil, items)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("bulk request failed with status %v: %s", status, result)
+	}
+
+	reader := newJSONReader(result)
+	if err := bulkReadToItems(reader); err != nil {
+		return nil, err
+	}
+	statuses := make([]int, count)
+	for i := range statuses {
+		status, msg, err := bulkReadItemStatus(log, reader)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 300 && status != 409 {
+			log.Warnf("Dead letter rejected again (status=%v): %s", status, msg)
+		}
+		statuses[i] = status
+	}
+	return statuses, nil
+}
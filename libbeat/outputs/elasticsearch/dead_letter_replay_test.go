@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	var bulkLines []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.17.0" } }`)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			bulkLines = append(bulkLines, line)
+		}
+		fmt.Fprintln(w, `{"items": [{"create": {"status": 201}}, {"create": {"status": 400, "error": "still failing"}}]}`)
+	}))
+	defer ts.Close()
+
+	conn, err := eslegclient.NewConnection(eslegclient.ConnectionSettings{URL: ts.URL})
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect())
+
+	replayed := `{"@timestamp":"2023-09-18T11:32:58Z","message":"{\"message\":\"one\"}","dead_letter":{"index":"logs","pipeline":"serverlog","id":"one","attempts":1}}`
+	failing := `{"@timestamp":"2023-09-18T11:32:59Z","message":"{\"message\":\"two\"}","dead_letter":{"index":"logs","attempts":1}}`
+	invalid := `{"message":"not a dead letter"}`
+	input := strings.Join([]string{replayed, invalid, "", failing}, "\n")
+
+	var rejected bytes.Buffer
+	stats, err := ReplayDeadLetters(context.Background(), conn, strings.NewReader(input), &rejected, 10)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 1, Rejected: 2}, stats)
+	assert.Equal(t, invalid+"\n"+failing+"\n", rejected.String())
+
+	require.Equal(t, 4, len(bulkLines))
+	assert.Equal(t, map[string]interface{}{
+		"create": map[string]interface{}{"_index": "logs", "_id": "one", "pipeline": "serverlog"},
+	}, bulkLines[0])
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp": "2023-09-18T11:32:58Z",
+		"message":    "one",
+	}, bulkLines[1])
+	assert.Equal(t, map[string]interface{}{
+		"create": map[string]interface{}{"_index": "logs"},
+	}, bulkLines[2])
+}
@@ -0,0 +1,256 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/joeshaw/multierror"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+)
+
+// deadLetterSpill is a policy keeping the dead letter documents of the
+// events rejected by Elasticsearch outside of it. The documents are JSON
+// objects, replayed with ReplayDeadLetters. A spill is shared by the clients
+// of the output. It is closed with each client, the next document opens it
+// again.
+type deadLetterSpill interface {
+	nonIndexablePolicy
+	spill(document []byte) error
+	close() error
+}
+
+// closeDeadLetterSpills closes the spills of a policy and of its fallbacks.
+func closeDeadLetterSpills(policy nonIndexablePolicy) error {
+	var errs multierror.Errors
+	for ; policy != nil; policy = policy.fallback() {
+		if spill, ok := policy.(deadLetterSpill); ok {
+			if err := spill.close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing %s policy: %w", policy.action(), err))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// DeadLetterFilePolicy appends the dead letter documents to a local file, one
+// per line.
+type DeadLetterFilePolicy struct {
+	Path        string                  `config:"path" validate:"required"`
+	Permissions uint32                  `config:"permissions"`
+	Fallback    *common.ConfigNamespace `config:"fallback"`
+
+	next nonIndexablePolicy
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newDeadLetterFilePolicy(config *common.Config) (nonIndexablePolicy, error) {
+	cfgwarn.Beta("The non_indexable_policy file is beta.")
+	policy := &DeadLetterFilePolicy{Permissions: 0600}
+	if err := config.Unpack(policy); err != nil {
+		return nil, fmt.Errorf("%s policy: %w", dead_letter_file, err)
+	}
+	next, err := newFallbackPolicy(policy.Fallback)
+	if err != nil {
+		return nil, err
+	}
+	policy.next = next
+	return policy, nil
+}
+
+func (d *DeadLetterFilePolicy) action() string {
+	return dead_letter_file
+}
+
+func (d *DeadLetterFilePolicy) index() string {
+	panic("file policy doesn't have an target index")
+}
+
+func (d *DeadLetterFilePolicy) fallback() nonIndexablePolicy {
+	return d.next
+}
+
+// spill appends the document to the file, opened with the first document. A
+// failed write closes the file, the next document opens it again.
+func (d *DeadLetterFilePolicy) spill(document []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		f, err := os.OpenFile(d.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(d.Permissions))
+		if err != nil {
+			return err
+		}
+		d.file = f
+	}
+
+	line := make([]byte, 0, len(document)+1)
+	line = append(append(line, document...), '\n')
+	if _, err := d.file.Write(line); err != nil {
+		d.file.Close()
+		d.file = nil
+		return err
+	}
+	return nil
+}
+
+// close closes the file, if open.
+func (d *DeadLetterFilePolicy) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// DeadLetterKafkaPolicy produces the dead letter documents to a Kafka topic,
+// one per record.
+type DeadLetterKafkaPolicy struct {
+	Hosts    []string                `config:"hosts" validate:"required"`
+	Topic    string                  `config:"topic" validate:"required"`
+	Version  kafka.Version           `config:"version"`
+	ClientID string                  `config:"client_id"`
+	Timeout  time.Duration           `config:"timeout" validate:"min=1"`
+	TLS      *tlscommon.Config       `config:"ssl"`
+	Username string                  `config:"username"`
+	Password string                  `config:"password"`
+	Sasl     kafka.SaslConfig        `config:"sasl"`
+	Fallback *common.ConfigNamespace `config:"fallback"`
+
+	next     nonIndexablePolicy
+	config   *sarama.Config
+	mu       sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func newDeadLetterKafkaPolicy(config *common.Config) (nonIndexablePolicy, error) {
+	cfgwarn.Beta("The non_indexable_policy kafka is beta.")
+	policy := &DeadLetterKafkaPolicy{
+		Version:  kafka.Version("1.0.0"),
+		ClientID: "beats",
+		Timeout:  30 * time.Second,
+	}
+	if err := config.Unpack(policy); err != nil {
+		return nil, fmt.Errorf("%s policy: %w", dead_letter_kafka, err)
+	}
+	saramaConfig, err := policy.saramaConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s policy: %w", dead_letter_kafka, err)
+	}
+	policy.config = saramaConfig
+	next, err := newFallbackPolicy(policy.Fallback)
+	if err != nil {
+		return nil, err
+	}
+	policy.next = next
+	return policy, nil
+}
+
+func (d *DeadLetterKafkaPolicy) saramaConfig() (*sarama.Config, error) {
+	version, ok := d.Version.Get()
+	if !ok {
+		return nil, fmt.Errorf("unknown/unsupported kafka version '%v'", d.Version)
+	}
+
+	config := sarama.NewConfig()
+	config.Version = version
+	config.ClientID = d.ClientID
+	config.Net.DialTimeout = d.Timeout
+	config.Net.ReadTimeout = d.Timeout
+	config.Net.WriteTimeout = d.Timeout
+
+	tls, err := tlscommon.LoadTLSConfig(d.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tls != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tls.BuildModuleClientConfig("")
+	}
+	if d.Username != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = d.Username
+		config.Net.SASL.Password = d.Password
+		d.Sasl.ConfigureSarama(config)
+	}
+
+	// the dead letters are only kept once written to all in sync replicas
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Timeout = d.Timeout
+	return config, config.Validate()
+}
+
+func (d *DeadLetterKafkaPolicy) action() string {
+	return dead_letter_kafka
+}
+
+func (d *DeadLetterKafkaPolicy) index() string {
+	panic("kafka policy doesn't have an target index")
+}
+
+func (d *DeadLetterKafkaPolicy) fallback() nonIndexablePolicy {
+	return d.next
+}
+
+// spill produces the document to the topic, connecting with the first
+// document.
+func (d *DeadLetterKafkaPolicy) spill(document []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.producer == nil {
+		producer, err := sarama.NewSyncProducer(d.Hosts, d.config)
+		if err != nil {
+			return err
+		}
+		d.producer = producer
+	}
+
+	_, _, err := d.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: d.Topic,
+		Value: sarama.ByteEncoder(document),
+	})
+	return err
+}
+
+// close closes the producer, if connected.
+func (d *DeadLetterKafkaPolicy) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.producer == nil {
+		return nil
+	}
+	err := d.producer.Close()
+	d.producer = nil
+	return err
+}
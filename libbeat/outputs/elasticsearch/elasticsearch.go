@@ -74,6 +74,11 @@ func makeES(
 		params = nil
 	}
 
+	var dataStreams bool
+	if dsm, ok := im.(outputs.DataStreamIndexManager); ok {
+		dataStreams = dsm.DataStreams()
+	}
+
 	if policy.action() == dead_letter_index {
 		index = DeadLetterSelector{
 			Selector:        index,
@@ -81,6 +86,14 @@ func makeES(
 		}
 	}
 
+	var adaptive *adaptiveController
+	if config.Adaptive.Enabled {
+		if maxConcurrency := config.Adaptive.MaxConcurrency; maxConcurrency > len(hosts) {
+			log.Warnf("adaptive.max_concurrency %d is limited to the %d workers of all the hosts", maxConcurrency, len(hosts))
+		}
+		adaptive = newAdaptiveController(config.Adaptive, config.BulkMaxSize, len(hosts), newAdaptiveRegistry())
+	}
+
 	clients := make([]outputs.NetworkClient, len(hosts))
 	for i, host := range hosts {
 		esURL, err := common.MakeURL(config.Protocol, config.Path, host, 9200)
@@ -109,6 +122,9 @@ func makeES(
 			Pipeline:           pipeline,
 			Observer:           observer,
 			NonIndexableAction: policy.action(),
+			NonIndexablePolicy: policy,
+			DataStreams:        dataStreams,
+			Adaptive:           adaptive,
 		}, &connectCallbackRegistry)
 		if err != nil {
 			return outputs.Fail(err)
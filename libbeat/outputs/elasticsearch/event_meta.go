@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+)
+
+var minVersionRequireAlias = common.MustNewVersion("7.10.0")
+
+// invalidEventMetaError reports event metadata that can't be encoded in a bulk
+// request. The event is handled by the non indexable policy.
+type invalidEventMetaError struct {
+	field  string
+	reason string
+	// target is the index and pipeline selected for the event.
+	target eslegclient.BulkMeta
+}
+
+func (e *invalidEventMetaError) Error() string {
+	return fmt.Sprintf("invalid @metadata.%s: %s", e.field, e.reason)
+}
+
+// itemError returns the error in the format of a rejected bulk item, for the
+// dead letter document of the event.
+func (e *invalidEventMetaError) itemError() []byte {
+	msg, _ := json.Marshal(bulkItemError{Type: "invalid_event_metadata", Reason: e.Error()})
+	return msg
+}
+
+// eventOpType returns the op_type of the event, the default one if not set.
+func eventOpType(event *beat.Event) (events.OpType, error) {
+	v, err := event.Meta.GetValue(events.FieldMetaOpType)
+	if err != nil {
+		return events.OpTypeDefault, nil
+	}
+
+	switch v := v.(type) {
+	case events.OpType:
+		if v >= events.OpTypeDefault && v <= events.OpTypeDelete {
+			return v, nil
+		}
+	case string:
+		switch v {
+		case "":
+			return events.OpTypeDefault, nil
+		case "create":
+			return events.OpTypeCreate, nil
+		case "index":
+			return events.OpTypeIndex, nil
+		case "delete":
+			return events.OpTypeDelete, nil
+		}
+	}
+	return events.OpTypeDefault, &invalidEventMetaError{
+		field:  events.FieldMetaOpType,
+		reason: fmt.Sprintf("unknown operation '%v', expected create, index or delete", v),
+	}
+}
+
+// eventRouting returns the routing of the event, empty if not set. Integers
+// are accepted, as identifiers are often numeric.
+func eventRouting(event *beat.Event) (string, error) {
+	v, err := event.Meta.GetValue(events.FieldMetaRouting)
+	if err != nil {
+		return "", nil
+	}
+
+	var routing string
+	switch v := v.(type) {
+	case string:
+		routing = v
+	case int:
+		routing = strconv.Itoa(v)
+	case int64:
+		routing = strconv.FormatInt(v, 10)
+	case uint64:
+		routing = strconv.FormatUint(v, 10)
+	default:
+		return "", &invalidEventMetaError{
+			field:  events.FieldMetaRouting,
+			reason: fmt.Sprintf("%T is not a string", v),
+		}
+	}
+	if routing == "" {
+		return "", &invalidEventMetaError{field: events.FieldMetaRouting, reason: "empty routing"}
+	}
+	return routing, nil
+}
+
+// eventRequireAlias returns true if the event must be indexed to an alias.
+func eventRequireAlias(version common.Version, event *beat.Event) (bool, error) {
+	v, err := event.Meta.GetValue(events.FieldMetaRequireAlias)
+	if err != nil {
+		return false, nil
+	}
+
+	var requireAlias bool
+	switch v := v.(type) {
+	case bool:
+		requireAlias = v
+	case string:
+		if requireAlias, err = strconv.ParseBool(v); err != nil {
+			return false, &invalidEventMetaError{
+				field:  events.FieldMetaRequireAlias,
+				reason: fmt.Sprintf("'%v' is not a boolean", v),
+			}
+		}
+	default:
+		return false, &invalidEventMetaError{
+			field:  events.FieldMetaRequireAlias,
+			reason: fmt.Sprintf("%T is not a boolean", v),
+		}
+	}
+	if requireAlias && version.LessThan(minVersionRequireAlias) {
+		return false, &invalidEventMetaError{
+			field:  events.FieldMetaRequireAlias,
+			reason: fmt.Sprintf("requires Elasticsearch %v or newer, found %v", minVersionRequireAlias, version),
+		}
+	}
+	return requireAlias, nil
+}
@@ -29,6 +29,11 @@ const (
 	dead_letter_marker_field = "deadlettered"
 	drop                     = "drop"
 	dead_letter_index        = "dead_letter_index"
+	dead_letter_file         = "file"
+	dead_letter_kafka        = "kafka"
+
+	// dead_letter_failure_field keeps the failed attempts of an event
+	dead_letter_failure_field = "deadletter_failure"
 )
 
 type DropPolicy struct{}
@@ -41,8 +46,15 @@ func (d DropPolicy) index() string {
 	panic("drop policy doesn't have an target index")
 }
 
+func (d DropPolicy) fallback() nonIndexablePolicy {
+	return nil
+}
+
 type DeadLetterIndexPolicy struct {
-	Index string
+	Index    string
+	Fallback *common.ConfigNamespace `config:"fallback"`
+
+	next nonIndexablePolicy
 }
 
 func (d DeadLetterIndexPolicy) action() string {
@@ -53,17 +65,30 @@ func (d DeadLetterIndexPolicy) index() string {
 	return d.Index
 }
 
+func (d DeadLetterIndexPolicy) fallback() nonIndexablePolicy {
+	return d.next
+}
+
 type nonIndexablePolicy interface {
 	action() string
 	index() string
+	// fallback returns the policy of the events this policy fails to keep,
+	// nil if they are retried.
+	fallback() nonIndexablePolicy
 }
 
-var (
+// policyFactories is set in init, the factories create the fallback
+// policies with it.
+var policyFactories map[string]policyFactory
+
+func init() {
 	policyFactories = map[string]policyFactory{
 		drop:              newDropPolicy,
 		dead_letter_index: newDeadLetterIndexPolicy,
+		dead_letter_file:  newDeadLetterFilePolicy,
+		dead_letter_kafka: newDeadLetterKafkaPolicy,
 	}
-)
+}
 
 func newDeadLetterIndexPolicy(config *common.Config) (nonIndexablePolicy, error) {
 	cfgwarn.Beta("The non_indexable_policy dead_letter_index is beta.")
@@ -72,6 +97,10 @@ func newDeadLetterIndexPolicy(config *common.Config) (nonIndexablePolicy, error)
 	if policy.index() == "" {
 		return nil, fmt.Errorf("%s policy requires an `index` to be specified specified", dead_letter_index)
 	}
+	if err != nil {
+		return nil, err
+	}
+	policy.next, err = newFallbackPolicy(policy.Fallback)
 	return policy, err
 }
 
@@ -102,3 +131,15 @@ func newNonIndexablePolicy(configNamespace *common.ConfigNamespace) (nonIndexabl
 
 	return factory(configNamespace.Config())
 }
+
+// newFallbackPolicy creates the fallback of a policy, nil if it has none. The
+// dead letter index can only be the first policy, its events are retried.
+func newFallbackPolicy(configNamespace *common.ConfigNamespace) (nonIndexablePolicy, error) {
+	if configNamespace == nil || !configNamespace.IsSet() {
+		return nil, nil
+	}
+	if configNamespace.Name() == dead_letter_index {
+		return nil, fmt.Errorf("%s policy can not be a fallback", dead_letter_index)
+	}
+	return newNonIndexablePolicy(configNamespace)
+}
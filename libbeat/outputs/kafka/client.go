@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,8 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/eapache/go-resiliency/breaker"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/common/transport"
 	"github.com/elastic/beats/v7/libbeat/logp"
@@ -45,6 +48,8 @@ type client struct {
 	hosts    []string
 	topic    outil.Selector
 	key      *fmtstr.EventFormatString
+	headers  []headerConfig
+	oversize oversizeConfig
 	index    string
 	codec    codec.Codec
 	config   sarama.Config
@@ -53,6 +58,11 @@ type client struct {
 
 	producer sarama.AsyncProducer
 
+	// the producer of the records larger than max_message_bytes, with the
+	// fallback oversize action
+	fallback       sarama.AsyncProducer
+	fallbackConfig sarama.Config
+
 	wg sync.WaitGroup
 }
 
@@ -63,6 +73,9 @@ type msgRef struct {
 	failed []publisher.Event
 	batch  publisher.Batch
 
+	// mu guards failed and err, the messages of a batch are returned by
+	// the error workers of the producer and of the fallback producer
+	mu  sync.Mutex
 	err error
 }
 
@@ -76,6 +89,8 @@ func newKafkaClient(
 	index string,
 	key *fmtstr.EventFormatString,
 	topic outil.Selector,
+	headers []headerConfig,
+	oversize oversizeConfig,
 	writer codec.Codec,
 	cfg *sarama.Config,
 ) (*client, error) {
@@ -85,11 +100,17 @@ func newKafkaClient(
 		hosts:    hosts,
 		topic:    topic,
 		key:      key,
+		headers:  headers,
+		oversize: oversize,
 		index:    strings.ToLower(index),
 		codec:    writer,
 		config:   *cfg,
 		done:     make(chan struct{}),
 	}
+	if oversize.Action == oversizeFallback {
+		c.fallbackConfig = *cfg
+		c.fallbackConfig.Producer.MaxMessageBytes = oversize.MaxMessageBytes
+	}
 	return c, nil
 }
 
@@ -106,6 +127,20 @@ func (c *client) Connect() error {
 		return err
 	}
 
+	if c.oversize.Action == oversizeFallback {
+		fallback, err := sarama.NewAsyncProducer(c.hosts, &c.fallbackConfig)
+		if err != nil {
+			c.log.Errorf("Kafka connect of the oversize fallback fails with: %+v", err)
+			producer.Close()
+			return err
+		}
+		c.fallback = fallback
+
+		c.wg.Add(2)
+		go c.successWorker(fallback.Successes())
+		go c.errorWorker(fallback.Errors())
+	}
+
 	c.producer = producer
 
 	c.wg.Add(2)
@@ -127,8 +162,12 @@ func (c *client) Close() error {
 
 	close(c.done)
 	c.producer.AsyncClose()
+	if c.fallback != nil {
+		c.fallback.AsyncClose()
+	}
 	c.wg.Wait()
 	c.producer = nil
+	c.fallback = nil
 	return nil
 }
 
@@ -157,9 +196,13 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 			continue
 		}
 
-		msg.ref = ref
-		msg.initProducerMessage()
-		ch <- &msg.msg
+		if c.oversize.Action != oversizeDrop && msg.byteSize(c.config.Version) > c.config.Producer.MaxMessageBytes {
+			c.publishOversized(ref, msg)
+		} else {
+			msg.ref = ref
+			msg.initProducerMessage()
+			ch <- &msg.msg
+		}
 
 		totalSize += d.Content.MessageSize
 	}
@@ -237,10 +280,72 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 			msg.key = key
 		}
 	}
+	msg.headers = c.recordHeaders(event)
 
 	return msg, nil
 }
 
+// recordHeaders returns the headers of the record of an event: the headers
+// of the record the event was read from, forwarded by the kafka input in
+// @metadata.kafka.headers, and the configured headers, replacing forwarded
+// headers of the same key. Headers whose value can not be formatted are not
+// set. Kafka before 0.11 has no headers, the forwarded ones are then dropped.
+func (c *client) recordHeaders(event *beat.Event) []sarama.RecordHeader {
+	if !c.config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil
+	}
+
+	var headers []sarama.RecordHeader
+	configured := make(map[string]bool, len(c.headers))
+	for _, h := range c.headers {
+		configured[h.Key] = true
+	}
+
+	if value, err := event.GetValue("@metadata.kafka.headers"); err == nil {
+		if forwarded, ok := value.(common.MapStr); ok {
+			keys := make([]string, 0, len(forwarded))
+			for k := range forwarded {
+				if !configured[k] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				// a key repeated in the record holds the list of its values
+				var values []interface{}
+				switch v := forwarded[k].(type) {
+				case []string:
+					for _, s := range v {
+						values = append(values, s)
+					}
+				case []interface{}:
+					values = v
+				default:
+					values = []interface{}{v}
+				}
+				for _, v := range values {
+					headers = append(headers, sarama.RecordHeader{
+						Key:   []byte(k),
+						Value: []byte(fmt.Sprint(v)),
+					})
+				}
+			}
+		}
+	}
+
+	for _, h := range c.headers {
+		value, err := h.Value.RunBytes(event)
+		if err != nil {
+			if c.log.IsDebug() {
+				c.log.Debugf("not setting header %v: %v", h.Key, err)
+			}
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(h.Key), Value: value})
+	}
+	return headers
+}
+
 func (c *client) successWorker(ch <-chan *sarama.ProducerMessage) {
 	defer c.wg.Done()
 	defer c.log.Debug("Stop kafka ack worker")
@@ -346,6 +451,7 @@ func (r *msgRef) done() {
 }
 
 func (r *msgRef) fail(msg *message, err error) {
+	r.mu.Lock()
 	switch err {
 	case sarama.ErrInvalidMessage:
 		r.client.log.Errorf("Kafka (topic=%v): dropping invalid message", msg.topic)
@@ -359,19 +465,32 @@ func (r *msgRef) fail(msg *message, err error) {
 	case breaker.ErrBreakerOpen:
 		// Add this message to the failed list, but don't overwrite r.err since
 		// all the breaker error means is "there were a lot of other errors".
-		r.failed = append(r.failed, msg.data)
+		r.retry(msg)
 
 	default:
-		r.failed = append(r.failed, msg.data)
+		r.retry(msg)
 		if r.err == nil {
 			// Don't overwrite an existing error. This way at tne end of the batch
 			// we report the first error that we saw, rather than the last one.
 			r.err = err
 		}
 	}
+	r.mu.Unlock()
 	r.dec()
 }
 
+// retry adds the event of a failed message to the events to retry, once for
+// all the parts of a split event.
+func (r *msgRef) retry(msg *message) {
+	if msg.split != nil {
+		if msg.split.failed {
+			return
+		}
+		msg.split.failed = true
+	}
+	r.failed = append(r.failed, msg.data)
+}
+
 func (r *msgRef) dec() {
 	i := atomic.AddInt32(&r.count, -1)
 	if i > 0 {
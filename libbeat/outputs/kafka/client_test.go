@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+func TestRecordHeaders(t *testing.T) {
+	config, err := readConfig(common.MustNewConfigFrom(common.MapStr{
+		"hosts": "localhost:9092",
+		"headers": []common.MapStr{
+			{"key": "trace_id", "value": "%{[trace.id]}"},
+			{"key": "vid", "value": "%{[vehicle.vid]}"},
+		},
+	}))
+	require.NoError(t, err)
+	c := &client{log: logp.NewLogger(logSelector), headers: config.Headers}
+	c.config.Version = sarama.V1_0_0_0
+
+	event := &beat.Event{
+		Fields: common.MapStr{"trace": common.MapStr{"id": "4bf92f35"}},
+		Meta: common.MapStr{"kafka": common.MapStr{"headers": common.MapStr{
+			"trace_id": "forwarded",
+			"source":   "ilogtail",
+			"hop":      []string{"a", "b"},
+		}}},
+	}
+	// the vid header is not set without the field, the configured trace_id
+	// replaces the forwarded one
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("hop"), Value: []byte("a")},
+		{Key: []byte("hop"), Value: []byte("b")},
+		{Key: []byte("source"), Value: []byte("ilogtail")},
+		{Key: []byte("trace_id"), Value: []byte("4bf92f35")},
+	}, c.recordHeaders(event))
+
+	// kafka before 0.11 has no headers
+	old := &client{log: logp.NewLogger(logSelector)}
+	old.config.Version = sarama.V0_10_2_0
+	assert.Nil(t, old.recordHeaders(event))
+
+	assert.Nil(t, (&client{}).recordHeaders(&beat.Event{Fields: common.MapStr{}}))
+}
+
+func TestHeadersRequireVersion(t *testing.T) {
+	_, err := readConfig(common.MustNewConfigFrom(common.MapStr{
+		"hosts":   "localhost:9092",
+		"version": "0.10",
+		"headers": []common.MapStr{{"key": "trace_id", "value": "%{[trace.id]}"}},
+	}))
+	assert.Error(t, err)
+}
+
+func newOversizeClient(t *testing.T, settings common.MapStr) *client {
+	cfg := common.MustNewConfigFrom(common.MapStr{
+		"hosts":             "localhost:9092",
+		"topic":             "test",
+		"max_message_bytes": 200,
+	})
+	require.NoError(t, cfg.Merge(settings))
+	config, err := readConfig(cfg)
+	require.NoError(t, err)
+	libCfg, err := newSaramaConfig(logp.L(), config)
+	require.NoError(t, err)
+
+	c, err := newKafkaClient(outputs.NewNilObserver(), config.Hosts, "test", nil,
+		outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorKeepCase)),
+		nil, config.Oversize, json.New("7.17.0", json.Config{}), libCfg)
+	require.NoError(t, err)
+	return c
+}
+
+func TestSplitMessage(t *testing.T) {
+	c := newOversizeClient(t, common.MapStr{"oversize.action": "split"})
+
+	// the escaped quotes and the multi-byte runes make the encoded parts
+	// larger than the message parts
+	text := strings.Repeat(`a "quoted" résumé, `, 30)
+	msg := &message{
+		topic: "test",
+		data: publisher.Event{Content: beat.Event{
+			Fields: common.MapStr{"message": text, "host": "vehicle-1"},
+		}},
+	}
+
+	parts, err := c.splitMessage(msg)
+	require.NoError(t, err)
+	require.True(t, len(parts) > 1)
+
+	var joined strings.Builder
+	for i, part := range parts {
+		assert.LessOrEqual(t, part.byteSize(c.config.Version), c.config.Producer.MaxMessageBytes)
+		assert.Same(t, parts[0].split, part.split)
+		assert.Equal(t, []sarama.RecordHeader{
+			{Key: []byte(splitIndexHeader), Value: []byte(strconv.Itoa(i))},
+			{Key: []byte(splitCountHeader), Value: []byte(strconv.Itoa(len(parts)))},
+		}, part.headers)
+
+		var fields common.MapStr
+		require.NoError(t, stdjson.Unmarshal(part.value, &fields))
+		assert.Equal(t, "vehicle-1", fields["host"])
+		joined.WriteString(fields["message"].(string))
+	}
+	assert.Equal(t, text, joined.String())
+	assert.Equal(t, text, msg.data.Content.Fields["message"], "the event must not be modified")
+
+	_, err = c.splitMessage(&message{data: publisher.Event{Content: beat.Event{
+		Fields: common.MapStr{"count": 1},
+	}}})
+	assert.Error(t, err, "events without a message can not be split")
+
+	_, err = c.splitMessage(&message{data: publisher.Event{Content: beat.Event{
+		Fields: common.MapStr{"message": "short", "other": strings.Repeat("x", 300)},
+	}}})
+	assert.Error(t, err, "events too large without their message can not be split")
+}
+
+func TestPublishOversized(t *testing.T) {
+	small := beat.Event{Fields: common.MapStr{"message": "small"}}
+	oversized := beat.Event{Fields: common.MapStr{"message": strings.Repeat("x", 400)}}
+
+	cases := map[string]struct {
+		settings common.MapStr
+		fallback bool // the oversized event is sent by the fallback producer
+	}{
+		"split": {
+			settings: common.MapStr{"oversize.action": "split"},
+		},
+		"fallback": {
+			settings: common.MapStr{
+				"oversize.action":            "fallback",
+				"oversize.topic":             "test-oversize",
+				"oversize.max_message_bytes": 1024,
+			},
+			fallback: true,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := newOversizeClient(t, test.settings)
+
+			producer := mocks.NewAsyncProducer(t, &c.config)
+			producer.ExpectInputAndSucceed()
+			c.producer = producer
+			c.wg.Add(1)
+			go c.successWorker(producer.Successes())
+
+			if test.fallback {
+				fallback := mocks.NewAsyncProducer(t, &c.fallbackConfig)
+				fallback.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+					assert.Equal(t, "test-oversize", msg.Topic)
+					return nil
+				})
+				c.fallback = fallback
+				c.wg.Add(1)
+				go c.successWorker(fallback.Successes())
+			} else {
+				parts, err := c.splitMessage(&message{data: publisher.Event{Content: oversized}})
+				require.NoError(t, err)
+				for range parts {
+					producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+						assert.LessOrEqual(t, msg.Metadata.(*message).byteSize(c.config.Version), c.config.Producer.MaxMessageBytes)
+						return nil
+					})
+				}
+			}
+
+			acked := make(chan struct{})
+			batch := outest.NewBatch(small, oversized)
+			batch.OnSignal = func(sig outest.BatchSignal) {
+				assert.Equal(t, outest.BatchACK, sig.Tag)
+				close(acked)
+			}
+			require.NoError(t, c.Publish(context.Background(), batch))
+			<-acked
+
+			producer.AsyncClose()
+			if c.fallback != nil {
+				c.fallback.AsyncClose()
+			}
+			c.wg.Wait()
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/Shopify/sarama"
 
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/common/kafka"
@@ -45,6 +46,9 @@ var (
 		"libbeat.outputs.kafka",
 		adapter.Rename("incoming-byte-rate", "bytes_read"),
 		adapter.Rename("outgoing-byte-rate", "bytes_write"),
+		adapter.Rename("batch-size", "batch_size"),
+		adapter.Rename("compression-ratio", "compression_ratio"),
+		adapter.Rename("records-per-request", "records_per_request"),
 		adapter.GoMetricsNilify,
 	)
 )
@@ -61,6 +65,7 @@ type kafkaConfig struct {
 	Timeout            time.Duration             `config:"timeout"             validate:"min=1"`
 	Metadata           metaConfig                `config:"metadata"`
 	Key                *fmtstr.EventFormatString `config:"key"`
+	Headers            []headerConfig            `config:"headers"`
 	Partition          map[string]*common.Config `config:"partition"`
 	KeepAlive          time.Duration             `config:"keep_alive"          validate:"min=0"`
 	MaxMessageBytes    *int                      `config:"max_message_bytes"   validate:"min=1"`
@@ -71,6 +76,9 @@ type kafkaConfig struct {
 	Version            kafka.Version             `config:"version"`
 	BulkMaxSize        int                       `config:"bulk_max_size"`
 	BulkFlushFrequency time.Duration             `config:"bulk_flush_frequency"`
+	BulkMode           bulkMode                  `config:"bulk_mode"`
+	BulkMaxBytes       cfgtype.ByteSize          `config:"bulk_max_bytes"      validate:"min=1"`
+	Oversize           oversizeConfig            `config:"oversize"`
 	MaxRetries         int                       `config:"max_retries"         validate:"min=-1,nonzero"`
 	Backoff            backoffConfig             `config:"backoff"`
 	ClientID           string                    `config:"client_id"`
@@ -80,8 +88,76 @@ type kafkaConfig struct {
 	Codec              codec.Config              `config:"codec"`
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
+	TransactionalID    string                    `config:"transactional_id"`
+	TransactionTimeout time.Duration             `config:"transaction_timeout" validate:"min=1"`
 }
 
+// headerConfig is a record header set from the event.
+type headerConfig struct {
+	Key   string                    `config:"key"   validate:"required"`
+	Value *fmtstr.EventFormatString `config:"value" validate:"required"`
+}
+
+// oversizeConfig configures the handling of the events whose record is
+// larger than max_message_bytes.
+type oversizeConfig struct {
+	Action          oversizeAction `config:"action"`
+	Topic           string         `config:"topic"`
+	MaxMessageBytes int            `config:"max_message_bytes" validate:"min=1"`
+}
+
+type bulkMode int
+
+const (
+	bulkModeStatic bulkMode = iota // requests are sized by bulk_max_size events
+	bulkModeBytes                  // requests are sized by bulk_max_bytes
+)
+
+type oversizeAction int
+
+const (
+	oversizeDrop     oversizeAction = iota // the broker rejects the record, the event is dropped
+	oversizeSplit                          // the message field is split into records that fit
+	oversizeFallback                       // the record is sent to the fallback topic
+)
+
+var (
+	bulkModes = map[string]bulkMode{
+		"static": bulkModeStatic,
+		"bytes":  bulkModeBytes,
+	}
+	oversizeActions = map[string]oversizeAction{
+		"drop":     oversizeDrop,
+		"split":    oversizeSplit,
+		"fallback": oversizeFallback,
+	}
+)
+
+// Unpack validates and unpack the "bulk_mode" config option
+func (m *bulkMode) Unpack(value string) error {
+	mode, ok := bulkModes[value]
+	if !ok {
+		return fmt.Errorf("invalid bulk mode '%s'", value)
+	}
+	*m = mode
+	return nil
+}
+
+// Unpack validates and unpack the "oversize.action" config option
+func (a *oversizeAction) Unpack(value string) error {
+	action, ok := oversizeActions[value]
+	if !ok {
+		return fmt.Errorf("invalid oversize action '%s'", value)
+	}
+	*a = action
+	return nil
+}
+
+// defaultBulkFlushFrequency is the flush frequency of the bytes bulk mode
+// when bulk_flush_frequency is not set. Batches sized by bytes are sent when
+// they are full or at the latest after this interval.
+const defaultBulkFlushFrequency = 100 * time.Millisecond
+
 type metaConfig struct {
 	Retry       metaRetryConfig `config:"retry"`
 	RefreshFreq time.Duration   `config:"refresh_frequency" validate:"min=0"`
@@ -116,6 +192,12 @@ func defaultConfig() kafkaConfig {
 		Timeout:            30 * time.Second,
 		BulkMaxSize:        2048,
 		BulkFlushFrequency: 0,
+		BulkMode:           bulkModeStatic,
+		BulkMaxBytes:       1024 * 1024,
+		Oversize: oversizeConfig{
+			Action:          oversizeDrop,
+			MaxMessageBytes: 10 * 1024 * 1024,
+		},
 		Metadata: metaConfig{
 			Retry: metaRetryConfig{
 				Max:     3,
@@ -136,10 +218,11 @@ func defaultConfig() kafkaConfig {
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
-		ClientID:       "beats",
-		ChanBufferSize: 256,
-		Username:       "",
-		Password:       "",
+		ClientID:           "beats",
+		ChanBufferSize:     256,
+		Username:           "",
+		Password:           "",
+		TransactionTimeout: 60 * time.Second,
 	}
 }
 
@@ -174,9 +257,51 @@ func (c *kafkaConfig) Validate() error {
 			return fmt.Errorf("compression_level must be between 0 and 9")
 		}
 	}
+
+	if len(c.Headers) > 0 {
+		if version, ok := c.Version.Get(); !ok || !version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("headers requires kafka version 0.11 or newer")
+		}
+	}
+
+	if c.TransactionalID != "" {
+		if version, ok := c.Version.Get(); !ok || !version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("transactional_id requires kafka version 0.11 or newer")
+		}
+		if c.RequiredACKs != nil && sarama.RequiredAcks(*c.RequiredACKs) != sarama.WaitForAll {
+			return fmt.Errorf("transactional_id requires required_acks: -1")
+		}
+		if c.BulkMode != bulkModeStatic || c.Oversize.Action != oversizeDrop {
+			return fmt.Errorf("transactional_id can not be used with bulk_mode: bytes or the split and fallback oversize actions")
+		}
+	}
+
+	if c.BulkMode == bulkModeBytes && c.BulkMaxBytes >= cfgtype.ByteSize(sarama.MaxRequestSize) {
+		return fmt.Errorf("bulk_max_bytes must be smaller than %v", sarama.MaxRequestSize)
+	}
+
+	if c.Oversize.Action == oversizeFallback {
+		if c.Oversize.Topic == "" {
+			return fmt.Errorf("oversize.topic must be set for the fallback action")
+		}
+		if c.Oversize.MaxMessageBytes <= c.maxMessageBytes() {
+			return fmt.Errorf("oversize.max_message_bytes must be larger than max_message_bytes")
+		}
+		if c.Oversize.MaxMessageBytes >= int(sarama.MaxRequestSize) {
+			return fmt.Errorf("oversize.max_message_bytes must be smaller than %v", sarama.MaxRequestSize)
+		}
+	}
 	return nil
 }
 
+// maxMessageBytes returns the record size limit of the producer.
+func (c *kafkaConfig) maxMessageBytes() int {
+	if c.MaxMessageBytes != nil {
+		return *c.MaxMessageBytes
+	}
+	return sarama.NewConfig().Producer.MaxMessageBytes
+}
+
 func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, error) {
 	partitioner, err := makePartitioner(log, config.Partition)
 	if err != nil {
@@ -248,6 +373,12 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	if config.RequiredACKs != nil {
 		k.Producer.RequiredAcks = sarama.RequiredAcks(*config.RequiredACKs)
 	}
+	if config.TransactionalID != "" {
+		// the records of a transaction are written to all in sync replicas,
+		// one request at a time to keep their sequence numbers in order
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
 
 	compressionMode, ok := compressionModes[strings.ToLower(config.Compression)]
 	if !ok {
@@ -270,9 +401,20 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	k.ChannelBufferSize = config.ChanBufferSize
 
 	// configure bulk size
-	k.Producer.Flush.MaxMessages = config.BulkMaxSize
-	if config.BulkFlushFrequency > 0 {
-		k.Producer.Flush.Frequency = config.BulkFlushFrequency
+	switch config.BulkMode {
+	case bulkModeBytes:
+		// requests are flushed when their records reach bulk_max_bytes, the
+		// number of records per request is not limited
+		k.Producer.Flush.Bytes = int(config.BulkMaxBytes)
+		k.Producer.Flush.Frequency = defaultBulkFlushFrequency
+		if config.BulkFlushFrequency > 0 {
+			k.Producer.Flush.Frequency = config.BulkFlushFrequency
+		}
+	default:
+		k.Producer.Flush.MaxMessages = config.BulkMaxSize
+		if config.BulkFlushFrequency > 0 {
+			k.Producer.Flush.Frequency = config.BulkFlushFrequency
+		}
 	}
 
 	// configure client ID
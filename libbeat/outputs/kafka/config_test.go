@@ -60,6 +60,18 @@ func TestConfigAcceptValid(t *testing.T) {
 				"realm":        "ELASTIC",
 			},
 		},
+		"bytes bulk mode": common.MapStr{
+			"bulk_mode":      "bytes",
+			"bulk_max_bytes": "4MiB",
+		},
+		"split oversized events": common.MapStr{
+			"oversize.action": "split",
+		},
+		"fallback topic for oversized events": common.MapStr{
+			"oversize.action":            "fallback",
+			"oversize.topic":             "oversize",
+			"oversize.max_message_bytes": 8 * 1024 * 1024,
+		},
 	}
 
 	for name, test := range tests {
@@ -88,6 +100,33 @@ func TestConfigInvalid(t *testing.T) {
 				"realm":        "ELASTIC",
 			},
 		},
+		"invalid bulk_mode": common.MapStr{
+			"bulk_mode": "dynamic",
+		},
+		"bulk_max_bytes larger than a request": common.MapStr{
+			"bulk_mode":      "bytes",
+			"bulk_max_bytes": "200MiB",
+		},
+		"invalid oversize action": common.MapStr{
+			"oversize.action": "truncate",
+		},
+		"fallback without topic": common.MapStr{
+			"oversize.action": "fallback",
+		},
+		"fallback not larger than max_message_bytes": common.MapStr{
+			"max_message_bytes":          2 * 1024 * 1024,
+			"oversize.action":            "fallback",
+			"oversize.topic":             "oversize",
+			"oversize.max_message_bytes": 1024 * 1024,
+		},
+		"split with transactional_id": common.MapStr{
+			"transactional_id": "beats",
+			"oversize.action":  "split",
+		},
+		"bytes bulk mode with transactional_id": common.MapStr{
+			"transactional_id": "beats",
+			"bulk_mode":        "bytes",
+		},
 	}
 
 	for name, test := range tests {
@@ -103,6 +142,51 @@ func TestConfigInvalid(t *testing.T) {
 	}
 }
 
+func TestBulkMode(t *testing.T) {
+	cases := map[string]struct {
+		cfg       common.MapStr
+		bytes     int
+		messages  int
+		frequency time.Duration
+	}{
+		"static": {
+			cfg:      common.MapStr{"bulk_max_size": 512},
+			messages: 512,
+		},
+		"bytes": {
+			cfg:       common.MapStr{"bulk_mode": "bytes", "bulk_max_bytes": "2MiB"},
+			bytes:     2 * 1024 * 1024,
+			frequency: defaultBulkFlushFrequency,
+		},
+		"bytes with flush frequency": {
+			cfg:       common.MapStr{"bulk_mode": "bytes", "bulk_flush_frequency": "1s"},
+			bytes:     1024 * 1024,
+			frequency: time.Second,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := common.MustNewConfigFrom(test.cfg)
+			c.SetString("hosts", 0, "localhost")
+			cfg, err := readConfig(c)
+			if err != nil {
+				t.Fatalf("Can not create test configuration: %v", err)
+			}
+			k, err := newSaramaConfig(logp.L(), cfg)
+			if err != nil {
+				t.Fatalf("Failure creating sarama config: %v", err)
+			}
+
+			flush := k.Producer.Flush
+			if flush.Bytes != test.bytes || flush.MaxMessages != test.messages || flush.Frequency != test.frequency {
+				t.Errorf("unexpected flush settings: %+v", flush)
+			}
+		})
+	}
+}
+
 func TestBackoffFunc(t *testing.T) {
 	testutil.SeedPRNG(t)
 	tests := map[int]backoffConfig{
@@ -72,7 +72,7 @@ func makeKafka(
 		return outputs.Fail(err)
 	}
 
-	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, topic, codec, libCfg)
+	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, topic, config.Headers, config.Oversize, codec, libCfg)
 	if err != nil {
 		return outputs.Fail(err)
 	}
@@ -81,6 +81,10 @@ func makeKafka(
 	if config.MaxRetries < 0 {
 		retry = -1
 	}
+	if config.TransactionalID != "" {
+		// failed transactions are retried by the client
+		return outputs.Success(config.BulkMaxSize, retry, newTransactionalClient(client, config))
+	}
 	return outputs.Success(config.BulkMaxSize, retry, client)
 }
 
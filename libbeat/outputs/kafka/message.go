@@ -18,6 +18,7 @@
 package kafka
 
 import (
+	"encoding/binary"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -28,18 +29,35 @@ import (
 type message struct {
 	msg sarama.ProducerMessage
 
-	topic string
-	key   []byte
-	value []byte
-	ref   *msgRef
-	ts    time.Time
+	topic   string
+	key     []byte
+	value   []byte
+	headers []sarama.RecordHeader
+	ref     *msgRef
+	ts      time.Time
 
 	hash      uint32
 	partition int32
 
 	data publisher.Event
+
+	// split is set on the parts of an event split by the split oversize action
+	split *splitEvent
+}
+
+// splitEvent is the state shared by the parts of a split event.
+type splitEvent struct {
+	failed bool // a part failed, the event is retried
 }
 
+// The overhead of a record, as the producer accounts it when checking the
+// size of a message against max_message_bytes.
+const (
+	messageOverhead      = 26                                                  // until kafka 0.11
+	recordOverhead       = 5*binary.MaxVarintLen32 + binary.MaxVarintLen64 + 1 // since kafka 0.11
+	recordHeaderOverhead = 2 * binary.MaxVarintLen32
+)
+
 var kafkaMessageKey interface{} = int(0)
 
 func (m *message) initProducerMessage() {
@@ -49,5 +67,19 @@ func (m *message) initProducerMessage() {
 		Key:       sarama.ByteEncoder(m.key),
 		Value:     sarama.ByteEncoder(m.value),
 		Timestamp: m.ts,
+		Headers:   m.headers,
+	}
+}
+
+// byteSize returns the size of the record of the message, as the producer
+// checks it against max_message_bytes.
+func (m *message) byteSize(version sarama.KafkaVersion) int {
+	if !version.IsAtLeast(sarama.V0_11_0_0) {
+		return messageOverhead + len(m.key) + len(m.value)
+	}
+	size := recordOverhead + len(m.key) + len(m.value)
+	for _, h := range m.headers {
+		size += len(h.Key) + len(h.Value) + recordHeaderOverhead
 	}
+	return size
 }
@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// The record headers marking the parts of a split event.
+const (
+	splitIndexHeader = "split.index"
+	splitCountHeader = "split.count"
+)
+
+// splitHeadersSize is the room kept in the parts of a split event for the
+// headers marking them.
+const splitHeadersSize = len(splitIndexHeader) + len(splitCountHeader) +
+	2*(len("2147483647")+recordHeaderOverhead)
+
+// publishOversized publishes the event of a message whose record is larger
+// than max_message_bytes according to the oversize action.
+func (c *client) publishOversized(ref *msgRef, msg *message) {
+	switch c.oversize.Action {
+	case oversizeFallback:
+		msg.topic = c.oversize.Topic
+		msg.ref = ref
+		msg.initProducerMessage()
+		c.fallback.Input() <- &msg.msg
+
+	case oversizeSplit:
+		parts, err := c.splitMessage(msg)
+		if err != nil {
+			c.log.Errorf("Dropping oversized event: %+v", err)
+			ref.done()
+			c.observer.Dropped(1)
+			return
+		}
+
+		// the event is done once all its parts are
+		atomic.AddInt32(&ref.count, int32(len(parts)-1))
+		ch := c.producer.Input()
+		for _, part := range parts {
+			part.ref = ref
+			part.initProducerMessage()
+			ch <- &part.msg
+		}
+	}
+}
+
+// splitMessage splits the message field of the event of an oversized message
+// into parts whose records fit max_message_bytes. Each part is the event with
+// a part of the message, marked with the split.index and split.count headers.
+func (c *client) splitMessage(msg *message) ([]*message, error) {
+	text, ok := msg.data.Content.Fields["message"].(string)
+	if !ok || text == "" {
+		return nil, errors.New("the event has no message to split")
+	}
+
+	limit := c.config.Producer.MaxMessageBytes - splitHeadersSize
+	empty, err := c.encodePart(msg, "")
+	if err != nil {
+		return nil, err
+	}
+	size := limit - empty.byteSize(c.config.Version)
+	if size <= 0 {
+		return nil, errors.New("the event is too large without its message")
+	}
+
+	var parts []*message
+	for rest := text; rest != ""; {
+		end := splitIndex(rest, size)
+		if end == 0 {
+			return nil, errors.New("the event is too large to split its message")
+		}
+		part, err := c.encodePart(msg, rest[:end])
+		if err != nil {
+			return nil, err
+		}
+
+		// the encoding of the message part can be larger than the part, with
+		// escaped characters, retry with a shorter part
+		if over := part.byteSize(c.config.Version) - limit; over > 0 {
+			size = end - over
+			continue
+		}
+		parts = append(parts, part)
+		rest = rest[end:]
+	}
+
+	split := &splitEvent{}
+	count := []byte(strconv.Itoa(len(parts)))
+	for i, part := range parts {
+		part.split = split
+		part.headers = append(part.headers,
+			sarama.RecordHeader{Key: []byte(splitIndexHeader), Value: []byte(strconv.Itoa(i))},
+			sarama.RecordHeader{Key: []byte(splitCountHeader), Value: count},
+		)
+	}
+	return parts, nil
+}
+
+// encodePart returns the message of the event of msg with the message field
+// set to text.
+func (c *client) encodePart(msg *message, text string) (*message, error) {
+	event := msg.data.Content
+	event.Fields = make(common.MapStr, len(msg.data.Content.Fields))
+	for k, v := range msg.data.Content.Fields {
+		event.Fields[k] = v
+	}
+	event.Fields["message"] = text
+
+	serializedEvent, err := c.codec.Encode(c.index, &event)
+	if err != nil {
+		return nil, err
+	}
+	part := &message{
+		topic:     msg.topic,
+		key:       msg.key,
+		ts:        msg.ts,
+		partition: msg.partition,
+		data:      msg.data,
+	}
+	part.value = make([]byte, len(serializedEvent))
+	copy(part.value, serializedEvent)
+	part.headers = append(part.headers, msg.headers...)
+	return part, nil
+}
+
+// splitIndex returns the largest index of s not after n that is the start of
+// a rune.
+func splitIndex(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	if n <= 0 {
+		return 0
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
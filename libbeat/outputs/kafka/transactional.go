@@ -0,0 +1,749 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// transactionalClient publishes each batch in a kafka transaction, together
+// with the consumer offsets of the events read by inputs leaving their offset
+// commits to the output (see kafka.OffsetCommitter). A failed transaction is
+// aborted and the batch is retried until it is committed or the output is
+// closed, so batches and offsets are committed in order. Errors that retrying
+// can not fix are not retried: the events of records rejected by a partition
+// are dropped and the transaction is retried without them, and the batch is
+// dropped when the producer can not write transactions at all.
+//
+// The sarama producers do not support transactions, so the client drives the
+// transaction protocol with the broker requests.
+type transactionalClient struct {
+	*client
+	id      string
+	timeout time.Duration
+	backoff func(retries, maxRetries int) time.Duration
+
+	// the transaction state, owned by Publish
+	txMu          sync.Mutex
+	kafka         sarama.Client
+	coordinator   *sarama.Broker            // the transaction coordinator
+	groups        map[string]*sarama.Broker // the coordinators of the committed groups
+	partitioners  map[string]sarama.Partitioner
+	producerID    int64 // -1 until the producer is initialized
+	producerEpoch int16
+	sequences     map[topicPartition]int32
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// transaction is the content of a batch: its messages and, by group, the
+// offsets to commit.
+type transaction struct {
+	messages []*message
+	offsets  map[string]map[topicPartition]int64
+	size     int
+}
+
+// recordError is a produce error rejecting the records of a partition, they
+// are dropped instead of retried.
+type recordError struct {
+	partition topicPartition
+	messages  []*message
+	err       error
+}
+
+func (e *recordError) Error() string {
+	return fmt.Sprintf("kafka (topic=%v, partition=%v) rejected %v records: %v",
+		e.partition.topic, e.partition.partition, len(e.messages), e.err)
+}
+
+func (e *recordError) Unwrap() error { return e.err }
+
+// recordBatchOverhead is the size of the header of a record batch.
+const recordBatchOverhead = 61
+
+// Retries of the requests failing while the previous transaction completes.
+const (
+	concurrentTransactionsRetries = 10
+	concurrentTransactionsBackoff = 20 * time.Millisecond
+)
+
+var errClientClosed = errors.New("kafka client closed")
+
+func newTransactionalClient(c *client, config *kafkaConfig) *transactionalClient {
+	return &transactionalClient{
+		client:     c,
+		id:         config.TransactionalID,
+		timeout:    config.TransactionTimeout,
+		backoff:    makeBackoffFunc(config.Backoff),
+		producerID: -1,
+	}
+}
+
+func (c *transactionalClient) Connect() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+
+	c.log.Debugf("connect: %v", c.hosts)
+
+	if c.kafka != nil {
+		c.closeKafka()
+	}
+	client, err := sarama.NewClient(c.hosts, &c.config)
+	if err != nil {
+		c.log.Errorf("Kafka connect fails with: %+v", err)
+		return err
+	}
+	c.kafka = client
+	c.partitioners = map[string]sarama.Partitioner{}
+	return nil
+}
+
+func (c *transactionalClient) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.log.Debug("closed kafka client")
+
+	if c.kafka == nil {
+		return nil
+	}
+
+	// stop retrying and wait for the transaction in progress
+	close(c.done)
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+	return c.closeKafka()
+}
+
+func (c *transactionalClient) closeKafka() error {
+	c.reset()
+	err := c.kafka.Close()
+	c.kafka = nil
+	return err
+}
+
+func (c *transactionalClient) Publish(_ context.Context, batch publisher.Batch) error {
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+	if c.kafka == nil {
+		batch.Cancelled()
+		return errClientClosed
+	}
+
+	txn := c.newTransaction(events)
+	for attempt := 0; ; attempt++ {
+		begin := time.Now()
+		err := c.commit(txn)
+		if err == nil {
+			c.observer.Latency(uint64(time.Since(begin).Milliseconds()))
+			c.observer.MessageBytes(txn.size)
+			batch.ACK()
+			c.observer.Acked(len(txn.messages))
+			return nil
+		}
+
+		// the failed transaction is aborted by initializing the producer again
+		c.reset()
+
+		var rejected *recordError
+		if errors.As(err, &rejected) {
+			c.log.Errorw("Kafka transaction failed, dropping the rejected events", "error", err,
+				"transactional_id", c.id)
+			txn.drop(rejected.messages)
+			c.observer.Dropped(len(rejected.messages))
+			continue
+		}
+		if fatalTransactionError(err) {
+			c.log.Errorw("Kafka transaction failed, dropping the batch", "error", err,
+				"transactional_id", c.id)
+			batch.Drop()
+			c.observer.Dropped(len(txn.messages))
+			return err
+		}
+
+		c.log.Errorw("Kafka transaction failed, retrying", "error", err,
+			"transactional_id", c.id, "attempt", attempt+1)
+		select {
+		case <-c.done:
+			batch.Cancelled()
+			c.observer.Failed(len(txn.messages))
+			return err
+		case <-time.After(c.backoff(attempt, 0)):
+		}
+	}
+}
+
+// newTransaction encodes the events of a batch and collects their consumer
+// offsets. The offsets of the dropped events are committed too.
+func (c *transactionalClient) newTransaction(events []publisher.Event) *transaction {
+	txn := &transaction{offsets: map[string]map[topicPartition]int64{}}
+	for i := range events {
+		d := &events[i]
+		if committer, ok := d.Content.Private.(kafka.OffsetCommitter); ok {
+			if offset, ok := committer.ConsumerOffset(); ok {
+				txn.addOffset(offset)
+			}
+		}
+
+		msg, err := c.getEventMessage(d)
+		if err != nil {
+			c.log.Errorf("Dropping event: %+v", err)
+			c.observer.Dropped(1)
+			continue
+		}
+		if size := msg.byteSize(c.config.Version); size > c.config.Producer.MaxMessageBytes {
+			c.log.Errorf("Kafka (topic=%v): dropping too large message of size %v.", msg.topic, size)
+			c.observer.Dropped(1)
+			continue
+		}
+		txn.messages = append(txn.messages, msg)
+		txn.size += d.Content.MessageSize
+	}
+	return txn
+}
+
+// addOffset keeps the highest offset of each partition, the events of a
+// partition being published in order.
+func (txn *transaction) addOffset(offset kafka.ConsumerOffset) {
+	offsets := txn.offsets[offset.GroupID]
+	if offsets == nil {
+		offsets = map[topicPartition]int64{}
+		txn.offsets[offset.GroupID] = offsets
+	}
+	tp := topicPartition{offset.Topic, offset.Partition}
+	if current, ok := offsets[tp]; !ok || offset.Offset > current {
+		offsets[tp] = offset.Offset
+	}
+}
+
+// drop removes the messages rejected by a partition, their offsets are still
+// committed.
+func (txn *transaction) drop(rejected []*message) {
+	dropped := make(map[*message]bool, len(rejected))
+	for _, msg := range rejected {
+		dropped[msg] = true
+	}
+	kept := txn.messages[:0]
+	for _, msg := range txn.messages {
+		if !dropped[msg] {
+			kept = append(kept, msg)
+		}
+	}
+	txn.messages = kept
+}
+
+// commit writes the messages and the offsets of txn in one transaction.
+func (c *transactionalClient) commit(txn *transaction) error {
+	if len(txn.messages) == 0 && len(txn.offsets) == 0 {
+		return nil
+	}
+	if c.producerID < 0 {
+		if err := c.initProducer(); err != nil {
+			return err
+		}
+	}
+
+	records := map[topicPartition][]*message{}
+	for _, msg := range txn.messages {
+		tp, err := c.partition(msg)
+		if err != nil {
+			return err
+		}
+		records[tp] = append(records[tp], msg)
+	}
+	if len(records) > 0 {
+		if err := c.addPartitions(records); err != nil {
+			return err
+		}
+		if err := c.produce(records); err != nil {
+			return err
+		}
+	}
+	for group, offsets := range txn.offsets {
+		if err := c.commitOffsets(group, offsets); err != nil {
+			return err
+		}
+	}
+	return c.endTransaction()
+}
+
+// initProducer gets the producer id and epoch of the transactional id. It
+// aborts the transaction left in progress by an earlier producer, which is
+// fenced.
+func (c *transactionalClient) initProducer() error {
+	coordinator, err := c.findCoordinator(sarama.CoordinatorTransaction, c.id)
+	if err != nil {
+		return err
+	}
+	c.coordinator = coordinator
+
+	resp, err := coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+		TransactionalID:    &c.id,
+		TransactionTimeout: c.timeout,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != sarama.ErrNoError {
+		return resp.Err
+	}
+	c.producerID, c.producerEpoch = resp.ProducerID, resp.ProducerEpoch
+	c.sequences = map[topicPartition]int32{}
+	c.log.Infow("Initialized kafka transactional producer", "transactional_id", c.id,
+		"producer_id", c.producerID, "producer_epoch", c.producerEpoch)
+	return nil
+}
+
+// reset drops the producer after a failure. The next transaction initializes
+// it again, aborting the failed transaction. It is only called once the
+// transaction is known not to be committed, see endTransaction.
+func (c *transactionalClient) reset() {
+	c.producerID = -1
+	if c.coordinator != nil {
+		c.coordinator.Close()
+		c.coordinator = nil
+	}
+	for group, coordinator := range c.groups {
+		coordinator.Close()
+		delete(c.groups, group)
+	}
+}
+
+// findCoordinator asks the brokers for the coordinator of a transactional id
+// or of a consumer group.
+func (c *transactionalClient) findCoordinator(coordinatorType sarama.CoordinatorType, key string) (*sarama.Broker, error) {
+	brokers := c.kafka.Brokers()
+	if len(brokers) == 0 {
+		// the brokers are only known once metadata is fetched
+		if err := c.kafka.RefreshMetadata(); err != nil {
+			return nil, err
+		}
+		brokers = c.kafka.Brokers()
+	}
+
+	err := errors.New("no kafka broker available")
+	for _, broker := range brokers {
+		if err = openBroker(broker, &c.config); err != nil {
+			continue
+		}
+		var resp *sarama.FindCoordinatorResponse
+		resp, err = broker.FindCoordinator(&sarama.FindCoordinatorRequest{
+			Version:         1,
+			CoordinatorKey:  key,
+			CoordinatorType: coordinatorType,
+		})
+		if err != nil {
+			continue
+		}
+		if resp.Err != sarama.ErrNoError {
+			return nil, resp.Err
+		}
+		if err := openBroker(resp.Coordinator, &c.config); err != nil {
+			return nil, err
+		}
+		return resp.Coordinator, nil
+	}
+	return nil, err
+}
+
+func openBroker(broker *sarama.Broker, config *sarama.Config) error {
+	if err := broker.Open(config); err != nil && err != sarama.ErrAlreadyConnected {
+		return err
+	}
+	return nil
+}
+
+// partition selects the partition of a message with the configured
+// partitioner.
+func (c *transactionalClient) partition(msg *message) (topicPartition, error) {
+	partitioner := c.partitioners[msg.topic]
+	if partitioner == nil {
+		partitioner = c.config.Producer.Partitioner(msg.topic)
+		c.partitioners[msg.topic] = partitioner
+	}
+
+	var partitions []int32
+	var err error
+	if partitioner.RequiresConsistency() {
+		partitions, err = c.kafka.Partitions(msg.topic)
+	} else {
+		partitions, err = c.kafka.WritablePartitions(msg.topic)
+	}
+	if err != nil {
+		return topicPartition{}, err
+	}
+	if len(partitions) == 0 {
+		return topicPartition{}, sarama.ErrLeaderNotAvailable
+	}
+
+	msg.initProducerMessage()
+	choice, err := partitioner.Partition(&msg.msg, int32(len(partitions)))
+	if err != nil {
+		return topicPartition{}, err
+	}
+	if choice < 0 || int(choice) >= len(partitions) {
+		return topicPartition{}, sarama.ErrInvalidPartition
+	}
+	return topicPartition{msg.topic, partitions[choice]}, nil
+}
+
+// addPartitions registers the partitions written by the transaction.
+func (c *transactionalClient) addPartitions(records map[topicPartition][]*message) error {
+	req := &sarama.AddPartitionsToTxnRequest{
+		TransactionalID: c.id,
+		ProducerID:      c.producerID,
+		ProducerEpoch:   c.producerEpoch,
+		TopicPartitions: map[string][]int32{},
+	}
+	for tp := range records {
+		req.TopicPartitions[tp.topic] = append(req.TopicPartitions[tp.topic], tp.partition)
+	}
+
+	return retryConcurrentTransactions(func() error {
+		resp, err := c.coordinator.AddPartitionsToTxn(req)
+		if err != nil {
+			return err
+		}
+		// the partitions not rejected fail with ErrOperationNotAttempted
+		err = nil
+		for topic, errs := range resp.Errors {
+			for _, e := range errs {
+				tp := topicPartition{topic, e.Partition}
+				switch {
+				case e.Err == sarama.ErrNoError:
+				case fatalRecordError(e.Err):
+					return &recordError{partition: tp, messages: records[tp], err: e.Err}
+				case err == nil:
+					err = e.Err
+				}
+			}
+		}
+		return err
+	})
+}
+
+// produce sends the records of the transaction to the partition leaders. The
+// records of a partition are split into record batches within
+// max_message_bytes, a request holding one record batch of each partition.
+func (c *transactionalClient) produce(records map[topicPartition][]*message) error {
+	type leaderRequest struct {
+		req        *sarama.ProduceRequest
+		partitions []topicPartition
+	}
+	batches := map[topicPartition][][]*message{}
+	for tp, msgs := range records {
+		batches[tp] = c.splitRecords(msgs)
+	}
+
+	for len(batches) > 0 {
+		requests := map[*sarama.Broker]*leaderRequest{}
+		for tp, pending := range batches {
+			leader, err := c.kafka.Leader(tp.topic, tp.partition)
+			if err != nil {
+				return err
+			}
+			lr := requests[leader]
+			if lr == nil {
+				lr = &leaderRequest{req: c.newProduceRequest()}
+				requests[leader] = lr
+			}
+			lr.req.AddBatch(tp.topic, tp.partition, c.newRecordBatch(tp, pending[0]))
+			lr.partitions = append(lr.partitions, tp)
+		}
+
+		for leader, lr := range requests {
+			resp, err := leader.Produce(lr.req)
+			if err != nil {
+				return err
+			}
+			for _, tp := range lr.partitions {
+				block := resp.GetBlock(tp.topic, tp.partition)
+				if block == nil {
+					return sarama.ErrIncompleteResponse
+				}
+				if fatalRecordError(block.Err) {
+					return &recordError{partition: tp, messages: batches[tp][0], err: block.Err}
+				}
+				if block.Err != sarama.ErrNoError {
+					// the leader may have moved
+					c.kafka.RefreshMetadata(tp.topic)
+					return block.Err
+				}
+				c.sequences[tp] += int32(len(batches[tp][0]))
+				if batches[tp] = batches[tp][1:]; len(batches[tp]) == 0 {
+					delete(batches, tp)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// splitRecords splits the messages of a partition into record batches within
+// max_message_bytes, as the producer does.
+func (c *transactionalClient) splitRecords(msgs []*message) [][]*message {
+	var batches [][]*message
+	start, size := 0, recordBatchOverhead
+	for i, msg := range msgs {
+		n := msg.byteSize(c.config.Version)
+		if i > start && size+n > c.config.Producer.MaxMessageBytes {
+			batches = append(batches, msgs[start:i])
+			start, size = i, recordBatchOverhead
+		}
+		size += n
+	}
+	return append(batches, msgs[start:])
+}
+
+func (c *transactionalClient) newProduceRequest() *sarama.ProduceRequest {
+	req := &sarama.ProduceRequest{
+		TransactionalID: &c.id,
+		RequiredAcks:    c.config.Producer.RequiredAcks,
+		Timeout:         int32(c.config.Producer.Timeout / time.Millisecond),
+		Version:         3,
+	}
+	if c.config.Producer.Compression == sarama.CompressionZSTD && c.config.Version.IsAtLeast(sarama.V2_1_0_0) {
+		req.Version = 7
+	}
+	return req
+}
+
+func (c *transactionalClient) newRecordBatch(tp topicPartition, msgs []*message) *sarama.RecordBatch {
+	first := recordTimestamp(msgs[0])
+	batch := &sarama.RecordBatch{
+		Version:          2,
+		Codec:            c.config.Producer.Compression,
+		CompressionLevel: c.config.Producer.CompressionLevel,
+		ProducerID:       c.producerID,
+		ProducerEpoch:    c.producerEpoch,
+		FirstSequence:    c.sequences[tp],
+		IsTransactional:  true,
+		FirstTimestamp:   first,
+		MaxTimestamp:     first,
+		LastOffsetDelta:  int32(len(msgs) - 1),
+	}
+	for i, msg := range msgs {
+		ts := recordTimestamp(msg)
+		if ts.After(batch.MaxTimestamp) {
+			batch.MaxTimestamp = ts
+		}
+		record := &sarama.Record{
+			OffsetDelta:    int64(i),
+			TimestampDelta: ts.Sub(first),
+			Key:            msg.key,
+			Value:          msg.value,
+		}
+		for j := range msg.headers {
+			record.Headers = append(record.Headers, &msg.headers[j])
+		}
+		batch.Records = append(batch.Records, record)
+	}
+	return batch
+}
+
+func recordTimestamp(msg *message) time.Time {
+	ts := msg.ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return ts.Truncate(time.Millisecond)
+}
+
+// commitOffsets adds the consumer offsets of a group to the transaction.
+func (c *transactionalClient) commitOffsets(group string, offsets map[topicPartition]int64) error {
+	err := retryConcurrentTransactions(func() error {
+		resp, err := c.coordinator.AddOffsetsToTxn(&sarama.AddOffsetsToTxnRequest{
+			TransactionalID: c.id,
+			ProducerID:      c.producerID,
+			ProducerEpoch:   c.producerEpoch,
+			GroupID:         group,
+		})
+		if err != nil {
+			return err
+		}
+		if resp.Err != sarama.ErrNoError {
+			return resp.Err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	coordinator := c.groups[group]
+	if coordinator == nil {
+		if coordinator, err = c.findCoordinator(sarama.CoordinatorGroup, group); err != nil {
+			return err
+		}
+		if c.groups == nil {
+			c.groups = map[string]*sarama.Broker{}
+		}
+		c.groups[group] = coordinator
+	}
+
+	req := &sarama.TxnOffsetCommitRequest{
+		TransactionalID: c.id,
+		GroupID:         group,
+		ProducerID:      c.producerID,
+		ProducerEpoch:   c.producerEpoch,
+		Topics:          map[string][]*sarama.PartitionOffsetMetadata{},
+	}
+	for tp, offset := range offsets {
+		req.Topics[tp.topic] = append(req.Topics[tp.topic], &sarama.PartitionOffsetMetadata{
+			Partition: tp.partition,
+			Offset:    offset,
+		})
+	}
+	resp, err := coordinator.TxnOffsetCommit(req)
+	if err != nil {
+		return err
+	}
+	for _, errs := range resp.Topics {
+		for _, e := range errs {
+			if e.Err != sarama.ErrNoError {
+				return e.Err
+			}
+		}
+	}
+	return nil
+}
+
+// endTransaction commits the transaction. Once the commit is sent only the
+// coordinator knows whether it completed, so while the outcome is unknown the
+// request is repeated with the same producer id and epoch, a commit repeated
+// after it completed succeeds. Initializing the producer again instead would
+// abort a transaction that may already be committed, and the retried batch
+// would be written twice. Other errors are definite: the transaction is not
+// committed.
+func (c *transactionalClient) endTransaction() error {
+	for attempt := 0; ; attempt++ {
+		err := retryConcurrentTransactions(func() error {
+			resp, err := c.coordinator.EndTxn(&sarama.EndTxnRequest{
+				TransactionalID:   c.id,
+				ProducerID:        c.producerID,
+				ProducerEpoch:     c.producerEpoch,
+				TransactionResult: true,
+			})
+			if err != nil {
+				return err
+			}
+			if resp.Err != sarama.ErrNoError {
+				return resp.Err
+			}
+			return nil
+		})
+		if err == nil || !commitOutcomeUnknown(err) {
+			return err
+		}
+
+		c.log.Warnw("Kafka transaction commit outcome unknown, retrying the commit", "error", err,
+			"transactional_id", c.id, "producer_id", c.producerID, "producer_epoch", c.producerEpoch,
+			"attempt", attempt+1)
+		select {
+		case <-c.done:
+			c.log.Errorw("Kafka output closed before the transaction commit completed, the batch may be written twice",
+				"transactional_id", c.id)
+			return errClientClosed
+		case <-time.After(c.backoff(attempt, 0)):
+		}
+
+		// the coordinator may have moved
+		c.coordinator.Close()
+		if coordinator, err := c.findCoordinator(sarama.CoordinatorTransaction, c.id); err == nil {
+			c.coordinator = coordinator
+		}
+	}
+}
+
+// commitOutcomeUnknown reports whether an EndTxn error leaves the outcome of
+// the transaction unknown: the request or its response was lost, or the
+// coordinator moved or is loading its state.
+func commitOutcomeUnknown(err error) bool {
+	kerr, ok := err.(sarama.KError)
+	if !ok {
+		return true // network errors
+	}
+	switch kerr {
+	case sarama.ErrRequestTimedOut,
+		sarama.ErrNotCoordinatorForConsumer,
+		sarama.ErrConsumerCoordinatorNotAvailable,
+		sarama.ErrOffsetsLoadInProgress,
+		sarama.ErrConcurrentTransactions:
+		return true
+	}
+	return false
+}
+
+// fatalRecordError reports whether a partition rejects records for a reason
+// retrying does not fix, the records are then dropped as the producer does.
+func fatalRecordError(err error) bool {
+	switch err {
+	case sarama.ErrInvalidMessage,
+		sarama.ErrInvalidRecord,
+		sarama.ErrMessageSizeTooLarge,
+		sarama.ErrInvalidMessageSize,
+		sarama.ErrMessageSetSizeTooLarge,
+		sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrInvalidTopic:
+		return true
+	}
+	return false
+}
+
+// fatalTransactionError reports whether an error prevents the producer from
+// writing any transaction, so that retrying the batch would never end.
+func fatalTransactionError(err error) bool {
+	switch err {
+	case sarama.ErrTransactionalIDAuthorizationFailed,
+		sarama.ErrGroupAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed,
+		sarama.ErrUnsupportedForMessageFormat,
+		sarama.ErrUnsupportedVersion:
+		return true
+	}
+	return false
+}
+
+// retryConcurrentTransactions retries a request rejected by the coordinator
+// while it completes the previous transaction of the producer.
+func retryConcurrentTransactions(request func() error) error {
+	for i := 0; ; i++ {
+		err := request()
+		if err != sarama.ErrConcurrentTransactions || i == concurrentTransactionsRetries {
+			return err
+		}
+		time.Sleep(concurrentTransactionsBackoff)
+	}
+}
@@ -0,0 +1,329 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package kafka
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/kafka"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+type testOffset kafka.ConsumerOffset
+
+func (o testOffset) ConsumerOffset() (kafka.ConsumerOffset, bool) {
+	return kafka.ConsumerOffset(o), true
+}
+
+func newTransactionalBroker(t *testing.T, handlers map[string]sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	defaults := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("relay", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{
+			Version:     1,
+			Coordinator: sarama.NewBroker(broker.Addr()),
+		}),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+			ProducerID:    7,
+			ProducerEpoch: 1,
+		}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{},
+		}),
+		"ProduceRequest":         sarama.NewMockProduceResponse(t).SetVersion(3),
+		"AddOffsetsToTxnRequest": sarama.NewMockWrapper(&sarama.AddOffsetsToTxnResponse{}),
+		"TxnOffsetCommitRequest": sarama.NewMockWrapper(&sarama.TxnOffsetCommitResponse{
+			Topics: map[string][]*sarama.PartitionError{},
+		}),
+		"EndTxnRequest": sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	}
+	for name, handler := range handlers {
+		defaults[name] = handler
+	}
+	broker.SetHandlerByMap(defaults)
+	return broker
+}
+
+func connectTransactional(t *testing.T, broker *sarama.MockBroker, settings common.MapStr) outputs.NetworkClient {
+	config := common.MapStr{
+		"hosts":            []string{broker.Addr()},
+		"topic":            "relay",
+		"version":          "2.1",
+		"transactional_id": "relay-1",
+		"backoff.init":     "10ms",
+	}
+	config.Update(settings)
+	cfg := common.MustNewConfigFrom(config)
+	group, err := makeKafka(nil, beat.Info{Beat: "libbeat", IndexPrefix: "testbeat"}, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	client := group.Clients[0].(outputs.NetworkClient)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestTransactionalPublish(t *testing.T) {
+	broker := newTransactionalBroker(t, nil)
+	client := connectTransactional(t, broker, nil)
+
+	var events []beat.Event
+	for offset := int64(4); offset < 7; offset++ {
+		events = append(events, beat.Event{
+			Fields:  common.MapStr{"message": "relayed"},
+			Private: testOffset{GroupID: "source", Topic: "logs", Partition: 2, Offset: offset},
+		})
+	}
+	batch := outest.NewBatch(events...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+
+	var requests []string
+	for _, rr := range broker.History() {
+		switch req := rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			requests = append(requests, "init")
+			assert.Equal(t, "relay-1", *req.TransactionalID)
+		case *sarama.AddPartitionsToTxnRequest:
+			requests = append(requests, "add partitions")
+			assert.Equal(t, map[string][]int32{"relay": {0}}, req.TopicPartitions)
+		case *sarama.ProduceRequest:
+			requests = append(requests, "produce")
+			assert.Equal(t, "relay-1", *req.TransactionalID)
+		case *sarama.AddOffsetsToTxnRequest:
+			requests = append(requests, "add offsets")
+			assert.Equal(t, "source", req.GroupID)
+		case *sarama.TxnOffsetCommitRequest:
+			requests = append(requests, "commit offsets")
+			assert.Equal(t, int64(7), req.ProducerID)
+			if assert.Len(t, req.Topics["logs"], 1) {
+				assert.Equal(t, int32(2), req.Topics["logs"][0].Partition)
+				assert.Equal(t, int64(6), req.Topics["logs"][0].Offset)
+			}
+		case *sarama.EndTxnRequest:
+			requests = append(requests, "end")
+			assert.True(t, req.TransactionResult)
+		}
+	}
+	assert.Equal(t, []string{"init", "add partitions", "produce", "add offsets", "commit offsets", "end"}, requests)
+}
+
+func TestTransactionalPublishRetries(t *testing.T) {
+	broker := newTransactionalBroker(t, map[string]sarama.MockResponse{
+		"ProduceRequest": sarama.NewMockSequence(
+			sarama.NewMockProduceResponse(t).SetVersion(3).SetError("relay", 0, sarama.ErrNotLeaderForPartition),
+			sarama.NewMockProduceResponse(t).SetVersion(3),
+		),
+	})
+	client := connectTransactional(t, broker, nil)
+
+	batch := outest.NewBatch(beat.Event{Fields: common.MapStr{"message": "relayed"}})
+	require.NoError(t, client.Publish(context.Background(), batch))
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag, "the batch is retried by the client")
+	}
+
+	inits, ends := 0, 0
+	for _, rr := range broker.History() {
+		switch rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			inits++
+		case *sarama.EndTxnRequest:
+			ends++
+		}
+	}
+	assert.Equal(t, 2, inits, "the failed transaction is aborted by initializing the producer again")
+	assert.Equal(t, 1, ends)
+}
+
+func TestTransactionalPublishSplitsRecordBatches(t *testing.T) {
+	broker := newTransactionalBroker(t, nil)
+	client := connectTransactional(t, broker, common.MapStr{"max_message_bytes": 1000})
+
+	var events []beat.Event
+	for i := 0; i < 6; i++ {
+		events = append(events, beat.Event{Fields: common.MapStr{"message": strings.Repeat("x", 300)}})
+	}
+	batch := outest.NewBatch(events...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+
+	produces := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produces++
+		}
+	}
+	assert.Equal(t, 3, produces, "the records of the partition are sent in record batches of two")
+}
+
+func TestSplitRecords(t *testing.T) {
+	c := &transactionalClient{client: &client{}}
+	c.config.Version = sarama.V2_1_0_0
+	msg := &message{value: make([]byte, 100)}
+	size := msg.byteSize(c.config.Version)
+	c.config.Producer.MaxMessageBytes = recordBatchOverhead + 2*size
+
+	var msgs []*message
+	for i := 0; i < 5; i++ {
+		msgs = append(msgs, msg)
+	}
+	var sizes []int
+	for _, batch := range c.splitRecords(msgs) {
+		sizes = append(sizes, len(batch))
+	}
+	assert.Equal(t, []int{2, 2, 1}, sizes)
+
+	// a record larger than the limit is sent alone
+	c.config.Producer.MaxMessageBytes = size
+	assert.Len(t, c.splitRecords(msgs[:2]), 2)
+}
+
+func TestTransactionalPublishDropsRejectedRecords(t *testing.T) {
+	broker := newTransactionalBroker(t, map[string]sarama.MockResponse{
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3).SetError("relay", 0, sarama.ErrInvalidRecord),
+	})
+	client := connectTransactional(t, broker, nil)
+
+	batch := outest.NewBatch(beat.Event{
+		Fields:  common.MapStr{"message": "relayed"},
+		Private: testOffset{GroupID: "source", Topic: "logs", Partition: 2, Offset: 4},
+	})
+	require.NoError(t, client.Publish(context.Background(), batch))
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+
+	var requests []string
+	for _, rr := range broker.History() {
+		switch rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			requests = append(requests, "init")
+		case *sarama.ProduceRequest:
+			requests = append(requests, "produce")
+		case *sarama.TxnOffsetCommitRequest:
+			requests = append(requests, "commit offsets")
+		case *sarama.EndTxnRequest:
+			requests = append(requests, "end")
+		}
+	}
+	assert.Equal(t, []string{"init", "produce", "init", "commit offsets", "end"}, requests,
+		"the rejected records are dropped and their offsets committed without retrying")
+}
+
+func TestTransactionalPublishFatalError(t *testing.T) {
+	broker := newTransactionalBroker(t, map[string]sarama.MockResponse{
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+			Err: sarama.ErrTransactionalIDAuthorizationFailed,
+		}),
+	})
+	client := connectTransactional(t, broker, nil)
+
+	batch := outest.NewBatch(beat.Event{Fields: common.MapStr{"message": "relayed"}})
+	assert.Equal(t, sarama.ErrTransactionalIDAuthorizationFailed, client.Publish(context.Background(), batch))
+	if assert.Len(t, batch.Signals, 1) {
+		assert.Equal(t, outest.BatchDrop, batch.Signals[0].Tag, "the batch is not retried")
+	}
+}
+
+func TestTransactionalCommitOutcome(t *testing.T) {
+	for name, test := range map[string]struct {
+		endErr sarama.KError
+		inits  int
+	}{
+		"unknown outcome is retried with the same producer":  {sarama.ErrConsumerCoordinatorNotAvailable, 1},
+		"aborted transaction is retried with a new producer": {sarama.ErrInvalidTxnState, 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker := newTransactionalBroker(t, map[string]sarama.MockResponse{
+				"EndTxnRequest": sarama.NewMockSequence(
+					&sarama.EndTxnResponse{Err: test.endErr},
+					&sarama.EndTxnResponse{},
+				),
+			})
+			client := connectTransactional(t, broker, nil)
+
+			batch := outest.NewBatch(beat.Event{Fields: common.MapStr{"message": "relayed"}})
+			require.NoError(t, client.Publish(context.Background(), batch))
+			if assert.Len(t, batch.Signals, 1) {
+				assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+			}
+
+			inits, produces, ends := 0, 0, 0
+			for _, rr := range broker.History() {
+				switch req := rr.Request.(type) {
+				case *sarama.InitProducerIDRequest:
+					inits++
+				case *sarama.ProduceRequest:
+					produces++
+				case *sarama.EndTxnRequest:
+					ends++
+					assert.Equal(t, int64(7), req.ProducerID)
+					assert.Equal(t, int16(1), req.ProducerEpoch)
+				}
+			}
+			assert.Equal(t, test.inits, inits)
+			assert.Equal(t, test.inits, produces, "the records are only produced again after an abort")
+			assert.Equal(t, 2, ends)
+		})
+	}
+}
+
+func TestTransactionalConfig(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings common.MapStr
+		valid    bool
+	}{
+		"defaults":    {common.MapStr{"transactional_id": "relay"}, true},
+		"old version": {common.MapStr{"transactional_id": "relay", "version": "0.10"}, false},
+		"leader acks": {common.MapStr{"transactional_id": "relay", "required_acks": 1}, false},
+		"all acks":    {common.MapStr{"transactional_id": "relay", "required_acks": -1}, true},
+		"no timeout":  {common.MapStr{"transactional_id": "relay", "transaction_timeout": 0}, false},
+		"not enabled": {common.MapStr{"required_acks": 1}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			settings := common.MapStr{"hosts": "localhost:9092"}
+			settings.Update(test.settings)
+			_, err := readConfig(common.MustNewConfigFrom(settings))
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -42,6 +42,15 @@ type IndexManager interface {
 	BuildSelector(cfg *common.Config) (IndexSelector, error)
 }
 
+// DataStreamIndexManager is implemented by index managers writing events to
+// data streams, which only accept the create operation.
+type DataStreamIndexManager interface {
+	IndexManager
+
+	// DataStreams returns true if events are written to data streams.
+	DataStreams() bool
+}
+
 // IndexSelector is used to find the index name an event shall be indexed to.
 type IndexSelector interface {
 	Select(event *beat.Event) (string, error)
@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dispatch
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+type config struct {
+	Field    string                    `config:"field"`                      // field holding the route name
+	Routes   map[string]*common.Config `config:"routes" validate:"required"` // route name to processor list
+	Fallback fallbackMode              `config:"fallback"`                   // what to do with unrouted events
+	Tag      string                    `config:"tag"`                        // tag added by the tag fallback
+}
+
+func defaultConfig() config {
+	return config{
+		Field:    processors.FieldProcessor,
+		Fallback: fallbackPass,
+		Tag:      "dispatch_unrouted",
+	}
+}
+
+type fallbackMode uint8
+
+// List of fallback modes.
+const (
+	fallbackPass fallbackMode = iota
+	fallbackDrop
+	fallbackTag
+)
+
+var fallbackModeNames = map[fallbackMode]string{
+	fallbackPass: "pass",
+	fallbackDrop: "drop",
+	fallbackTag:  "tag",
+}
+
+func (m fallbackMode) String() string {
+	return fallbackModeNames[m]
+}
+
+func (m fallbackMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *fallbackMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range fallbackModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid fallback: %v", s)
+}
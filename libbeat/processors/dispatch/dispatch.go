@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dispatch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const (
+	procName = "dispatch"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+}
+
+type route struct {
+	processors *processors.Processors
+	events     *monitoring.Int
+}
+
+type dispatch struct {
+	config config
+	logger *logp.Logger
+	routes map[string]*route
+
+	unrouted *monitoring.Int
+}
+
+// New constructs a new dispatch processor. Each event is looked up once by its
+// route field and handed to the processors of the matching route only.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrapf(err, "failed to unpack %v processor configuration", procName)
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &dispatch{
+		config:   config,
+		logger:   log,
+		routes:   make(map[string]*route, len(config.Routes)),
+		unrouted: monitoring.NewInt(reg, "unrouted"),
+	}
+
+	routesReg := reg.NewRegistry("routes")
+	for name, routeCfg := range config.Routes {
+		procs, err := newProcessors(routeCfg)
+		if err != nil {
+			p.Close()
+			return nil, errors.Wrapf(err, "failed to make processors of route %v", name)
+		}
+		p.routes[name] = &route{
+			processors: procs,
+			events:     monitoring.NewInt(routesReg.NewRegistry(name), "events"),
+		}
+	}
+
+	return p, nil
+}
+
+func newProcessors(c *common.Config) (*processors.Processors, error) {
+	if !c.IsArray() {
+		return processors.New([]*common.Config{c})
+	}
+
+	var pc processors.PluginConfig
+	if err := c.Unpack(&pc); err != nil {
+		return nil, err
+	}
+	return processors.New(pc)
+}
+
+// Run hands the event to the processors of its route.
+func (p *dispatch) Run(event *beat.Event) (*beat.Event, error) {
+	var r *route
+	if value, err := event.GetValue(p.config.Field); err == nil {
+		if name, ok := value.(string); ok {
+			r = p.routes[name]
+		}
+	}
+
+	if r == nil {
+		p.unrouted.Inc()
+		switch p.config.Fallback {
+		case fallbackDrop:
+			return nil, nil
+		case fallbackTag:
+			if err := common.AddTags(event.Fields, []string{p.config.Tag}); err != nil {
+				return event, err
+			}
+		}
+		return event, nil
+	}
+
+	r.events.Inc()
+	return r.processors.Run(event)
+}
+
+// Close closes the processors of all routes.
+func (p *dispatch) Close() error {
+	var errs []string
+	for name, r := range p.routes {
+		if err := r.processors.Close(); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close %v routes: %v", procName, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *dispatch) String() string {
+	names := make([]string, 0, len(p.routes))
+	for name, r := range p.routes {
+		names = append(names, name+"="+r.processors.String())
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%v=[field=%v, routes=[%v], fallback=%v]",
+		procName, p.config.Field, strings.Join(names, ", "), p.config.Fallback)
+}
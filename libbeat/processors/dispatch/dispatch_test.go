@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dispatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	_ "github.com/elastic/beats/v7/libbeat/processors/actions"
+)
+
+func TestDispatch(t *testing.T) {
+	config := common.MustNewConfigFrom(`
+routes:
+  parse_serverlog:
+    - add_fields: {target: "", fields: {route: serverlog}}
+  parse_cdc_alog:
+    add_fields: {target: "", fields: {route: cdc_alog}}
+`)
+	p, err := New(config)
+	require.NoError(t, err)
+	d := p.(*dispatch)
+
+	for handler, expected := range map[string]string{
+		"parse_serverlog": "serverlog",
+		"parse_cdc_alog":  "cdc_alog",
+	} {
+		event, err := p.Run(newEvent(handler))
+		require.NoError(t, err)
+		assert.Equal(t, expected, event.Fields["route"])
+	}
+	assert.Equal(t, int64(1), d.routes["parse_serverlog"].events.Get())
+	assert.Equal(t, int64(1), d.routes["parse_cdc_alog"].events.Get())
+	assert.Equal(t, int64(0), d.unrouted.Get())
+}
+
+func TestDispatchFallback(t *testing.T) {
+	cases := map[string]struct {
+		config common.MapStr
+		check  func(t *testing.T, event *beat.Event)
+	}{
+		"pass": {
+			config: common.MapStr{},
+			check: func(t *testing.T, event *beat.Event) {
+				require.NotNil(t, event)
+				assert.NotContains(t, event.Fields, "route")
+				assert.NotContains(t, event.Fields, "tags")
+			},
+		},
+		"drop": {
+			config: common.MapStr{"fallback": "drop"},
+			check: func(t *testing.T, event *beat.Event) {
+				assert.Nil(t, event)
+			},
+		},
+		"tag": {
+			config: common.MapStr{"fallback": "tag", "tag": "no_handler"},
+			check: func(t *testing.T, event *beat.Event) {
+				require.NotNil(t, event)
+				assert.Equal(t, []string{"no_handler"}, event.Fields["tags"])
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := common.MapStr{
+				"routes": common.MapStr{
+					"parse_serverlog": []common.MapStr{
+						{"add_fields": common.MapStr{"target": "", "fields": common.MapStr{"route": "serverlog"}}},
+					},
+				},
+			}
+			config.Update(test.config)
+			p, err := New(common.MustNewConfigFrom(config))
+			require.NoError(t, err)
+
+			// unknown handler
+			event, err := p.Run(newEvent("parse_unknown"))
+			require.NoError(t, err)
+			test.check(t, event)
+
+			// missing handler
+			event, err = p.Run(&beat.Event{Fields: common.MapStr{"message": "line"}})
+			require.NoError(t, err)
+			test.check(t, event)
+
+			assert.Equal(t, int64(2), p.(*dispatch).unrouted.Get())
+		})
+	}
+}
+
+func TestDispatchField(t *testing.T) {
+	config := common.MustNewConfigFrom(common.MapStr{
+		"field": "service",
+		"routes": common.MapStr{
+			"gateway": []common.MapStr{{"drop_event": nil}},
+		},
+	})
+	p, err := New(config)
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{"service": "gateway"}})
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for name, config := range map[string]common.MapStr{
+		"no routes":         {},
+		"unknown fallback":  {"routes": common.MapStr{"a": []common.MapStr{{"drop_event": nil}}}, "fallback": "retry"},
+		"unknown processor": {"routes": common.MapStr{"a": []common.MapStr{{"unknown": nil}}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func newEvent(handler string) *beat.Event {
+	return &beat.Event{Fields: common.MapStr{
+		"message": "line",
+		"fields":  common.MapStr{"handler": handler},
+	}}
+}
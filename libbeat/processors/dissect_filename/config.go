@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dissect_filename
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+type config struct {
+	Field         string       `config:"field"`          // field holding the file name
+	Separator     string       `config:"separator"`      // segment separator
+	Segments      []Segment    `config:"segments"`       // segment layout, vehicle uploads by default
+	Target        string       `config:"target"`         // namespace of the segments, root when empty
+	IgnoreMissing bool         `config:"ignore_missing"` // pass events without field
+	Remove        bool         `config:"remove"`         // remove field after dissecting it
+	OnMismatch    mismatchMode `config:"on_mismatch"`    // what to do with file names not matching the segments
+	Routing       string       `config:"routing"`        // segment set as @metadata.routing of the event
+}
+
+func defaultConfig() config {
+	return config{
+		Field:      processors.LogFilename,
+		Separator:  "@",
+		Target:     "upload",
+		OnMismatch: mismatchError,
+	}
+}
+
+type mismatchMode uint8
+
+// List of modes for file names not matching the segments.
+const (
+	mismatchError mismatchMode = iota
+	mismatchDrop
+	mismatchFail
+)
+
+var mismatchModeNames = map[mismatchMode]string{
+	mismatchError: "error",
+	mismatchDrop:  "drop",
+	mismatchFail:  "fail",
+}
+
+func (m mismatchMode) String() string {
+	return mismatchModeNames[m]
+}
+
+func (m mismatchMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *mismatchMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range mismatchModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid on_mismatch: %v", s)
+}
@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dissect_filename
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const (
+	procName = "dissect_filename"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+}
+
+type dissectFilename struct {
+	config config
+	logger *logp.Logger
+	schema *Schema
+
+	mismatch *monitoring.Int
+}
+
+// New constructs a new dissect_filename processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrapf(err, "failed to unpack %v processor configuration", procName)
+	}
+	if !cfg.HasField("segments") {
+		config.Segments = VehicleUploadSegments()
+	}
+
+	schema, err := NewSchema(config.Separator, config.Segments)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %v segments", procName)
+	}
+	if config.Routing != "" && !hasSegment(config.Segments, config.Routing) {
+		return nil, errors.Errorf("%v routing %q is not a segment", procName, config.Routing)
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	return &dissectFilename{
+		config:   config,
+		logger:   log,
+		schema:   schema,
+		mismatch: monitoring.NewInt(reg, "mismatch"),
+	}, nil
+}
+
+// Run splits the file name of the event into its segments.
+func (p *dissectFilename) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+			return event, nil
+		}
+		return event, errors.Wrapf(err, "failed to find field [%v] in event", p.config.Field)
+	}
+	name, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field [%v] is %T, expected string", p.config.Field, v)
+	}
+
+	fields, err := p.schema.Dissect(name)
+	if err != nil {
+		p.mismatch.Inc()
+		switch p.config.OnMismatch {
+		case mismatchDrop:
+			return nil, nil
+		case mismatchFail:
+			return event, err
+		default:
+			event.SetErrorWithOption(common.MapStr{
+				"message": err.Error(),
+				"field":   p.config.Field,
+			}, true)
+			return event, nil
+		}
+	}
+
+	for k, v := range fields {
+		key := k
+		if p.config.Target != "" {
+			key = p.config.Target + "." + k
+		}
+		if _, err := event.PutValue(key, v); err != nil {
+			return event, errors.Wrapf(err, "failed to write segment %v", k)
+		}
+	}
+	if p.config.Routing != "" {
+		if v, ok := fields[p.config.Routing]; ok {
+			if err := processors.SetRouting(event, v); err != nil {
+				return event, err
+			}
+		}
+	}
+	if p.config.Remove {
+		_ = event.Delete(p.config.Field)
+	}
+	return event, nil
+}
+
+func hasSegment(segments []Segment, name string) bool {
+	for _, seg := range segments {
+		if seg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *dissectFilename) String() string {
+	return fmt.Sprintf("%v=[field=%v, separator=%v, segments=%d, target=%v]",
+		procName, p.config.Field, p.config.Separator, len(p.config.Segments), p.config.Target)
+}
@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dissect_filename
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const uploadName = "/data/log/main.log@cdc@LJ1E6A2U0N7700010@alog@1695007978511@1695008000000"
+
+func TestDissectVehicleUpload(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"remove": true}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{"file": uploadName}})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"upload": common.MapStr{
+			"filename":    "main",
+			"ecu":         "cdc",
+			"vid":         "LJ1E6A2U0N7700010",
+			"log_type":    "alog",
+			"modified_at": time.Date(2023, 9, 18, 3, 32, 58, int(511*time.Millisecond), time.UTC),
+			"uploaded_at": time.Date(2023, 9, 18, 3, 33, 20, 0, time.UTC),
+		},
+	}, event.Fields)
+}
+
+func TestDissectCustomSegments(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"field":     "log.file.path",
+		"separator": "_",
+		"target":    "",
+		"segments": []common.MapStr{
+			{"name": "service", "base": true},
+			{"name": "shard", "type": "long"},
+			{"name": "suffix", "optional": true, "trim_extension": true},
+		},
+	}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{
+		"log": common.MapStr{"file": common.MapStr{"path": "/var/log/gateway_3"}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "gateway", event.Fields["service"])
+	assert.Equal(t, int64(3), event.Fields["shard"])
+	assert.Equal(t, nil, event.Fields["suffix"])
+
+	event, err = p.Run(&beat.Event{Fields: common.MapStr{
+		"log": common.MapStr{"file": common.MapStr{"path": "/var/log/gateway_3_gc.log"}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "gc", event.Fields["suffix"])
+}
+
+func TestMismatch(t *testing.T) {
+	const short = "main.log@cdc@LJ1E6A2U0N7700010"
+
+	tests := map[string]struct {
+		mode    string
+		dropped bool
+		fails   bool
+	}{
+		"error": {mode: "error"},
+		"drop":  {mode: "drop", dropped: true},
+		"fail":  {mode: "fail", fails: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(common.MustNewConfigFrom(common.MapStr{"on_mismatch": test.mode}))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: common.MapStr{"file": short}})
+			assert.Equal(t, int64(1), p.(*dissectFilename).mismatch.Get())
+			if test.dropped {
+				assert.NoError(t, err)
+				assert.Nil(t, event)
+				return
+			}
+			if test.fails {
+				var countErr *SegmentCountError
+				assert.ErrorAs(t, err, &countErr)
+				return
+			}
+			require.NoError(t, err)
+			msg, err := event.GetValue("error.message")
+			require.NoError(t, err)
+			assert.Equal(t, `file name "main.log@cdc@LJ1E6A2U0N7700010" has 3 segments separated by "@", expected 6`, msg)
+			assert.NotContains(t, event.Fields, "upload")
+		})
+	}
+}
+
+func TestInvalidEpochMillis(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"on_mismatch": "fail"}))
+	require.NoError(t, err)
+
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{"file": "main.log@cdc@vid@alog@yesterday@1695008000000"}})
+	assert.EqualError(t, err, `segment modified_at of "main.log@cdc@vid@alog@yesterday@1695008000000": invalid epoch millis "yesterday"`)
+}
+
+func TestMissingField(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"ignore_missing": true}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "line"}})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"message": "line"}, event.Fields)
+
+	p, err = New(common.NewConfig())
+	require.NoError(t, err)
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{"message": "line"}})
+	assert.Error(t, err)
+}
+
+func TestRouting(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"routing": "vid"}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{"file": uploadName}})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{"routing": "LJ1E6A2U0N7700010"}, event.Meta)
+
+	_, err = New(common.MustNewConfigFrom(common.MapStr{"routing": "vin"}))
+	assert.Error(t, err)
+}
+
+func TestInvalidSchema(t *testing.T) {
+	for name, segments := range map[string][]common.MapStr{
+		"duplicate":         {{"name": "a"}, {"name": "a"}},
+		"optional in front": {{"name": "a", "optional": true}, {"name": "b"}},
+		"unknown type":      {{"name": "a", "type": "uuid"}},
+		"empty":             {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(common.MapStr{"segments": segments}))
+			assert.Error(t, err)
+		})
+	}
+}
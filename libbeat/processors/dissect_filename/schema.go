@@ -0,0 +1,209 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package dissect_filename
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Segment describes one separator delimited part of a file name.
+type Segment struct {
+	Name          string      `config:"name" validate:"required"`
+	Type          segmentType `config:"type"`           // string, long or epoch_millis
+	Optional      bool        `config:"optional"`       // may be missing, only allowed for trailing segments
+	Base          bool        `config:"base"`           // strip the directory
+	TrimExtension bool        `config:"trim_extension"` // strip the extension
+}
+
+// VehicleUploadSegments is the layout of log files uploaded by vehicles:
+// filename@ecu@vid@log_type@modified_at@uploaded_at, both times in epoch
+// milliseconds.
+func VehicleUploadSegments() []Segment {
+	return []Segment{
+		{Name: "filename", Base: true, TrimExtension: true},
+		{Name: "ecu"},
+		{Name: "vid"},
+		{Name: "log_type"},
+		{Name: "modified_at", Type: TypeEpochMillis},
+		{Name: "uploaded_at", Type: TypeEpochMillis},
+	}
+}
+
+// Schema splits file names into named segments.
+type Schema struct {
+	separator string
+	segments  []Segment
+	required  int
+}
+
+// NewSchema validates the segments and returns a Schema splitting on
+// separator.
+func NewSchema(separator string, segments []Segment) (*Schema, error) {
+	if separator == "" {
+		return nil, errors.New("separator must not be empty")
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("at least one segment is required")
+	}
+
+	s := &Schema{separator: separator, segments: segments}
+	names := make(map[string]bool, len(segments))
+	for i, seg := range segments {
+		if names[seg.Name] {
+			return nil, fmt.Errorf("duplicate segment %v", seg.Name)
+		}
+		names[seg.Name] = true
+		if seg.Optional {
+			continue
+		}
+		if s.required != i {
+			return nil, fmt.Errorf("segment %v must be optional, it follows an optional segment", seg.Name)
+		}
+		s.required++
+	}
+	return s, nil
+}
+
+// MustNewSchema is like NewSchema but panics on invalid segments.
+func MustNewSchema(separator string, segments []Segment) *Schema {
+	s, err := NewSchema(separator, segments)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Dissect splits name and converts every segment to its type. Missing
+// optional segments are left out of the result.
+func (s *Schema) Dissect(name string) (common.MapStr, error) {
+	fields := make(common.MapStr, len(s.segments))
+	if err := s.DissectInto(fields, "", name); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// DissectInto is like Dissect but writes the segments straight to fields,
+// prefixing their names with prefix. Nothing is written on error.
+func (s *Schema) DissectInto(fields common.MapStr, prefix, name string) error {
+	items := strings.Split(name, s.separator)
+	if len(items) < s.required || len(items) > len(s.segments) {
+		return &SegmentCountError{
+			Name:      name,
+			Separator: s.separator,
+			Got:       len(items),
+			Min:       s.required,
+			Max:       len(s.segments),
+		}
+	}
+
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		seg := &s.segments[i]
+		if seg.Base {
+			item = path.Base(item)
+		}
+		if seg.TrimExtension {
+			item = strings.TrimSuffix(item, path.Ext(item))
+		}
+		v, err := seg.Type.convert(item)
+		if err != nil {
+			return errors.Wrapf(err, "segment %v of %q", seg.Name, name)
+		}
+		values[i] = v
+	}
+	for i, v := range values {
+		fields[prefix+s.segments[i].Name] = v
+	}
+	return nil
+}
+
+// SegmentCountError is returned by Dissect when a file name does not have
+// the number of segments of the schema.
+type SegmentCountError struct {
+	Name      string
+	Separator string
+	Got       int
+	Min, Max  int
+}
+
+func (e *SegmentCountError) Error() string {
+	if e.Min == e.Max {
+		return fmt.Sprintf("file name %q has %d segments separated by %q, expected %d",
+			e.Name, e.Got, e.Separator, e.Min)
+	}
+	return fmt.Sprintf("file name %q has %d segments separated by %q, expected %d to %d",
+		e.Name, e.Got, e.Separator, e.Min, e.Max)
+}
+
+type segmentType uint8
+
+// List of segment types.
+const (
+	TypeString segmentType = iota
+	TypeLong
+	TypeEpochMillis
+)
+
+var segmentTypeNames = map[segmentType]string{
+	TypeString:      "string",
+	TypeLong:        "long",
+	TypeEpochMillis: "epoch_millis",
+}
+
+func (t segmentType) String() string {
+	return segmentTypeNames[t]
+}
+
+func (t segmentType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *segmentType) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for typ, name := range segmentTypeNames {
+		if s == name {
+			*t = typ
+			return nil
+		}
+	}
+	return errors.Errorf("invalid segment type: %v", s)
+}
+
+func (t segmentType) convert(s string) (interface{}, error) {
+	switch t {
+	case TypeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case TypeEpochMillis:
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid epoch millis %q", s)
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	default:
+		return s, nil
+	}
+}
@@ -18,18 +18,31 @@
 package parse_cdc_alog
 
 import (
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
 )
 
-// Config for parse_parse_vehicle_trace2trace processor.
+// Config for parse_cdc_alog processor.
 type Config struct {
-	Field         string            `config:"field"`                         // log message field
-	IgnoreMissing bool              `config:"ignore_missing"`                // Skip field when From field is missing.
-	TimeField     string            `config:"time_field"`                    // specified the time field
-	Timezone      *cfgtype.Timezone `config:"timezone"`                      // specify timezone
-	AllowOld      string            `config:"allow_old" validate:"required"` // allow old data, duration in golang
+	Field          string                       `config:"field"`                         // log message field
+	IgnoreMissing  bool                         `config:"ignore_missing"`                // Skip field when From field is missing.
+	TimeField      string                       `config:"time_field"`                    // specified the time field
+	Timezone       *cfgtype.Timezone            `config:"timezone"`                      // specify timezone
+	Timezones      map[string]*cfgtype.Timezone `config:"timezones"`                     // timezone per ecu, overrides timezone
+	AllowOld       string                       `config:"allow_old" validate:"required"` // allow old data, duration in golang
+	YearInference  yearInference                `config:"year_inference"`                // how the missing year of logcat is inferred
+	DetectRollover bool                         `config:"detect_rollover"`               // follow the year across consecutive lines of a file
+	MaxFiles       int                          `config:"max_files" validate:"min=1"`    // files tracked for rollover detection
+	OnTooOld       tooOldMode                   `config:"on_too_old"`                    // what to do with lines outside allow_old
+	TooOldTag      string                       `config:"too_old_tag"`                   // tag added by on_too_old: tag
+	Format         util.LogcatFormat            `config:"format"`                        // logcat output format, auto detected by default
+	Rules          []ruleConfig                 `config:"rules"`                         // business fields derived from the line
+	RoutingByVid   bool                         `config:"routing_by_vid"`                // route the events by the vid of the file name
 
 	// cache field
 	AllowOldDuration time.Duration
@@ -37,10 +50,90 @@ type Config struct {
 
 func defaultConfig() Config {
 	return Config{
-		Field:         "message",
-		TimeField:     "@timestamp",
-		IgnoreMissing: false,
-		Timezone:      cfgtype.MustNewTimezone("Asia/Shanghai"),
-		AllowOld:      "24h",
+		Field:          "message",
+		TimeField:      "@timestamp",
+		IgnoreMissing:  false,
+		Timezone:       cfgtype.MustNewTimezone("Asia/Shanghai"),
+		AllowOld:       "24h",
+		YearInference:  yearNearest,
+		DetectRollover: true,
+		MaxFiles:       10000,
+		OnTooOld:       tooOldTag,
+		TooOldTag:      "alog_too_old",
+		Format:         util.LogcatAuto,
+	}
+}
+
+// location returns the timezone of the logs of the given ecu.
+func (c *Config) location(ecu string) *time.Location {
+	if tz, ok := c.Timezones[ecu]; ok && tz != nil {
+		return tz.Location()
+	}
+	return c.Timezone.Location()
+}
+
+type yearInference uint8
+
+// List of year inference modes.
+const (
+	// yearNearest picks the year putting the log time nearest to the file's modified time
+	yearNearest yearInference = iota
+	// yearModified uses the year of the file's modified time
+	yearModified
+)
+
+var yearInferenceNames = map[yearInference]string{
+	yearNearest:  "nearest",
+	yearModified: "modified",
+}
+
+func (y yearInference) String() string {
+	return yearInferenceNames[y]
+}
+
+func (y yearInference) MarshalText() ([]byte, error) {
+	return []byte(y.String()), nil
+}
+
+func (y *yearInference) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for mode, name := range yearInferenceNames {
+		if s == name {
+			*y = mode
+			return nil
+		}
+	}
+	return errors.Errorf("invalid year_inference: %v", s)
+}
+
+type tooOldMode uint8
+
+// List of modes for lines outside allow_old.
+const (
+	tooOldTag tooOldMode = iota
+	tooOldDrop
+)
+
+var tooOldModeNames = map[tooOldMode]string{
+	tooOldTag:  "tag",
+	tooOldDrop: "drop",
+}
+
+func (m tooOldMode) String() string {
+	return tooOldModeNames[m]
+}
+
+func (m tooOldMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *tooOldMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for mode, name := range tooOldModeNames {
+		if s == name {
+			*m = mode
+			return nil
+		}
 	}
+	return errors.Errorf("invalid on_too_old: %v", s)
 }
@@ -27,8 +27,12 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/dissect_filename"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
 )
 
 const (
@@ -36,19 +40,34 @@ const (
 	logName  = "processor." + procName
 )
 
-const (
-	UsbMounted   = "UsbDeviceService:     state=MOUNTED"
-	UsbUnmounted = "UsbDeviceService:     state=EJECTING"
-)
-
 func init() {
 	processors.RegisterPlugin(procName, New)
 	// jsprocessor.RegisterPlugin(strings.Title(procName), New)
 }
 
+// fileSchema is the layout of uploaded alog file names, the times are kept
+// as the raw epoch millis.
+var fileSchema = dissect_filename.MustNewSchema("@", []dissect_filename.Segment{
+	{Name: "filename", TrimExtension: true},
+	{Name: "ecu"},
+	{Name: "vid"},
+	{Name: "log_type"},
+	{Name: "modified_at"},
+	{Name: "uploaded_at"},
+})
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
 type parseServerlog struct {
 	config Config
 	logger *logp.Logger
+	years  *util.FileYears
+	rules  []rule
+
+	tooOld      *monitoring.Int
+	malformed   *monitoring.Int
+	badFilename *monitoring.Int
 }
 
 // New constructs a new parse_serverlog processor.
@@ -64,9 +83,26 @@ func New(cfg *common.Config) (processors.Processor, error) {
 	}
 	config.AllowOldDuration = duration
 
+	rules, err := newRules(config.Rules)
+	if err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
 	p := &parseServerlog{
 		config: config,
-		logger: logp.NewLogger(logName),
+		logger: log,
+		years:  util.NewFileYears(config.MaxFiles),
+		rules:  rules,
+
+		tooOld:      monitoring.NewInt(reg, "too_old"),
+		malformed:   monitoring.NewInt(reg, "malformed"),
+		badFilename: monitoring.NewInt(reg, "bad_filename"),
 	}
 
 	return p, nil
@@ -76,10 +112,7 @@ func New(cfg *common.Config) (processors.Processor, error) {
 func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 	// event filter
 	processor, err := event.GetValue(processors.FieldProcessor)
-	if err != nil {
-		return nil, err
-	}
-	if processor != procName {
+	if err != nil || processor != procName {
 		return event, nil
 	}
 
@@ -100,16 +133,13 @@ func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 		return nil, makeErrMissingField(p.config.Field, err)
 	}
 
-	const dateLayout = "01-02 15:04:05.999999"
 	msg := message.(string)
-	if len(msg) <= len(dateLayout) {
+	line, ok := util.ParseLogcat(msg, p.config.Format)
+	if !ok {
+		// Drop event<malformed log>
+		p.malformed.Inc()
 		return nil, nil
 	}
-	// 日志时间
-	logtime, err := time.ParseInLocation(dateLayout, msg[:len(dateLayout)], time.Local)
-	if err != nil {
-		return nil, makeErrCompute(errors.New("invalid log time: " + msg[:len(dateLayout)]))
-	}
 
 	// 解析文件名称中的信息
 	path, err := event.GetValue(processors.LogFilename)
@@ -118,46 +148,96 @@ func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 	}
 
 	/* parse */
-	items := strings.Split(path.(string), "@")
-	if len(items) < 6 {
+	if err := fileSchema.DissectInto(event.Fields, "", path.(string)); err != nil {
+		// Drop event<unexpected file name>
+		p.badFilename.Inc()
+		p.logger.Debugw("Dropping line of unexpected file", "error", err)
 		return nil, nil
 	}
-	event.Fields["filename"] = items[0][:strings.LastIndex(items[0], ".")]
-	event.Fields["ecu"] = items[1]
-	event.Fields["vid"] = items[2]
-	event.Fields["log_type"] = items[3]
-	event.Fields["modified_at"] = items[4]
-	event.Fields["uploaded_at"] = items[5]
+	ecu, modifiedAt := event.Fields["ecu"].(string), event.Fields["modified_at"].(string)
+	if p.config.RoutingByVid {
+		if err := processors.SetRouting(event, event.Fields["vid"]); err != nil {
+			return nil, err
+		}
+	}
 
 	// 移除file信息
 	delete(event.Fields, processors.LogFilename)
 
-	// 解析日期
-	lastModifiedAt, err := strconv.Atoi(items[4])
+	logtime, hasTime, err := p.logtime(line, path.(string), ecu, modifiedAt)
 	if err != nil {
-		return nil, makeErrCompute(errors.New("invalid file modify time"))
+		return nil, err
 	}
-	mt := time.UnixMilli(int64(lastModifiedAt)).In(time.Local)
-	logtime = logtime.AddDate(mt.Year(), 0, 0)
-	if time.Now().Sub(logtime) > p.config.AllowOldDuration || logtime.Sub(time.Now()) > p.config.AllowOldDuration {
-		// 过滤日期差异很大的数据
-		return nil, nil
+	if hasTime {
+		_, err = event.PutValue(p.config.TimeField, logtime)
+		if err != nil {
+			return nil, makeErrCompute(err)
+		}
+
+		now := time.Now()
+		if now.Sub(logtime) > p.config.AllowOldDuration || logtime.Sub(now) > p.config.AllowOldDuration {
+			// 日期差异很大的数据
+			p.tooOld.Inc()
+			if p.config.OnTooOld == tooOldDrop {
+				return nil, nil
+			}
+			if err := common.AddTags(event.Fields, []string{p.config.TooOldTag}); err != nil {
+				return nil, makeErrCompute(err)
+			}
+		}
 	}
-	_, err = event.PutValue(p.config.TimeField, logtime)
-	if err != nil {
-		return nil, makeErrCompute(err)
+	if line.Format == util.LogcatMonotonic {
+		event.Fields["monotonic"] = line.Seconds
 	}
 
+	event.Fields["pid"] = line.PID
+	if line.Format != util.LogcatBrief && line.Format != util.LogcatTime {
+		event.Fields["tid"] = line.TID
+	}
+	if value, ok := util.LevelMap[line.Priority]; ok {
+		event.Fields["level"] = value
+	} else {
+		event.Fields["level"] = strings.ToUpper(line.Priority)
+	}
+	event.Fields["tag"] = line.Tag
+	event.Fields["message"] = line.Message
+
 	// 业务属性
-	// if strings.Index(msg, UsbMounted) > 0 {
-	// 	event.Fields["usb_mounted"] = 1
-	// } else if strings.Index(msg, UsbUnmounted) > 0 {
-	// 	event.Fields["usb_mounted"] = 2
-	// }
+	applyRules(p.rules, event, line.Tag, msg)
 
 	return event, nil
 }
 
+// logtime returns the time of a line, brief and monotonic lines have none.
+func (p *parseServerlog) logtime(line util.LogcatLine, path, ecu, modifiedAt string) (time.Time, bool, error) {
+	const dateLayout = "01-02 15:04:05.999999"
+
+	loc := p.config.location(ecu)
+	switch line.Format {
+	case util.LogcatEpoch:
+		return line.Epoch.In(loc), true, nil
+	case util.LogcatBrief, util.LogcatMonotonic:
+		return time.Time{}, false, nil
+	}
+
+	// 日志时间, logcat 不含年份
+	logtime, err := time.ParseInLocation(dateLayout, line.Date, loc)
+	if err != nil {
+		return time.Time{}, false, makeErrCompute(errors.New("invalid log time: " + line.Date))
+	}
+
+	// 解析日期
+	lastModifiedAt, err := strconv.Atoi(modifiedAt)
+	if err != nil {
+		return time.Time{}, false, makeErrCompute(errors.New("invalid file modify time"))
+	}
+	mt := time.UnixMilli(int64(lastModifiedAt)).In(loc)
+	if p.config.YearInference == yearModified {
+		return util.WithYear(logtime, mt.Year()), true, nil
+	}
+	return p.years.Nearest(path, logtime, mt, p.config.DetectRollover), true, nil
+}
+
 func (p *parseServerlog) String() string {
 	conf, _ := json.Marshal(p.config)
 	return procName + "=" + string(conf)
@@ -18,21 +18,26 @@
 package parse_cdc_alog
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/processors"
 )
 
+// filebeatFixture is an alog line shipped by filebeat.
+const filebeatFixture = `{"@timestamp":"2023-09-27T10:55:53.798Z","@metadata":{"beat":"filebeat","type":"_doc","version":"7.9.3"},
+"log":{"file":{"path":"/vlog/cdc/A_log_3292_20231221_195338.gz.1737806441831505920@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@1703159620000@1703160317000"},
+"offset":6984921},"message":"12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 [cockpit_perception_proxy.cc][34938]user callback elapsed_time_ms:0.header id:3500872286,sn:1874249","fields":{"servicetype":"syslogcdc"}}`
+
 func TestServerLogWithData(t *testing.T) {
 	input := common.MapStr{
-		"message": `{"@timestamp":"2023-09-27T10:55:53.798Z","@metadata":{"beat":"filebeat","type":"_doc","version":"7.9.3"},
-"log":{"file":{"path":"/vlog/cdc/A_log_3292_20231221_195338.gz.1737806441831505920@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@1703159620000@1703160317000"},
-"offset":6984921},"message":"12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 [cockpit_perception_proxy.cc][34938]user callback elapsed_time_ms:0.header id:3500872286,sn:1874249","fields":{"servicetype":"syslogcdc"}}`,
+		"message": filebeatFixture,
 		"fields": common.MapStr{
 			"handler":   procName,
 			"collector": string(processors.LogFormatFilebeat),
@@ -52,8 +57,12 @@ func TestServerLogWithData(t *testing.T) {
 		"log_type":    "logcat",
 		"modified_at": "1703159620000",
 		"uploaded_at": "1703160317000",
-		"@timestamp":  time.Date(2023, 12, 21, 20, 34, 38, int(5963*time.Microsecond), time.Local),
-		"message":     "12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 [cockpit_perception_proxy.cc][34938]user callback elapsed_time_ms:0.header id:3500872286,sn:1874249",
+		"@timestamp":  time.Date(2023, 12, 21, 20, 34, 38, int(5963*time.Microsecond), shanghai(t)),
+		"pid":         int64(3810),
+		"tid":         int64(6369),
+		"level":       "DEBUG",
+		"tag":         "BTS",
+		"message":     "67380602 [cockpit_perception_proxy.cc][34938]user callback elapsed_time_ms:0.header id:3500872286,sn:1874249",
 	}
 
 	assert.Equal(t, expected["filename"], actual["filename"])
@@ -63,7 +72,243 @@ func TestServerLogWithData(t *testing.T) {
 	assert.Equal(t, expected["modified_at"], actual["modified_at"])
 	assert.Equal(t, expected["uploaded_at"], actual["uploaded_at"])
 	assert.Equal(t, expected["@timestamp"], actual["@timestamp"])
+	assert.Equal(t, expected["pid"], actual["pid"])
+	assert.Equal(t, expected["tid"], actual["tid"])
+	assert.Equal(t, expected["level"], actual["level"])
+	assert.Equal(t, expected["tag"], actual["tag"])
 	assert.Equal(t, expected["message"], actual["message"])
+	assert.Equal(t, []string{"alog_too_old"}, actual["tags"])
+}
+
+func TestLogcatFormats(t *testing.T) {
+	modified := time.Date(2023, 12, 22, 8, 0, 0, 0, shanghai(t))
+	logtime := time.Date(2023, 12, 21, 20, 34, 38, int(5*time.Millisecond), shanghai(t))
+
+	cases := map[string]struct {
+		format string
+		line   string
+		want   common.MapStr
+		time   time.Time
+	}{
+		"threadtime": {
+			line: "12-21 20:34:38.005  3810  6369 I ActivityManager: Start proc",
+			want: common.MapStr{"pid": int64(3810), "tid": int64(6369), "level": "INFO", "tag": "ActivityManager", "message": "Start proc"},
+			time: logtime,
+		},
+		"time": {
+			line: "12-21 20:34:38.005 W/ActivityManager( 3810): Start proc",
+			want: common.MapStr{"pid": int64(3810), "level": "WARN", "tag": "ActivityManager", "message": "Start proc"},
+			time: logtime,
+		},
+		"brief": {
+			line: "E/ActivityManager( 3810): Start proc",
+			want: common.MapStr{"pid": int64(3810), "level": "ERROR", "tag": "ActivityManager", "message": "Start proc"},
+		},
+		"long": {
+			line: "[ 12-21 20:34:38.005  3810: 0x18e1 F/ActivityManager ]\nStart proc",
+			want: common.MapStr{"pid": int64(3810), "tid": int64(6369), "level": "FATAL", "tag": "ActivityManager", "message": "Start proc"},
+			time: logtime,
+		},
+		"epoch": {
+			line: fmt.Sprintf("%d.005000  3810  6369 V ActivityManager: Start proc", logtime.Unix()),
+			want: common.MapStr{"pid": int64(3810), "tid": int64(6369), "level": "VERBOSE", "tag": "ActivityManager", "message": "Start proc"},
+			time: logtime,
+		},
+		"monotonic": {
+			line: "  12345.678901  3810  6369 D ActivityManager: Start proc",
+			want: common.MapStr{"pid": int64(3810), "tid": int64(6369), "level": "DEBUG", "tag": "ActivityManager", "message": "Start proc", "monotonic": 12345.678901},
+		},
+		"explicit format": {
+			format: "brief",
+			line:   "I/ActivityManager( 3810): Start proc",
+			want:   common.MapStr{"pid": int64(3810), "level": "INFO", "tag": "ActivityManager", "message": "Start proc"},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := common.MapStr{"allow_old": "87600h"}
+			if test.format != "" {
+				config["format"] = test.format
+			}
+			p, err := New(common.MustNewConfigFrom(config))
+			require.NoError(t, err)
+
+			event, err := p.Run(alogEvent(test.line, modified))
+			require.NoError(t, err)
+			require.NotNil(t, event)
+
+			for k, v := range test.want {
+				assert.Equal(t, v, event.Fields[k], k)
+			}
+			if test.time.IsZero() {
+				assert.True(t, event.Timestamp.IsZero())
+			} else {
+				assert.True(t, test.time.Equal(event.Timestamp), "want %v, got %v", test.time, event.Timestamp)
+			}
+		})
+	}
+}
+
+func TestMalformedLine(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{}))
+	require.NoError(t, err)
+
+	event, err := p.Run(alogEvent("--------- beginning of main", time.Now()))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Equal(t, int64(1), p.(*parseServerlog).malformed.Get())
+}
+
+func TestRoutingByVid(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"routing_by_vid": true}))
+	require.NoError(t, err)
+
+	event, err := p.Run(alogEvent("12-21 20:34:38.005  3810  6369 I UsbDeviceService: attached", time.Now()))
+	require.NoError(t, err)
+	routing, err := event.GetValue("@metadata.routing")
+	require.NoError(t, err)
+	assert.Equal(t, "6c9b10c6fd944651f6c8a22fa376ec13", routing)
+}
+
+func TestRules(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(`
+rules:
+  - {field: usb_mounted, value: 1, tag: UsbDeviceService, contains: "state=MOUNTED"}
+  - {field: usb_mounted, value: 2, tag: UsbDeviceService, pattern: "state=(EJECTING|UNMOUNTED)"}
+  - {field: usb.any, value: true, contains: "state="}
+`))
+	require.NoError(t, err)
+
+	cases := map[string]common.MapStr{
+		"UsbDeviceService:     state=MOUNTED":   {"usb_mounted": uint64(1), "usb": common.MapStr{"any": true}},
+		"UsbDeviceService:     state=EJECTING":  {"usb_mounted": uint64(2), "usb": common.MapStr{"any": true}},
+		"StorageManager:     state=MOUNTED":     {"usb": common.MapStr{"any": true}},
+		"UsbDeviceService:     device attached": {},
+	}
+	for message, want := range cases {
+		event, err := p.Run(alogEvent("12-21 20:34:38.005  3810  6369 I "+message, time.Now()))
+		require.NoError(t, err)
+		for _, field := range []string{"usb_mounted", "usb"} {
+			assert.Equal(t, want[field], event.Fields[field], message)
+		}
+	}
+}
+
+func TestInvalidRule(t *testing.T) {
+	for _, rule := range []common.MapStr{
+		{"field": "usb_mounted", "value": 1},
+		{"field": "usb_mounted", "value": 1, "contains": "a", "pattern": "b"},
+		{"field": "usb_mounted", "value": 1, "pattern": "("},
+	} {
+		_, err := New(common.MustNewConfigFrom(common.MapStr{"rules": []common.MapStr{rule}}))
+		assert.Error(t, err)
+	}
+}
+
+func alogEvent(line string, modified time.Time) *beat.Event {
+	return &beat.Event{Fields: common.MapStr{
+		"message": line,
+		"file":    fmt.Sprintf("A_log.gz.1@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@%d@1703160317000", modified.UnixMilli()),
+		"fields": common.MapStr{
+			"handler":   procName,
+			"collector": string(processors.LogFormatRaw),
+		},
+	}}
+}
+
+func TestYearInference(t *testing.T) {
+	cases := map[string]struct {
+		config   common.MapStr
+		modified time.Time
+		lines    []string
+		want     []time.Time
+	}{
+		"nearest before new year": {
+			modified: time.Date(2024, 1, 2, 8, 0, 0, 0, shanghai(t)),
+			lines:    []string{"12-31 23:59:59.000000"},
+			want:     []time.Time{time.Date(2023, 12, 31, 23, 59, 59, 0, shanghai(t))},
+		},
+		"modified before new year": {
+			config:   common.MapStr{"year_inference": "modified", "detect_rollover": false},
+			modified: time.Date(2024, 1, 2, 8, 0, 0, 0, shanghai(t)),
+			lines:    []string{"12-31 23:59:59.000000"},
+			want:     []time.Time{time.Date(2024, 12, 31, 23, 59, 59, 0, shanghai(t))},
+		},
+		"rollover across lines": {
+			modified: time.Date(2023, 6, 30, 8, 0, 0, 0, shanghai(t)),
+			lines:    []string{"12-31 23:59:59.000000", "01-01 00:00:01.000000", "07-01 10:00:00.000000"},
+			want: []time.Time{
+				time.Date(2022, 12, 31, 23, 59, 59, 0, shanghai(t)),
+				time.Date(2023, 1, 1, 0, 0, 1, 0, shanghai(t)),
+				time.Date(2023, 7, 1, 10, 0, 0, 0, shanghai(t)),
+			},
+		},
+		"ecu timezone": {
+			config:   common.MapStr{"timezones": common.MapStr{"cdc": "UTC"}},
+			modified: time.Date(2023, 12, 22, 8, 0, 0, 0, time.UTC),
+			lines:    []string{"12-21 20:34:38.000000"},
+			want:     []time.Time{time.Date(2023, 12, 21, 20, 34, 38, 0, time.UTC)},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			filename := fmt.Sprintf("A_log.gz.1@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@%d@1703160317000", test.modified.UnixMilli())
+			for i, line := range test.lines {
+				event, err := p.Run(&beat.Event{Fields: common.MapStr{
+					"message": line + "  3810  6369 D BTS     : line",
+					"file":    filename,
+					"fields": common.MapStr{
+						"handler":   procName,
+						"collector": string(processors.LogFormatRaw),
+					},
+				}})
+				require.NoError(t, err)
+				assert.True(t, test.want[i].Equal(event.Timestamp), "want %v, got %v", test.want[i], event.Timestamp)
+			}
+		})
+	}
+}
+
+func TestTooOld(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"on_too_old": "drop"}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: common.MapStr{
+		"message": "12-21 20:34:38.005963  3810  6369 D BTS     : line",
+		"file":    "A_log.gz.1@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@1703159620000@1703160317000",
+		"fields": common.MapStr{
+			"handler":   procName,
+			"collector": string(processors.LogFormatRaw),
+		},
+	}})
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	assert.Equal(t, int64(1), p.(*parseServerlog).tooOld.Get())
+}
+
+func BenchmarkRun(b *testing.B) {
+	p, err := New(common.NewConfig())
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{
+			"message": filebeatFixture,
+			"fields": common.MapStr{
+				"handler":   procName,
+				"collector": string(processors.LogFormatFilebeat),
+			},
+		}})
+		if err != nil || event == nil {
+			b.Fatal("event dropped", err)
+		}
+	}
 }
 
 func getActualValue(t *testing.T, config *common.Config, input common.MapStr) common.MapStr {
@@ -77,5 +322,12 @@ func getActualValue(t *testing.T, config *common.Config, input common.MapStr) co
 		t.Fatal(err)
 	}
 
+	actual.Fields["@timestamp"] = actual.Timestamp
 	return actual.Fields
 }
+
+func shanghai(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	return loc
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_cdc_alog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// ruleConfig derives a business field from a logcat line, such as
+// usb_mounted from the state changes logged by UsbDeviceService.
+type ruleConfig struct {
+	Field    string      `config:"field" validate:"required"`
+	Value    interface{} `config:"value" validate:"required"`
+	Tag      string      `config:"tag"`      // only lines of this logcat tag
+	Contains string      `config:"contains"` // substring of the line
+	Pattern  string      `config:"pattern"`  // or regular expression matching the line
+}
+
+func (r *ruleConfig) Validate() error {
+	if (r.Contains == "") == (r.Pattern == "") {
+		return fmt.Errorf("rule for %v requires either contains or pattern", r.Field)
+	}
+	return nil
+}
+
+type rule struct {
+	ruleConfig
+	pattern *regexp.Regexp
+}
+
+func newRules(configs []ruleConfig) ([]rule, error) {
+	rules := make([]rule, 0, len(configs))
+	for _, c := range configs {
+		r := rule{ruleConfig: c}
+		if c.Pattern != "" {
+			var err error
+			if r.pattern, err = regexp.Compile(c.Pattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern of rule for %v", c.Field)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r *rule) match(tag, line string) bool {
+	if r.Tag != "" && r.Tag != tag {
+		return false
+	}
+	if r.pattern != nil {
+		return r.pattern.MatchString(line)
+	}
+	return strings.Contains(line, r.Contains)
+}
+
+// applyRules sets the field of the first matching rule of each field.
+func applyRules(rules []rule, event *beat.Event, tag, line string) {
+	var set map[string]bool
+	for i := range rules {
+		r := &rules[i]
+		if set[r.Field] || !r.match(tag, line) {
+			continue
+		}
+		if set == nil {
+			set = map[string]bool{}
+		}
+		set[r.Field] = true
+		event.PutValue(r.Field, r.Value)
+	}
+}
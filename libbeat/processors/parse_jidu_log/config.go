@@ -0,0 +1,406 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_jidu_log
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+)
+
+// Config for parse_jidu_log processor.
+type Config struct {
+	Preset        string        `config:"preset"`         // name of a shipped layout, see presets.go
+	Handler       string        `config:"handler"`        // only parse events whose fields.handler matches, empty parses all
+	Preprocess    bool          `config:"preprocess"`     // unwrap the collector envelope named by fields.collector
+	Field         string        `config:"field"`          // log message field
+	Target        string        `config:"target"`         // namespace of the captured fields, empty writes to the root
+	IgnoreMissing bool          `config:"ignore_missing"` // Skip event when the message field is missing.
+	OnMalformed   malformedMode `config:"on_malformed"`   // what to do with lines not matching the layout
+	MinLength     int           `config:"min_length"`     // lines shorter than this are malformed
+
+	// Layout of the line, either Delimiter, Pattern or Logcat.
+	Delimiter string        `config:"delimiter"`
+	MaxSplits int           `config:"max_splits"`
+	Pattern   string        `config:"pattern"`
+	Logcat    *logcatConfig `config:"logcat"`
+	Fields    []fieldConfig `config:"fields"`
+
+	Tags      *tagsConfig      `config:"tags"`
+	Timestamp *timestampConfig `config:"timestamp"`
+	Filename  *filenameConfig  `config:"filename"`
+	Drop      []dropConfig     `config:"drop"`
+}
+
+// logcatConfig parses the line as Android logcat output. The captures are
+// time, monotonic, pid, tid, level (the priority letter), tag and message.
+type logcatConfig struct {
+	Format util.LogcatFormat `config:"format"` // output format, auto detected by default
+}
+
+type fieldConfig struct {
+	Name     string         `config:"name" validate:"required"`
+	Index    int            `config:"index"`    // split index in delimiter mode
+	Group    string         `config:"group"`    // named capture in pattern mode, defaults to name
+	Trim     string         `config:"trim"`     // cutset trimmed from both ends, e.g. " "
+	Unwrap   bool           `config:"unwrap"`   // strip the first and last character, e.g. brackets
+	Type     dataType       `config:"type"`     // conversion of the value
+	OnError  fieldErrorMode `config:"on_error"` // what to do when the conversion fails
+	Requires string         `config:"requires"` // only keep the field when this field was converted
+}
+
+// tagsConfig extracts the message from between in-house markers such as
+// ##JIDU## and ##MSG##.
+type tagsConfig struct {
+	Field   string             `config:"field"`   // captured field rewritten, message by default
+	After   []string           `config:"after"`   // the field is the rest of the line after the first tag found
+	Before  string             `config:"before"`  // the field is cut at the last occurrence of this tag
+	Payload string             `config:"payload"` // JSON between the after tag and the last marker is merged
+	JSON    util.PayloadConfig `config:"json"`
+}
+
+type timestampConfig struct {
+	Field      string            `config:"field"`  // captured field holding the time
+	Prefix     int               `config:"prefix"` // or the first N bytes of the line
+	Target     string            `config:"target"`
+	Layouts    []string          `config:"layouts" validate:"required"`
+	Timezone   *cfgtype.Timezone `config:"timezone"`
+	YearField  string            `config:"year_field"`  // epoch millis field supplying the year for year-less layouts
+	KeepSource bool              `config:"keep_source"` // keep the captured time field
+	UTC        bool              `config:"utc"`         // store the time in UTC
+	OnError    timeErrorMode     `config:"on_error"`    // what to do when no layout matches
+
+	YearInference  yearInference `config:"year_inference"`             // modified or nearest
+	DetectRollover bool          `config:"detect_rollover"`            // follow the year across consecutive lines of a file
+	MaxFiles       int           `config:"max_files" validate:"min=1"` // files tracked for rollover detection
+
+	MaxAge    time.Duration `config:"max_age"`     // lines further than this from now are too old
+	OnTooOld  tooOldMode    `config:"on_too_old"`  // tag or drop
+	TooOldTag string        `config:"too_old_tag"` // tag added by on_too_old: tag
+}
+
+type filenameConfig struct {
+	Field         string   `config:"field"`
+	Separator     string   `config:"separator"`
+	Segments      []string `config:"segments" validate:"required"` // segment names, "" skips a segment
+	Prefix        string   `config:"prefix"`                       // prefix of the output field names
+	Base          bool     `config:"base"`                         // strip the directory of the first segment
+	TrimExtension bool     `config:"trim_extension"`               // strip the extension of the first segment
+	Remove        bool     `config:"remove"`                       // remove the source field afterwards
+	DropMismatch  bool     `config:"drop_mismatch"`                // drop the event when the segment count is wrong
+	Required      bool     `config:"required"`                     // fail the event when the source field is missing
+}
+
+type dropConfig struct {
+	Field         string `config:"field" validate:"required"`
+	Prefix        string `config:"prefix"`
+	ExcludePrefix string `config:"exclude_prefix"`
+	Pattern       string `config:"pattern"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Field:       "message",
+		OnMalformed: malformedDrop,
+	}
+}
+
+func defaultTagsConfig() tagsConfig {
+	return tagsConfig{
+		Field: "message",
+		JSON:  util.DefaultPayloadConfig(),
+	}
+}
+
+func defaultTimestampConfig() timestampConfig {
+	return timestampConfig{
+		Target:    "@timestamp",
+		Timezone:  cfgtype.MustNewTimezone("Asia/Shanghai"),
+		MaxFiles:  10000,
+		TooOldTag: "too_old",
+	}
+}
+
+// setDefaults fills the optional sections after unpacking.
+func (c *Config) setDefaults() {
+	if f := c.Filename; f != nil {
+		if f.Field == "" {
+			f.Field = processors.LogFilename
+		}
+		if f.Separator == "" {
+			f.Separator = "@"
+		}
+	}
+}
+
+// Validate checks that exactly one layout is configured.
+func (c *Config) Validate() error {
+	layouts := 0
+	for _, set := range []bool{c.Delimiter != "", c.Pattern != "", c.Logcat != nil} {
+		if set {
+			layouts++
+		}
+	}
+	if layouts > 1 {
+		return errors.New("delimiter, pattern and logcat are mutually exclusive")
+	}
+	if layouts == 0 && len(c.Fields) > 0 {
+		return errors.New("fields require a delimiter, a pattern or logcat")
+	}
+	names := make(map[string]bool, len(c.Fields))
+	for _, f := range c.Fields {
+		names[f.Name] = true
+	}
+	for _, f := range c.Fields {
+		if f.Requires != "" && (f.Requires == f.Name || !names[f.Requires]) {
+			return fmt.Errorf("field %q requires %q, which is not another field", f.Name, f.Requires)
+		}
+	}
+	if t := c.Tags; t != nil && len(t.After) == 0 && t.Before == "" {
+		return errors.New("tags require after or before")
+	}
+	if t := c.Tags; t != nil && t.Payload != "" && len(t.After) == 0 {
+		return errors.New("tags.payload requires after")
+	}
+	if c.Timestamp != nil && c.Timestamp.Field == "" && c.Timestamp.Prefix <= 0 {
+		return errors.New("timestamp requires a field or a prefix")
+	}
+	if c.Timestamp != nil && c.Timestamp.YearInference == yearNearest && c.Timestamp.YearField == "" {
+		return errors.New("timestamp.year_inference: nearest requires a year_field")
+	}
+	for _, d := range c.Drop {
+		if d.Prefix == "" && d.Pattern == "" {
+			return fmt.Errorf("drop rule on %q requires a prefix or a pattern", d.Field)
+		}
+	}
+	return nil
+}
+
+type dataType uint8
+
+// List of dataTypes.
+const (
+	typeString dataType = iota
+	typeLong
+	typeDouble
+	typeBoolean
+	typeUpper
+	typeLower
+	typeLevel
+)
+
+var dataTypeNames = map[dataType]string{
+	typeString:  "string",
+	typeLong:    "long",
+	typeDouble:  "double",
+	typeBoolean: "boolean",
+	typeUpper:   "upper",
+	typeLower:   "lower",
+	typeLevel:   "level",
+}
+
+func (dt dataType) String() string {
+	return dataTypeNames[dt]
+}
+
+func (dt dataType) MarshalText() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+func (dt *dataType) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for typ, name := range dataTypeNames {
+		if s == name {
+			*dt = typ
+			return nil
+		}
+	}
+	return errors.Errorf("invalid data type: %v", s)
+}
+
+type malformedMode uint8
+
+// List of malformed modes.
+const (
+	malformedDrop malformedMode = iota
+	malformedKeep
+	malformedFail
+)
+
+var malformedModeNames = map[malformedMode]string{
+	malformedDrop: "drop",
+	malformedKeep: "keep",
+	malformedFail: "fail",
+}
+
+func (m malformedMode) String() string {
+	return malformedModeNames[m]
+}
+
+func (m malformedMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *malformedMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range malformedModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid on_malformed mode: %v", s)
+}
+
+type fieldErrorMode uint8
+
+// List of modes for values failing their conversion.
+const (
+	// fieldErrorMalformed handles the line as malformed
+	fieldErrorMalformed fieldErrorMode = iota
+	// fieldErrorSkip leaves the field and the fields requiring it out
+	fieldErrorSkip
+)
+
+var fieldErrorModeNames = map[fieldErrorMode]string{
+	fieldErrorMalformed: "malformed",
+	fieldErrorSkip:      "skip",
+}
+
+func (m fieldErrorMode) String() string {
+	return fieldErrorModeNames[m]
+}
+
+func (m fieldErrorMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *fieldErrorMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range fieldErrorModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid on_error mode: %v", s)
+}
+
+type timeErrorMode uint8
+
+// List of modes for times matching no layout.
+const (
+	timeErrorIgnore timeErrorMode = iota
+	timeErrorFail
+)
+
+var timeErrorModeNames = map[timeErrorMode]string{
+	timeErrorIgnore: "ignore",
+	timeErrorFail:   "fail",
+}
+
+func (m timeErrorMode) String() string {
+	return timeErrorModeNames[m]
+}
+
+func (m timeErrorMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *timeErrorMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range timeErrorModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid timestamp.on_error mode: %v", s)
+}
+
+type yearInference uint8
+
+// List of year inference modes.
+const (
+	// yearModified uses the year of year_field
+	yearModified yearInference = iota
+	// yearNearest picks the year putting the time nearest to year_field
+	yearNearest
+)
+
+var yearInferenceNames = map[yearInference]string{
+	yearModified: "modified",
+	yearNearest:  "nearest",
+}
+
+func (y yearInference) String() string {
+	return yearInferenceNames[y]
+}
+
+func (y yearInference) MarshalText() ([]byte, error) {
+	return []byte(y.String()), nil
+}
+
+func (y *yearInference) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for mode, name := range yearInferenceNames {
+		if s == name {
+			*y = mode
+			return nil
+		}
+	}
+	return errors.Errorf("invalid year_inference: %v", s)
+}
+
+type tooOldMode uint8
+
+// List of modes for lines outside max_age.
+const (
+	tooOldTag tooOldMode = iota
+	tooOldDrop
+)
+
+var tooOldModeNames = map[tooOldMode]string{
+	tooOldTag:  "tag",
+	tooOldDrop: "drop",
+}
+
+func (m tooOldMode) String() string {
+	return tooOldModeNames[m]
+}
+
+func (m tooOldMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *tooOldMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for mode, name := range tooOldModeNames {
+		if s == name {
+			*m = mode
+			return nil
+		}
+	}
+	return errors.Errorf("invalid on_too_old: %v", s)
+}
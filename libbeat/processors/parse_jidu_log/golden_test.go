@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_jidu_log
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	_ "github.com/elastic/beats/v7/libbeat/processors/parse_cdc_alog"
+	_ "github.com/elastic/beats/v7/libbeat/processors/parse_filebeat_log"
+	_ "github.com/elastic/beats/v7/libbeat/processors/parse_serverlog"
+	_ "github.com/elastic/beats/v7/libbeat/processors/parse_vehicle_tracelog"
+)
+
+// The golden tests run each preset and the processor it replaces on the same
+// events, in order, and expect the same results.
+
+const serverlogHeader = "2023-09-18 11:32:58.511 ai-repair-common ai-repair-common-69685c846c-kr47m INFO [http-nio-8080-exec-1] com.jidu.postsale.config.LogAspect doAround "
+
+func TestGoldenServerlog(t *testing.T) {
+	raw := func(message string) common.MapStr {
+		return common.MapStr{
+			"message": message,
+			"fields":  common.MapStr{"handler": "parse_serverlog", "collector": "raw"},
+		}
+	}
+
+	runGolden(t, "serverlog", common.MapStr{"layouts": []string{"2006-01-02 15:04:05.000"}}, map[string]common.MapStr{
+		"plain":             raw(serverlogHeader + "[66] [4652dc92fb8240777ad468f1623aaaff] [f9567a128ed25419] 【智能维修】【响应日志】"),
+		"payload":           raw(serverlogHeader + `[66] [t1] [s1] ##JIDU##{"user":"u1","level":"DEBUG","a.b":{"c":1}}##JIDU## done`),
+		"concatenated tags": raw(serverlogHeader + `[66] [t1] [s1] ##JIDU####JIDU##{"user":"u1"}##JIDU##`),
+		"empty payload":     raw(serverlogHeader + `[66] [t1] [s1] ##JIDU####JIDU## done`),
+		"invalid payload":   raw(serverlogHeader + `[66] [t1] [s1] ##JIDU##{"user":##JIDU##`),
+		"line not a number": raw(serverlogHeader + "[abc] [t1] [s1] ##JIDU##{\"user\":\"u1\"}##JIDU##"),
+		"short brackets":    raw(serverlogHeader + "[66] [] [s] x"),
+		"benchmark":         raw(serverlogHeader + "[66] [00000000a2f85dae36f2a95e4e032b2e] [s1] x"),
+		"excluded trace":    raw(serverlogHeader + "[66] [0000000000000000e4e032b2e2a6a8e5] [s1] x"),
+		"too short":         raw("2023-09-18 11:32:58.511"),
+		"too few items":     raw("2023-09-18 11:32:58.511 svc host INFO [main] c.x.Job run [181] [t1] [s1]"),
+		"invalid time":      raw("2023/09/18 11:32:58.511 svc host INFO [main] c.x.Job run [181] [t1] [s1] x"),
+		"other handler":     {"message": "x", "fields": common.MapStr{"handler": "parse_cdc_alog", "collector": "raw"}},
+		"no handler":        {"message": "x"},
+		"missing collector": {"message": "x", "fields": common.MapStr{"handler": "parse_serverlog"}},
+		"filebeat envelope": {
+			"message": `{"message":"` + serverlogHeader + `[66] [t1] [s1] done","log":{"file":{"path":"/var/log/app.log"}}}`,
+			"fields":  common.MapStr{"handler": "parse_serverlog", "collector": "filebeat"},
+		},
+		"ilogtail envelope": {
+			"message": `{"contents":{"content":"` + serverlogHeader + `[66] [t1] [s1] done"},"tags":{"k8s.namespace.name":"ns"}}`,
+			"fields":  common.MapStr{"handler": "parse_serverlog", "collector": "ilogtail"},
+		},
+	})
+}
+
+func TestGoldenCdcAlog(t *testing.T) {
+	const file = "/vlog/cdc/A_log_3292_20231221_195338.gz.1737806441831505920@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@%v@1703160317000"
+	alog := func(line string, modified interface{}) common.MapStr {
+		return common.MapStr{
+			"message": fmt.Sprintf(`{"message":%q,"log":{"file":{"path":%q}}}`, line, fmt.Sprintf(file, modified)),
+			"fields":  common.MapStr{"handler": "parse_cdc_alog", "collector": "filebeat"},
+		}
+	}
+
+	now := time.Now().In(shanghai(t))
+	runGolden(t, "cdc_alog", nil, map[string]common.MapStr{
+		"threadtime":         alog("12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 user callback", 1703159620000),
+		"time":               alog("12-21 20:34:38.005 D/BTS     ( 3810): user callback", 1703159620000),
+		"brief":              alog("D/BTS     ( 3810): user callback", 1703159620000),
+		"long":               alog("[ 12-21 20:34:38.005  3810: 6369 D/BTS ]\nuser callback", 1703159620000),
+		"epoch":              alog("1703162078.005963  3810  6369 D BTS     : user callback", 1703159620000),
+		"monotonic":          alog("   12345.678901  3810  6369 D BTS     : user callback", 1703159620000),
+		"previous year":      alog("12-31 23:59:59.000  3810  6369 I BTS     : x", 1704067300000),
+		"recent":             alog(now.Format("01-02 15:04:05.000000")+"  1  2 W tag: x", now.UnixMilli()),
+		"malformed":          alog("not logcat", 1703159620000),
+		"invalid date":       alog("13-45 20:34:38.005963  3810  6369 D BTS     : x", 1703159620000),
+		"invalid modified":   alog("12-21 20:34:38.005963  3810  6369 D BTS     : x", "yesterday"),
+		"unexpected file":    {"message": `{"message":"12-21 20:34:38.005963  3810  6369 D BTS     : x","log":{"file":{"path":"/vlog/a.log"}}}`, "fields": common.MapStr{"handler": "parse_cdc_alog", "collector": "filebeat"}},
+		"missing file":       {"message": "12-21 20:34:38.005963  3810  6369 D BTS     : x", "fields": common.MapStr{"handler": "parse_cdc_alog", "collector": "raw"}},
+		"other handler":      {"message": "x", "fields": common.MapStr{"handler": "parse_serverlog", "collector": "raw"}},
+		"missing collector":  {"message": "x", "fields": common.MapStr{"handler": "parse_cdc_alog"}},
+		"rollover december":  alog("12-31 23:59:58.000  1  2 I tag: x", 1704067300000),
+		"rollover new year":  alog("01-01 00:00:01.000  1  2 I tag: x", 1704067300000),
+		"rollover same file": alog("12-31 23:59:59.000  1  2 I tag: x", 1704067300000),
+	})
+}
+
+func TestGoldenVehicleTracelog(t *testing.T) {
+	const path = "/vlog/cdc/20230826120955_763.log.gz.1695288295082205184@cdc@b974519299bfa3e1faf92e611331aa08@tracelog@1693023196000@1693023204332"
+	trace := func(message, path string) common.MapStr {
+		return common.MapStr{
+			"message": message,
+			"log":     common.MapStr{"file": common.MapStr{"path": path}},
+		}
+	}
+	const header = "2023-08-26 12:11:47.898 4664 24435 D com.jidu.media.service:HttpLogInterceptor:##MSG## [6d3e1573c45f07a1c60c6be4aeb3d2a0] [789f9212a72f683f] [] [5g] [441018276115528658] "
+
+	runGolden(t, "vehicle_tracelog", nil, map[string]common.MapStr{
+		"closed":          trace(header+"response url: https://vehiclesvc.jiduapp.cn\nResponse Result -->：{\"code\":0} ##MSG##", path),
+		"open":            trace(header+"response", path),
+		"trailer":         trace(header+"a ##MSG## b ##MSG## tail", path),
+		"empty message":   trace(header+"##MSG##", path),
+		"unknown level":   trace("2023-08-26 12:11:47.898 1 2 X tag:##MSG## [] [] [] [] [] x", path),
+		"colon in tag":    trace("2023-08-26 12:11:47.898 1 2 I a:b:c:##MSG## [t] [s] [p] [wifi] [u]\tx", path),
+		"malformed":       trace("2023-08-26 12:11:47.898 1 2 I tag: x", path),
+		"unexpected file": trace(header+"x", "/vlog/cdc/a.log"),
+		"missing file":    {"message": header + "x"},
+		"missing message": {"log": common.MapStr{"file": common.MapStr{"path": path}}},
+	})
+}
+
+func TestGoldenFilebeatLog(t *testing.T) {
+	log := func(message string) common.MapStr {
+		return common.MapStr{"message": message, "fields.handler": "parse_filebeat_log"}
+	}
+
+	runGolden(t, "filebeat_log", common.MapStr{"layouts": []string{"2006-01-02T15:04:05.000Z0700"}}, map[string]common.MapStr{
+		"plain":         log("2023-08-31T12:14:43.594+0800\tINFO\tfilebeat-benchmark-log-dev-75c886ff7d-rx9sd\t[monitoring]\tlog/log.go:184\tNon-zero metrics in the last 30s"),
+		"utc":           log("2023-08-31T04:14:43.594Z\twarn\thost\tmessage"),
+		"invalid time":  log("yesterday\tINFO\thost\tmessage"),
+		"malformed":     log("2023-08-31T12:14:43.594+0800\tINFO\thost"),
+		"other handler": {"message": "a\tb\tc\td", "fields.handler": "parse_serverlog"},
+		"not a string":  {"message": 1, "fields.handler": "parse_filebeat_log"},
+	})
+}
+
+// runGolden runs the events through the preset and through the legacy
+// processor configured with legacyConfig, and compares the results.
+func runGolden(t *testing.T, preset string, legacyConfig common.MapStr, events map[string]common.MapStr) {
+	t.Helper()
+
+	presetProc, err := New(common.MustNewConfigFrom(common.MapStr{"preset": preset}))
+	require.NoError(t, err)
+
+	if legacyConfig == nil {
+		legacyConfig = common.MapStr{}
+	}
+	legacy, err := processors.New(processors.PluginConfig{
+		common.MustNewConfigFrom(common.MapStr{"parse_" + preset: legacyConfig}),
+	})
+	require.NoError(t, err)
+	legacyProc := legacy.List[0]
+
+	// Sorted, so that stateful processors see the events in the same order.
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		input := events[name]
+		want, wantErr := legacyProc.Run(&beat.Event{Fields: input.Clone()})
+		got, gotErr := presetProc.Run(&beat.Event{Fields: input.Clone()})
+
+		if !assert.Equal(t, wantErr != nil, gotErr != nil, "%v: errors %v and %v", name, wantErr, gotErr) || wantErr != nil {
+			continue
+		}
+		if !assert.Equal(t, want == nil, got == nil, "%v: dropped", name) || want == nil {
+			continue
+		}
+		assert.Equal(t, want.Fields, got.Fields, name)
+		assert.True(t, want.Timestamp.Equal(got.Timestamp), "%v: timestamp %v, want %v", name, got.Timestamp, want.Timestamp)
+		assert.Equal(t, want.Timestamp.Location().String(), got.Timestamp.Location().String(), name)
+	}
+}
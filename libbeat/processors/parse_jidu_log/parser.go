@@ -0,0 +1,570 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_jidu_log
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+const (
+	procName = "parse_jidu_log"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+}
+
+type dropRule struct {
+	dropConfig
+	pattern *regexp.Regexp
+}
+
+type parseJiduLog struct {
+	config  Config
+	logger  *logp.Logger
+	pattern *regexp.Regexp
+	minKeys int // number of items a delimited line must have
+	drops   []dropRule
+	years   *util.FileYears
+}
+
+// New constructs a new parse_jidu_log processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	cfg, err := applyPreset(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultConfig()
+	if cfg.HasField("tags") {
+		tags := defaultTagsConfig()
+		config.Tags = &tags
+	}
+	if cfg.HasField("timestamp") {
+		ts := defaultTimestampConfig()
+		config.Timestamp = &ts
+	}
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
+	config.setDefaults()
+
+	p := &parseJiduLog{
+		config: config,
+		logger: logp.NewLogger(logName),
+	}
+
+	if config.Pattern != "" {
+		p.pattern, err = regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, makeErrConfigUnpack(err)
+		}
+		named := false
+		for _, name := range p.pattern.SubexpNames() {
+			named = named || name != ""
+		}
+		if !named {
+			return nil, makeErrConfigUnpack(errors.New("pattern has no named group"))
+		}
+		for _, f := range config.Fields {
+			if f.Group != "" && p.pattern.SubexpIndex(f.Group) < 0 {
+				return nil, makeErrConfigUnpack(fmt.Errorf("pattern has no group named %q", f.Group))
+			}
+		}
+	}
+	for _, f := range config.Fields {
+		if config.MaxSplits > 0 && f.Index >= config.MaxSplits {
+			return nil, makeErrConfigUnpack(fmt.Errorf("index %d of field %q exceeds max_splits", f.Index, f.Name))
+		}
+		if f.Index+1 > p.minKeys {
+			p.minKeys = f.Index + 1
+		}
+	}
+	for _, d := range config.Drop {
+		rule := dropRule{dropConfig: d}
+		if d.Pattern != "" {
+			rule.pattern, err = regexp.Compile(d.Pattern)
+			if err != nil {
+				return nil, makeErrConfigUnpack(err)
+			}
+		}
+		p.drops = append(p.drops, rule)
+	}
+	if t := config.Timestamp; t != nil && t.YearInference == yearNearest {
+		p.years = util.NewFileYears(t.MaxFiles)
+	}
+
+	return p, nil
+}
+
+// applyPreset merges the user settings on top of the named preset.
+func applyPreset(cfg *common.Config) (*common.Config, error) {
+	name, err := cfg.String("preset", -1)
+	if err != nil || name == "" {
+		return cfg, nil
+	}
+	preset, ok := presets[name]
+	if !ok {
+		return nil, makeErrUnknownPreset(name)
+	}
+
+	merged, err := common.NewConfigWithYAML([]byte(preset), procName+"."+name)
+	if err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
+	if err := merged.MergeWithOpts(cfg, ucfg.ReplaceArrValues); err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
+	return merged, nil
+}
+
+// Run parse log
+func (p *parseJiduLog) Run(event *beat.Event) (*beat.Event, error) {
+	// event filter
+	if p.config.Handler != "" {
+		handler, err := event.GetValue(processors.FieldProcessor)
+		if err != nil || handler != p.config.Handler {
+			return event, nil
+		}
+	}
+
+	if p.config.Preprocess {
+		collector, err := event.GetValue(processors.FieldCollector)
+		if err != nil {
+			return nil, makeErrMissingField(processors.FieldCollector, err)
+		}
+		format, ok := collector.(string)
+		if !ok {
+			return nil, makeErrFieldType(processors.FieldCollector, "string", fmt.Sprintf("%T", collector))
+		}
+		if err := processors.LogPreprocessing(event, processors.LogFormat(format)); err != nil {
+			return event, err
+		}
+	}
+
+	message, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+			return event, nil
+		}
+		return nil, makeErrMissingField(p.config.Field, err)
+	}
+	msg, ok := message.(string)
+	if !ok {
+		return nil, makeErrFieldType(p.config.Field, "string", fmt.Sprintf("%T", message))
+	}
+	if len(msg) < p.config.MinLength {
+		return p.malformed(event, fmt.Sprintf("at least %d characters", p.config.MinLength))
+	}
+
+	captured := common.MapStr{}
+	switch {
+	case p.config.Delimiter != "":
+		if !p.splitFields(msg, captured) {
+			return p.malformed(event, fmt.Sprintf("%d items separated by %q", p.minKeys, p.config.Delimiter))
+		}
+	case p.pattern != nil:
+		if !p.matchFields(msg, captured) {
+			return p.malformed(event, p.config.Pattern)
+		}
+	case p.config.Logcat != nil:
+		if !logcatFields(msg, p.config.Logcat.Format, captured) {
+			return p.malformed(event, "logcat "+p.config.Logcat.Format.String())
+		}
+	}
+	if err := p.convertFields(captured); err != nil {
+		return p.malformed(event, err.Error())
+	}
+	payload := p.extractTags(msg, captured)
+
+	file, segments, ok, err := p.filenameFields(event)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	if t := p.config.Timestamp; t != nil {
+		ts, found, err := p.parseTime(msg, captured, segments, file)
+		if err != nil {
+			return nil, err
+		}
+		if !t.KeepSource && t.Field != "" {
+			delete(captured, t.Field)
+		}
+		if found {
+			if _, err := event.PutValue(t.Target, ts); err != nil {
+				return nil, makeErrCompute(err)
+			}
+			if t.MaxAge > 0 && tooOld(ts, t.MaxAge) {
+				if t.OnTooOld == tooOldDrop {
+					return nil, nil
+				}
+				if err := common.AddTags(event.Fields, []string{t.TooOldTag}); err != nil {
+					return nil, makeErrCompute(err)
+				}
+			}
+		}
+	}
+
+	if p.shouldDrop(event, captured) {
+		return nil, nil
+	}
+
+	for k, v := range segments {
+		event.Fields[p.config.Filename.Prefix+k] = v
+	}
+	if p.config.Filename != nil && p.config.Filename.Remove {
+		_ = event.Delete(p.config.Filename.Field)
+	}
+	for k, v := range captured {
+		key := k
+		if p.config.Target != "" {
+			key = p.config.Target + "." + k
+		}
+		if _, err := event.PutValue(key, v); err != nil {
+			return nil, makeErrCompute(err)
+		}
+	}
+	if payload != "" {
+		util.MergePayload(event, payload, p.config.Field, p.config.Tags.JSON)
+	}
+
+	return event, nil
+}
+
+func (p *parseJiduLog) malformed(event *beat.Event, format string) (*beat.Event, error) {
+	switch p.config.OnMalformed {
+	case malformedKeep:
+		return event, nil
+	case malformedFail:
+		return nil, makeErrLogFormat(format)
+	default:
+		// Drop event<malformed log>
+		return nil, nil
+	}
+}
+
+func (p *parseJiduLog) splitFields(msg string, captured common.MapStr) bool {
+	n := p.config.MaxSplits
+	if n == 0 {
+		n = -1
+	}
+	items := strings.SplitN(msg, p.config.Delimiter, n)
+	if len(items) < p.minKeys {
+		return false
+	}
+	for _, f := range p.config.Fields {
+		captured[f.Name] = items[f.Index]
+	}
+	return true
+}
+
+func (p *parseJiduLog) matchFields(msg string, captured common.MapStr) bool {
+	matches := p.pattern.FindStringSubmatch(msg)
+	if matches == nil {
+		return false
+	}
+	for i, name := range p.pattern.SubexpNames() {
+		if name != "" {
+			captured[name] = matches[i]
+		}
+	}
+	for _, f := range p.config.Fields {
+		if f.Group != "" {
+			captured[f.Name] = matches[p.pattern.SubexpIndex(f.Group)]
+		}
+	}
+	return true
+}
+
+// logcatFields captures the parts of a logcat line. The time is the raw
+// date, or the time itself for the epoch format.
+func logcatFields(msg string, format util.LogcatFormat, captured common.MapStr) bool {
+	line, ok := util.ParseLogcat(msg, format)
+	if !ok {
+		return false
+	}
+	switch line.Format {
+	case util.LogcatEpoch:
+		captured["time"] = line.Epoch
+	case util.LogcatMonotonic:
+		captured["monotonic"] = line.Seconds
+	case util.LogcatThreadtime, util.LogcatTime, util.LogcatLong:
+		captured["time"] = line.Date
+	}
+	captured["pid"] = line.PID
+	if line.Format != util.LogcatBrief && line.Format != util.LogcatTime {
+		captured["tid"] = line.TID
+	}
+	captured["level"] = line.Priority
+	captured["tag"] = line.Tag
+	captured["message"] = line.Message
+	return true
+}
+
+func (p *parseJiduLog) convertFields(captured common.MapStr) error {
+	var skipped map[string]bool
+	for _, f := range p.config.Fields {
+		raw, ok := captured[f.Name].(string)
+		if !ok {
+			continue
+		}
+		if f.Unwrap {
+			raw = util.Trim(raw)
+		}
+		if f.Trim != "" {
+			raw = strings.Trim(raw, f.Trim)
+		}
+		value, err := convert(raw, f.Type)
+		if err != nil {
+			if f.OnError == fieldErrorSkip {
+				if skipped == nil {
+					skipped = map[string]bool{}
+				}
+				skipped[f.Name] = true
+				delete(captured, f.Name)
+				continue
+			}
+			return fmt.Errorf("field %q: %w", f.Name, err)
+		}
+		captured[f.Name] = value
+	}
+	for _, f := range p.config.Fields {
+		if skipped[f.Requires] {
+			delete(captured, f.Name)
+		}
+	}
+	return nil
+}
+
+// extractTags rewrites the tagged field and returns the JSON payload of the
+// line, if any.
+func (p *parseJiduLog) extractTags(msg string, captured common.MapStr) string {
+	conf := p.config.Tags
+	if conf == nil {
+		return ""
+	}
+	value, ok := captured[conf.Field].(string)
+	if !ok {
+		return ""
+	}
+
+	begin := -1
+	for _, tag := range conf.After {
+		if idx := strings.Index(msg, tag); idx > 0 {
+			begin = idx
+			value = msg[idx+len(tag):]
+			break
+		}
+	}
+	if conf.Before != "" {
+		if idx := strings.LastIndex(value, conf.Before); idx > 0 {
+			value = value[:idx]
+		}
+	}
+	captured[conf.Field] = value
+
+	if conf.Payload == "" || begin < 0 {
+		return ""
+	}
+	end := strings.LastIndex(msg, conf.Payload)
+	if begin+len(conf.Payload) >= end {
+		return ""
+	}
+	return msg[begin+len(conf.Payload) : end]
+}
+
+func convert(s string, typ dataType) (interface{}, error) {
+	switch typ {
+	case typeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case typeDouble:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	case typeUpper:
+		return strings.ToUpper(s), nil
+	case typeLower:
+		return strings.ToLower(s), nil
+	case typeLevel:
+		if value, ok := util.LevelMap[s]; ok {
+			return value, nil
+		}
+		return strings.ToUpper(s), nil
+	default:
+		return s, nil
+	}
+}
+
+// filenameFields splits the upload file name into its segments. It returns
+// the file name, and false when the event has to be dropped.
+func (p *parseJiduLog) filenameFields(event *beat.Event) (string, map[string]string, bool, error) {
+	conf := p.config.Filename
+	if conf == nil {
+		return "", nil, true, nil
+	}
+
+	value, err := event.GetValue(conf.Field)
+	if err != nil {
+		if conf.Required {
+			return "", nil, false, makeErrMissingField(conf.Field, err)
+		}
+		return "", nil, !conf.DropMismatch, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return "", nil, false, makeErrFieldType(conf.Field, "string", fmt.Sprintf("%T", value))
+	}
+
+	items := strings.Split(name, conf.Separator)
+	if len(items) != len(conf.Segments) {
+		return name, nil, !conf.DropMismatch, nil
+	}
+	if conf.Base {
+		items[0] = path.Base(items[0])
+	}
+	if conf.TrimExtension {
+		items[0] = strings.TrimSuffix(items[0], path.Ext(items[0]))
+	}
+
+	segments := make(map[string]string, len(items))
+	for i, segment := range conf.Segments {
+		if segment != "" {
+			segments[segment] = items[i]
+		}
+	}
+	return name, segments, true, nil
+}
+
+func (p *parseJiduLog) parseTime(msg string, captured common.MapStr, segments map[string]string, file string) (time.Time, bool, error) {
+	conf := p.config.Timestamp
+	loc := conf.Timezone.Location()
+
+	var value string
+	if conf.Field != "" {
+		switch v := captured[conf.Field].(type) {
+		case time.Time:
+			return p.inZone(v.In(loc)), true, nil
+		case string:
+			value = v
+		}
+	} else if len(msg) >= conf.Prefix {
+		value = msg[:conf.Prefix]
+	}
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	for _, layout := range conf.Layouts {
+		ts, err := time.ParseInLocation(layout, value, loc)
+		if err != nil {
+			continue
+		}
+		if conf.YearField != "" && ts.Year() == 0 {
+			modified, err := p.modifiedAt(conf.YearField, captured, segments, loc)
+			if err != nil {
+				return time.Time{}, false, err
+			}
+			if conf.YearInference == yearNearest {
+				ts = p.years.Nearest(file, ts, modified, conf.DetectRollover)
+			} else {
+				ts = util.WithYear(ts, modified.Year())
+			}
+		}
+		return p.inZone(ts), true, nil
+	}
+	if conf.OnError == timeErrorFail {
+		return time.Time{}, false, makeErrCompute(fmt.Errorf("invalid log time: %v", value))
+	}
+	return time.Time{}, false, nil
+}
+
+func (p *parseJiduLog) inZone(ts time.Time) time.Time {
+	if p.config.Timestamp.UTC {
+		return ts.UTC()
+	}
+	return ts
+}
+
+// modifiedAt reads the epoch millis stored in field.
+func (p *parseJiduLog) modifiedAt(field string, captured common.MapStr, segments map[string]string, loc *time.Location) (time.Time, error) {
+	value, ok := segments[field]
+	if !ok {
+		value = fmt.Sprint(captured[field])
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, makeErrCompute(fmt.Errorf("invalid epoch millis in %v: %v", field, value))
+	}
+	return time.UnixMilli(millis).In(loc), nil
+}
+
+// tooOld reports whether ts is further than maxAge from now, in either
+// direction.
+func tooOld(ts time.Time, maxAge time.Duration) bool {
+	now := time.Now()
+	return now.Sub(ts) > maxAge || ts.Sub(now) > maxAge
+}
+
+func (p *parseJiduLog) shouldDrop(event *beat.Event, captured common.MapStr) bool {
+	for _, rule := range p.drops {
+		value, ok := captured[rule.Field]
+		if !ok {
+			v, err := event.GetValue(rule.Field)
+			if err != nil {
+				continue
+			}
+			value = v
+		}
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if rule.Prefix != "" && strings.HasPrefix(s, rule.Prefix) &&
+			(rule.ExcludePrefix == "" || !strings.HasPrefix(s, rule.ExcludePrefix)) {
+			return true
+		}
+		if rule.pattern != nil && rule.pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parseJiduLog) String() string {
+	conf, _ := json.Marshal(p.config)
+	return procName + "=" + string(conf)
+}
@@ -0,0 +1,269 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_jidu_log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+func TestPresetServerlog(t *testing.T) {
+	message := `2023-09-18 11:32:58.511 ai-repair-common ai-repair-common-69685c846c-kr47m INFO [http-nio-8080-exec-1] com.jidu.postsale.config.LogAspect doAround [66] [4652dc92fb8240777ad468f1623aaaff] [f9567a128ed25419] 【智能维修】【响应日志】`
+
+	actual := runProcessor(t, common.MapStr{"preset": "serverlog"}, common.MapStr{
+		"message": message,
+		"fields":  common.MapStr{"handler": "parse_serverlog", "collector": "raw"},
+	})
+	require.NotNil(t, actual)
+
+	assert.Equal(t, time.Date(2023, 9, 18, 11, 32, 58, int(511*time.Millisecond), shanghai(t)), actual.Timestamp)
+	assert.Equal(t, "ai-repair-common", actual.Fields["jiduservicename"])
+	assert.Equal(t, "ai-repair-common-69685c846c-kr47m", actual.Fields["hostname"])
+	assert.Equal(t, "INFO", actual.Fields["level"])
+	assert.Equal(t, "http-nio-8080-exec-1", actual.Fields["thread"])
+	assert.Equal(t, "com.jidu.postsale.config.LogAspect", actual.Fields["class"])
+	assert.Equal(t, "doAround", actual.Fields["method"])
+	assert.Equal(t, int64(66), actual.Fields["line"])
+	assert.Equal(t, "4652dc92fb8240777ad468f1623aaaff", actual.Fields["trace_id"])
+	assert.Equal(t, "f9567a128ed25419", actual.Fields["span_id"])
+	assert.Equal(t, "【智能维修】【响应日志】", actual.Fields["message"])
+}
+
+func TestPresetServerlogBenchmark(t *testing.T) {
+	cases := map[string]struct {
+		traceID string
+		dropped bool
+	}{
+		"benchmark trace": {traceID: "00000000a2f85dae36f2a95e4e032b2e", dropped: true},
+		"excluded trace":  {traceID: "0000000000000000e4e032b2e2a6a8e5", dropped: false},
+		"regular trace":   {traceID: "02f85dae36f2a95e4e032b2e2a6a8e51", dropped: false},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			message := "2023-09-27 20:40:11.012 svc host INFO [main] c.x.Job run [181] [" + test.traceID + "] [0f260428d86e8068] msg"
+			actual := runProcessor(t, common.MapStr{"preset": "serverlog"}, common.MapStr{
+				"message": message,
+				"fields":  common.MapStr{"handler": "parse_serverlog", "collector": "raw"},
+			})
+			assert.Equal(t, test.dropped, actual == nil)
+		})
+	}
+}
+
+func TestPresetHandlerFilter(t *testing.T) {
+	input := common.MapStr{
+		"message": "not a server log",
+		"fields":  common.MapStr{"handler": "parse_cdc_alog", "collector": "raw"},
+	}
+	actual := runProcessor(t, common.MapStr{"preset": "serverlog"}, input.Clone())
+	require.NotNil(t, actual)
+	assert.Equal(t, input, actual.Fields)
+
+	// the handler of a preset can be overridden
+	actual = runProcessor(t, common.MapStr{"preset": "serverlog", "handler": "parse_cdc_alog"}, input.Clone())
+	assert.Nil(t, actual)
+}
+
+func TestPresetCdcAlog(t *testing.T) {
+	input := common.MapStr{
+		"message": `{"@timestamp":"2023-09-27T10:55:53.798Z","@metadata":{"beat":"filebeat","type":"_doc","version":"7.9.3"},
+"log":{"file":{"path":"/vlog/cdc/A_log_3292_20231221_195338.gz.1737806441831505920@cdc@6c9b10c6fd944651f6c8a22fa376ec13@logcat@1703159620000@1703160317000"},
+"offset":6984921},"message":"12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 user callback","fields":{"servicetype":"syslogcdc"}}`,
+		"fields": common.MapStr{
+			"handler":   "parse_cdc_alog",
+			"collector": string(processors.LogFormatFilebeat),
+		},
+	}
+
+	actual := runProcessor(t, common.MapStr{"preset": "cdc_alog"}, input)
+	require.NotNil(t, actual)
+
+	assert.Equal(t, "A_log_3292_20231221_195338.gz", actual.Fields["filename"])
+	assert.Equal(t, "cdc", actual.Fields["ecu"])
+	assert.Equal(t, "6c9b10c6fd944651f6c8a22fa376ec13", actual.Fields["vid"])
+	assert.Equal(t, "logcat", actual.Fields["log_type"])
+	assert.Equal(t, "1703159620000", actual.Fields["modified_at"])
+	assert.Equal(t, "1703160317000", actual.Fields["uploaded_at"])
+	assert.Equal(t, time.Date(2023, 12, 21, 20, 34, 38, int(5963*time.Microsecond), shanghai(t)), actual.Timestamp)
+	assert.Equal(t, int64(3810), actual.Fields["pid"])
+	assert.Equal(t, int64(6369), actual.Fields["tid"])
+	assert.Equal(t, "DEBUG", actual.Fields["level"])
+	assert.Equal(t, "BTS", actual.Fields["tag"])
+	assert.Equal(t, "67380602 user callback", actual.Fields["message"])
+	assert.Equal(t, []string{"alog_too_old"}, actual.Fields["tags"])
+	assert.NotContains(t, actual.Fields, processors.LogFilename)
+	assert.NotContains(t, actual.Fields, "time")
+}
+
+func TestPresetVehicleTracelog(t *testing.T) {
+	input := common.MapStr{
+		"message": "2023-08-26 12:11:47.898 4664 24435 D com.jidu.media.service:HttpLogInterceptor:##MSG## [6d3e1573c45f07a1c60c6be4aeb3d2a0] [789f9212a72f683f] [] [5g] [441018276115528658] response url: https://vehiclesvc.jiduapp.cn\nResponse Result -->：{\"code\":0} ##MSG##",
+		"log": common.MapStr{
+			"file": common.MapStr{
+				"path": "/vlog/cdc/20230826120955_763.log.gz.1695288295082205184@cdc@b974519299bfa3e1faf92e611331aa08@tracelog@1693023196000@1693023204332",
+			},
+		},
+	}
+
+	actual := runProcessor(t, common.MapStr{"preset": "vehicle_tracelog"}, input)
+	require.NotNil(t, actual)
+
+	assert.Equal(t, common.MapStr{
+		"message": "response url: https://vehiclesvc.jiduapp.cn\nResponse Result -->：{\"code\":0} ",
+		"log": common.MapStr{
+			"file": common.MapStr{
+				"path": "/vlog/cdc/20230826120955_763.log.gz.1695288295082205184@cdc@b974519299bfa3e1faf92e611331aa08@tracelog@1693023196000@1693023204332",
+			},
+		},
+		"x-header_filename":    "20230826120955_763.log.gz",
+		"x-header_ecu":         "cdc",
+		"x-header_vid":         "b974519299bfa3e1faf92e611331aa08",
+		"x-header_log_type":    "tracelog",
+		"x-header_created_at":  "1693023196000",
+		"x-header_uploaded_at": "1693023204332",
+		"time":                 "2023-08-26 12:11:47.898",
+		"pid":                  int64(4664),
+		"tid":                  int64(24435),
+		"level":                "DEBUG",
+		"tag":                  "com.jidu.media.service:HttpLogInterceptor",
+		"trace_id":             "6d3e1573c45f07a1c60c6be4aeb3d2a0",
+		"span_id":              "789f9212a72f683f",
+		"parent_span_id":       "",
+		"network":              "5g",
+		"user_id":              "441018276115528658",
+	}, actual.Fields)
+}
+
+func TestPresetFilebeatLog(t *testing.T) {
+	input := common.MapStr{
+		"message": "2023-08-31T12:14:43.594+0800\tINFO\tfilebeat-benchmark-log-dev-75c886ff7d-rx9sd\t[monitoring]\tlog/log.go:184\tNon-zero metrics in the last 30s",
+		"fields":  common.MapStr{"handler": "parse_filebeat_log"},
+	}
+
+	actual := runProcessor(t, common.MapStr{"preset": "filebeat_log"}, input)
+	require.NotNil(t, actual)
+
+	assert.True(t, time.Date(2023, 8, 31, 4, 14, 43, int(594*time.Millisecond), time.UTC).Equal(actual.Timestamp))
+	assert.Equal(t, "INFO", actual.Fields["level"])
+	assert.Equal(t, "filebeat-benchmark-log-dev-75c886ff7d-rx9sd", actual.Fields["hostname"])
+	assert.Equal(t, "[monitoring]\tlog/log.go:184\tNon-zero metrics in the last 30s", actual.Fields["message"])
+	assert.NotContains(t, actual.Fields, "time")
+}
+
+func TestCustomLayout(t *testing.T) {
+	config := common.MapStr{
+		"target":    "gateway",
+		"delimiter": "|",
+		"fields": []common.MapStr{
+			{"name": "status", "index": 1, "type": "long"},
+			{"name": "latency", "index": 2, "type": "double"},
+			{"name": "cached", "index": 3, "type": "boolean"},
+			{"name": "level", "index": 4, "type": "level"},
+		},
+		"drop": []common.MapStr{
+			{"field": "path", "pattern": "^/health"},
+		},
+	}
+
+	actual := runProcessor(t, config, common.MapStr{"message": "GET|200|12.5|true|W", "path": "/api"})
+	require.NotNil(t, actual)
+	assert.Equal(t, common.MapStr{
+		"status":  int64(200),
+		"latency": 12.5,
+		"cached":  true,
+		"level":   "WARN",
+	}, actual.Fields["gateway"])
+
+	actual = runProcessor(t, config, common.MapStr{"message": "GET|200|12.5|true|W", "path": "/health"})
+	assert.Nil(t, actual)
+}
+
+func TestMalformed(t *testing.T) {
+	input := common.MapStr{"message": "a|b"}
+	base := common.MapStr{
+		"delimiter": "|",
+		"fields":    []common.MapStr{{"name": "c", "index": 2}},
+	}
+
+	for mode, check := range map[string]func(*beat.Event, error){
+		"drop": func(event *beat.Event, err error) {
+			assert.NoError(t, err)
+			assert.Nil(t, event)
+		},
+		"keep": func(event *beat.Event, err error) {
+			assert.NoError(t, err)
+			assert.Equal(t, input, event.Fields)
+		},
+		"fail": func(event *beat.Event, err error) {
+			assert.Error(t, err)
+		},
+	} {
+		config := base.Clone()
+		config["on_malformed"] = mode
+		p, err := New(common.MustNewConfigFrom(config))
+		require.NoError(t, err)
+
+		check(p.Run(&beat.Event{Fields: input.Clone()}))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cases := map[string]common.MapStr{
+		"unknown preset":        {"preset": "unknown"},
+		"delimiter and regex":   {"delimiter": " ", "pattern": "(?P<a>.*)"},
+		"fields without split":  {"fields": []common.MapStr{{"name": "a"}}},
+		"no named group":        {"pattern": "(.*)"},
+		"index out of range":    {"delimiter": " ", "max_splits": 2, "fields": []common.MapStr{{"name": "a", "index": 2}}},
+		"timestamp source":      {"timestamp": common.MapStr{"layouts": []string{"2006"}}},
+		"delimiter and logcat":  {"delimiter": " ", "logcat": common.MapStr{"format": "auto"}},
+		"requires unknown":      {"delimiter": " ", "fields": []common.MapStr{{"name": "a", "requires": "b"}}},
+		"empty tags":            {"tags": common.MapStr{"field": "message"}},
+		"payload without after": {"tags": common.MapStr{"before": "##", "payload": "##"}},
+		"nearest without field": {"timestamp": common.MapStr{"prefix": 4, "layouts": []string{"2006"}, "year_inference": "nearest"}},
+	}
+
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func runProcessor(t *testing.T, config common.MapStr, input common.MapStr) *beat.Event {
+	p, err := New(common.MustNewConfigFrom(config))
+	require.NoError(t, err)
+
+	actual, err := p.Run(&beat.Event{Fields: input})
+	require.NoError(t, err)
+	return actual
+}
+
+func shanghai(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	return loc
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_jidu_log
+
+// presets holds the layouts of the in-house log formats that used to have a
+// dedicated processor. Settings given next to `preset` override the preset.
+var presets = map[string]string{
+	// 服务端日志: datetime service hostname LEVEL [thread] class method [line] [trace_id] [span_id] message
+	// Lines whose [line] is not a number only get the service, host and level.
+	"serverlog": `
+handler: parse_serverlog
+preprocess: true
+min_length: 24
+on_malformed: drop
+delimiter: " "
+max_splits: 12
+fields:
+  - {name: jiduservicename, index: 2}
+  - {name: hostname, index: 3}
+  - {name: level, index: 4, type: upper}
+  - {name: thread, index: 5, unwrap: true, requires: line}
+  - {name: class, index: 6, requires: line}
+  - {name: method, index: 7, requires: line}
+  - {name: line, index: 8, unwrap: true, type: long, on_error: skip}
+  - {name: trace_id, index: 9, unwrap: true, requires: line}
+  - {name: span_id, index: 10, unwrap: true, requires: line}
+  - {name: message, index: 11, requires: line}
+tags:
+  after: ["##JIDU####JIDU##", "##JIDU##"]
+  payload: "##JIDU##"
+timestamp:
+  prefix: 23
+  layouts: ["2006-01-02 15:04:05.000"]
+  timezone: Asia/Shanghai
+drop:
+  - field: trace_id
+    prefix: "00000000"
+    exclude_prefix: "0000000000000000"
+`,
+
+	// 车机 Android logcat in any `adb logcat -v` format, named after the upload
+	// file: filename@ecu@vid@log_type@modified_at@uploaded_at.
+	"cdc_alog": `
+handler: parse_cdc_alog
+preprocess: true
+on_malformed: drop
+logcat: {format: auto}
+fields:
+  - {name: level, type: level}
+timestamp:
+  field: time
+  layouts: ["01-02 15:04:05.999999"]
+  timezone: Asia/Shanghai
+  on_error: fail
+  year_field: modified_at
+  year_inference: nearest
+  detect_rollover: true
+  max_age: 24h
+  on_too_old: tag
+  too_old_tag: alog_too_old
+filename:
+  segments: [filename, ecu, vid, log_type, modified_at, uploaded_at]
+  trim_extension: true
+  required: true
+  remove: true
+  drop_mismatch: true
+`,
+
+	// 车机 trace log: datetime pid tid LEVEL tag:##MSG## [trace_id] [span_id] [parent_span_id] [network] [user_id] message ##MSG##
+	"vehicle_tracelog": `
+on_malformed: drop
+pattern: '^(?P<time>\d{4}-\d{2}-\d{2}\s\d{2}:\d{2}:\d{2}\.\d{3})\s+(?P<pid>\d+)\s+(?P<tid>\d+)\s+(?P<level>[a-zA-Z]+)\s+(?P<tag>.*):\s*##MSG##\s*\[(?P<trace_id>\w*)\]\s*\[(?P<span_id>\w*)\]\s*\[(?P<parent_span_id>\w*)\]\s*\[(?P<network>[^\[\]]*)\]\s*\[(?P<user_id>[^\[\]]*)\]\s+(?P<message>(?s:.*))$'
+fields:
+  - {name: pid, type: long}
+  - {name: tid, type: long}
+  - {name: level, type: level}
+tags:
+  before: "##MSG##"
+filename:
+  field: log.file.path
+  segments: [filename, ecu, vid, log_type, created_at, uploaded_at]
+  prefix: x-header_
+  base: true
+  trim_extension: true
+  required: true
+`,
+
+	// filebeat 自身日志: datetime\tLEVEL\thostname\tmessage
+	"filebeat_log": `
+handler: parse_filebeat_log
+on_malformed: keep
+delimiter: "\t"
+max_splits: 4
+fields:
+  - {name: time, index: 0}
+  - {name: level, index: 1, type: upper}
+  - {name: hostname, index: 2}
+  - {name: message, index: 3}
+timestamp:
+  field: time
+  layouts: ["2006-01-02T15:04:05.000Z0700"]
+  timezone: Asia/Shanghai
+  utc: true
+`,
+}
@@ -18,16 +18,24 @@
 package parse_serverlog
 
 import (
+	"strings"
+
+	"github.com/pkg/errors"
+
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
 )
 
 // Config for parse_parse_vehicle_trace2trace processor.
 type Config struct {
-	Field         string            `config:"field"`          // log message field
-	IgnoreMissing bool              `config:"ignore_missing"` // Skip field when From field is missing.
-	TimeField     string            `config:"time_field"`     // specified the time field
-	Timezone      *cfgtype.Timezone `config:"timezone"`
-	Layouts       []string          `configs:"layouts" validate:"required"`
+	Field         string             `config:"field"`          // log message field
+	IgnoreMissing bool               `config:"ignore_missing"` // Skip field when From field is missing.
+	TimeField     string             `config:"time_field"`     // specified the time field
+	Timezone      *cfgtype.Timezone  `config:"timezone"`
+	Layouts       []string           `configs:"layouts" validate:"required"`
+	JSON          util.PayloadConfig `config:"json"`         // ##JIDU## payload extraction
+	Stress        []stressConfig     `config:"stress"`       // benchmark/stress-test traffic rules
+	OnMalformed   malformedMode      `config:"on_malformed"` // drop malformed lines or fail with an error
 }
 
 func defaultConfig() Config {
@@ -36,5 +44,41 @@ func defaultConfig() Config {
 		TimeField:     "@timestamp",
 		IgnoreMissing: false,
 		Timezone:      cfgtype.MustNewTimezone("Asia/Shanghai"),
+		JSON:          util.DefaultPayloadConfig(),
+	}
+}
+
+type malformedMode uint8
+
+// List of modes for lines not in the serverlog layout.
+const (
+	// malformedDrop drops the line silently
+	malformedDrop malformedMode = iota
+	// malformedError drops the line with an error, so that inputs with a
+	// dead letter queue can keep it
+	malformedError
+)
+
+var malformedModeNames = map[malformedMode]string{
+	malformedDrop:  "drop",
+	malformedError: "error",
+}
+
+func (m malformedMode) String() string {
+	return malformedModeNames[m]
+}
+
+func (m malformedMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *malformedMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for mode, name := range malformedModeNames {
+		if s == name {
+			*m = mode
+			return nil
+		}
 	}
+	return errors.Errorf("invalid on_malformed: %v", s)
 }
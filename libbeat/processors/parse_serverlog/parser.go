@@ -22,13 +22,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/bytedance/sonic"
 	"github.com/goccy/go-json"
 	"github.com/pkg/errors"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/processors/util"
 )
@@ -43,9 +44,19 @@ func init() {
 	// jsprocessor.RegisterPlugin(strings.Title(procName), New)
 }
 
+// serverlogFormat is the layout of a serverlog line, reported for malformed
+// lines.
+const serverlogFormat = "<time> <service> <host> <level> [<thread>] <class> <method> [<line>] [<trace_id>] [<span_id>] <message>"
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
 type parseServerlog struct {
 	config Config
 	logger *logp.Logger
+	stress []stressRule
+
+	malformed *monitoring.Int
 }
 
 // New constructs a new parse_serverlog processor.
@@ -54,12 +65,27 @@ func New(cfg *common.Config) (processors.Processor, error) {
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, makeErrConfigUnpack(err)
 	}
+	if !cfg.HasField("stress") {
+		config.Stress = defaultStressRules()
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
 
-	logger := logp.NewLogger(logName)
+	stress, err := newStressRules(config.Stress, reg)
+	if err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
 
 	p := &parseServerlog{
 		config: config,
-		logger: logger,
+		logger: log,
+		stress: stress,
+
+		malformed: monitoring.NewInt(reg, "malformed"),
 	}
 
 	return p, nil
@@ -69,10 +95,7 @@ func New(cfg *common.Config) (processors.Processor, error) {
 func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 	// event filter
 	processor, err := event.GetValue(processors.FieldProcessor)
-	if err != nil {
-		return nil, err
-	}
-	if processor != procName {
+	if err != nil || processor != procName {
 		return event, nil
 	}
 
@@ -94,7 +117,7 @@ func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 	}
 	msg := message.(string)
 	if len(msg) <= 23 {
-		return nil, nil
+		return p.dropMalformed()
 	}
 	event.Fields["message"] = msg
 
@@ -114,14 +137,7 @@ func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 	items := strings.SplitN(msg, " ", 12)
 	if len(items) < 12 {
 		// Drop event<malformed log>
-		return nil, nil
-	}
-
-	// filter benchmark log
-	if strings.HasPrefix(util.Trim(items[9]), util.BenchmarkPrefix) &&
-		!strings.HasPrefix(util.Trim(items[9]), util.BenchmarkExcludePrefix) {
-		// Drop event<benchmark log>
-		return nil, nil
+		return p.dropMalformed()
 	}
 
 	event.Fields["jiduservicename"] = items[2]
@@ -149,23 +165,35 @@ func (p *parseServerlog) Run(event *beat.Event) (*beat.Event, error) {
 		}
 	}
 
+	// benchmark and stress-test traffic, matched on the ids at their
+	// position even when the line number did not parse
+	raw := common.MapStr{
+		"trace_id": util.Trim(items[9]),
+		"span_id":  util.Trim(items[10]),
+	}
+	if event, err = applyStressRules(p.stress, event, raw); event == nil {
+		return nil, err
+	}
+
 	// 含有json数据
 	endIdx = strings.LastIndex(msg, util.MsgTag)
 	if beginIdx > 0 && beginIdx+len(util.MsgTag) < endIdx {
-		var obj map[string]interface{}
-		err = sonic.UnmarshalString(msg[beginIdx+len(util.MsgTag):endIdx], &obj)
-		if err != nil {
-			event.Fields["json_error"] = err
-		} else {
-			for k, v := range obj {
-				event.Fields[k] = v
-			}
-		}
+		util.MergePayload(event, msg[beginIdx+len(util.MsgTag):endIdx], p.config.Field, p.config.JSON)
 	}
 
 	return event, nil
 }
 
+// dropMalformed drops a line not in the serverlog layout, with an error when
+// on_malformed is error.
+func (p *parseServerlog) dropMalformed() (*beat.Event, error) {
+	p.malformed.Inc()
+	if p.config.OnMalformed == malformedError {
+		return nil, makeErrLogFormat(serverlogFormat)
+	}
+	return nil, nil
+}
+
 func (p *parseServerlog) String() string {
 	conf, _ := json.Marshal(p.config)
 	return procName + "=" + string(conf)
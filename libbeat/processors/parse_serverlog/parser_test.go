@@ -18,36 +18,40 @@
 package parse_serverlog
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/goccy/go-json"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
 )
 
 func TestServerLogWithData(t *testing.T) {
 	input := common.MapStr{
-		"message": `{"contents":{"content":"2023-09-18 11:32:58.511 ai-repair-common ai-repair-common-69685c846c-kr47m INFO [http-nio-8080-exec-1]
-com.jidu.postsale.config.LogAspect doAround [66] [4652dc92fb8240777ad468f1623aaaff] [f9567a128ed25419]
-【智能维修】【响应日志】{\"code\":0,\"msg\":\"请求成功\"}##JIDU##{\"conts\":{\"cont\":\"123\"},\"ta\":{\"ip\":\"10.90.33.11\",\"name\":\"10.90.33.11\"},
-\"time-test\":1695007978}##JIDU## time=2023-09-22T16:42:02+08:00 level=info msg=Stats In One Minute. AVGPT=0 SUM=0 TPS=0.00 statsKey=topic_passport_c_token@apisix-token-clean-passportc statsName=PULL_RT"},
+		"message": `{"contents":{"content":"2023-09-18 11:32:58.511 ai-repair-common ai-repair-common-69685c846c-kr47m INFO [http-nio-8080-exec-1] com.jidu.postsale.config.LogAspect doAround [66] [4652dc92fb8240777ad468f1623aaaff] [f9567a128ed25419] 【智能维修】【响应日志】{\"code\":0,\"msg\":\"请求成功\"}##JIDU##{\"conts\":{\"cont\":\"123\"},\"ta\":{\"ip\":\"10.90.33.11\",\"name\":\"10.90.33.11\"},\"time-test\":1695007978}##JIDU## time=2023-09-22T16:42:02+08:00 level=info msg=Stats In One Minute. AVGPT=0 SUM=0 TPS=0.00 statsKey=topic_passport_c_token@apisix-token-clean-passportc statsName=PULL_RT"},
 "tags":{"container.image.name":"docker.jidudev.com/tech/ai-repair-common:s.95f66.57.1904","container.ip":"10.90.44.137",
 "container.name":"ai-repair-common","host.ip":"10.90.162.80","host.name":"log-collector-6s7vk","k8s.namespace.name":"develop","k8s.node.ip":"10.90.33.11",
 "k8s.node.name":"10.90.33.11","k8s.pod.name":"ai-repair-common-69685c846c-kr47m","k8s.pod.uid":"fc75c40f-f5b1-4e64-8ef9-0557c7ceca82",
 "log.file.path":"/app/logs/ai-repair-common/serverlog.ai-repair-common-69685c846c-kr47m.log"},"time":1695007978}`,
+		"fields": common.MapStr{
+			"handler":   procName,
+			"collector": string(processors.LogFormatIlogtail),
+		},
 	}
-	testConfig, _ := common.NewConfigFrom(map[string]interface{}{
-		"Field":           "message",
-		"TimeField":       "logtime",
-		"IgnoreMissing":   true,
-		"IgnoreMalformed": true,
-		"DropOrigin":      true,
+	testConfig := common.MustNewConfigFrom(common.MapStr{
+		"field":          "message",
+		"time_field":     "logtime",
+		"ignore_missing": true,
+		"layouts":        []string{"2006-01-02 15:04:05.000"},
 	})
 	actual := getActualValue(t, testConfig, input)
 	expected := map[string]interface{}{
-		"logtime":         "2023-09-18 11:32:58.511",
+		"logtime":         time.Date(2023, 9, 18, 11, 32, 58, 511000000, time.FixedZone("CST", 8*3600)),
 		"jiduservicename": "ai-repair-common",
 		"hostname":        "ai-repair-common-69685c846c-kr47m",
 		"level":           "INFO",
@@ -64,7 +68,7 @@ com.jidu.postsale.config.LogAspect doAround [66] [4652dc92fb8240777ad468f1623aaa
 		"time-test":       float64(1695007978),
 	}
 
-	assert.Equal(t, expected["logtime"], actual["logtime"])
+	assert.True(t, expected["logtime"].(time.Time).Equal(actual["logtime"].(time.Time)))
 	assert.Equal(t, expected["jiduservicename"], actual["jiduservicename"])
 	assert.Equal(t, expected["hostname"], actual["hostname"])
 	assert.Equal(t, expected["level"], actual["level"])
@@ -115,7 +119,8 @@ func TestMalformedLog(t *testing.T) {
 		Fields: common.MapStr{
 			"message": message,
 			"fields": common.MapStr{
-				"handler": "parse_serverlog",
+				"handler":   "parse_serverlog",
+				"collector": string(processors.LogFormatRaw),
 			},
 		},
 	})
@@ -124,12 +129,349 @@ func TestMalformedLog(t *testing.T) {
 	t.Log(event)
 }
 
+func TestOnMalformed(t *testing.T) {
+	for mode, fails := range map[string]bool{"drop": false, "error": true} {
+		t.Run(mode, func(t *testing.T) {
+			config := common.MustNewConfigFrom(common.MapStr{
+				"layouts":      []string{"2006-01-02 15:04:05.000"},
+				"on_malformed": mode,
+			})
+			p, err := New(config)
+			require.NoError(t, err)
+
+			for _, message := range []string{"short", "2023-09-27 20:40:11.012 too few items"} {
+				event, err := p.Run(&beat.Event{
+					Fields: common.MapStr{
+						"message": message,
+						"fields": common.MapStr{
+							"handler":   "parse_serverlog",
+							"collector": string(processors.LogFormatRaw),
+						},
+					},
+				})
+				assert.Nil(t, event)
+				assert.Equal(t, fails, err != nil, "%v", err)
+			}
+			assert.Equal(t, int64(2), p.(*parseServerlog).malformed.Get())
+		})
+	}
+}
+
+func TestServerLogWithoutHandler(t *testing.T) {
+	config := common.MustNewConfigFrom(common.MapStr{
+		"layouts": []string{"2006-01-02 15:04:05.000"},
+	})
+	p, err := New(config)
+	require.NoError(t, err)
+
+	// events of other handlers, or without any, pass through untouched
+	for _, input := range []common.MapStr{
+		{"message": "2023-09-18 11:32:58.511 svc host INFO [main] c.x.Job run [181] [t1] [s1] x"},
+		{"message": "2023-09-18 11:32:58.511 svc host INFO [main] c.x.Job run [181] [t1] [s1] x", "fields": common.MapStr{"handler": "parse_cdc_alog"}},
+	} {
+		event, err := p.Run(&beat.Event{Fields: input.Clone()})
+		require.NoError(t, err)
+		assert.Equal(t, input, event.Fields)
+	}
+}
+
+func TestJSONPayload(t *testing.T) {
+	const line = "2023-09-18 11:32:58.511 svc svc-0 INFO [main] com.jidu.Cls doAround [66] [trace-1] [span-1] ##JIDU##%s##JIDU## done"
+
+	tests := map[string]struct {
+		config  common.MapStr
+		payload string
+		check   func(t *testing.T, fields common.MapStr)
+	}{
+		"replace existing keys by default": {
+			payload: `{"level":"DEBUG","@timestamp":"2000-01-01","a.b":{"c":{"d":{"e":1}}}}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, "DEBUG", fields["level"])
+				assert.NotContains(t, fields, "@timestamp")
+				// neither sanitized nor limited in depth
+				assert.Equal(t, common.MapStr{"c": common.MapStr{"d": common.MapStr{"e": float64(1)}}}, fields["a.b"])
+				assert.NotContains(t, fields, "tags")
+			},
+		},
+		"keep existing keys": {
+			config:  common.MapStr{"overwrite": "keep"},
+			payload: `{"level":"DEBUG","trace_id":"x","@timestamp":"2000-01-01","user":"u1"}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, "INFO", fields["level"])
+				assert.Equal(t, "trace-1", fields["trace_id"])
+				assert.NotContains(t, fields, "@timestamp")
+				assert.Equal(t, "u1", fields["user"])
+			},
+		},
+		"prefix existing keys": {
+			config:  common.MapStr{"overwrite": "prefix"},
+			payload: `{"level":"DEBUG","span_id":"x"}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, "INFO", fields["level"])
+				assert.Equal(t, "DEBUG", fields["json_level"])
+				assert.Equal(t, "x", fields["json_span_id"])
+			},
+		},
+		"prefixed key taken too": {
+			config:  common.MapStr{"overwrite": "prefix"},
+			payload: `{"json_level":"x","level":"DEBUG"}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, "INFO", fields["level"])
+				assert.Equal(t, "x", fields["json_level"])
+			},
+		},
+		"target namespace": {
+			config:  common.MapStr{"target": "payload"},
+			payload: `{"level":"DEBUG","@timestamp":"2000-01-01"}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, "INFO", fields["level"])
+				assert.Equal(t, common.MapStr{"level": "DEBUG", "@timestamp": "2000-01-01"}, fields["payload"])
+			},
+		},
+		"max depth": {
+			config:  common.MapStr{"max_depth": 2},
+			payload: `{"a":{"b":{"c":1}}}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				v, err := fields.GetValue("a.b")
+				require.NoError(t, err)
+				assert.Equal(t, `{"c":1}`, v)
+			},
+		},
+		"max keys": {
+			config:  common.MapStr{"max_keys": 2},
+			payload: `{"c":3,"b":{"y":2,"x":1},"a":1}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, float64(1), fields["a"])
+				assert.Equal(t, common.MapStr{}, fields["b"])
+				assert.NotContains(t, fields, "c")
+				assert.Equal(t, []string{"serverlog_json_truncated"}, fields["tags"])
+			},
+		},
+		"sanitize keys": {
+			config:  common.MapStr{"sanitize_keys": true},
+			payload: `{"a.b":1,"c d":2,"e-f":3}`,
+			check: func(t *testing.T, fields common.MapStr) {
+				assert.Equal(t, float64(1), fields["a_b"])
+				assert.Equal(t, float64(2), fields["c_d"])
+				assert.Equal(t, float64(3), fields["e-f"])
+			},
+		},
+		"parse error": {
+			payload: `{"a":`,
+			check: func(t *testing.T, fields common.MapStr) {
+				msg, err := fields.GetValue("error.message")
+				require.NoError(t, err)
+				assert.IsType(t, "", msg)
+				assert.Contains(t, msg, "parsing JSON payload")
+				assert.NotContains(t, fields, "json_error")
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := common.MustNewConfigFrom(common.MapStr{
+				"layouts": []string{"2006-01-02 15:04:05.000"},
+				"json":    test.config,
+			})
+			p, err := New(config)
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{
+				Fields: common.MapStr{
+					"message": fmt.Sprintf(line, test.payload),
+					"fields": common.MapStr{
+						"handler":   procName,
+						"collector": string(processors.LogFormatRaw),
+					},
+				},
+			})
+			require.NoError(t, err)
+			require.NotNil(t, event)
+			test.check(t, event.Fields)
+		})
+	}
+}
+
+func TestInvalidOverwrite(t *testing.T) {
+	_, err := New(common.MustNewConfigFrom(common.MapStr{
+		"layouts": []string{"2006-01-02 15:04:05.000"},
+		"json":    common.MapStr{"overwrite": "merge"},
+	}))
+	assert.Error(t, err)
+}
+
+func TestStressRules(t *testing.T) {
+	const line = "2023-09-18 11:32:58.511 svc svc-0 INFO [main] com.jidu.Cls doAround [%s] [%s] [span-1] done"
+
+	tests := map[string]struct {
+		stress  interface{}
+		lineNo  string
+		traceID string
+		dropped bool
+		tags    interface{}
+		index   interface{}
+	}{
+		"default drops benchmark": {
+			traceID: "00000000abcdef",
+			dropped: true,
+		},
+		"default drops benchmark without line number": {
+			lineNo:  "-",
+			traceID: "00000000abcdef",
+			dropped: true,
+		},
+		"default keeps excluded prefix": {
+			traceID: "0000000000000000abcdef",
+		},
+		"default keeps regular traffic": {
+			traceID: "4652dc92fb8240777ad468f1623aaaff",
+		},
+		"tag": {
+			stress:  []common.MapStr{{"name": "load", "prefix": "00000000", "action": "tag"}},
+			traceID: "00000000abcdef",
+			tags:    []string{"stress_test"},
+		},
+		"route": {
+			stress: []common.MapStr{{
+				"name": "load", "pattern": "^0{8}[^0]", "action": "route",
+				"index": "serverlog-stress", "tag": "load_test",
+			}},
+			traceID: "00000000abcdef",
+			tags:    []string{"load_test"},
+			index:   "serverlog-stress",
+		},
+		"disabled": {
+			stress:  []common.MapStr{},
+			traceID: "00000000abcdef",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := common.MapStr{"layouts": []string{"2006-01-02 15:04:05.000"}}
+			if test.stress != nil {
+				settings["stress"] = test.stress
+			}
+			p, err := New(common.MustNewConfigFrom(settings))
+			require.NoError(t, err)
+
+			lineNo := test.lineNo
+			if lineNo == "" {
+				lineNo = "66"
+			}
+			event, err := p.Run(&beat.Event{
+				Fields: common.MapStr{
+					"message": fmt.Sprintf(line, lineNo, test.traceID),
+					"fields": common.MapStr{
+						"handler":   procName,
+						"collector": string(processors.LogFormatRaw),
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			var matched int64
+			for _, r := range p.(*parseServerlog).stress {
+				matched += r.matched.Get()
+			}
+			if test.dropped {
+				assert.Nil(t, event)
+				assert.Equal(t, int64(1), matched)
+				return
+			}
+			require.NotNil(t, event)
+			assert.Equal(t, test.tags, event.Fields["tags"])
+			assert.Equal(t, test.index, event.Meta["index"])
+			if test.tags != nil {
+				assert.Equal(t, int64(1), matched)
+			}
+		})
+	}
+}
+
+func TestInvalidStressRule(t *testing.T) {
+	for name, rule := range map[string]common.MapStr{
+		"no prefix or pattern": {"name": "load"},
+		"route without index":  {"name": "load", "prefix": "0", "action": "route"},
+		"unknown action":       {"name": "load", "prefix": "0", "action": "mirror"},
+		"bad pattern":          {"name": "load", "pattern": "("},
+		"dotted name":          {"name": "load.test", "prefix": "0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(common.MapStr{
+				"layouts": []string{"2006-01-02 15:04:05.000"},
+				"stress":  []common.MapStr{rule},
+			}))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDuplicateStressRuleName(t *testing.T) {
+	_, err := New(common.MustNewConfigFrom(common.MapStr{
+		"layouts": []string{"2006-01-02 15:04:05.000"},
+		"stress": []common.MapStr{
+			{"name": "load", "prefix": "00000000"},
+			{"name": "load", "pattern": "^f{8}"},
+		},
+	}))
+	assert.Error(t, err)
+}
+
+func BenchmarkRun(b *testing.B) {
+	const line = "2023-09-18 11:32:58.511 ai-repair-common ai-repair-common-69685c846c-kr47m INFO [http-nio-8080-exec-1] com.jidu.postsale.config.LogAspect doAround [66] [4652dc92fb8240777ad468f1623aaaff] [f9567a128ed25419] ##JIDU##{\"conts\":{\"cont\":\"123\"},\"time-test\":1695007978}##JIDU## done"
+	content, err := json.Marshal(line)
+	require.NoError(b, err)
+	message := `{"contents":{"content":` + string(content) + `},"tags":{"container.ip":"10.90.44.137","k8s.namespace.name":"develop","k8s.node.ip":"10.90.33.11"},"time":1695007978}`
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"layouts": []string{"2006-01-02 15:04:05.000"},
+	}))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event, err := p.Run(&beat.Event{Fields: common.MapStr{
+			"message": message,
+			"fields": common.MapStr{
+				"handler":   procName,
+				"collector": string(processors.LogFormatIlogtail),
+			},
+		}})
+		if err != nil || event == nil {
+			b.Fatal("event dropped", err)
+		}
+	}
+}
+
 func getActualValue(t *testing.T, config *common.Config, input common.MapStr) common.MapStr {
 	p, err := New(config)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	actual, _ := p.Run(&beat.Event{Fields: input})
+	actual, err := p.Run(&beat.Event{Fields: input})
+	require.NoError(t, err)
+	require.NotNil(t, actual)
 	return actual.Fields
 }
+
+func TestStressRuleTagError(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"layouts": []string{"2006-01-02 15:04:05.000"},
+		"stress":  []common.MapStr{{"name": "load", "prefix": "load", "action": "tag"}},
+	}))
+	require.NoError(t, err)
+
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{
+		"message": "2023-09-18 11:32:58.511 svc svc-0 INFO [main] com.jidu.Cls doAround [66] [load-1] [span-1] done",
+		"tags":    "not a list",
+		"fields": common.MapStr{
+			"handler":   procName,
+			"collector": string(processors.LogFormatRaw),
+		},
+	}})
+	assert.Error(t, err)
+}
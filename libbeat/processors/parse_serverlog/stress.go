@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_serverlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+)
+
+// stressConfig recognises benchmark and stress-test traffic, usually by the
+// trace_id the load generator stamps on every request.
+type stressConfig struct {
+	Name          string       `config:"name" validate:"required"`
+	Field         string       `config:"field"`          // event field to match, trace_id by default
+	Prefix        string       `config:"prefix"`         // value prefix of stress traffic
+	ExcludePrefix string       `config:"exclude_prefix"` // prefix of real traffic that looks like stress traffic
+	Pattern       string       `config:"pattern"`        // or regular expression matching the value
+	Action        stressAction `config:"action"`         // drop, tag or route
+	Tag           string       `config:"tag"`            // tag added by tag and route
+	Index         string       `config:"index"`          // @metadata.index set by route
+}
+
+func (c *stressConfig) Validate() error {
+	if (c.Prefix == "") == (c.Pattern == "") {
+		return fmt.Errorf("stress rule %v requires either prefix or pattern", c.Name)
+	}
+	if c.Action == stressRoute && c.Index == "" {
+		return fmt.Errorf("stress rule %v requires an index to route to", c.Name)
+	}
+	return nil
+}
+
+// defaultStressRules keeps the historical behaviour: trace ids starting
+// with 8 zeros come from the load generator and are dropped. The Geely
+// pdp-gateway sends trace ids starting with 16 zeros, which are real traffic.
+func defaultStressRules() []stressConfig {
+	return []stressConfig{{
+		Name:          "benchmark",
+		Prefix:        util.BenchmarkPrefix,
+		ExcludePrefix: util.BenchmarkExcludePrefix,
+		Action:        stressDrop,
+	}}
+}
+
+type stressRule struct {
+	stressConfig
+	pattern *regexp.Regexp
+	matched *monitoring.Int
+}
+
+// newStressRules compiles the rules and registers their counters. Rule names
+// are used as registry keys, so they must be unique and free of dots.
+func newStressRules(configs []stressConfig, reg *monitoring.Registry) ([]stressRule, error) {
+	rules := make([]stressRule, 0, len(configs))
+	names := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		if strings.Contains(c.Name, ".") {
+			return nil, errors.Errorf("stress rule name %v must not contain dots", c.Name)
+		}
+		if names[c.Name] {
+			return nil, errors.Errorf("duplicate stress rule name %v", c.Name)
+		}
+		names[c.Name] = true
+		if c.Field == "" {
+			c.Field = "trace_id"
+		}
+		if c.Tag == "" {
+			c.Tag = "stress_test"
+		}
+		r := stressRule{
+			stressConfig: c,
+			matched:      monitoring.NewInt(reg, "stress."+c.Name+".matched"),
+		}
+		if c.Pattern != "" {
+			var err error
+			if r.pattern, err = regexp.Compile(c.Pattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern of stress rule %v", c.Name)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// match reports whether the rule matches the event. Fields not in the event
+// are looked up in raw, the values split from lines whose layout was only
+// partly recognised.
+func (r *stressRule) match(event *beat.Event, raw common.MapStr) bool {
+	v, err := event.GetValue(r.Field)
+	if err != nil {
+		if v, err = raw.GetValue(r.Field); err != nil {
+			return false
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if r.ExcludePrefix != "" && strings.HasPrefix(s, r.ExcludePrefix) {
+		return false
+	}
+	if r.pattern != nil {
+		return r.pattern.MatchString(s)
+	}
+	return strings.HasPrefix(s, r.Prefix)
+}
+
+// applyStressRules runs the action of the first matching rule. It returns
+// nil when the event is dropped.
+func applyStressRules(rules []stressRule, event *beat.Event, raw common.MapStr) (*beat.Event, error) {
+	for i := range rules {
+		r := &rules[i]
+		if !r.match(event, raw) {
+			continue
+		}
+		r.matched.Inc()
+		switch r.Action {
+		case stressDrop:
+			return nil, nil
+		case stressRoute:
+			if _, err := event.PutValue("@metadata."+events.FieldMetaIndex, r.Index); err != nil {
+				return nil, makeErrCompute(err)
+			}
+		}
+		if err := common.AddTags(event.Fields, []string{r.Tag}); err != nil {
+			return nil, makeErrCompute(err)
+		}
+		return event, nil
+	}
+	return event, nil
+}
+
+type stressAction uint8
+
+// List of actions for stress traffic.
+const (
+	stressDrop stressAction = iota
+	stressTag
+	stressRoute
+)
+
+var stressActionNames = map[stressAction]string{
+	stressDrop:  "drop",
+	stressTag:   "tag",
+	stressRoute: "route",
+}
+
+func (a stressAction) String() string {
+	return stressActionNames[a]
+}
+
+func (a stressAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *stressAction) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for action, name := range stressActionNames {
+		if s == name {
+			*a = action
+			return nil
+		}
+	}
+	return errors.Errorf("invalid stress action: %v", s)
+}
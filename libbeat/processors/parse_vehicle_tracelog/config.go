@@ -22,6 +22,7 @@ type Config struct {
 	Field           string `config:"field"`            // log message field
 	IgnoreMissing   bool   `config:"ignore_missing"`   // Skip field when From field is missing.
 	IgnoreMalformed bool   `config:"ignore_malformed"` // Skip log when From log is incorrect.
+	RoutingByVid    bool   `config:"routing_by_vid"`   // Route the events by the vid of the file name.
 }
 
 func defaultConfig() Config {
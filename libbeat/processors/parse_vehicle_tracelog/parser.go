@@ -18,7 +18,6 @@
 package parse_vehicle_tracelog
 
 import (
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -29,27 +28,37 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/logp"
 	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/dissect_filename"
 	"github.com/elastic/beats/v7/libbeat/processors/util"
 )
 
 const (
-	procName   = "parse_vehicle_tracelog"
-	logName    = "processor." + procName
-	patternStr = "^(\\d{4}\\-\\d{2}\\-\\d{2}\\s\\d{2}:\\d{2}:\\d{2}\\.\\d{3})\\s+(\\d+)\\s+(\\d+)\\s+([a-zA-Z]+)\\s+(.*):\\s*##MSG##\\s*\\[(\\w*)\\]\\s*\\[(\\w*)\\]\\s*\\[(\\w*)\\]\\s*\\[([^\\[\\]]*)\\]\\s*\\[([^\\[\\]]*)\\]\\s+"
+	procName = "parse_vehicle_tracelog"
+	logName  = "processor." + procName
 )
 
+// fileSchema is the layout of uploaded trace log file names, the times are
+// kept as the raw epoch millis.
+var fileSchema = dissect_filename.MustNewSchema("@", []dissect_filename.Segment{
+	{Name: "filename", Base: true, TrimExtension: true},
+	{Name: "ecu"},
+	{Name: "vid"},
+	{Name: "log_type"},
+	{Name: "created_at"},
+	{Name: "uploaded_at"},
+})
+
 func init() {
 	processors.RegisterPlugin(procName, NewParseVehicleTracelog)
 	// jsprocessor.RegisterPlugin(strings.Title(procName), New)
 }
 
 type parseVehicleTrace2trace struct {
-	config  Config
-	logger  *logp.Logger
-	pattern *regexp.Regexp
+	config Config
+	logger *logp.Logger
 }
 
-// NewParseVehicleTrace2trace constructs a new parse_vehicle_trace2trace processor.
+// NewParseVehicleTracelog constructs a new parse_vehicle_tracelog processor.
 func NewParseVehicleTracelog(cfg *common.Config) (processors.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
@@ -59,9 +68,8 @@ func NewParseVehicleTracelog(cfg *common.Config) (processors.Processor, error) {
 	logger := logp.NewLogger(logName)
 
 	p := &parseVehicleTrace2trace{
-		config:  config,
-		logger:  logger,
-		pattern: regexp.MustCompile(patternStr),
+		config: config,
+		logger: logger,
 	}
 
 	return p, nil
@@ -84,48 +92,46 @@ func (p *parseVehicleTrace2trace) Run(event *beat.Event) (*beat.Event, error) {
 	}
 
 	/* parse */
-	items := strings.Split(path.(string), "@")
-	if len(items) == 6 {
-		event.Fields["x-header_filename"] = items[0][strings.LastIndex(items[0], "/")+1 : strings.LastIndex(items[0], ".")]
-		event.Fields["x-header_ecu"] = items[1]
-		event.Fields["x-header_vid"] = items[2]
-		event.Fields["x-header_log_type"] = items[3]
-		event.Fields["x-header_created_at"] = items[4]
-		event.Fields["x-header_uploaded_at"] = items[5]
+	if err := fileSchema.DissectInto(event.Fields, "x-header_", path.(string)); err != nil {
+		p.logger.Debugw("Skipping file name headers", "error", err)
+	} else if p.config.RoutingByVid {
+		if err := processors.SetRouting(event, event.Fields["x-header_vid"]); err != nil {
+			return nil, err
+		}
 	}
 
 	msg := message.(string)
 	// override
 	event.Fields["message"] = msg
-	matches := p.pattern.FindStringSubmatch(msg)
-	if len(matches) < 11 || len(matches[6]) < 0 {
+	h, ok := scanHeader(msg)
+	if !ok {
 		// Drop event
 		return nil, nil
 	}
 
 	// the time field is served for trace collector
-	event.Fields["time"] = matches[1]
+	event.Fields["time"] = h.time
 
-	pid, _ := strconv.ParseInt(matches[2], 10, 64)
+	pid, _ := strconv.ParseInt(h.pid, 10, 64)
 	event.Fields["pid"] = pid
-	tid, _ := strconv.ParseInt(matches[3], 10, 64)
+	tid, _ := strconv.ParseInt(h.tid, 10, 64)
 	event.Fields["tid"] = tid
-	if value, ok := util.LevelMap[matches[4]]; ok {
+	if value, ok := util.LevelMap[h.level]; ok {
 		event.Fields["level"] = value
 	} else {
-		event.Fields["level"] = strings.ToUpper(matches[4])
+		event.Fields["level"] = strings.ToUpper(h.level)
 	}
-	event.Fields["tag"] = matches[5]
-	event.Fields["trace_id"] = matches[6]
-
-	event.Fields["span_id"] = matches[7]
-	event.Fields["parent_span_id"] = matches[8]
-	event.Fields["network"] = matches[9]
-	event.Fields["user_id"] = matches[10]
-	if endIdx := strings.LastIndex(msg, "##MSG##"); endIdx > len(matches[0]) {
-		event.Fields["message"] = msg[len(matches[0]):endIdx]
+	event.Fields["tag"] = h.tag
+	event.Fields["trace_id"] = h.traceID
+
+	event.Fields["span_id"] = h.spanID
+	event.Fields["parent_span_id"] = h.parentSpanID
+	event.Fields["network"] = h.network
+	event.Fields["user_id"] = h.userID
+	if endIdx := strings.LastIndex(msg, msgTag); endIdx > h.end {
+		event.Fields["message"] = msg[h.end:endIdx]
 	} else {
-		event.Fields["message"] = msg[len(matches[0]):]
+		event.Fields["message"] = msg[h.end:]
 	}
 
 	return event, nil
@@ -18,9 +18,12 @@
 package parse_vehicle_tracelog
 
 import (
+	"encoding/json"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -32,15 +35,11 @@ var (
 )
 
 func TestWithConfig(t *testing.T) {
-	input := common.MapStr{
-		"message": defaultMessage,
-	}
-	testConfig, _ := common.NewConfigFrom(map[string]interface{}{
-		"Field":           "message",
-		"TimeField":       "@timestamp",
-		"IgnoreMissing":   true,
-		"IgnoreMalformed": true,
-		"DropOrigin":      true,
+	var input common.MapStr
+	require.NoError(t, json.Unmarshal([]byte(defaultMessage), &input))
+	testConfig := common.MustNewConfigFrom(common.MapStr{
+		"field":          "message",
+		"ignore_missing": true,
 	})
 	actual := getActualValue(t, testConfig, input)
 	expected := common.MapStr{
@@ -82,15 +81,95 @@ func TestWithConfig(t *testing.T) {
 	assert.Equal(t, expected["message"], actual["message"])
 }
 
+// tracePattern is the regular expression scanHeader replaces, kept to check
+// that both accept the same lines.
+var tracePattern = regexp.MustCompile(`^(\d{4}\-\d{2}\-\d{2}\s\d{2}:\d{2}:\d{2}\.\d{3})\s+(\d+)\s+(\d+)\s+([a-zA-Z]+)\s+(.*):\s*##MSG##\s*\[(\w*)\]\s*\[(\w*)\]\s*\[(\w*)\]\s*\[([^\[\]]*)\]\s*\[([^\[\]]*)\]\s+`)
+
+func TestScanHeaderMatchesPattern(t *testing.T) {
+	lines := []string{
+		"2023-08-26 12:11:47.898 4664 24435 DEBUG com.jidu.media.service:MediaService@HttpLogInterceptor:##MSG## [6d3e15] [789f92] [] [5g] [4410] response\nline 2 ##MSG##",
+		"2023-08-26 12:11:47.898 4664 24435 I Tag:##MSG## [a] [b] [c] [wifi] [u] msg ##MSG##",
+		"2023-08-26 12:11:47.898 4664 24435 I a:b:##MSG## [a] [b] [c] [wifi] [u] x:##MSG## [d] [e] [f] [g] [h] tail",
+		"2023-08-26 12:11:47.898 4664 24435 I a:##MSG## [a] [b] [c] [wifi] [u] x:##MSG## [d] [broken",
+		"2023-08-26 12:11:47.898 4664 24435 I tag: \t ##MSG##[a][b][c][][]\n\nbody",
+		"2023-08-26 12:11:47.898 4664 24435 I :##MSG## [] [] [] [] [] body",
+		"2023-08-26\t12:11:47.898\t4664\t24435\tW\ttag:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I\ntag:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I ta\ng:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I tag:##MSG## [a-b] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I tag:##MSG## [a] [b] [c] [d\nd] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I tag:##MSG## [a] [b] [c] [d] [e]body",
+		"2023-08-26 12:11:47.898 4664 24435 I tag:##MSG## [a] [b] [c] [d] [e]",
+		"2023-08-26 12:11:47.898 4664 24435 I tag ##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.89 4664 24435 I tag:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 46a4 24435 I tag:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I1 tag:##MSG## [a] [b] [c] [d] [e] body",
+		"2023-08-26 12:11:47.898 4664 24435 I tag:##MSG## [a] [b] [c] [d] [e] [f] body",
+		"",
+	}
+
+	for _, line := range lines {
+		h, ok := scanHeader(line)
+		m := tracePattern.FindStringSubmatch(line)
+		if !assert.Equal(t, m != nil, ok, line) || m == nil {
+			continue
+		}
+		assert.Equal(t, m[1:], []string{h.time, h.pid, h.tid, h.level, h.tag,
+			h.traceID, h.spanID, h.parentSpanID, h.network, h.userID}, line)
+		assert.Equal(t, len(m[0]), h.end, line)
+	}
+}
+
+func BenchmarkScanHeader(b *testing.B) {
+	var input common.MapStr
+	require.NoError(b, json.Unmarshal([]byte(defaultMessage), &input))
+	line := input["message"].(string)
+
+	b.Run("scanner", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, ok := scanHeader(line); !ok {
+				b.Fatal("no match")
+			}
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if tracePattern.FindStringSubmatch(line) == nil {
+				b.Fatal("no match")
+			}
+		}
+	})
+}
+
+func BenchmarkRun(b *testing.B) {
+	var input common.MapStr
+	require.NoError(b, json.Unmarshal([]byte(defaultMessage), &input))
+	p, err := NewParseVehicleTracelog(common.NewConfig())
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event, _ := p.Run(&beat.Event{Fields: input.Clone()})
+		if event == nil {
+			b.Fatal("event dropped")
+		}
+	}
+}
+
 func getActualValue(t *testing.T, config *common.Config, input common.MapStr) common.MapStr {
 	log := logp.NewLogger("parse_vehicle_trace2trace_test")
 
-	p, err := NewParseVehicleTrace2trace(config)
+	p, err := NewParseVehicleTracelog(config)
 	if err != nil {
 		log.Error("Error initializing decode_json_fields")
 		t.Fatal(err)
 	}
 
-	actual, _ := p.Run(&beat.Event{Fields: input})
+	actual, err := p.Run(&beat.Event{Fields: input})
+	require.NoError(t, err)
+	require.NotNil(t, actual)
 	return actual.Fields
 }
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package parse_vehicle_tracelog
+
+import (
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/processors/util"
+)
+
+const msgTag = "##MSG##"
+
+// traceHeader holds the header fields of a trace line. The strings share the
+// memory of the line.
+type traceHeader struct {
+	time, pid, tid, level, tag    string
+	traceID, spanID, parentSpanID string
+	network, userID               string
+	end                           int // length of the header including the trailing whitespace
+}
+
+// scanHeader matches the header of a trace line:
+//
+//	datetime pid tid LEVEL tag:##MSG## [trace_id] [span_id] [parent_span_id] [network] [user_id] message
+//
+// It accepts exactly the lines matched by the former regular expression
+// `^(\d{4}-\d{2}-\d{2}\s\d{2}:\d{2}:\d{2}\.\d{3})\s+(\d+)\s+(\d+)\s+([a-zA-Z]+)\s+(.*):\s*##MSG##\s*\[(\w*)\]\s*\[(\w*)\]\s*\[(\w*)\]\s*\[([^\[\]]*)\]\s*\[([^\[\]]*)\]\s+`,
+// at about a tenth of its cost and without allocating.
+func scanHeader(line string) (h traceHeader, ok bool) {
+	s := util.NewScanner(line)
+	if h.time, ok = s.Template("0000-00-00_00:00:00.000"); !ok || !s.Space() {
+		return h, false
+	}
+	if h.pid, ok = s.Run(util.IsDigit); !ok || !s.Space() {
+		return h, false
+	}
+	if h.tid, ok = s.Run(util.IsDigit); !ok || !s.Space() {
+		return h, false
+	}
+	if h.level, ok = s.Run(util.IsLetter); !ok || !s.Space() {
+		return h, false
+	}
+
+	// The tag is greedy and cannot span lines: try the colons of the rest of
+	// the line from the last one.
+	tagStart := s.Pos
+	tagEnd := len(line)
+	if i := strings.IndexByte(line[tagStart:], '\n'); i >= 0 {
+		tagEnd = tagStart + i
+	}
+	for colon := strings.LastIndexByte(line[tagStart:tagEnd], ':'); colon >= 0; colon = strings.LastIndexByte(line[tagStart:tagStart+colon], ':') {
+		s.Pos = tagStart + colon + 1
+		s.Skip(util.IsSpace)
+		if s.Literal(msgTag) && h.scanIDs(&s) {
+			h.tag = line[tagStart : tagStart+colon]
+			h.end = s.Pos
+			return h, true
+		}
+	}
+	return h, false
+}
+
+func (h *traceHeader) scanIDs(s *util.Scanner) bool {
+	notBracket := func(c byte) bool { return c != '[' && c != ']' }
+
+	var ok bool
+	for _, id := range []*string{&h.traceID, &h.spanID, &h.parentSpanID} {
+		s.Skip(util.IsSpace)
+		if *id, ok = s.Bracketed(util.IsWord); !ok {
+			return false
+		}
+	}
+	for _, v := range []*string{&h.network, &h.userID} {
+		s.Skip(util.IsSpace)
+		if *v, ok = s.Bracketed(notBracket); !ok {
+			return false
+		}
+	}
+	return s.Space()
+}
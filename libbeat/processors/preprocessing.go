@@ -1,18 +1,30 @@
 package processors
 
 import (
+	"errors"
+	"fmt"
 	"path"
+	"sort"
+	"sync"
 
 	"github.com/bytedance/sonic"
+	"github.com/bytedance/sonic/ast"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 )
 
 type LogFormat string
 
 const (
-	LogFormatIlogtail LogFormat = "ilogtail"
-	LogFormatFilebeat LogFormat = "filebeat"
+	LogFormatIlogtail  LogFormat = "ilogtail"
+	LogFormatFilebeat  LogFormat = "filebeat"
+	LogFormatFluentBit LogFormat = "fluent-bit"
+	LogFormatVector    LogFormat = "vector"
+	LogFormatOTel      LogFormat = "otel"
+	LogFormatLogstash  LogFormat = "logstash"
+	// LogFormatRaw 未经采集器封装的原始日志
+	LogFormatRaw LogFormat = "raw"
 )
 
 const (
@@ -20,79 +32,335 @@ const (
 	LogFilename = "file"
 )
 
-type IlogtailMessage struct {
-	Contents struct {
-		Content string `json:"content"`
-	} `json:"contents"`
-	Tags struct {
-		ContainerImageName string `json:"container.image.name"`
-		ContainerIp        string `json:"container.ip"`
-		ContainerName      string `json:"container.name"`
-		HostIp             string `json:"host.ip"`
-		HostName           string `json:"host.name"`
-		K8sNamespaceName   string `json:"k8s.namespace.name"`
-		K8sNodeIp          string `json:"k8s.node.ip"`
-		K8sNodeName        string `json:"k8s.node.name"`
-		K8sPodName         string `json:"k8s.pod.name"`
-		K8sPodUid          string `json:"k8s.pod.uid"`
-		LogFilePath        string `json:"log.file.path"`
-	} `json:"tags"`
-	Time int `json:"time"`
+// EnvelopeKey is the path of a value inside a collector envelope. Each element
+// is one object key, so keys containing dots such as `k8s.pod.name` are
+// addressed as a single element.
+type EnvelopeKey []string
+
+// EnvelopeField maps a value of the envelope to an event field.
+type EnvelopeField struct {
+	Key   EnvelopeKey
+	Field string
+	// Default is written when the envelope lacks the key, nil leaves the
+	// field out.
+	Default interface{}
 }
 
-type FilebeatMessage struct {
-	Timestamp string `json:"@timestamp"`
-	Metadata  struct {
-		Beat    string `json:"beat"`
-		Type    string `json:"type"`
-		Version string `json:"version"`
-	} `json:"@metadata"`
-	Log struct {
-		File struct {
-			Path string `json:"path"`
-		} `json:"file"`
-		Offset int `json:"offset"`
-	} `json:"log"`
-	Message string `json:"message"`
-	Fields  struct {
-		Servicetype string `json:"servicetype"`
-	} `json:"fields"`
+// EnvelopeDecoder declares how the JSON envelope of a log collector is
+// unwrapped into the event.
+type EnvelopeDecoder struct {
+	// Message is the path of the log line, it replaces the message field.
+	Message EnvelopeKey
+	// OptionalMessage decodes an envelope without a log line as an empty
+	// line instead of failing.
+	OptionalMessage bool
+	// Filename is the path of the log file, its base name is written to
+	// LogFilename.
+	Filename EnvelopeKey
+	// Fields are copied to the event when present in the envelope.
+	Fields []EnvelopeField
+	// SizeField receives the length of the log line when set.
+	SizeField string
+	// Normalize rewrites the decoded envelope before the keys are looked up.
+	Normalize func(envelope map[string]interface{}) (map[string]interface{}, error)
+
+	messagePath  []interface{}
+	filenamePath []interface{}
+	fieldPaths   [][]interface{}
+	decodeErrors *monitoring.Int
 }
 
+var errInvalidEnvelope = errors.New("envelope is not valid JSON")
+
+var (
+	envelopeMutex    sync.RWMutex
+	envelopeDecoders = map[LogFormat]*EnvelopeDecoder{}
+
+	preprocessingRegistry = monitoring.Default.NewRegistry("processor.preprocessing", monitoring.DoNotReport)
+	unknownCollectors     = monitoring.NewInt(preprocessingRegistry, "unknown_collector")
+)
+
+// RegisterEnvelopeDecoder registers the decoder of the given collector.
+func RegisterEnvelopeDecoder(format LogFormat, decoder *EnvelopeDecoder) error {
+	envelopeMutex.Lock()
+	defer envelopeMutex.Unlock()
+
+	if _, exists := envelopeDecoders[format]; exists {
+		return fmt.Errorf("envelope decoder for collector '%v' already registered", format)
+	}
+
+	decoder.messagePath = decoder.Message.searchPath()
+	decoder.filenamePath = decoder.Filename.searchPath()
+	decoder.fieldPaths = make([][]interface{}, len(decoder.Fields))
+	for i, f := range decoder.Fields {
+		decoder.fieldPaths[i] = f.Key.searchPath()
+	}
+
+	reg := preprocessingRegistry.NewRegistry(string(format))
+	decoder.decodeErrors = monitoring.NewInt(reg, "decode_errors")
+	envelopeDecoders[format] = decoder
+	return nil
+}
+
+// EnvelopeFormats returns the names of the registered collectors.
+func EnvelopeFormats() []string {
+	envelopeMutex.RLock()
+	defer envelopeMutex.RUnlock()
+
+	formats := make([]string, 0, len(envelopeDecoders))
+	for format := range envelopeDecoders {
+		formats = append(formats, string(format))
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func init() {
+	for format, decoder := range map[LogFormat]*EnvelopeDecoder{
+		LogFormatRaw: {},
+		// The ilogtail and filebeat envelopes keep the defaults of the
+		// structs they used to be decoded into.
+		LogFormatIlogtail: {
+			Message:         EnvelopeKey{"contents", "content"},
+			OptionalMessage: true,
+			SizeField:       "filebeat_size", // metric
+			Fields: []EnvelopeField{
+				{Key: EnvelopeKey{"tags", "k8s.namespace.name"}, Field: "namespace", Default: ""},
+				{Key: EnvelopeKey{"tags", "k8s.node.ip"}, Field: "nodeip", Default: ""},
+				{Key: EnvelopeKey{"tags", "container.ip"}, Field: "podip", Default: ""},
+			},
+		},
+		LogFormatFilebeat: {
+			Message:         EnvelopeKey{"message"},
+			OptionalMessage: true,
+			Filename:        EnvelopeKey{"log", "file", "path"},
+		},
+		// fluent-bit tail input with `Path_Key filepath` and the kubernetes filter
+		LogFormatFluentBit: {
+			Message:  EnvelopeKey{"log"},
+			Filename: EnvelopeKey{"filepath"},
+			Fields: []EnvelopeField{
+				{Key: EnvelopeKey{"kubernetes", "namespace_name"}, Field: "namespace"},
+				{Key: EnvelopeKey{"kubernetes", "pod_ip"}, Field: "podip"},
+				{Key: EnvelopeKey{"kubernetes", "host_ip"}, Field: "nodeip"},
+			},
+		},
+		// vector kubernetes_logs source
+		LogFormatVector: {
+			Message:  EnvelopeKey{"message"},
+			Filename: EnvelopeKey{"file"},
+			Fields: []EnvelopeField{
+				{Key: EnvelopeKey{"kubernetes", "pod_namespace"}, Field: "namespace"},
+				{Key: EnvelopeKey{"kubernetes", "pod_ip"}, Field: "podip"},
+				{Key: EnvelopeKey{"kubernetes", "pod_host_ip"}, Field: "nodeip"},
+			},
+		},
+		// OTLP logs encoded as JSON, holding exactly one log record
+		LogFormatOTel: {
+			Message:   EnvelopeKey{"body"},
+			Filename:  EnvelopeKey{"attributes", "log.file.path"},
+			Normalize: normalizeOTelLogs,
+			Fields: []EnvelopeField{
+				{Key: EnvelopeKey{"resource", "k8s.namespace.name"}, Field: "namespace"},
+				{Key: EnvelopeKey{"resource", "k8s.pod.ip"}, Field: "podip"},
+				{Key: EnvelopeKey{"resource", "k8s.node.ip"}, Field: "nodeip"},
+			},
+		},
+		// logstash json codec with ECS compatibility
+		LogFormatLogstash: {
+			Message:  EnvelopeKey{"message"},
+			Filename: EnvelopeKey{"log", "file", "path"},
+		},
+	} {
+		if err := RegisterEnvelopeDecoder(format, decoder); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LogPreprocessing unwraps the envelope of the collector that shipped the
+// event. Unknown collectors and undecodable envelopes are reported as errors
+// and leave the event unchanged; unknown collectors used to pass the raw
+// envelope on as the log line.
 func LogPreprocessing(event *beat.Event, format LogFormat) error {
-	message := event.Fields["message"].(string)
-
-	var err error
-	switch format {
-	case LogFormatIlogtail:
-		var msg IlogtailMessage
-		err = sonic.UnmarshalString(message, &msg)
-		if err != nil {
+	envelopeMutex.RLock()
+	decoder, found := envelopeDecoders[format]
+	envelopeMutex.RUnlock()
+	if !found {
+		unknownCollectors.Inc()
+		return fmt.Errorf("unknown log collector '%v', expected one of %v", format, EnvelopeFormats())
+	}
+
+	if err := decoder.decode(event); err != nil {
+		decoder.decodeErrors.Inc()
+		return fmt.Errorf("failed to decode %v envelope: %w", format, err)
+	}
+	return nil
+}
+
+func (d *EnvelopeDecoder) decode(event *beat.Event) error {
+	if d.Message == nil {
+		return nil
+	}
+
+	message, ok := event.Fields["message"].(string)
+	if !ok {
+		return fmt.Errorf("message is %T, not a string", event.Fields["message"])
+	}
+
+	// The lookups skip what they do not need, validate the whole envelope
+	// first so that a broken one is not half read.
+	if !sonic.Valid([]byte(message)) {
+		return errInvalidEnvelope
+	}
+	envelope := envelopeView{raw: message}
+	if d.Normalize != nil {
+		var err error
+		if err = sonic.UnmarshalString(message, &envelope.decoded); err != nil {
 			return err
 		}
+		if envelope.decoded, err = d.Normalize(envelope.decoded); err != nil {
+			return err
+		}
+	}
 
-		event.Fields["namespace"] = msg.Tags.K8sNamespaceName
-		event.Fields["nodeip"] = msg.Tags.K8sNodeIp
-		event.Fields["podip"] = msg.Tags.ContainerIp
+	value, err := envelope.lookup(d.Message, d.messagePath)
+	if err != nil {
+		return err
+	}
+	content, ok := value.(string)
+	if !ok {
+		if value != nil || !d.OptionalMessage {
+			return fmt.Errorf("missing log line at %v", d.Message)
+		}
+	}
 
-		event.Fields["message"] = msg.Contents.Content
-		event.Fields["filebeat_size"] = len(msg.Contents.Content) // metric
+	for i, f := range d.Fields {
+		if value, _ := envelope.lookup(f.Key, d.fieldPaths[i]); value != nil {
+			event.Fields[f.Field] = value
+		} else if f.Default != nil {
+			event.Fields[f.Field] = f.Default
+		}
+	}
+	if d.Filename != nil {
+		if value, _ := envelope.lookup(d.Filename, d.filenamePath); value != nil {
+			if filename, ok := value.(string); ok {
+				event.Fields[LogFilename] = path.Base(filename)
+			}
+		}
+	}
 
-		delete(event.Fields, "input")
-	case LogFormatFilebeat:
-		var msg FilebeatMessage
-		err = sonic.UnmarshalString(message, &msg)
-		if err != nil {
-			return err
+	event.Fields["message"] = content
+	if d.SizeField != "" {
+		event.Fields[d.SizeField] = len(content)
+	}
+	delete(event.Fields, "input")
+
+	return nil
+}
+
+// envelopeView looks values up in a collector envelope. Unless the decoder
+// normalizes the decoded envelope, only the values looked up are decoded and
+// the rest of the envelope is skipped without building maps.
+type envelopeView struct {
+	raw     string
+	decoded map[string]interface{}
+}
+
+func (v *envelopeView) lookup(key EnvelopeKey, path []interface{}) (interface{}, error) {
+	if v.decoded != nil {
+		return lookupEnvelope(v.decoded, key), nil
+	}
+	node, err := sonic.GetFromString(v.raw, path...)
+	if err != nil {
+		if errors.Is(err, ast.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return node.Interface()
+}
+
+// searchPath converts key to the path of a sonic search.
+func (k EnvelopeKey) searchPath() []interface{} {
+	path := make([]interface{}, len(k))
+	for i, s := range k {
+		path[i] = s
+	}
+	return path
+}
+
+func lookupEnvelope(envelope map[string]interface{}, key EnvelopeKey) interface{} {
+	var value interface{} = envelope
+	for _, k := range key {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
 		}
-		event.Fields[LogFilename] = path.Base(msg.Log.File.Path)
+		value = obj[k]
+	}
+	return value
+}
 
-		event.Fields["message"] = msg.Message
+// normalizeOTelLogs flattens an OTLP/JSON export request into the body, the
+// log record attributes and the resource attributes of its only log record.
+func normalizeOTelLogs(envelope map[string]interface{}) (map[string]interface{}, error) {
+	var (
+		normalized map[string]interface{}
+		records    int
+	)
+	for _, rl := range otelList(envelope, "resourceLogs") {
+		resource := otelAttributes(lookupEnvelope(rl, EnvelopeKey{"resource"}))
+		for _, sl := range otelList(rl, "scopeLogs") {
+			for _, record := range otelList(sl, "logRecords") {
+				records++
+				normalized = map[string]interface{}{
+					"body":       otelValue(record["body"]),
+					"attributes": otelAttributes(record),
+					"resource":   resource,
+				}
+			}
+		}
+	}
+	if records != 1 {
+		return nil, fmt.Errorf("expected exactly one log record, found %d", records)
+	}
+	return normalized, nil
+}
 
-		delete(event.Fields, "input")
-	default:
+func otelList(obj map[string]interface{}, key string) []map[string]interface{} {
+	items, _ := obj[key].([]interface{})
+	list := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			list = append(list, m)
+		}
+	}
+	return list
+}
 
+func otelAttributes(obj interface{}) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	m, ok := obj.(map[string]interface{})
+	if !ok {
+		return attributes
 	}
+	for _, kv := range otelList(m, "attributes") {
+		if key, ok := kv["key"].(string); ok {
+			attributes[key] = otelValue(kv["value"])
+		}
+	}
+	return attributes
+}
 
+// otelValue unwraps an AnyValue such as {"stringValue": "..."}.
+func otelValue(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for _, value := range m {
+		return value
+	}
 	return nil
 }
@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var envelopeFixtures = map[LogFormat]struct {
+	message  string
+	expected common.MapStr
+}{
+	LogFormatIlogtail: {
+		message: `{"contents":{"content":"line"},"tags":{"container.ip":"10.90.44.137","k8s.namespace.name":"develop","k8s.node.ip":"10.90.33.11"},"time":1695007978}`,
+		expected: common.MapStr{
+			"message":       "line",
+			"namespace":     "develop",
+			"nodeip":        "10.90.33.11",
+			"podip":         "10.90.44.137",
+			"filebeat_size": 4,
+		},
+	},
+	LogFormatFilebeat: {
+		message: `{"@timestamp":"2023-09-27T10:55:53.798Z","log":{"file":{"path":"/vlog/cdc/a@cdc@vid"},"offset":1},"message":"line","fields":{"servicetype":"syslogcdc"}}`,
+		expected: common.MapStr{
+			"message": "line",
+			"file":    "a@cdc@vid",
+		},
+	},
+	LogFormatFluentBit: {
+		message: `{"date":1695007978.1,"log":"line","filepath":"/var/log/containers/a.log","kubernetes":{"namespace_name":"develop","pod_ip":"10.90.44.137","host_ip":"10.90.33.11"}}`,
+		expected: common.MapStr{
+			"message":   "line",
+			"file":      "a.log",
+			"namespace": "develop",
+			"podip":     "10.90.44.137",
+			"nodeip":    "10.90.33.11",
+		},
+	},
+	LogFormatVector: {
+		message: `{"message":"line","file":"/var/log/pods/a/0.log","kubernetes":{"pod_namespace":"develop","pod_ip":"10.90.44.137"}}`,
+		expected: common.MapStr{
+			"message":   "line",
+			"file":      "0.log",
+			"namespace": "develop",
+			"podip":     "10.90.44.137",
+		},
+	},
+	LogFormatOTel: {
+		message: `{"resourceLogs":[{"resource":{"attributes":[{"key":"k8s.namespace.name","value":{"stringValue":"develop"}}]},"scopeLogs":[{"logRecords":[{"timeUnixNano":"1695007978000000000","body":{"stringValue":"line"},"attributes":[{"key":"log.file.path","value":{"stringValue":"/app/logs/serverlog.log"}}]}]}]}]}`,
+		expected: common.MapStr{
+			"message":   "line",
+			"file":      "serverlog.log",
+			"namespace": "develop",
+		},
+	},
+	LogFormatLogstash: {
+		message: `{"@timestamp":"2023-09-27T10:55:53.798Z","@version":"1","message":"line","log":{"file":{"path":"/app/logs/serverlog.log"}}}`,
+		expected: common.MapStr{
+			"message": "line",
+			"file":    "serverlog.log",
+		},
+	},
+}
+
+func TestLogPreprocessing(t *testing.T) {
+	for format, test := range envelopeFixtures {
+		t.Run(string(format), func(t *testing.T) {
+			event := &beat.Event{Fields: common.MapStr{
+				"message": test.message,
+				"input":   common.MapStr{"type": "kafka"},
+			}}
+			require.NoError(t, LogPreprocessing(event, format))
+			assert.Equal(t, test.expected, event.Fields)
+		})
+	}
+}
+
+func BenchmarkLogPreprocessing(b *testing.B) {
+	for format, test := range envelopeFixtures {
+		message := test.message
+		b.Run(string(format), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				event := &beat.Event{Fields: common.MapStr{"message": message}}
+				if err := LogPreprocessing(event, format); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLogPreprocessingRaw(t *testing.T) {
+	event := &beat.Event{Fields: common.MapStr{"message": "line"}}
+	require.NoError(t, LogPreprocessing(event, LogFormatRaw))
+	assert.Equal(t, common.MapStr{"message": "line"}, event.Fields)
+}
+
+func TestLogPreprocessingDefaults(t *testing.T) {
+	tests := map[string]struct {
+		format   LogFormat
+		message  string
+		expected common.MapStr
+	}{
+		"ilogtail without tags": {
+			format:  LogFormatIlogtail,
+			message: `{"contents":{"content":"line"},"time":1695007978}`,
+			expected: common.MapStr{
+				"message":       "line",
+				"namespace":     "",
+				"nodeip":        "",
+				"podip":         "",
+				"filebeat_size": 4,
+			},
+		},
+		"ilogtail without content": {
+			format:  LogFormatIlogtail,
+			message: `{"tags":{"k8s.namespace.name":"develop"}}`,
+			expected: common.MapStr{
+				"message":       "",
+				"namespace":     "develop",
+				"nodeip":        "",
+				"podip":         "",
+				"filebeat_size": 0,
+			},
+		},
+		"filebeat without message": {
+			format:   LogFormatFilebeat,
+			message:  `{"log":{"file":{"path":"/app/a.log"}}}`,
+			expected: common.MapStr{"message": "", "file": "a.log"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			event := &beat.Event{Fields: common.MapStr{"message": test.message}}
+			require.NoError(t, LogPreprocessing(event, test.format))
+			assert.Equal(t, test.expected, event.Fields)
+		})
+	}
+
+	// a log line of the wrong type is still an error
+	event := &beat.Event{Fields: common.MapStr{"message": `{"contents":{"content":1}}`}}
+	assert.Error(t, LogPreprocessing(event, LogFormatIlogtail))
+}
+
+func TestLogPreprocessingUnknownCollector(t *testing.T) {
+	before := unknownCollectors.Get()
+
+	event := &beat.Event{Fields: common.MapStr{"message": `{"log":"line"}`}}
+	err := LogPreprocessing(event, "promtail")
+	assert.Error(t, err)
+	assert.Equal(t, before+1, unknownCollectors.Get())
+	assert.Equal(t, `{"log":"line"}`, event.Fields["message"])
+}
+
+func TestLogPreprocessingDecodeError(t *testing.T) {
+	decoder := envelopeDecoders[LogFormatOTel]
+	before := decoder.decodeErrors.Get()
+
+	for _, message := range []string{
+		`not json`,
+		`{"resourceLogs":[]}`,
+		`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"stringValue":"a"}},{"body":{"stringValue":"b"}}]}]}]}`,
+	} {
+		event := &beat.Event{Fields: common.MapStr{"message": message}}
+		assert.Error(t, LogPreprocessing(event, LogFormatOTel))
+		assert.Equal(t, message, event.Fields["message"])
+	}
+	assert.Equal(t, before+3, decoder.decodeErrors.Get())
+}
+
+func TestRegisterEnvelopeDecoder(t *testing.T) {
+	assert.Error(t, RegisterEnvelopeDecoder(LogFormatFilebeat, &EnvelopeDecoder{}))
+	assert.Contains(t, EnvelopeFormats(), string(LogFormatVector))
+}
@@ -0,0 +1,38 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+)
+
+// SetRouting routes the event by the value v, for the Elasticsearch output to
+// store the events sharing it in the same shard. An empty value is ignored.
+func SetRouting(event *beat.Event, v interface{}) error {
+	routing := fmt.Sprint(v)
+	if routing == "" {
+		return nil
+	}
+	if _, err := event.PutValue("@metadata."+events.FieldMetaRouting, routing); err != nil {
+		return fmt.Errorf("failed to set the routing: %w", err)
+	}
+	return nil
+}
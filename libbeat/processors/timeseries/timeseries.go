@@ -124,26 +124,16 @@ func populateDimensions(prefix string, dimensions map[string]bool, prefixes map[
 				name += "."
 			}
 			if _, ok := prefixes[name]; !ok || f.Overwrite {
-				prefixes[name] = isDimension(f)
+				prefixes[name] = f.IsDimension()
 			}
 		} else {
 			if _, ok := dimensions[name]; !ok || f.Overwrite {
-				dimensions[name] = isDimension(f)
+				dimensions[name] = f.IsDimension()
 			}
 		}
 	}
 }
 
-func isDimension(f mapping.Field) bool {
-	// keywords are dimensions by default (disabled with dimension: false in fields.yml)
-	if f.Dimension == nil {
-		return f.Type == "keyword" || (f.Type == "object" && f.ObjectType == "keyword")
-	}
-
-	// user defined dimension (dimension: true in fields.yml)
-	return *f.Dimension
-}
-
 func (t *timeseriesProcessor) String() string {
 	return "timeseries"
 }
@@ -0,0 +1,226 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogcatFormat is an output format of `adb logcat`.
+type LogcatFormat uint8
+
+// List of logcat output formats, see `adb logcat -v`.
+const (
+	LogcatAuto LogcatFormat = iota
+	LogcatThreadtime
+	LogcatTime
+	LogcatBrief
+	LogcatLong
+	LogcatEpoch
+	LogcatMonotonic
+)
+
+var logcatFormatNames = map[LogcatFormat]string{
+	LogcatAuto:       "auto",
+	LogcatThreadtime: "threadtime",
+	LogcatTime:       "time",
+	LogcatBrief:      "brief",
+	LogcatLong:       "long",
+	LogcatEpoch:      "epoch",
+	LogcatMonotonic:  "monotonic",
+}
+
+func (f LogcatFormat) String() string {
+	return logcatFormatNames[f]
+}
+
+func (f LogcatFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *LogcatFormat) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for format, name := range logcatFormatNames {
+		if s == name {
+			*f = format
+			return nil
+		}
+	}
+	return errors.Errorf("invalid logcat format: %v", s)
+}
+
+// minEpoch separates epoch seconds from the uptime of the monotonic format.
+const minEpoch = 1e9
+
+var (
+	// 12-21 20:34:38.005 D/BTS     ( 3810): message
+	timePattern = regexp.MustCompile(`(?s)^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+([VDIWEFS])/(.*?)\s*\(\s*(\d+)\): (.*)$`)
+	// D/BTS     ( 3810): message
+	briefPattern = regexp.MustCompile(`(?s)^([VDIWEFS])/(.*?)\s*\(\s*(\d+)\): (.*)$`)
+	// [ 12-21 20:34:38.005  3810: 6369 D/BTS ]
+	// message
+	longPattern = regexp.MustCompile(`(?s)^\[ (\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+):\s*(0x[0-9a-fA-F]+|\d+) ([VDIWEFS])/(.*?)\s*\]\r?\n?(.*)$`)
+	// 1703162078.005963  3810  6369 D BTS     : message (epoch)
+	//     12345.678901  3810  6369 D BTS     : message (monotonic)
+	secondsPattern = regexp.MustCompile(`(?s)^\s*(\d+\.\d+)\s+(\d+)\s+(\d+)\s+([VDIWEFS])\s+(.*?)\s*: (.*)$`)
+)
+
+// LogcatLine is a parsed logcat line. Date is set for the formats printing
+// the month and day, Seconds for epoch and monotonic.
+type LogcatLine struct {
+	Format   LogcatFormat
+	Date     string
+	Seconds  float64
+	Epoch    time.Time
+	PID      int64
+	TID      int64
+	Priority string
+	Tag      string
+	Message  string
+}
+
+// ParseLogcat parses a line in the given format, LogcatAuto tries all of them.
+func ParseLogcat(line string, format LogcatFormat) (LogcatLine, bool) {
+	if format != LogcatAuto {
+		return parseLogcatFormat(line, format)
+	}
+	for _, f := range []LogcatFormat{LogcatThreadtime, LogcatLong, LogcatTime, LogcatEpoch, LogcatBrief} {
+		if l, ok := parseLogcatFormat(line, f); ok {
+			if l.Format == LogcatEpoch && l.Seconds < minEpoch {
+				l.Format = LogcatMonotonic
+			}
+			return l, true
+		}
+	}
+	return LogcatLine{}, false
+}
+
+func parseLogcatFormat(line string, format LogcatFormat) (LogcatLine, bool) {
+	l := LogcatLine{Format: format}
+
+	switch format {
+	case LogcatThreadtime:
+		return scanThreadtime(line)
+	case LogcatTime:
+		m := timePattern.FindStringSubmatch(line)
+		if m == nil {
+			return l, false
+		}
+		l.Date, l.Priority, l.Tag, l.PID, l.Message = m[1], m[2], m[3], atoi(m[4]), m[5]
+	case LogcatBrief:
+		m := briefPattern.FindStringSubmatch(line)
+		if m == nil {
+			return l, false
+		}
+		l.Priority, l.Tag, l.PID, l.Message = m[1], m[2], atoi(m[3]), m[4]
+	case LogcatLong:
+		m := longPattern.FindStringSubmatch(line)
+		if m == nil {
+			return l, false
+		}
+		l.Date, l.PID, l.TID, l.Priority, l.Tag, l.Message = m[1], atoi(m[2]), atoi(m[3]), m[4], m[5], m[6]
+	case LogcatEpoch, LogcatMonotonic:
+		m := secondsPattern.FindStringSubmatch(line)
+		if m == nil {
+			return l, false
+		}
+		seconds, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return l, false
+		}
+		l.Epoch = parseEpoch(m[1])
+		l.Seconds, l.PID, l.TID, l.Priority, l.Tag, l.Message = seconds, atoi(m[2]), atoi(m[3]), m[4], m[5], m[6]
+	default:
+		return l, false
+	}
+	return l, true
+}
+
+// scanThreadtime parses the default logcat format,
+//
+//	12-21 20:34:38.005963  3810  6369 D BTS     : message
+//
+// accepting the lines of `(?s)^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+)\s+(\d+)\s+([VDIWEFS])\s+(.*?)\s*: (.*)$`
+// without the regexp engine. It is the hot path of alog parsing.
+func scanThreadtime(line string) (LogcatLine, bool) {
+	l := LogcatLine{Format: LogcatThreadtime}
+
+	s := NewScanner(line)
+	if _, ok := s.Template("00-00 00:00:00."); !ok {
+		return l, false
+	}
+	if _, ok := s.Run(IsDigit); !ok {
+		return l, false
+	}
+	l.Date = line[:s.Pos]
+
+	var pid, tid string
+	var ok bool
+	if !s.Space() {
+		return l, false
+	}
+	if pid, ok = s.Run(IsDigit); !ok || !s.Space() {
+		return l, false
+	}
+	if tid, ok = s.Run(IsDigit); !ok || !s.Space() {
+		return l, false
+	}
+	if s.Done() || strings.IndexByte("VDIWEFS", s.Line[s.Pos]) < 0 {
+		return l, false
+	}
+	l.Priority = s.Line[s.Pos : s.Pos+1]
+	s.Pos++
+	if !s.Space() {
+		return l, false
+	}
+
+	rest := s.Rest()
+	sep := strings.Index(rest, ": ")
+	if sep < 0 {
+		return l, false
+	}
+	tag := rest[:sep]
+	for tag != "" && IsSpace(tag[len(tag)-1]) {
+		tag = tag[:len(tag)-1]
+	}
+	l.Tag, l.Message = tag, rest[sep+2:]
+	l.PID, l.TID = atoi(pid), atoi(tid)
+	return l, true
+}
+
+// parseEpoch parses seconds with a decimal fraction without losing precision.
+func parseEpoch(s string) time.Time {
+	sec, frac, _ := strings.Cut(s, ".")
+	nsec := atoi((frac + "000000000")[:9])
+	return time.Unix(atoi(sec), nsec)
+}
+
+// atoi parses decimal and 0x prefixed hexadecimal ids.
+func atoi(s string) int64 {
+	if strings.HasPrefix(s, "0x") {
+		n, _ := strconv.ParseInt(s[2:], 16, 64)
+		return n
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
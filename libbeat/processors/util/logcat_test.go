@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// threadtimePattern is the regular expression scanThreadtime replaces, kept
+// to check that both accept the same lines.
+var threadtimePattern = regexp.MustCompile(`(?s)^(\d\d-\d\d \d\d:\d\d:\d\d\.\d+)\s+(\d+)\s+(\d+)\s+([VDIWEFS])\s+(.*?)\s*: (.*)$`)
+
+func TestScanThreadtimeMatchesPattern(t *testing.T) {
+	lines := []string{
+		"12-21 20:34:38.005963  3810  6369 D BTS     : message",
+		"12-21 20:34:38.005  3810  6369 I ActivityManager: Start proc: a: b",
+		"12-21 20:34:38.005  3810  6369 I : empty tag",
+		"12-21 20:34:38.005  3810  6369 I tag with spaces \t : multi\nline",
+		"12-21 20:34:38.005  3810  6369 I a:b : c",
+		"12-21 20:34:38.005  3810  6369 I tag: ",
+		"12-21 20:34:38.005\n3810\t6369\nW\ttag: message",
+		"12-21 20:34:38.005  3810  6369 I tag:message",
+		"12-21 20:34:38.  3810  6369 I tag: message",
+		"12-21 20:34:38.005  3810  6369 X tag: message",
+		"12-21 20:34:38.005  3810  6369 II tag: message",
+		"12-21 20:34:38.005  3810 I tag: message",
+		"12-21\t20:34:38.005  3810  6369 I tag: message",
+		"1703162078.005963  3810  6369 D BTS     : message",
+		"",
+	}
+
+	for _, line := range lines {
+		l, ok := scanThreadtime(line)
+		m := threadtimePattern.FindStringSubmatch(line)
+		if !assert.Equal(t, m != nil, ok, line) || m == nil {
+			continue
+		}
+		assert.Equal(t, []interface{}{m[1], atoi(m[2]), atoi(m[3]), m[4], m[5], m[6]},
+			[]interface{}{l.Date, l.PID, l.TID, l.Priority, l.Tag, l.Message}, line)
+	}
+}
+
+func BenchmarkParseLogcat(b *testing.B) {
+	const line = "12-21 20:34:38.005963  3810  6369 D BTS     : 67380602 [cockpit_perception_proxy.cc][34938]user callback elapsed_time_ms:0.header id:3500872286,sn:1874249"
+
+	for _, format := range []LogcatFormat{LogcatThreadtime, LogcatAuto} {
+		b.Run(format.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok := ParseLogcat(line, format); !ok {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
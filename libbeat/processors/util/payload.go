@@ -0,0 +1,244 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bytedance/sonic"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// PayloadConfig controls how the JSON payload between ##JIDU## markers is
+// written to the event.
+type PayloadConfig struct {
+	Target       string          `config:"target"`                     // namespace for the payload, root when empty
+	Overwrite    OverwritePolicy `config:"overwrite"`                  // keep, replace or prefix existing keys
+	Prefix       string          `config:"prefix"`                     // prefix for colliding keys with overwrite: prefix
+	MaxDepth     int             `config:"max_depth" validate:"min=0"` // 0 is unlimited
+	MaxKeys      int             `config:"max_keys" validate:"min=0"`  // 0 is unlimited
+	SanitizeKeys bool            `config:"sanitize_keys"`
+	TruncatedTag string          `config:"truncated_tag"`
+}
+
+// DefaultPayloadConfig returns the payload settings of the serverlog format.
+// They merge the payload into the event root as previous versions did, the
+// limits and key sanitization are opt-in.
+func DefaultPayloadConfig() PayloadConfig {
+	return PayloadConfig{
+		Overwrite:    OverwriteReplace,
+		Prefix:       "json_",
+		TruncatedTag: "serverlog_json_truncated",
+	}
+}
+
+// protectedKeys are never written from the payload when it is merged into
+// the event root, whatever the overwrite policy is.
+var protectedKeys = map[string]bool{
+	"@timestamp": true,
+	"@metadata":  true,
+}
+
+// payloadWriter copies a decoded payload into the event honouring the
+// payload settings.
+type payloadWriter struct {
+	config    PayloadConfig
+	keys      int
+	truncated bool
+}
+
+// MergePayload decodes the JSON payload and writes it to the event. Parse
+// failures are reported in error.message, with field as the source field.
+func MergePayload(event *beat.Event, payload, field string, config PayloadConfig) {
+	var obj map[string]interface{}
+	if err := sonic.UnmarshalString(payload, &obj); err != nil {
+		event.SetErrorWithOption(common.MapStr{
+			"message": "parsing JSON payload: " + err.Error(),
+			"field":   field,
+		}, true)
+		return
+	}
+
+	dest := event.Fields
+	root := true
+	if target := config.Target; target != "" {
+		root = false
+		v, _ := event.GetValue(target)
+		var ok bool
+		if dest, ok = toMapStr(v); !ok {
+			dest = common.MapStr{}
+			if _, err := event.PutValue(target, dest); err != nil {
+				event.SetErrorWithOption(common.MapStr{
+					"message": "writing JSON payload: " + err.Error(),
+					"field":   target,
+				}, true)
+				return
+			}
+		}
+	}
+
+	// The keys are merged in order, so that max_keys truncates the same
+	// keys of the same line every time.
+	keys := sortedKeys(obj)
+	w := payloadWriter{config: config}
+	for _, k := range keys {
+		if w.full() {
+			break
+		}
+		key := w.key(k)
+		if root && protectedKeys[key] {
+			continue
+		}
+		if _, exists := dest[key]; exists {
+			switch config.Overwrite {
+			case OverwriteKeep:
+				continue
+			case OverwritePrefix:
+				key = config.Prefix + key
+				if _, exists := dest[key]; exists || (root && protectedKeys[key]) {
+					// the prefixed key is taken too, the existing field is kept
+					continue
+				}
+			}
+		}
+		dest[key] = w.value(obj[k], 1)
+	}
+	if w.truncated {
+		common.AddTags(event.Fields, []string{config.TruncatedTag})
+	}
+}
+
+func (w *payloadWriter) full() bool {
+	if w.config.MaxKeys > 0 && w.keys >= w.config.MaxKeys {
+		w.truncated = true
+		return true
+	}
+	w.keys++
+	return false
+}
+
+func (w *payloadWriter) key(k string) string {
+	if !w.config.SanitizeKeys {
+		return k
+	}
+	return sanitizeKey(k)
+}
+
+// value converts v for storage at the given depth. Objects nested deeper
+// than max_depth are kept as their JSON text.
+func (w *payloadWriter) value(v interface{}, depth int) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if w.config.MaxDepth > 0 && depth >= w.config.MaxDepth {
+			s, err := sonic.MarshalString(t)
+			if err != nil {
+				return nil
+			}
+			return s
+		}
+		m := make(common.MapStr, len(t))
+		for _, k := range sortedKeys(t) {
+			if w.full() {
+				break
+			}
+			m[w.key(k)] = w.value(t[k], depth+1)
+		}
+		return m
+	case []interface{}:
+		for i, sub := range t {
+			t[i] = w.value(sub, depth)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sanitizeKey replaces characters that Elasticsearch treats specially in
+// field names, dots first of all, with underscores.
+func sanitizeKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '@' {
+			return r
+		}
+		return '_'
+	}, k)
+}
+
+func toMapStr(v interface{}) (common.MapStr, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+// OverwritePolicy decides what happens to payload keys that already exist in
+// the event.
+type OverwritePolicy uint8
+
+// List of policies for payload keys that already exist in the event.
+const (
+	OverwriteKeep OverwritePolicy = iota
+	OverwriteReplace
+	OverwritePrefix
+)
+
+var overwritePolicyNames = map[OverwritePolicy]string{
+	OverwriteKeep:    "keep",
+	OverwriteReplace: "replace",
+	OverwritePrefix:  "prefix",
+}
+
+func (o OverwritePolicy) String() string {
+	return overwritePolicyNames[o]
+}
+
+func (o OverwritePolicy) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *OverwritePolicy) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for policy, name := range overwritePolicyNames {
+		if s == name {
+			*o = policy
+			return nil
+		}
+	}
+	return errors.Errorf("invalid json.overwrite: %v", s)
+}
@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import "strings"
+
+// Scanner walks a log line left to right without copying it, all returned
+// strings share the memory of Line. It is the allocation free counterpart of
+// the regular expressions of the JIDU log formats: its character classes match
+// the ASCII \d, \w and \s classes of package regexp.
+//
+// A zero Scanner is not useful, create one with NewScanner. Scanner is small
+// enough to be passed and copied by value, which is how a failed alternative
+// is backtracked.
+type Scanner struct {
+	Line string
+	Pos  int
+}
+
+// NewScanner returns a Scanner positioned at the start of line.
+func NewScanner(line string) Scanner {
+	return Scanner{Line: line}
+}
+
+// IsSpace reports whether c is in the \s class.
+func IsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// IsDigit reports whether c is in the \d class.
+func IsDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// IsLetter reports whether c is in [a-zA-Z].
+func IsLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// IsWord reports whether c is in the \w class.
+func IsWord(c byte) bool {
+	return IsLetter(c) || IsDigit(c) || c == '_'
+}
+
+// Done reports whether the whole line has been consumed.
+func (s *Scanner) Done() bool {
+	return s.Pos >= len(s.Line)
+}
+
+// Rest returns the unconsumed part of the line.
+func (s *Scanner) Rest() string {
+	return s.Line[s.Pos:]
+}
+
+// Skip consumes the longest run of bytes matching class and returns it.
+func (s *Scanner) Skip(class func(byte) bool) string {
+	start := s.Pos
+	for s.Pos < len(s.Line) && class(s.Line[s.Pos]) {
+		s.Pos++
+	}
+	return s.Line[start:s.Pos]
+}
+
+// Run is like Skip but requires at least one byte, like a + quantifier.
+func (s *Scanner) Run(class func(byte) bool) (string, bool) {
+	v := s.Skip(class)
+	return v, v != ""
+}
+
+// Space consumes \s+.
+func (s *Scanner) Space() bool {
+	_, ok := s.Run(IsSpace)
+	return ok
+}
+
+// Byte consumes c.
+func (s *Scanner) Byte(c byte) bool {
+	if s.Pos < len(s.Line) && s.Line[s.Pos] == c {
+		s.Pos++
+		return true
+	}
+	return false
+}
+
+// Literal consumes lit.
+func (s *Scanner) Literal(lit string) bool {
+	if strings.HasPrefix(s.Line[s.Pos:], lit) {
+		s.Pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// Until consumes all bytes up to but excluding the first byte of stop and
+// returns them. It fails when no byte of stop follows.
+func (s *Scanner) Until(stop string) (string, bool) {
+	i := strings.IndexAny(s.Line[s.Pos:], stop)
+	if i < 0 {
+		return "", false
+	}
+	v := s.Line[s.Pos : s.Pos+i]
+	s.Pos += i
+	return v, true
+}
+
+// Template consumes a fixed width value such as a timestamp. In tmpl '0'
+// matches a digit, '_' matches a \s byte and any other byte matches itself,
+// so "0000-00-00 00:00:00.000" matches "2023-08-26 12:11:47.898".
+func (s *Scanner) Template(tmpl string) (string, bool) {
+	if len(s.Line)-s.Pos < len(tmpl) {
+		return "", false
+	}
+	v := s.Line[s.Pos : s.Pos+len(tmpl)]
+	for i := 0; i < len(tmpl); i++ {
+		switch c := v[i]; tmpl[i] {
+		case '0':
+			if !IsDigit(c) {
+				return "", false
+			}
+		case '_':
+			if !IsSpace(c) {
+				return "", false
+			}
+		default:
+			if c != tmpl[i] {
+				return "", false
+			}
+		}
+	}
+	s.Pos += len(tmpl)
+	return v, true
+}
+
+// Bracketed consumes `[` class* `]` and returns the content.
+func (s *Scanner) Bracketed(class func(byte) bool) (string, bool) {
+	save := *s
+	if !s.Byte('[') {
+		return "", false
+	}
+	v := s.Skip(class)
+	if !s.Byte(']') {
+		*s = save
+		return "", false
+	}
+	return v, true
+}
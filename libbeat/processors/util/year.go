@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// FileYears remembers the time of the last line of each file, so the year of
+// a year-less log line follows the previous line across New Year.
+type FileYears struct {
+	mu   sync.Mutex
+	max  int
+	last map[string]time.Time
+}
+
+// NewFileYears returns a FileYears tracking at most max files.
+func NewFileYears(max int) *FileYears {
+	return &FileYears{max: max, last: map[string]time.Time{}}
+}
+
+// Nearest completes the year-less time of a line of file with the year
+// putting it nearest to modified, the modified time of the file. With
+// rollover the previous line of the file is the reference instead.
+func (f *FileYears) Nearest(file string, logtime, modified time.Time, rollover bool) time.Time {
+	ref := modified
+	if rollover {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if last, ok := f.last[file]; ok {
+			ref = last
+		}
+	}
+
+	ts := NearestYear(logtime, ref)
+	if rollover {
+		if _, ok := f.last[file]; !ok && len(f.last) >= f.max {
+			for k := range f.last {
+				delete(f.last, k)
+				break
+			}
+		}
+		f.last[file] = ts
+	}
+	return ts
+}
+
+// NearestYear returns logtime in the year putting it nearest to ref.
+func NearestYear(logtime, ref time.Time) time.Time {
+	var (
+		nearest time.Time
+		best    time.Duration = -1
+	)
+	for year := ref.Year() - 1; year <= ref.Year()+1; year++ {
+		candidate := WithYear(logtime, year)
+		diff := candidate.Sub(ref)
+		if diff < 0 {
+			diff = -diff
+		}
+		if best < 0 || diff < best {
+			nearest, best = candidate, diff
+		}
+	}
+	return nearest
+}
+
+// WithYear returns t in the given year.
+func WithYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
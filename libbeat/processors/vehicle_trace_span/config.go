@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package vehicle_trace_span
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+)
+
+// Config for vehicle_trace_span processor.
+type Config struct {
+	Window       time.Duration     `config:"window" validate:"positive"` // max time between the first and the last line of a span
+	MaxSpans     int               `config:"max_spans" validate:"min=1"` // max number of open spans kept in memory
+	StartPattern string            `config:"start_pattern"`              // message of the line opening a span, the first line by default
+	EndPattern   string            `config:"end_pattern"`                // message of the line closing a span, the next line by default
+	TimeField    string            `config:"time_field"`                 // time of the line written by parse_vehicle_tracelog
+	TimeLayout   string            `config:"time_layout"`                // layout of time_field
+	Timezone     *cfgtype.Timezone `config:"timezone"`                   // timezone of time_field
+	Target       string            `config:"target"`                     // field receiving the span document
+	Mode         emitMode          `config:"mode"`                       // attach the span to the closing line or replace it
+	Kind         string            `config:"kind"`                       // OTLP span kind
+	Attributes   []string          `config:"attributes"`                 // line fields copied to the span attributes
+	Resource     []string          `config:"resource"`                   // line fields copied to the resource attributes
+}
+
+func defaultConfig() Config {
+	return Config{
+		Window:     5 * time.Minute,
+		MaxSpans:   100000,
+		TimeField:  "time",
+		TimeLayout: "2006-01-02 15:04:05.000",
+		Timezone:   cfgtype.MustNewTimezone("Asia/Shanghai"),
+		Target:     "span",
+		Mode:       emitAttach,
+		Kind:       "SPAN_KIND_INTERNAL",
+		Attributes: []string{"network", "user_id", "pid", "tid"},
+		Resource:   []string{"x-header_vid", "x-header_ecu"},
+	}
+}
+
+type emitMode uint8
+
+// List of emit modes.
+const (
+	emitAttach emitMode = iota
+	emitReplace
+)
+
+var emitModeNames = map[emitMode]string{
+	emitAttach:  "attach",
+	emitReplace: "replace",
+}
+
+func (m emitMode) String() string {
+	return emitModeNames[m]
+}
+
+func (m emitMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *emitMode) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for md, name := range emitModeNames {
+		if s == name {
+			*m = md
+			return nil
+		}
+	}
+	return errors.Errorf("invalid mode: %v", s)
+}
@@ -0,0 +1,283 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package vehicle_trace_span
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+const (
+	procName = "vehicle_trace_span"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+}
+
+type metrics struct {
+	spans     *monitoring.Int // span documents emitted
+	open      *monitoring.Int // spans waiting for their closing line
+	expired   *monitoring.Int // spans not closed within the window
+	unmatched *monitoring.Int // closing lines without an opening line
+	overflow  *monitoring.Int // opening lines not cached because max_spans was reached
+}
+
+// openSpan is the state kept from the line opening a span.
+type openSpan struct {
+	start      time.Time
+	cachedAt   time.Time
+	parent     string
+	name       string
+	attributes common.MapStr
+	resource   common.MapStr
+}
+
+type vehicleTraceSpan struct {
+	config Config
+	logger *logp.Logger
+	start  *regexp.Regexp
+	end    *regexp.Regexp
+
+	mu        sync.Mutex
+	spans     map[string]*openSpan
+	lastSweep time.Time
+	clock     clockwork.Clock
+
+	metrics metrics
+}
+
+// New constructs a new vehicle_trace_span processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrapf(err, "failed to unpack %v processor configuration", procName)
+	}
+
+	var (
+		id  = int(instanceID.Inc())
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &vehicleTraceSpan{
+		config: config,
+		logger: log,
+		spans:  map[string]*openSpan{},
+		metrics: metrics{
+			spans:     monitoring.NewInt(reg, "spans"),
+			open:      monitoring.NewInt(reg, "open"),
+			expired:   monitoring.NewInt(reg, "expired"),
+			unmatched: monitoring.NewInt(reg, "unmatched"),
+			overflow:  monitoring.NewInt(reg, "overflow"),
+		},
+	}
+	p.setClock(clockwork.NewRealClock())
+
+	var err error
+	if config.StartPattern != "" {
+		if p.start, err = regexp.Compile(config.StartPattern); err != nil {
+			return nil, errors.Wrap(err, "invalid start_pattern")
+		}
+	}
+	if config.EndPattern != "" {
+		if p.end, err = regexp.Compile(config.EndPattern); err != nil {
+			return nil, errors.Wrap(err, "invalid end_pattern")
+		}
+	}
+
+	return p, nil
+}
+
+// setClock allows test code to inject a fake clock
+func (p *vehicleTraceSpan) setClock(c clockwork.Clock) {
+	p.clock = c
+	p.lastSweep = c.Now()
+}
+
+// Run correlates the lines of a span. The line opening a span is cached, the
+// line closing it gets the span document.
+func (p *vehicleTraceSpan) Run(event *beat.Event) (*beat.Event, error) {
+	traceID := stringField(event, "trace_id")
+	spanID := stringField(event, "span_id")
+	if traceID == "" || spanID == "" {
+		return event, nil
+	}
+
+	logtime, err := time.ParseInLocation(p.config.TimeLayout, stringField(event, p.config.TimeField), p.config.Timezone.Location())
+	if err != nil {
+		p.logger.Debugf("skip line of span %v/%v: %v", traceID, spanID, err)
+		return event, nil
+	}
+
+	message := stringField(event, "message")
+	key := traceID + "/" + spanID
+
+	p.mu.Lock()
+	p.sweep()
+	open, found := p.spans[key]
+
+	// without start_pattern a line opens a span unless one is open or the
+	// line closes one, a closing line whose span is gone is unmatched
+	var isStart, isEnd bool
+	if p.end != nil {
+		isEnd = p.end.MatchString(message)
+	}
+	if p.start != nil {
+		isStart = p.start.MatchString(message)
+	} else {
+		isStart = !found && !isEnd
+	}
+	if p.end == nil {
+		isEnd = found && !isStart
+	}
+
+	switch {
+	case isEnd && found:
+		delete(p.spans, key)
+	case isStart:
+		if !found && len(p.spans) >= p.config.MaxSpans {
+			p.metrics.overflow.Inc()
+		} else {
+			p.spans[key] = p.openSpan(event, logtime)
+		}
+	case isEnd:
+		p.metrics.unmatched.Inc()
+	}
+	p.metrics.open.Set(int64(len(p.spans)))
+	p.mu.Unlock()
+
+	if !isEnd || !found {
+		return event, nil
+	}
+	if logtime.Sub(open.start) > p.config.Window {
+		p.metrics.expired.Inc()
+		return event, nil
+	}
+
+	span := p.makeSpan(traceID, spanID, open, logtime, event)
+	p.metrics.spans.Inc()
+	if p.config.Mode == emitReplace {
+		event.Fields = span
+		event.Timestamp = open.start
+		return event, nil
+	}
+	if _, err := event.PutValue(p.config.Target, span); err != nil {
+		return event, errors.Wrapf(err, "failed to write span to %v", p.config.Target)
+	}
+	return event, nil
+}
+
+func (p *vehicleTraceSpan) openSpan(event *beat.Event, logtime time.Time) *openSpan {
+	return &openSpan{
+		start:      logtime,
+		cachedAt:   p.clock.Now(),
+		parent:     stringField(event, "parent_span_id"),
+		name:       stringField(event, "tag"),
+		attributes: copyFields(event, p.config.Attributes),
+		resource:   copyFields(event, p.config.Resource),
+	}
+}
+
+// makeSpan builds a span document following the field names of OTLP/JSON.
+func (p *vehicleTraceSpan) makeSpan(traceID, spanID string, open *openSpan, end time.Time, event *beat.Event) common.MapStr {
+	attributes := copyFields(event, p.config.Attributes)
+	attributes.Update(open.attributes)
+	resource := copyFields(event, p.config.Resource)
+	resource.Update(open.resource)
+
+	name := open.name
+	if name == "" {
+		name = stringField(event, "tag")
+	}
+
+	return common.MapStr{
+		"trace_id":             traceID,
+		"span_id":              spanID,
+		"parent_span_id":       open.parent,
+		"name":                 name,
+		"kind":                 p.config.Kind,
+		"start_time_unix_nano": open.start.UnixNano(),
+		"end_time_unix_nano":   end.UnixNano(),
+		"duration_nano":        end.Sub(open.start).Nanoseconds(),
+		"status":               common.MapStr{"code": "STATUS_CODE_UNSET"},
+		"attributes":           attributes,
+		"resource":             common.MapStr{"attributes": resource},
+	}
+}
+
+// sweep evicts the spans not closed within the window. It must be called
+// with the lock held.
+func (p *vehicleTraceSpan) sweep() {
+	now := p.clock.Now()
+	if now.Sub(p.lastSweep) < p.config.Window {
+		return
+	}
+	p.lastSweep = now
+
+	for key, open := range p.spans {
+		if now.Sub(open.cachedAt) > p.config.Window {
+			delete(p.spans, key)
+			p.metrics.expired.Inc()
+		}
+	}
+}
+
+func (p *vehicleTraceSpan) String() string {
+	conf, _ := json.Marshal(p.config)
+	return procName + "=" + string(conf)
+}
+
+func stringField(event *beat.Event, field string) string {
+	value, err := event.GetValue(field)
+	if err != nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func copyFields(event *beat.Event, fields []string) common.MapStr {
+	m := common.MapStr{}
+	for _, field := range fields {
+		if value, err := event.GetValue(field); err == nil {
+			m[field] = value
+		}
+	}
+	return m
+}
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package vehicle_trace_span
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+func TestSpanPairing(t *testing.T) {
+	p := newProcessor(t, common.MapStr{})
+
+	start := run(t, p, traceLine("2023-08-26 12:11:47.398", "span-1", "request url: /album"))
+	assert.NotContains(t, start.Fields, "span")
+
+	end := run(t, p, traceLine("2023-08-26 12:11:47.898", "span-1", "response url: /album"))
+	span, err := end.GetValue("span")
+	require.NoError(t, err)
+
+	startTime := time.Date(2023, 8, 26, 12, 11, 47, int(398*time.Millisecond), shanghai(t))
+	assert.Equal(t, common.MapStr{
+		"trace_id":             "6d3e1573c45f07a1c60c6be4aeb3d2a0",
+		"span_id":              "span-1",
+		"parent_span_id":       "parent-1",
+		"name":                 "com.jidu.media.service:HttpLogInterceptor",
+		"kind":                 "SPAN_KIND_INTERNAL",
+		"start_time_unix_nano": startTime.UnixNano(),
+		"end_time_unix_nano":   startTime.Add(500 * time.Millisecond).UnixNano(),
+		"duration_nano":        int64(500 * time.Millisecond),
+		"status":               common.MapStr{"code": "STATUS_CODE_UNSET"},
+		"attributes": common.MapStr{
+			"network": "5g",
+			"user_id": "441018276115528658",
+			"pid":     int64(4664),
+			"tid":     int64(24435),
+		},
+		"resource": common.MapStr{"attributes": common.MapStr{
+			"x-header_vid": "b974519299bfa3e1faf92e611331aa08",
+			"x-header_ecu": "cdc",
+		}},
+	}, span)
+
+	metrics := p.(*vehicleTraceSpan).metrics
+	assert.Equal(t, int64(1), metrics.spans.Get())
+	assert.Equal(t, int64(0), metrics.open.Get())
+}
+
+func TestSpanPatterns(t *testing.T) {
+	p := newProcessor(t, common.MapStr{
+		"start_pattern": "^request",
+		"end_pattern":   "^response",
+	})
+
+	// closing line without opening line
+	event := run(t, p, traceLine("2023-08-26 12:11:47.000", "span-1", "response url: /album"))
+	assert.NotContains(t, event.Fields, "span")
+
+	run(t, p, traceLine("2023-08-26 12:11:47.100", "span-1", "request url: /album"))
+	event = run(t, p, traceLine("2023-08-26 12:11:47.200", "span-1", "retrying"))
+	assert.NotContains(t, event.Fields, "span")
+	event = run(t, p, traceLine("2023-08-26 12:11:47.300", "span-1", "response url: /album"))
+	duration, err := event.GetValue("span.duration_nano")
+	require.NoError(t, err)
+	assert.Equal(t, int64(200*time.Millisecond), duration)
+
+	assert.Equal(t, int64(1), p.(*vehicleTraceSpan).metrics.unmatched.Get())
+}
+
+func TestSpanReplace(t *testing.T) {
+	p := newProcessor(t, common.MapStr{"mode": "replace"})
+
+	run(t, p, traceLine("2023-08-26 12:11:47.398", "span-1", "request"))
+	event := run(t, p, traceLine("2023-08-26 12:11:47.898", "span-1", "response"))
+
+	assert.Equal(t, "span-1", event.Fields["span_id"])
+	assert.NotContains(t, event.Fields, "message")
+	assert.Equal(t, time.Date(2023, 8, 26, 12, 11, 47, int(398*time.Millisecond), shanghai(t)), event.Timestamp)
+}
+
+func TestSpanWindow(t *testing.T) {
+	p := newProcessor(t, common.MapStr{"window": "1s", "end_pattern": "^response"})
+	clock := clockwork.NewFakeClock()
+	p.(*vehicleTraceSpan).setClock(clock)
+
+	// closing line too late in log time
+	run(t, p, traceLine("2023-08-26 12:11:47.000", "span-1", "request"))
+	event := run(t, p, traceLine("2023-08-26 12:11:49.000", "span-1", "response"))
+	assert.NotContains(t, event.Fields, "span")
+
+	// opening line evicted from memory
+	run(t, p, traceLine("2023-08-26 12:11:47.000", "span-2", "request"))
+	clock.Advance(2 * time.Second)
+	event = run(t, p, traceLine("2023-08-26 12:11:47.500", "span-2", "response"))
+	assert.NotContains(t, event.Fields, "span")
+
+	metrics := p.(*vehicleTraceSpan).metrics
+	assert.Equal(t, int64(2), metrics.expired.Get())
+	assert.Equal(t, int64(1), metrics.unmatched.Get()) // span-2 response has no open span
+	assert.Equal(t, int64(0), metrics.open.Get())
+}
+
+func TestSpanOverflow(t *testing.T) {
+	p := newProcessor(t, common.MapStr{"max_spans": 1})
+
+	run(t, p, traceLine("2023-08-26 12:11:47.000", "span-1", "request"))
+	run(t, p, traceLine("2023-08-26 12:11:47.000", "span-2", "request"))
+	assert.Equal(t, int64(1), p.(*vehicleTraceSpan).metrics.overflow.Get())
+}
+
+func TestNotATraceLine(t *testing.T) {
+	p := newProcessor(t, common.MapStr{})
+
+	input := common.MapStr{"message": "plain line"}
+	event := run(t, p, &beat.Event{Fields: input.Clone()})
+	assert.Equal(t, input, event.Fields)
+}
+
+func newProcessor(t *testing.T, config common.MapStr) processors.Processor {
+	p, err := New(common.MustNewConfigFrom(config))
+	require.NoError(t, err)
+	return p
+}
+
+func run(t *testing.T, p processors.Processor, event *beat.Event) *beat.Event {
+	event, err := p.Run(event)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	return event
+}
+
+// traceLine returns an event as produced by parse_vehicle_tracelog.
+func traceLine(logtime, spanID, message string) *beat.Event {
+	return &beat.Event{Fields: common.MapStr{
+		"x-header_ecu":   "cdc",
+		"x-header_vid":   "b974519299bfa3e1faf92e611331aa08",
+		"time":           logtime,
+		"pid":            int64(4664),
+		"tid":            int64(24435),
+		"level":          "DEBUG",
+		"tag":            "com.jidu.media.service:HttpLogInterceptor",
+		"trace_id":       "6d3e1573c45f07a1c60c6be4aeb3d2a0",
+		"span_id":        spanID,
+		"parent_span_id": "parent-1",
+		"network":        "5g",
+		"user_id":        "441018276115528658",
+		"message":        message,
+	}}
+}
+
+func shanghai(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	return loc
+}
@@ -102,9 +102,10 @@ func (c *client) publish(e beat.Event) {
 		event, err = c.processors.Run(event)
 		publish = event != nil
 		if err != nil {
-			// TODO: introduce dead-letter queue?
-
 			log.Errorf("Failed to publish event: %v", err)
+			if failed, ok := c.eventer.(beat.ProcessingErrorEventer); ok && !publish {
+				failed.ProcessingFailed(e, err)
+			}
 		}
 	}
 
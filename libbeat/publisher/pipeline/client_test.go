@@ -19,6 +19,7 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -123,6 +124,60 @@ func TestClient(t *testing.T) {
 	})
 }
 
+type failingSupport struct{}
+
+func (failingSupport) Create(beat.ProcessingConfig, bool) (beat.Processor, error) {
+	return failingProcessor{}, nil
+}
+func (failingSupport) Close() error { return nil }
+
+type failingProcessor struct{}
+
+func (failingProcessor) String() string { return "failing" }
+func (failingProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	if event.Fields["fail"] == true {
+		return nil, errors.New("processing failed")
+	}
+	return nil, nil
+}
+
+type processingErrorEventer struct {
+	failed []interface{}
+}
+
+func (e *processingErrorEventer) Closing()                    {}
+func (e *processingErrorEventer) Closed()                     {}
+func (e *processingErrorEventer) Published()                  {}
+func (e *processingErrorEventer) FilteredOut(beat.Event)      {}
+func (e *processingErrorEventer) DroppedOnPublish(beat.Event) {}
+func (e *processingErrorEventer) ProcessingFailed(event beat.Event, err error) {
+	e.failed = append(e.failed, event.Private)
+}
+
+func TestClientProcessingFailed(t *testing.T) {
+	pipeline, err := New(beat.Info{},
+		Monitors{},
+		func(_ queue.ACKListener) (queue.Queue, error) {
+			return makeBlockingQueue(), nil
+		},
+		outputs.Group{},
+		Settings{Processors: failingSupport{}},
+	)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	eventer := &processingErrorEventer{}
+	client, err := pipeline.ConnectWith(beat.ClientConfig{Events: eventer})
+	require.NoError(t, err)
+	defer client.Close()
+
+	client.Publish(beat.Event{Fields: common.MapStr{"fail": true}, Private: 1})
+	client.Publish(beat.Event{Fields: common.MapStr{"fail": false}, Private: 2})
+
+	// only the event dropped with an error is reported
+	assert.Equal(t, []interface{}{1}, eventer.failed)
+}
+
 func TestClientWaitClose(t *testing.T) {
 	routinesChecker := resources.NewGoroutinesChecker()
 	defer routinesChecker.Check(t)
@@ -30,6 +30,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/reader/multiline"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readjson"
+	"github.com/elastic/beats/v7/libbeat/reader/readschema"
 )
 
 var (
@@ -50,6 +51,9 @@ type CommonConfig struct {
 
 type Config struct {
 	Suffix string
+	// Merging is set when a parser joins several messages into one, like
+	// multiline. The merged message keeps no Private data.
+	Merging bool
 
 	pCfg    CommonConfig
 	parsers []common.ConfigNamespace
@@ -82,6 +86,7 @@ func (c *Config) Unpack(cc *common.Config) error {
 
 func NewConfig(pCfg CommonConfig, parsers []common.ConfigNamespace) (*Config, error) {
 	var suffix string
+	var merging bool
 	for _, ns := range parsers {
 		name := ns.Name()
 		switch name {
@@ -92,6 +97,7 @@ func NewConfig(pCfg CommonConfig, parsers []common.ConfigNamespace) (*Config, er
 			if err != nil {
 				return nil, fmt.Errorf("error while parsing multiline parser config: %+v", err)
 			}
+			merging = true
 		case "ndjson":
 			var config readjson.ParserConfig
 			cfg := ns.Config()
@@ -112,6 +118,13 @@ func NewConfig(pCfg CommonConfig, parsers []common.ConfigNamespace) (*Config, er
 				}
 				suffix = config.Stream.String()
 			}
+		case "schema_registry":
+			config := readschema.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing schema_registry parser config: %+v", err)
+			}
 		default:
 			return nil, fmt.Errorf("%s: %s", ErrNoSuchParser, name)
 		}
@@ -119,6 +132,7 @@ func NewConfig(pCfg CommonConfig, parsers []common.ConfigNamespace) (*Config, er
 
 	return &Config{
 		Suffix:  suffix,
+		Merging: merging,
 		pCfg:    pCfg,
 		parsers: parsers,
 	}, nil
@@ -157,6 +171,18 @@ func (c *Config) Create(in reader.Reader) Parser {
 				return p
 			}
 			p = readjson.NewContainerParser(p, &config)
+		case "schema_registry":
+			config := readschema.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			parser, err := readschema.NewParser(p, &config)
+			if err != nil {
+				return p
+			}
+			p = parser
 		default:
 			return p
 		}
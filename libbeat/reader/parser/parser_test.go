@@ -78,6 +78,18 @@ func TestParsersConfigSuffix(t *testing.T) {
 			},
 			expectedError: "only one stream selection is allowed",
 		},
+		"schema registry parser without url": {
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"schema_registry": map[string]interface{}{
+							"target": "event",
+						},
+					},
+				},
+			},
+			expectedError: "error while parsing schema_registry parser config",
+		},
 	}
 
 	for name, test := range tests {
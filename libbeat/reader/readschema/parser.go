@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readschema
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+// Parser decodes messages encoded in the schema registry wire format, like
+// the records of the avro and protobuf output codecs, with the schema they
+// reference.
+type Parser struct {
+	reader       reader.Reader
+	deserializer *schemaregistry.Deserializer
+	cfg          *Config
+	logger       *logp.Logger
+}
+
+// NewParser creates a new parser decoding the messages of the reader.
+func NewParser(r reader.Reader, cfg *Config) (*Parser, error) {
+	client, err := schemaregistry.NewClient(cfg.Registry)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{
+		reader:       r,
+		deserializer: schemaregistry.NewDeserializer(client),
+		cfg:          cfg,
+		logger:       logp.NewLogger("parser_schema_registry"),
+	}, nil
+}
+
+// Next decodes the content of the next message into its fields. Messages
+// failing to decode are returned unchanged.
+func (p *Parser) Next() (reader.Message, error) {
+	message, err := p.reader.Next()
+	if err != nil {
+		return message, err
+	}
+
+	fields, err := p.deserializer.Decode(message.Content)
+	if err != nil {
+		if !p.cfg.IgnoreDecodingError {
+			p.logger.Errorf("Error decoding schema registry payload: %v", err)
+		}
+		if p.cfg.AddErrorKey {
+			message.AddFields(common.MapStr{"error": common.MapStr{
+				"message": fmt.Sprintf("Error decoding schema registry payload: %v", err),
+				"type":    "schema_registry",
+			}})
+		}
+		return message, nil
+	}
+
+	// The binary payload is not kept as the message of the event.
+	delete(message.Fields, "message")
+
+	if p.cfg.Target != "" {
+		message.AddFields(common.MapStr{p.cfg.Target: fields})
+		return message, nil
+	}
+
+	event := &beat.Event{
+		Timestamp: message.Ts,
+		Meta:      message.Meta,
+		Fields:    message.Fields,
+	}
+	if event.Fields == nil {
+		event.Fields = common.MapStr{}
+	}
+	jsontransform.WriteJSONKeys(event, fields, false, p.cfg.OverwriteKeys, p.cfg.AddErrorKey)
+	message.Ts = event.Timestamp
+	message.Fields = event.Fields
+	message.Meta = event.Meta
+	return message, nil
+}
+
+func (p *Parser) Close() error {
+	return p.reader.Close()
+}
@@ -0,0 +1,130 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readschema
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/common/schemaregistry/schemaregistrytest"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "Log",
+	"fields": [
+		{"name": "message", "type": "string"},
+		{"name": "level", "type": "string"}
+	]
+}`
+
+func TestParser(t *testing.T) {
+	registry := schemaregistrytest.NewRegistry()
+	defer registry.Close()
+	id := registry.Register("logs-value", "", testSchema)
+
+	schema, err := schemaregistry.NewAvroSchema(testSchema)
+	require.NoError(t, err)
+	payload, err := schema.Encode(common.MapStr{"message": "hello", "level": "info"})
+	require.NoError(t, err)
+	content := schemaregistry.Frame(id, payload)
+
+	tests := map[string]struct {
+		config   map[string]interface{}
+		content  []byte
+		expected common.MapStr
+	}{
+		"under root": {
+			config:  map[string]interface{}{},
+			content: content,
+			expected: common.MapStr{
+				"message": "hello",
+				"level":   "info",
+				"kafka":   common.MapStr{"topic": "logs"},
+			},
+		},
+		"target": {
+			config:  map[string]interface{}{"target": "log"},
+			content: content,
+			expected: common.MapStr{
+				"log":   common.MapStr{"message": "hello", "level": "info"},
+				"kafka": common.MapStr{"topic": "logs"},
+			},
+		},
+		"decoding error": {
+			config:  map[string]interface{}{"add_error_key": true},
+			content: []byte("plain text"),
+			expected: common.MapStr{
+				"message": "plain text",
+				"kafka":   common.MapStr{"topic": "logs"},
+				"error": common.MapStr{
+					"message": "Error decoding schema registry payload: unknown magic byte 112",
+					"type":    "schema_registry",
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultConfig()
+			settings := common.MapStr{"url": registry.URL}
+			settings.Update(test.config)
+			require.NoError(t, common.MustNewConfigFrom(settings).Unpack(&config))
+
+			parser, err := NewParser(&messageReader{message: reader.Message{
+				Content: test.content,
+				Fields: common.MapStr{
+					"message": string(test.content),
+					"kafka":   common.MapStr{"topic": "logs"},
+				},
+			}}, &config)
+			require.NoError(t, err)
+
+			message, err := parser.Next()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, message.Fields)
+
+			_, err = parser.Next()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+type messageReader struct {
+	message reader.Message
+	read    bool
+}
+
+func (r *messageReader) Next() (reader.Message, error) {
+	if r.read {
+		return reader.Message{}, io.EOF
+	}
+	r.read = true
+	return r.message, nil
+}
+
+func (r *messageReader) Close() error {
+	return nil
+}
@@ -18,6 +18,7 @@
 package template
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -41,6 +42,21 @@ var (
 
 type IndexTemplateType uint8
 
+const (
+	DataStreamModeStandard DataStreamMode = iota
+	DataStreamModeTimeSeries
+)
+
+var (
+	dataStreamModes = map[string]DataStreamMode{
+		"standard":    DataStreamModeStandard,
+		"time_series": DataStreamModeTimeSeries,
+	}
+)
+
+// DataStreamMode selects the index mode of the backing indices of a data stream.
+type DataStreamMode uint8
+
 // TemplateConfig holds config information about the Elasticsearch template
 type TemplateConfig struct {
 	Enabled bool   `config:"enabled"`
@@ -58,6 +74,15 @@ type TemplateConfig struct {
 	Order        int               `config:"order"`
 	Priority     int               `config:"priority"`
 	Type         IndexTemplateType `config:"type"`
+
+	DataStream DataStreamConfig `config:"data_stream"`
+}
+
+// DataStreamConfig configures the index template to create a data stream,
+// instead of an index, for the template pattern.
+type DataStreamConfig struct {
+	Enabled bool           `config:"enabled"`
+	Mode    DataStreamMode `config:"mode"`
 }
 
 // TemplateSettings are part of the Elasticsearch template and hold index and source specific information.
@@ -96,6 +121,25 @@ func Unpack(c *common.Config) (TemplateConfig, error) {
 
 }
 
+// Validate checks the data stream settings can be applied to the template.
+func (c *TemplateConfig) Validate() error {
+	if !c.DataStream.Enabled {
+		return nil
+	}
+	if c.JSON.Enabled {
+		return errors.New("data_stream can not be used with a json template")
+	}
+	if c.Type != IndexTemplateIndex {
+		return errors.New("data_stream requires the index template type")
+	}
+	return nil
+}
+
+// TimeSeries returns true if the data stream is in time series mode.
+func (c DataStreamConfig) TimeSeries() bool {
+	return c.Enabled && c.Mode == DataStreamModeTimeSeries
+}
+
 func (t *IndexTemplateType) Unpack(v string) error {
 	if v == "" {
 		*t = IndexTemplateIndex
@@ -113,3 +157,17 @@ func (t *IndexTemplateType) Unpack(v string) error {
 
 	return nil
 }
+
+func (m *DataStreamMode) Unpack(v string) error {
+	if v == "" {
+		*m = DataStreamModeStandard
+		return nil
+	}
+
+	mode, ok := dataStreamModes[v]
+	if !ok {
+		return fmt.Errorf("unknown data stream mode: %s", v)
+	}
+	*m = mode
+	return nil
+}
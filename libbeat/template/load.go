@@ -116,6 +116,15 @@ func (l *ESLoader) Load(config TemplateConfig, info beat.Info, fields []byte, mi
 	if err != nil {
 		return err
 	}
+	if config.DataStream.Enabled {
+		for _, t := range tmpl.dataStreamTemplates(body) {
+			if err := l.loadTemplate(t.name, t.templateType, t.body); err != nil {
+				return fmt.Errorf("failed to load template %q: %w", t.name, err)
+			}
+		}
+		logp.Info("Data stream template with name %q loaded.", templateName)
+		return nil
+	}
 	if err := l.loadTemplate(templateName, config.Type, body); err != nil {
 		return fmt.Errorf("failed to load template: %w", err)
 	}
@@ -173,6 +182,20 @@ func (l *FileLoader) Load(config TemplateConfig, info beat.Info, fields []byte,
 		return err
 	}
 
+	if config.DataStream.Enabled {
+		for _, t := range tmpl.dataStreamTemplates(body) {
+			component := "template"
+			if t.templateType == IndexTemplateComponent {
+				component = "component_template"
+			}
+			str := fmt.Sprintf("%s\n", t.body.StringToPrint())
+			if err := l.client.Write(component, t.name, str); err != nil {
+				return fmt.Errorf("error printing template: %v", err)
+			}
+		}
+		return nil
+	}
+
 	str := fmt.Sprintf("%s\n", body.StringToPrint())
 	if err := l.client.Write("template", tmpl.name, str); err != nil {
 		return fmt.Errorf("error printing template: %v", err)
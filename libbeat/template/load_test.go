@@ -89,8 +89,35 @@ func TestFileLoader_Load(t *testing.T) {
 	}
 }
 
+func TestFileLoader_LoadDataStream(t *testing.T) {
+	ver := "7.17.0"
+	prefix := "mock"
+	info := beat.Info{Version: ver, IndexPrefix: prefix}
+	tmplName := fmt.Sprintf("%s-%s", prefix, ver)
+
+	fc, err := newFileClient(ver)
+	require.NoError(t, err)
+	fl := NewFileLoader(fc)
+
+	cfg := DefaultConfig()
+	cfg.DataStream.Enabled = true
+
+	err = fl.Load(cfg, info, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"component_template", "template"}, fc.components)
+	assert.Equal(t, []string{tmplName + "-settings", tmplName}, fc.names)
+	assert.Equal(t, common.MapStr{
+		"index_patterns": []string{"mock-7.17.0*"},
+		"priority":       150,
+		"data_stream":    common.MapStr{},
+		"composed_of":    []string{tmplName + "-settings"},
+		"_meta":          common.MapStr{"beat": prefix, "version": ver},
+	}.StringToPrint()+"\n", fc.body)
+}
+
 type fileClient struct {
 	component, name, body, ver string
+	components, names          []string
 }
 
 func newFileClient(ver string) (*fileClient, error) {
@@ -103,5 +130,6 @@ func (c *fileClient) GetVersion() common.Version {
 
 func (c *fileClient) Write(component string, name string, body string) error {
 	c.component, c.name, c.body = component, name, body
+	c.components, c.names = append(c.components, component), append(c.names, name)
 	return nil
 }
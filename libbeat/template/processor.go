@@ -43,11 +43,15 @@ type Processor struct {
 	EsVersion       common.Version
 	Migration       bool
 	ElasticLicensed bool
+	// TimeSeries marks dimensions and metrics for a time series data stream.
+	TimeSeries bool
 
 	// dynamicTemplatesMap records which dynamic templates have been added, to prevent duplicates.
 	dynamicTemplatesMap map[dynamicTemplateKey]common.MapStr
 	// dynamicTemplates records the dynamic templates in the order they were added.
 	dynamicTemplates []common.MapStr
+	// routingPath records the keyword dimensions the time series are routed by.
+	routingPath []string
 }
 
 var (
@@ -60,6 +64,10 @@ const scalingFactorKey = "scalingFactor"
 type fieldState struct {
 	DefaultField bool
 	Path         string
+
+	// MultiField is set when processing the multi-fields of a field, which
+	// are never dimensions.
+	MultiField bool
 }
 
 // Process recursively processes the given fields and writes the template in the given output
@@ -131,6 +139,10 @@ func (p *Processor) Process(fields mapping.Fields, state *fieldState, output com
 			indexMapping = p.other(&field)
 		}
 
+		if p.TimeSeries && !state.MultiField && !field.DynamicTemplate && len(indexMapping) > 0 {
+			p.timeSeries(&field, indexMapping)
+		}
+
 		if *field.DefaultField {
 			switch field.Type {
 			case "", "keyword", "text", "match_only_text", "wildcard":
@@ -153,6 +165,34 @@ func (p *Processor) Process(fields mapping.Fields, state *fieldState, output com
 	return nil
 }
 
+// timeSeries flags the time series metrics and dimensions, routing time series
+// by the keyword dimensions. Object fields are flagged in their dynamic templates.
+func (p *Processor) timeSeries(f *mapping.Field, indexMapping common.MapStr) {
+	if f.Type == "object" {
+		return
+	}
+	if f.MetricType != "" {
+		indexMapping["time_series_metric"] = f.MetricType
+	}
+	if !f.IsDimension() {
+		return
+	}
+	switch f.Type {
+	case "keyword":
+		indexMapping["time_series_dimension"] = true
+		p.routingPath = append(p.routingPath, fieldPath(f))
+	case "ip", "long", "integer", "short", "byte":
+		indexMapping["time_series_dimension"] = true
+	}
+}
+
+func fieldPath(f *mapping.Field) string {
+	if f.Path != "" {
+		return f.Path + "." + f.Name
+	}
+	return f.Name
+}
+
 func addToDefaultFields(f *mapping.Field) {
 	fullName := f.Name
 	if f.Path != "" {
@@ -275,6 +315,7 @@ func stateFromField(f *mapping.Field) *fieldState {
 	st := &fieldState{
 		DefaultField: DefaultField,
 		Path:         f.Name,
+		MultiField:   true,
 	}
 	if f.DefaultField != nil {
 		st.DefaultField = *f.DefaultField
@@ -385,7 +426,7 @@ func (p *Processor) matchOnlyText(f *mapping.Field) common.MapStr {
 
 	if len(f.MultiFields) > 0 {
 		fields := common.MapStr{}
-		p.Process(f.MultiFields, nil, fields)
+		p.Process(f.MultiFields, &fieldState{DefaultField: DefaultField, MultiField: true}, fields)
 		properties["fields"] = fields
 	}
 
@@ -451,11 +492,13 @@ func (p *Processor) object(f *mapping.Field) common.MapStr {
 	for _, otp := range otParams {
 		dynProperties := p.getDefaultProperties(f)
 		var matchingType string
+		var numeric bool
 
 		switch otp.ObjectType {
 		case "scaled_float":
 			dynProperties = p.scaledFloat(f, common.MapStr{scalingFactorKey: otp.ScalingFactor})
 			matchingType = matchType("*", otp.ObjectTypeMappingType)
+			numeric = true
 		case "text":
 			dynProperties["type"] = "text"
 
@@ -467,15 +510,23 @@ func (p *Processor) object(f *mapping.Field) common.MapStr {
 		case "keyword":
 			dynProperties["type"] = otp.ObjectType
 			matchingType = matchType("string", otp.ObjectTypeMappingType)
+			if p.TimeSeries && f.IsDimension() {
+				dynProperties["time_series_dimension"] = true
+			}
 		case "byte", "double", "float", "long", "short", "boolean":
 			dynProperties["type"] = otp.ObjectType
 			matchingType = matchType(otp.ObjectType, otp.ObjectTypeMappingType)
+			numeric = otp.ObjectType != "boolean"
 		case "histogram":
 			dynProperties["type"] = otp.ObjectType
 			matchingType = matchType("*", otp.ObjectTypeMappingType)
+			numeric = true
 		default:
 			continue
 		}
+		if p.TimeSeries && f.MetricType != "" && numeric {
+			dynProperties["time_series_metric"] = f.MetricType
+		}
 
 		path := f.Path
 		if len(path) > 0 {
@@ -487,6 +538,9 @@ func (p *Processor) object(f *mapping.Field) common.MapStr {
 		if !strings.ContainsRune(path, '*') {
 			pathMatch += ".*"
 		}
+		if _, ok := dynProperties["time_series_dimension"]; ok {
+			p.routingPath = append(p.routingPath, pathMatch)
+		}
 		// When multiple object type parameters are detected for a field,
 		// add a unique part to the name of the dynamic template.
 		// Duplicated dynamic template names can lead to errors when template
@@ -18,6 +18,7 @@
 package template
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -36,6 +37,10 @@ var (
 	defaultTotalFieldsLimit        = 10000
 	defaultNumberOfRoutingShards   = 30
 	defaultMaxDocvalueFieldsSearch = 200
+	defaultDimensionFieldsLimit    = 1024
+
+	minVersionDataStream = common.MustNewVersion("7.9.0")
+	minVersionTimeSeries = common.MustNewVersion("8.1.0")
 
 	defaultFields []string
 )
@@ -54,6 +59,10 @@ type Template struct {
 	templateType    IndexTemplateType
 	order           int
 	priority        int
+
+	// routingPath holds the keyword dimensions of the last loaded fields, in
+	// time series mode.
+	routingPath []string
 }
 
 // New creates a new template instance
@@ -78,6 +87,10 @@ func New(
 	pattern := config.Pattern
 	if pattern == "" {
 		pattern = name + "-*"
+		if config.DataStream.Enabled {
+			// the data stream is named after the template
+			pattern = name + "*"
+		}
 	}
 
 	event := &beat.Event{
@@ -123,6 +136,15 @@ func New(
 		esVersion = *bV
 	}
 
+	if config.DataStream.Enabled && esVersion.LessThan(minVersionDataStream) {
+		return nil, fmt.Errorf("data streams require Elasticsearch %v or newer, found %v",
+			minVersionDataStream, esVersion)
+	}
+	if config.DataStream.TimeSeries() && esVersion.LessThan(minVersionTimeSeries) {
+		return nil, fmt.Errorf("time series data streams require Elasticsearch %v or newer, found %v",
+			minVersionTimeSeries, esVersion)
+	}
+
 	return &Template{
 		pattern:         pattern,
 		name:            name,
@@ -156,11 +178,21 @@ func (t *Template) load(fields mapping.Fields) (common.MapStr, error) {
 
 	// Start processing at the root
 	properties := common.MapStr{}
-	processor := Processor{EsVersion: t.esVersion, ElasticLicensed: t.elasticLicensed, Migration: t.migration}
+	processor := Processor{
+		EsVersion:       t.esVersion,
+		ElasticLicensed: t.elasticLicensed,
+		Migration:       t.migration,
+		TimeSeries:      t.config.DataStream.TimeSeries(),
+	}
 	if err := processor.Process(fields, nil, properties); err != nil {
 		return nil, err
 	}
 
+	t.routingPath = uniqueStrings(processor.routingPath)
+	if processor.TimeSeries && len(t.routingPath) == 0 {
+		return nil, errors.New("time series mode requires at least one keyword dimension")
+	}
+
 	output := t.Generate(properties, processor.dynamicTemplates)
 
 	return output, nil
@@ -188,6 +220,10 @@ func (t *Template) LoadBytes(data []byte) (common.MapStr, error) {
 
 // LoadMinimal loads the template only with the given configuration
 func (t *Template) LoadMinimal() (common.MapStr, error) {
+	if t.config.DataStream.TimeSeries() {
+		return nil, errors.New("time series mode requires the fields dimensions, a minimal template can not be loaded")
+	}
+
 	m := common.MapStr{}
 	switch t.templateType {
 	case IndexTemplateLegacy:
@@ -239,6 +275,9 @@ func (t *Template) loadMinimalIndex() common.MapStr {
 	m := t.loadMinimalComponent()
 	m["priority"] = t.priority
 	m[keyPattern] = patterns
+	if t.config.DataStream.Enabled {
+		m["data_stream"] = common.MapStr{}
+	}
 	return m
 }
 
@@ -296,21 +335,94 @@ func (t *Template) generateComponent(properties common.MapStr, dynamicTemplates
 			"settings": common.MapStr{
 				"index": buildIdxSettings(
 					t.esVersion,
-					t.config.Settings.Index,
+					t.indexSettings(),
 				),
 			},
 		},
 	}
 }
 
+// indexSettings returns the user index settings, on top of the time series
+// settings in time series mode.
+func (t *Template) indexSettings() common.MapStr {
+	if !t.config.DataStream.TimeSeries() {
+		return t.config.Settings.Index
+	}
+
+	limit := defaultDimensionFieldsLimit
+	if len(t.routingPath) > limit {
+		limit = len(t.routingPath)
+	}
+	settings := common.MapStr{
+		"mode":         "time_series",
+		"routing_path": t.routingPath,
+		"mapping": common.MapStr{
+			"dimension_fields": common.MapStr{
+				"limit": limit,
+			},
+		},
+	}
+	settings.DeepUpdate(common.MapStr(t.config.Settings.Index).Clone())
+	return settings
+}
+
 func (t *Template) generateIndex(properties common.MapStr, dynamicTemplates []common.MapStr) common.MapStr {
 	tmpl := t.generateComponent(properties, dynamicTemplates)
 	tmpl["priority"] = t.priority
 	keyPattern, patterns := buildPatternSettings(t.esVersion, t.GetPattern())
 	tmpl[keyPattern] = patterns
+	if t.config.DataStream.Enabled {
+		tmpl["data_stream"] = common.MapStr{}
+	}
 	return tmpl
 }
 
+// namedTemplate is a template to install under its name.
+type namedTemplate struct {
+	name         string
+	templateType IndexTemplateType
+	body         common.MapStr
+}
+
+// dataStreamTemplates splits the body of a data stream index template into
+// component templates holding its mappings and settings, and the index
+// template composing them. Component templates come first, as they must
+// exist when the index template is installed.
+func (t *Template) dataStreamTemplates(body common.MapStr) []namedTemplate {
+	var templates []namedTemplate
+	var composedOf []string
+	index := body.Clone()
+	if tmpl, ok := index["template"].(common.MapStr); ok {
+		delete(index, "template")
+		for _, part := range []string{"mappings", "settings"} {
+			section, ok := tmpl[part]
+			if !ok {
+				continue
+			}
+			name := t.name + "-" + part
+			composedOf = append(composedOf, name)
+			templates = append(templates, namedTemplate{
+				name:         name,
+				templateType: IndexTemplateComponent,
+				body: common.MapStr{
+					"template": common.MapStr{part: section},
+				},
+			})
+		}
+	}
+
+	index["composed_of"] = composedOf
+	index["_meta"] = common.MapStr{
+		"beat":    t.beatName,
+		"version": t.beatVersion.String(),
+	}
+	return append(templates, namedTemplate{
+		name:         t.name,
+		templateType: IndexTemplateIndex,
+		body:         index,
+	})
+}
+
 func buildPatternSettings(ver common.Version, pattern string) (string, interface{}) {
 	if ver.Major < 6 {
 		return "template", pattern
@@ -413,6 +525,18 @@ func buildIdxSettings(ver common.Version, userSettings common.MapStr) common.Map
 	return indexSettings
 }
 
+func uniqueStrings(values []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
 func loadYamlByte(data []byte) (mapping.Fields, error) {
 	cfg, err := yaml.NewConfig(data)
 	if err != nil {
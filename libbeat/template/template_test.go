@@ -134,6 +134,129 @@ func TestTemplate(t *testing.T) {
 	})
 }
 
+func TestDataStreamTemplate(t *testing.T) {
+	currentVersion := getVersion("")
+
+	cfg := DefaultConfig()
+	cfg.DataStream.Enabled = true
+
+	t.Run("generated index template", func(t *testing.T) {
+		template := createTestTemplate(t, currentVersion, "7.17.0", cfg)
+		template.Assert("index_patterns", []string{"testbeat-" + currentVersion + "*"})
+		template.Assert("data_stream", common.MapStr{})
+		template.AssertMissing("template.settings.index.mode")
+	})
+
+	t.Run("split into component templates", func(t *testing.T) {
+		template := createTestTemplate(t, currentVersion, "7.17.0", cfg)
+		templates := template.tmpl.dataStreamTemplates(template.data)
+		name := "testbeat-" + currentVersion
+
+		assert.Len(t, templates, 3)
+		assert.Equal(t, name+"-mappings", templates[0].name)
+		assert.Equal(t, IndexTemplateComponent, templates[0].templateType)
+		assert.Contains(t, templates[0].body["template"], "mappings")
+		assert.Equal(t, name+"-settings", templates[1].name)
+		assert.Equal(t, IndexTemplateComponent, templates[1].templateType)
+
+		index := templates[2]
+		assert.Equal(t, name, index.name)
+		assert.Equal(t, IndexTemplateIndex, index.templateType)
+		assert.Equal(t, []string{name + "-mappings", name + "-settings"}, index.body["composed_of"])
+		assert.Equal(t, common.MapStr{}, index.body["data_stream"])
+		assert.NotContains(t, index.body, "template")
+		assert.Contains(t, template.data, "template", "the generated body must not be modified")
+	})
+
+	t.Run("requires ES 7.9", func(t *testing.T) {
+		_, err := New(currentVersion, "testbeat", false, *common.MustNewVersion("7.8.0"), cfg, false)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid configurations", func(t *testing.T) {
+		for name, config := range map[string]string{
+			"json template":      `{data_stream.enabled: true, json.enabled: true, json.path: t.json, json.name: t}`,
+			"legacy template":    `{data_stream.enabled: true, type: legacy}`,
+			"unknown index mode": `{data_stream.enabled: true, data_stream.mode: rollup}`,
+		} {
+			_, err := Unpack(common.MustNewConfigFrom(config))
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestTimeSeriesTemplate(t *testing.T) {
+	currentVersion := getVersion("")
+	fields := []byte(`
+- key: test
+  title: Test
+  fields:
+    - name: host.name
+      type: keyword
+    - name: process.name
+      type: keyword
+      dimension: false
+    - name: service.port
+      type: long
+      dimension: true
+    - name: labels
+      type: object
+      object_type: keyword
+    - name: cpu.pct
+      type: scaled_float
+      metric_type: gauge
+`)
+
+	cfg := DefaultConfig()
+	cfg.DataStream.Enabled = true
+	cfg.DataStream.Mode = DataStreamModeTimeSeries
+	cfg.Settings.Index = map[string]interface{}{"number_of_shards": 2}
+
+	t.Run("dimensions and metrics", func(t *testing.T) {
+		tmpl, err := New(currentVersion, "testbeat", false, *common.MustNewVersion("8.1.0"), cfg, false)
+		assert.NoError(t, err)
+		data, err := tmpl.LoadBytes(fields)
+		assert.NoError(t, err)
+		template := &testTemplate{t: t, tmpl: tmpl, data: data}
+
+		template.Assert("data_stream", common.MapStr{})
+		template.Assert("template.settings.index.mode", "time_series")
+		template.Assert("template.settings.index.routing_path", []string{"host.name", "labels.*"})
+		template.Assert("template.settings.index.mapping.dimension_fields.limit", 1024)
+		template.Assert("template.settings.index.mapping.total_fields.limit", 10000)
+		template.Assert("template.settings.index.number_of_shards", 2)
+
+		template.Assert("template.mappings.properties.host.properties.name.time_series_dimension", true)
+		template.AssertMissing("template.mappings.properties.process.properties.name.time_series_dimension")
+		template.Assert("template.mappings.properties.service.properties.port.time_series_dimension", true)
+		template.Assert("template.mappings.properties.cpu.properties.pct.time_series_metric", "gauge")
+
+		dynamic := template.Get("template.mappings.dynamic_templates").([]common.MapStr)
+		assert.Equal(t, true, dynamic[0]["labels"].(common.MapStr)["mapping"].(common.MapStr)["time_series_dimension"])
+	})
+
+	t.Run("requires ES 8.1", func(t *testing.T) {
+		_, err := New(currentVersion, "testbeat", false, *common.MustNewVersion("7.17.0"), cfg, false)
+		assert.Error(t, err)
+	})
+
+	t.Run("requires a dimension", func(t *testing.T) {
+		tmpl, err := New(currentVersion, "testbeat", false, *common.MustNewVersion("8.1.0"), cfg, false)
+		assert.NoError(t, err)
+		_, err = tmpl.LoadBytes([]byte(`
+- key: test
+  title: Test
+  fields:
+    - name: cpu.pct
+      type: scaled_float
+      metric_type: gauge
+`))
+		assert.Error(t, err)
+		_, err = tmpl.LoadMinimal()
+		assert.Error(t, err)
+	})
+}
+
 func createTestTemplate(t *testing.T, beatVersion, esVersion string, config TemplateConfig) *testTemplate {
 	beatVersion = getVersion(beatVersion)
 	esVersion = getVersion(esVersion)